@@ -5,7 +5,7 @@ go 1.16
 require (
 	github.com/adrg/xdg v0.3.3
 	github.com/alecthomas/units v0.0.0-20210208195552-ff826a37aa15 // indirect
-	github.com/barasher/go-exiftool v1.5.0
+	github.com/barasher/go-exiftool v1.9.0
 	github.com/dhowden/tag v0.0.0-20201120070457-d52dcb253c63
 	github.com/google/go-cmp v0.5.4
 	github.com/konsorten/go-windows-terminal-sequences v1.0.3 // indirect
@@ -15,7 +15,7 @@ require (
 	github.com/olekukonko/tablewriter v0.0.5
 	github.com/pterm/pterm v0.12.29
 	github.com/rwcarlsen/goexif v0.0.0-20190401172101-9e8deecbddbd
-	github.com/sebdah/goldie/v2 v2.5.3 // indirect
+	github.com/sebdah/goldie/v2 v2.5.3
 	github.com/segmentio/golines v0.5.0 // indirect
 	github.com/sergi/go-diff v1.2.0 // indirect
 	github.com/sirupsen/logrus v1.8.1 // indirect
@@ -26,4 +26,5 @@ require (
 	golang.org/x/text v0.3.6
 	golang.org/x/tools v0.1.5 // indirect
 	gopkg.in/djherbis/times.v1 v1.2.0
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 )
@@ -0,0 +1,109 @@
+package f2
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultAgeBuckets is used for {{agebucket}} if no
+	// buckets are specified with the `--age-buckets` flag.
+	defaultAgeBuckets = "today,7d,30d"
+	// todayBucket matches files modified since midnight.
+	todayBucket = "today"
+	// olderBucket is used for files that do not fall in any bucket.
+	olderBucket = "older"
+)
+
+// ageBucketUnitRegex matches a bucket threshold such as 12h, 7d, or 2w.
+var ageBucketUnitRegex = regexp.MustCompile(`^(\d+)([hdw])$`)
+
+// ageBucketUnits maps each bucket threshold unit to its duration.
+var ageBucketUnits = map[string]time.Duration{
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// ageBucket represents a label for the files modified within
+// the specified duration (or since midnight for 'today').
+type ageBucket struct {
+	label string
+	age   time.Duration
+	today bool
+}
+
+// parseAgeBuckets parses a comma-separated list of buckets such as
+// 'today,7d,30d'. Each bucket is its own label.
+func parseAgeBuckets(input string) ([]ageBucket, error) {
+	var buckets []ageBucket
+
+	for _, v := range strings.Split(input, ",") {
+		v = strings.TrimSpace(v)
+
+		if v == todayBucket {
+			buckets = append(buckets, ageBucket{label: v, today: true})
+			continue
+		}
+
+		match := ageBucketUnitRegex.FindStringSubmatch(v)
+		if match == nil {
+			return nil, errInvalidAgeBuckets
+		}
+
+		n, err := strconv.Atoi(match[1])
+		if err != nil || n == 0 {
+			return nil, errInvalidAgeBuckets
+		}
+
+		buckets = append(buckets, ageBucket{
+			label: v,
+			age:   time.Duration(n) * ageBucketUnits[match[2]],
+		})
+	}
+
+	return buckets, nil
+}
+
+// fileAgeBucket returns the label of the first bucket that contains
+// the modification time of a file relative to the start of the
+// operation. 'older' is returned if the file is not in any bucket.
+func (op *Operation) fileAgeBucket(sourcePath string) (string, error) {
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return "", err
+	}
+
+	modTime := info.ModTime()
+
+	// the default buckets are not parsed in simple mode
+	buckets := op.ageBuckets
+	if buckets == nil {
+		buckets, err = parseAgeBuckets(defaultAgeBuckets)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	for _, b := range buckets {
+		if b.today {
+			y, m, d := op.now.Date()
+			midnight := time.Date(y, m, d, 0, 0, 0, 0, op.now.Location())
+
+			if !modTime.Before(midnight) {
+				return b.label, nil
+			}
+
+			continue
+		}
+
+		if op.now.Sub(modTime) <= b.age {
+			return b.label, nil
+		}
+	}
+
+	return olderBucket, nil
+}
@@ -0,0 +1,82 @@
+package f2
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	errUndefinedAlias = errors.New("Undefined variable alias")
+
+	errAliasCycle = errors.New("Variable alias refers to itself")
+)
+
+var (
+	// aliasNameRegex matches the name of a variable alias
+	aliasNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+	// aliasRegex matches a reference to a variable alias (e.g. {{@album}})
+	aliasRegex = regexp.MustCompile(`{{@([A-Za-z_][A-Za-z0-9_-]*)}}`)
+)
+
+// expandAliases replaces each alias reference in the input with the
+// expression that it stands for. Aliases may refer to other aliases which
+// are expanded in turn. An error is returned if an alias is not defined or
+// if it refers back to itself.
+func expandAliases(input string, aliases map[string]string) (string, error) {
+	return expandAliasRefs(input, aliases, nil)
+}
+
+// expandAliasRefs expands the alias references in the input. The chain
+// holds the aliases that are currently being expanded so that cycles are
+// detected.
+func expandAliasRefs(
+	input string,
+	aliases map[string]string,
+	chain []string,
+) (string, error) {
+	var err error
+
+	out := aliasRegex.ReplaceAllStringFunc(input, func(match string) string {
+		if err != nil {
+			return match
+		}
+
+		name := aliasRegex.FindStringSubmatch(match)[1]
+
+		expr, ok := aliases[name]
+		if !ok {
+			err = fmt.Errorf("%w: '%s'", errUndefinedAlias, name)
+			return match
+		}
+
+		for _, v := range chain {
+			if v == name {
+				err = fmt.Errorf(
+					"%w: %s",
+					errAliasCycle,
+					strings.Join(append(chain, name), " -> "),
+				)
+
+				return match
+			}
+		}
+
+		var value string
+
+		value, err = expandAliasRefs(
+			expr,
+			aliases,
+			append(append([]string(nil), chain...), name),
+		)
+
+		return value
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return out, nil
+}
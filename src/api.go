@@ -0,0 +1,273 @@
+package f2
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli/v2"
+)
+
+// ErrNoMatches is returned by NewPlan if no files are left to rename after
+// the find pattern and the filters (such as the exclude patterns) are
+// applied, and by the command line if the --no-match-error flag is set. It
+// helps programs catch a mistyped pattern instead of treating an empty
+// plan as a successful run.
+var ErrNoMatches = errors.New("Failed to match any files")
+
+// Plan contains the changes that a renaming operation will make. It is
+// created by NewPlan without renaming any files so that programs which
+// embed f2 can inspect the changes (and modify their targets or remove
+// them) before the files are renamed with Apply.
+type Plan struct {
+	Changes []Change
+	// RequireExec prevents Apply from renaming any files unless the plan
+	// was created with the -x flag so that a program which builds its
+	// arguments from user input only previews the changes by default
+	// like the command line does.
+	RequireExec bool
+	// Backup records the renamed files when the plan is applied so that
+	// the operation can be reverted with the -u flag. Nothing is recorded
+	// by default.
+	Backup bool
+	op     *Operation
+}
+
+// Result describes the outcome of applying a plan.
+type Result struct {
+	// Renamed contains the changes that were applied successfully.
+	Renamed []Change
+	// RolledBack contains the changes that were applied and then reverted
+	// because another change in the plan failed.
+	RolledBack []Change
+	// Stranded contains the paths of files that were left at a temporary
+	// name because they could not be moved back to their source.
+	Stranded []string
+	// Errors contains the reason that each of the other changes failed.
+	Errors []error
+}
+
+// NewPlan resolves the changes for the specified command-line arguments
+// (excluding the program name) without renaming any files. ErrNoMatches
+// is returned if there are no files to rename. Conflicts are
+// fixed in the plan if the -F flag is set, and are otherwise reported when
+// the plan is applied since the targets may be modified in the meantime.
+// The options set the hooks that are used when the plan is created and
+// applied.
+func NewPlan(args []string, opts ...Option) (*Plan, error) {
+	var plan *Plan
+
+	o := newOptions(opts)
+
+	app := newApp(o)
+	app.Action = func(c *cli.Context) error {
+		op, err := newOperation(c)
+		if err != nil {
+			return err
+		}
+
+		o.configure(op)
+
+		if op.revert {
+			return errPlanUndo
+		}
+
+		err = op.resolveChanges()
+		if err != nil {
+			return err
+		}
+
+		if len(op.matches) == 0 {
+			return ErrNoMatches
+		}
+
+		op.detectConflicts()
+
+		plan = &Plan{
+			Changes: append([]Change(nil), op.matches...),
+			op:      op,
+		}
+
+		return nil
+	}
+
+	err := app.Run(append([]string{"f2"}, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// Apply renames the files according to the changes in the plan. The
+// changes are checked for conflicts again and nothing is renamed if any
+// are found (unless the plan was created with -F). Otherwise, the files are
+// renamed in an order that avoids overwriting each other. If any change
+// fails, the changes that were already applied are reverted so that the
+// plan is applied either completely or not at all. The changes that cannot
+// be reverted remain in the renamed changes of the result along with the
+// paths of any files left at a temporary name. The operation is recorded if
+// the plan has Backup set. Nothing is printed since the outcome of each
+// change is described by the result. If the plan requires it, the -x flag
+// must have been set as well.
+func Apply(plan *Plan) (Result, error) {
+	var result Result
+
+	op := plan.op
+
+	if plan.RequireExec && !op.exec {
+		return result, errExecRequired
+	}
+
+	op.matches = append([]Change(nil), plan.Changes...)
+	op.errors = nil
+	op.stranded = nil
+	op.tempRenames = 0
+
+	if len(op.matches) == 0 {
+		return result, nil
+	}
+
+	op.detectConflicts()
+
+	if len(op.conflicts) > 0 && !op.fixConflicts {
+		return result, errConflictDetected
+	}
+
+	// each renamed file is reported in the result instead
+	op.verbose = false
+
+	op.commit()
+
+	op.removeFailed()
+
+	failed := op.errors
+
+	if len(failed) > 0 {
+		result.RolledBack = op.rollback()
+	}
+
+	result.Renamed = append(result.Renamed, op.matches...)
+	result.Stranded = append(result.Stranded, op.stranded...)
+
+	for _, v := range append(failed, op.errors...) {
+		result.Errors = append(result.Errors, fmt.Errorf(
+			"%s: %w",
+			filepath.Join(v.entry.BaseDir, v.entry.Source),
+			v.err,
+		))
+	}
+
+	if plan.Backup && len(op.matches) > 0 && !op.copyMode {
+		err := op.backup()
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if len(failed) > 0 {
+		return result, errRenameFailed
+	}
+
+	return result, nil
+}
+
+// rollback reverts the changes that were applied before another change
+// failed and returns them. The reverse changes are ordered like the
+// original ones so that chains and cycles do not overwrite each other.
+// Copies are removed instead, and files that were moved out of the way by
+// the backup overwrite policy are moved back to their original path. The
+// changes that cannot be reverted are left in the matches and the reasons
+// are recorded in the errors of the operation.
+func (op *Operation) rollback() []Change {
+	applied := op.matches
+	op.matches, op.errors = nil, nil
+
+	var reverted []Change
+
+	if op.copyMode {
+		for _, ch := range applied {
+			err := os.Remove(filepath.Join(ch.BaseDir, ch.Target))
+			if err != nil {
+				op.rollbackFailed(ch, err)
+				continue
+			}
+
+			reverted = append(reverted, ch)
+		}
+
+		return reverted
+	}
+
+	// inverse maps the path of each reverse change to the original change
+	inverse := make(map[string]Change, len(applied))
+	matches := make([]Change, 0, len(applied))
+
+	for _, ch := range applied {
+		rev := Change{
+			BaseDir:     ch.BaseDir,
+			Source:      ch.Target,
+			Target:      ch.Source,
+			IsDir:       ch.IsDir,
+			crossDevice: ch.crossDevice,
+		}
+
+		inverse[filepath.Join(rev.BaseDir, rev.Source)] = ch
+		matches = append(matches, rev)
+	}
+
+	confirm := op.confirm
+	op.confirm = nil
+	op.matches = matches
+
+	op.planRenames()
+	op.rename()
+	op.removeFailed()
+
+	op.confirm = confirm
+
+	for _, rev := range op.matches {
+		ch := inverse[filepath.Join(rev.BaseDir, rev.Source)]
+
+		if ch.action == overwritePolicyBackup {
+			err := os.Rename(ch.backupPath, filepath.Join(ch.BaseDir, ch.Target))
+			if err != nil {
+				op.rollbackFailed(ch, err)
+			}
+		}
+
+		delete(inverse, filepath.Join(rev.BaseDir, rev.Source))
+
+		reverted = append(reverted, ch)
+	}
+
+	errs := op.errors
+	op.matches, op.errors = nil, nil
+
+	for _, v := range errs {
+		ch, ok := inverse[filepath.Join(v.entry.BaseDir, v.entry.Source)]
+		if !ok {
+			continue
+		}
+
+		op.rollbackFailed(ch, v.err)
+	}
+
+	// the changes that could not be reverted remain applied
+	for _, ch := range applied {
+		if _, ok := inverse[filepath.Join(ch.BaseDir, ch.Target)]; ok {
+			op.matches = append(op.matches, ch)
+		}
+	}
+
+	return reverted
+}
+
+// rollbackFailed records that an applied change could not be reverted.
+func (op *Operation) rollbackFailed(ch Change, err error) {
+	op.errors = append(op.errors, renameError{
+		entry: ch,
+		err:   fmt.Errorf("%w: %s", errRollbackFailed, err.Error()),
+	})
+}
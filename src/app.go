@@ -91,8 +91,52 @@ func checkForUpdates(app *cli.App) {
 	}
 }
 
-// GetApp retrieves the f2 app instance.
-func GetApp() *cli.App {
+// Option customizes the app returned by GetApp or the plan created by
+// NewPlan. This allows programs that embed f2 to hook into an operation
+// (e.g. to confirm each change or display the progress in a TUI).
+type Option func(*options)
+
+// options contains the hooks set by the options.
+type options struct {
+	confirm  ConfirmFunc
+	progress ProgressFunc
+	content  ContentFunc
+}
+
+// newOptions returns the hooks set by the specified options.
+func newOptions(opts []Option) options {
+	var o options
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// configure sets the hooks on the operation. The changes are applied
+// without the -x flag if each one is confirmed.
+func (o options) configure(op *Operation) {
+	op.confirm = o.confirm
+	op.progress = o.progress
+	op.content = o.content
+
+	if op.confirm != nil {
+		op.exec = true
+	}
+}
+
+// GetApp retrieves the f2 app instance customized with the specified
+// options.
+func GetApp(opts ...Option) *cli.App {
+	return newApp(newOptions(opts))
+}
+
+// newApp creates the f2 app instance. If no confirm hook is set,
+// each change is confirmed only if --confirm-each is set.
+// Progress is not reported if there is no progress hook, and the files
+// on disk are hashed if there is no content hook.
+func newApp(o options) *cli.App {
 	usageText := `FLAGS [OPTIONS] [PATHS TO FILES OR DIRECTORIES...]
 or: f2 FIND [REPLACE] [PATHS TO FILES OR DIRECTORIES...]`
 
@@ -126,15 +170,235 @@ or: f2 FIND [REPLACE] [PATHS TO FILES OR DIRECTORIES...]`
 				Aliases: []string{"u"},
 				Usage:   "Undo the last operation performed in the current working directory if possible.\n\t\t\t\tLearn more: https://github.com/ayoisaiah/f2/wiki/Undoing-a-renaming-operation.",
 			},
+			&cli.StringFlag{
+				Name:        "config",
+				Usage:       "Load the options for the operation from a JSON or YAML file. The keys are the long names of the options\n\t\t\t\tand 'paths' may be used for the files or directories. Options specified on the command line take precedence.\n\t\t\t\t'aliases' maps names to expressions that are referenced in the replacement as {{@name}}.",
+				DefaultText: "<file>",
+			},
 			&cli.StringFlag{
 				Name:        "csv",
 				Usage:       "Load a CSV file, and rename according to its contents.\n\t\t\t\tLearn more: https://github.com/ayoisaiah/f2/wiki/Renaming-from-a-CSV-file.",
 				DefaultText: "<csv file>",
 			},
+			&cli.IntFlag{
+				Name:        "csv-key",
+				Usage:       "Use the CSV file as a lookup table in which the specified column (starting from 1) is matched\n\t\t\t\tagainst the name of each file. The CSV variables are taken from the first row that matches.",
+				DefaultText: "<column>",
+			},
+			&cli.StringFlag{
+				Name:        "csv-match",
+				Usage:       "How the --csv-key column is matched against the file name.\n\t\t\t\tAllowed values: 'equals' (the default; with or without the extension), 'contains', 'regex'.",
+				Value:       string(csvMatchEquals),
+				DefaultText: "<type>",
+			},
+			&cli.StringFlag{
+				Name:        "csv-missing",
+				Usage:       "Determines what happens when no row matches with --csv-key.\n\t\t\t\tAllowed values: 'empty' (the default), 'skip' (leave the file unchanged).",
+				Value:       string(csvMissingEmpty),
+				DefaultText: "<policy>",
+			},
+			&cli.StringFlag{
+				Name:        "date-tree",
+				Usage:       "Place each file in a date-based folder hierarchy such as 'YYYY/YYYY-MM/YYYY-MM-DD'.\n\t\t\t\tAllowed values: 'year', 'month', 'day' (the depth of the hierarchy).",
+				DefaultText: "<depth>",
+			},
+			&cli.StringFlag{
+				Name:        "date-tree-source",
+				Usage:       "The date used for --date-tree. Allowed values: 'exif' (falls back to 'mtime'), 'mtime', 'btime', 'atime', 'ctime'.",
+				Value:       "exif",
+				DefaultText: "<source>",
+			},
+			&cli.StringFlag{
+				Name:        "dest-root",
+				Usage:       "Resolve the target of each match relative to the specified directory instead of the directory of the source file.\n\t\t\t\tUseful for consolidating files from several directories into one.",
+				DefaultText: "<dir>",
+			},
+			&cli.StringFlag{
+				Name:        "hash-sidecar",
+				Usage:       "Include the sidecar file with the specified extension (e.g. 'xmp') in the {{hash}} variable.\n\t\t\t\tThe file and its sidecar are hashed in that order so that both are given the same hash.",
+				DefaultText: "<ext>",
+			},
+			&cli.StringFlag{
+				Name:        "hash-head",
+				Usage:       "Hash only the specified number of bytes at the start of each file in the {{hash}} variable\n\t\t\t\twhich is much faster for large media files. Accepts suffixes such as '64k', '1M', or '2G'.",
+				DefaultText: "<size>",
+			},
+			&cli.IntFlag{
+				Name:        "chunk-size",
+				Usage:       "Split the matches into chunks of the specified size. The index restarts at the beginning of each chunk\n\t\t\t\tand {{group}} is replaced with the number of the chunk (e.g. 'page{{group}}/%02d{{ext}}').",
+				DefaultText: "<integer>",
+			},
+			&cli.IntFlag{
+				Name:        "trim-start",
+				Usage:       "Remove the specified number of characters from the start of each new file name (excluding the extension).",
+				DefaultText: "<integer>",
+			},
+			&cli.IntFlag{
+				Name:        "trim-end",
+				Usage:       "Remove the specified number of characters from the end of each new file name (excluding the extension).",
+				DefaultText: "<integer>",
+			},
+			&cli.IntFlag{
+				Name:        "pad-width",
+				Usage:       "Pad each new file name (excluding the extension) to the specified number of characters.\n\t\t\t\tNames that are already as long are left unchanged.",
+				DefaultText: "<integer>",
+			},
+			&cli.StringFlag{
+				Name:        "pad-char",
+				Usage:       "The character used to pad file names with --pad-width.",
+				Value:       "0",
+				DefaultText: "<character>",
+			},
+			&cli.StringFlag{
+				Name:        "pad-side",
+				Usage:       "The side of the file name that is padded with --pad-width.\n\t\t\t\tAllowed values: 'left' (the default), 'right'.",
+				Value:       padLeft,
+				DefaultText: "<side>",
+			},
+			&cli.StringFlag{
+				Name:        "json-sidecar",
+				Usage:       "The path to the JSON sidecar used by {{json.<key>}} relative to each file. {name} is replaced with the file name\n\t\t\t\tand {stem} with the file name without the extension. Defaults to '{name}.json' or '{stem}.json' whichever exists.",
+				DefaultText: "<pattern>",
+			},
+			&cli.StringFlag{
+				Name:        "age-buckets",
+				Usage:       "Specify the comma-separated buckets used by {{agebucket}} in ascending order. Each bucket is either 'today'\n\t\t\t\t(modified since midnight) or a duration in hours, days, or weeks (e.g. '12h', '7d', '2w'). Files that are not in any bucket are labelled 'older'.",
+				Value:       defaultAgeBuckets,
+				DefaultText: "<buckets>",
+			},
+			&cli.StringFlag{
+				Name:        "dateseq-start",
+				Usage:       "The date assigned to the first file by {{dateseq.<format>}} (e.g. '2021-05-01' or '2021-05-01T09:30').\n\t\t\t\tDefaults to midnight on the current day. Each subsequent file in the --sort order is one --dateseq-step later.",
+				DefaultText: "<date>",
+			},
+			&cli.StringFlag{
+				Name:        "dateseq-step",
+				Usage:       "The interval between the dates assigned by {{dateseq.<format>}} in hours, days, or weeks (e.g. '12h', '1d', '2w').",
+				Value:       defaultDateSeqStep,
+				DefaultText: "<interval>",
+			},
+			&cli.StringFlag{
+				Name:        "art-labels",
+				Usage:       "Specify the comma-separated labels used by {{id3.hasart}} for audio files with and without embedded cover art.",
+				Value:       "true,false",
+				DefaultText: "<with,without>",
+			},
+			&cli.BoolFlag{
+				Name:  "case-conflicts",
+				Usage: "Report targets that differ only in case (e.g. 'Song.mp3' and 'song.mp3') as conflicts even on case-sensitive filesystems.\n\t\t\t\tUse with -F to number all but the first of such targets.",
+			},
+			&cli.BoolFlag{
+				Name:  "strip-symbols",
+				Usage: "Remove emoji and symbols from the file name in each target. Emoji sequences are removed as a whole.\n\t\t\t\tOnly characters in --keep-categories or --keep-chars are kept.",
+			},
+			&cli.StringFlag{
+				Name:        "keep-categories",
+				Usage:       "A comma-separated list of the Unicode categories (e.g. 'L', 'Lu', 'Nd', 'Zs') that are kept by --strip-symbols.",
+				Value:       defaultKeepCategories,
+				DefaultText: "<categories>",
+			},
+			&cli.StringFlag{
+				Name:        "keep-chars",
+				Usage:       "The characters that are kept by --strip-symbols regardless of their category.",
+				Value:       defaultKeepChars,
+				DefaultText: "<characters>",
+			},
+			&cli.StringFlag{
+				Name:        "target-fs",
+				Usage:       "Make the targets valid on the specified filesystem ('fat32', 'exfat', 'ntfs', or 'ext4') by removing the characters\n\t\t\t\tit forbids (and trailing periods and spaces on Windows filesystems) and truncating each name to its maximum length.",
+				DefaultText: "<filesystem>",
+			},
+			&cli.BoolFlag{
+				Name:  "path-segments",
+				Usage: "Apply the replacement to each directory between the search path and the file as well as the file name.\n\t\t\t\tFiles are moved into the renamed directories which are created as needed. Directories are not matched themselves.",
+			},
+			&cli.BoolFlag{
+				Name:  "fix-ext",
+				Usage: "Only rename files whose extension disagrees with their content (e.g. a PNG image named 'photo.jpg')\n\t\t\t\tand replace the extension with the one that matches the content. Files with unknown content types are left alone.",
+			},
+			&cli.StringFlag{
+				Name:        "ext-folders",
+				Usage:       "Load a CSV file of folders and the extensions of the files that are moved into them (e.g. 'images,jpg,png').\n\t\t\t\tThe folders are created relative to the directory of each file and files with other extensions are left in place.",
+				DefaultText: "<csv file>",
+			},
+			&cli.StringFlag{
+				Name:        "ext-folder-default",
+				Usage:       "The folder that files whose extension is not listed in --ext-folders are moved into.",
+				DefaultText: "<folder>",
+			},
+			&cli.StringFlag{
+				Name:        "ext-map",
+				Usage:       "Load a CSV file of content types and their extensions which replace the defaults used by --fix-ext.\n\t\t\t\tEach row has a content type (e.g. 'image/jpeg'), the preferred extension, and any alternative extensions.",
+				DefaultText: "<csv file>",
+			},
+			&cli.StringSliceFlag{
+				Name:        "exiftool-opt",
+				Usage:       "Pass an option to exiftool when resolving {{xt.<tag>}} (e.g. '-api largefilesupport=1').\n\t\t\t\tSupported options: '-api <value>', '-charset <value>', '-ee', and '-n'. Can be repeated.",
+				DefaultText: "<option>",
+			},
+			&cli.StringFlag{
+				Name:        "exif-offset",
+				Usage:       "Convert exif original dates to UTC before they are formatted by {{exif.dt}} or sorted with --sort exifdate.\n\t\t\t\tThe offset (e.g. '+01:00') is the timezone of the camera clock and is only used if the OffsetTimeOriginal tag is missing.",
+				DefaultText: "<offset>",
+			},
+			&cli.StringFlag{
+				Name:        "make-map",
+				Usage:       "Load a CSV file of exif camera makes and their short names used by {{exif.make.short}}.\n\t\t\t\tThe entries take precedence over the built-in names. Unknown makes are title-cased.",
+				DefaultText: "<csv file>",
+			},
+			&cli.StringFlag{
+				Name:        "overrides",
+				Usage:       "Load a CSV file of source paths and their exact targets which take precedence over the replacement string.\n\t\t\t\tFiles that are not listed are renamed as usual. Relative source paths are resolved from the current directory.",
+				DefaultText: "<csv file>",
+			},
+			&cli.StringFlag{
+				Name:        "manifest",
+				Usage:       "Load a CSV file of expected content hashes and targets. Each matched file is renamed to the target of its hash\n\t\t\t\tand files whose hash is not listed are reported as mismatched and left unchanged.",
+				DefaultText: "<csv file>",
+			},
+			&cli.StringFlag{
+				Name:        "manifest-hash",
+				Usage:       "The hash algorithm used to verify files against the manifest.\n\t\t\t\tAllowed values: 'sha1', 'sha256' (the default), 'sha512', 'md5'.",
+				Value:       "sha256",
+				DefaultText: "<algorithm>",
+			},
+			&cli.StringFlag{
+				Name:        "paths-from",
+				Usage:       "Read the paths to the files or directories to operate on from the specified file (one per line).\n\t\t\t\tUse '-' to read from the standard input.",
+				DefaultText: "<file>",
+			},
+			&cli.BoolFlag{
+				Name:  "null",
+				Usage: "Separate the paths read with --paths-from by NUL characters instead of newlines.\n\t\t\t\tUse this with 'find -print0' or 'fd -0' for filenames that contain newlines.",
+			},
+			&cli.StringFlag{
+				Name:        "sibling-ext",
+				Usage:       "Only consider files with the specified extension (e.g. 'mkv') when resolving {{sibling.name}}.",
+				DefaultText: "<ext>",
+			},
+			&cli.StringFlag{
+				Name:        "sibling-pattern",
+				Usage:       "Only consider files whose name matches the specified regular expression when resolving {{sibling.name}}.",
+				DefaultText: "<pattern>",
+			},
+			&cli.StringFlag{
+				Name:        "sibling-missing",
+				Usage:       "Determines what happens when no sibling matches for {{sibling.name}}.\n\t\t\t\tAllowed values: 'empty' (the default), 'skip' (leave the file unchanged).",
+				DefaultText: "<policy>",
+			},
+			&cli.Int64Flag{
+				Name:        "seed",
+				Usage:       "Seed the random number generator used by the random variables so that the output is reproducible.",
+				DefaultText: "<integer>",
+			},
+			&cli.BoolFlag{
+				Name:  "deterministic",
+				Usage: "Seed the random number generator with a fixed value and freeze the current time at 2000-01-01T00:00:00Z\n\t\t\t\tso that identical runs produce identical results. The seed can be overridden with --seed.",
+			},
 			&cli.IntFlag{
 				Name:        "replace-limit",
 				Aliases:     []string{"l"},
-				Usage:       "Limit the number of replacements to be made on each matched file (replaces all matches if set to 0).\n\t\t\t\tCan be set to a negative integer to start replacing from the end of the file name.",
+				Usage:       "Limit the number of replacements to be made on each matched file (replaces all matches if set to 0).\n\t\t\t\tCan be set to a negative integer to start replacing from the end of the file name.\n\t\t\t\t{{matchnum}} in the replacement is the position of each match among all the matches in the name\n\t\t\t\tincluding those that are not replaced due to the limit.",
 				Value:       0,
 				DefaultText: "<integer>",
 			},
@@ -143,12 +407,36 @@ or: f2 FIND [REPLACE] [PATHS TO FILES OR DIRECTORIES...]`
 				Aliases: []string{"s"},
 				Usage:   "Treats the search pattern as a non-regex string.",
 			},
+			&cli.BoolFlag{
+				Name:  "go-template",
+				Usage: "Treats the replacement string as a Go text/template instead of parsing the built-in variables.\n\t\t\t\tThe template has access to the file metadata (.Source, .Name, .Ext, .Index, .Exif, .ID3, e.t.c.).",
+			},
 			&cli.StringSliceFlag{
 				Name:        "exclude",
 				Aliases:     []string{"E"},
 				Usage:       "Exclude files/directories that match the given search pattern. Treated as a regular expression.\n\t\t\t\tMultiple exclude patterns can be specified by repeating this option.",
 				DefaultText: "<pattern>",
 			},
+			&cli.StringSliceFlag{
+				Name:        "exclude-path",
+				Usage:       "Exclude files/directories whose path relative to the current directory matches the given pattern.\n\t\t\t\tForward slashes are used as the path separator on all platforms. Use ^ and $ to anchor the pattern.\n\t\t\t\tMultiple exclude patterns can be specified by repeating this option.",
+				DefaultText: "<pattern>",
+			},
+			&cli.StringFlag{
+				Name:        "content-match",
+				Usage:       "Only rename files whose contents match the given regular expression. Directories are excluded.\n\t\t\t\tOnly the start of each file is scanned (see --content-limit). UTF-16 text files are decoded before matching.",
+				DefaultText: "<pattern>",
+			},
+			&cli.StringFlag{
+				Name:        "content-limit",
+				Usage:       "The number of bytes scanned at the start of each file for --content-match. Accepts suffixes such as '64k', '1M', or '2G'.",
+				Value:       "1M",
+				DefaultText: "<size>",
+			},
+			&cli.BoolFlag{
+				Name:  "skip-binary",
+				Usage: "Never match binary files with --content-match.",
+			},
 			&cli.BoolFlag{
 				Name:    "exec",
 				Aliases: []string{"x"},
@@ -159,11 +447,11 @@ or: f2 FIND [REPLACE] [PATHS TO FILES OR DIRECTORIES...]`
 				Aliases: []string{"R"},
 				Usage:   "Recursively traverse directories when searching for matches.",
 			},
-			&cli.UintFlag{
+			&cli.IntFlag{
 				Name:        "max-depth",
 				Aliases:     []string{"m"},
-				Usage:       "Indicates the maximum depth for a recursive search (set to 0 by default for no limit).",
-				Value:       0,
+				Usage:       "Indicates the maximum depth for a recursive search. A depth of 0 matches only the top-level entries.\n\t\t\t\tSet to -1 by default for no limit.",
+				Value:       -1,
 				DefaultText: "<integer>",
 			},
 			&cli.StringFlag{
@@ -175,19 +463,44 @@ or: f2 FIND [REPLACE] [PATHS TO FILES OR DIRECTORIES...]`
 						'mtime': file last modified time
 						'btime': file creation time (Windows and macOS only)
 						'atime': file last access time
-						'ctime': file metadata last change time`,
+						'ctime': file metadata last change time
+						'exifdate': exif original date (files without one are
+						placed at the end and ordered by their path)
+					Sizes and times are sorted from largest to smallest
+					(newest first). Files with the same size or time are
+					ordered by their path.`,
 				DefaultText: "<sort>",
 			},
 			&cli.StringFlag{
 				Name:        "sortr",
-				Usage:       "Same as --sort but presents the matches in the reverse order.",
+				Usage:       "Same as --sort but presents the matches in the reverse order.\n\t\t\t\tOnly the sort key is reversed so files with the same\n\t\t\t\tsize or time remain ordered by their path.",
 				DefaultText: "<sort>",
 			},
+			&cli.BoolFlag{
+				Name:  "dirsize-hidden",
+				Usage: "Include hidden files and directories in {{dirsize.count}}.",
+			},
+			&cli.BoolFlag{
+				Name:  "undated-first",
+				Usage: "Place files without an exif date before the others\n\t\t\t\twhen sorting by 'exifdate'.",
+			},
+			&cli.BoolFlag{
+				Name:  "unrated-zero",
+				Usage: "Resolve {{exif.rating}} to 0 for photos without a rating instead of an empty string.",
+			},
+			&cli.BoolFlag{
+				Name:  "keep-order",
+				Usage: "Use the --sort or --sortr order only for assigning indices.\n\t\t\t\tThe matches are presented in their original order.",
+			},
 			&cli.BoolFlag{
 				Name:    "ignore-case",
 				Aliases: []string{"i"},
 				Usage:   "Search for matches case insensitively.",
 			},
+			&cli.BoolFlag{
+				Name:  "normalize-variables",
+				Usage: "Trim and collapse the whitespace in the values of variables before they are placed in the target.\n\t\t\t\tWhitespace that is part of the replacement string itself is preserved.",
+			},
 			&cli.BoolFlag{
 				Name:    "quiet",
 				Aliases: []string{"q"},
@@ -198,6 +511,10 @@ or: f2 FIND [REPLACE] [PATHS TO FILES OR DIRECTORIES...]`
 				Aliases: []string{"e"},
 				Usage:   "Ignore the file extension when searching for matches.",
 			},
+			&cli.BoolFlag{
+				Name:  "preserve-ext",
+				Usage: "Keep the original extension of each file exactly (including its case) even if the replacement changes it.\n\t\t\t\tThe extension is still corrected with --fix-ext.",
+			},
 			&cli.BoolFlag{
 				Name:    "include-dir",
 				Aliases: []string{"d"},
@@ -211,13 +528,17 @@ or: f2 FIND [REPLACE] [PATHS TO FILES OR DIRECTORIES...]`
 			&cli.BoolFlag{
 				Name:    "hidden",
 				Aliases: []string{"H"},
-				Usage:   "Include hidden files (they are skipped by default).",
+				Usage:   "Include hidden files and directories (they are skipped by default, including when recursing).\n\t\t\t\tDotfiles are hidden on every platform as well as files with the hidden attribute on Windows.",
 			},
 			&cli.BoolFlag{
 				Name:    "verbose",
 				Aliases: []string{"V"},
 				Usage:   "Enable verbose output.",
 			},
+			&cli.BoolFlag{
+				Name:  "debug-variables",
+				Usage: "Print the value that each variable in the replacement resolves to for every file before the new\n\t\t\t\tname is assembled. Useful for finding out why a variable is empty or unexpected.",
+			},
 			&cli.BoolFlag{
 				Name:  "no-color",
 				Usage: "Disable coloured output.",
@@ -225,12 +546,64 @@ or: f2 FIND [REPLACE] [PATHS TO FILES OR DIRECTORIES...]`
 			&cli.BoolFlag{
 				Name:    "fix-conflicts",
 				Aliases: []string{"F"},
-				Usage:   "Automatically fix conflicts based on predefined rules.\n\t\t\t\tLearn more: https://github.com/ayoisaiah/f2/wiki/Validation-and-conflict-detection.",
+				Usage:   "Automatically fix conflicts based on predefined rules. Files that share a target are numbered in the --sort order.\n\t\t\t\tLearn more: https://github.com/ayoisaiah/f2/wiki/Validation-and-conflict-detection.",
+			},
+			&cli.StringFlag{
+				Name:        "fix-strategy",
+				Usage:       "The comma-separated strategies tried in order for each conflicting target when fixing conflicts with -F.\n\t\t\t\tAllowed values: 'dir' (move into a directory named after the source directory), 'hash' (append part of the\n\t\t\t\tcontent hash), 'number' (append the next free number). The first strategy that produces a free target is used\n\t\t\t\tand files are numbered if none does. The strategy used for each file is shown in its status.",
+				DefaultText: "<strategies>",
+			},
+			&cli.BoolFlag{
+				Name:  "interactive-edit",
+				Usage: "Open the targets in $VISUAL or $EDITOR before the changes are presented or applied so that they can be\n\t\t\t\tedited by hand. Each target is on its own line below its source and the lines must not be added or removed.",
+			},
+			&cli.BoolFlag{
+				Name:  "confirm-each",
+				Usage: "Ask for confirmation before renaming each file. The changes are applied without the -x flag.\n\t\t\t\tAnswer 'y' to rename the file, 'n' to skip it, or 'q' to stop.",
+			},
+			&cli.IntFlag{
+				Name:        "renumber",
+				Usage:       "Renumber a numbered series as a gapless sequence that starts at 1. The existing number is matched by the\n\t\t\t\tfirst capture group of the find pattern (or the whole match if it has no groups) and defaults to the first number\n\t\t\t\tin the name. The extension is ignored as with -e. Files are ordered by their existing number and the new numbers\n\t\t\t\tare padded with zeros to the specified width (0 uses the length of the longest existing number). Files whose\n\t\t\t\tname does not contain a number are left unchanged. Cannot be used with -r or --sort.",
+				DefaultText: "<width>",
+			},
+			&cli.BoolFlag{
+				Name:  "gapless-index",
+				Usage: "Assign the indices (e.g. %03d) only to the files that will be renamed so that the numbering has no gaps.\n\t\t\t\tFiles that are left unchanged (e.g. skipped by the overwrite policy) keep their original index.",
+			},
+			&cli.BoolFlag{
+				Name:  "timestamp-suffix",
+				Usage: "Append '_1', '_2', etc. to files that are named by a date variable and end up with the same target.\n\t\t\t\tThe files are numbered in the order of their names and the first one is left without a suffix.",
+			},
+			&cli.BoolFlag{
+				Name:  "no-op-on-error",
+				Usage: "Leave files whose target cannot be resolved (e.g. due to unreadable metadata) unchanged and continue\n\t\t\t\twith the others instead of stopping at the first error. The failed files are reported with their errors.",
+			},
+			&cli.BoolFlag{
+				Name:  "no-match-error",
+				Usage: "Exit with an error if no files are matched by the find pattern and the filters so that scripts can detect it.",
 			},
 			&cli.BoolFlag{
 				Name:  "allow-overwrites",
 				Usage: "Allow the overwriting of existing files.",
 			},
+			&cli.BoolFlag{
+				Name:  "copy",
+				Usage: "Copy each file to its target instead of renaming it so that the original is left in place.\n\t\t\t\tThe permissions and modification times are preserved. Copies are not recorded for undo.",
+			},
+			&cli.BoolFlag{
+				Name:  "preserve-streams",
+				Usage: "Copy the alternate data streams of each file (e.g. Zone.Identifier) along with its contents in copy mode.\n\t\t\t\tOn Windows, files whose streams will be lost when they are copied or moved across devices are reported.",
+			},
+			&cli.StringFlag{
+				Name:        "cross-device",
+				Usage:       "Determines what happens when a target is on a different device (filesystem) from the source.\n\t\t\t\tAllowed values: 'error' (report a conflict, the default), 'copy' (copy the file to the target and remove the source).",
+				DefaultText: "<policy>",
+			},
+			&cli.StringFlag{
+				Name:        "overwrite-policy",
+				Usage:       "Determines what happens when a target is an existing file that is not being renamed.\n\t\t\t\tAllowed values: 'skip' (leave the source unchanged), 'overwrite', 'backup' (rename the existing file with a .bak suffix).",
+				DefaultText: "<policy>",
+			},
 		},
 		UseShortOptionHandling: true,
 		Action: func(c *cli.Context) error {
@@ -253,6 +626,12 @@ or: f2 FIND [REPLACE] [PATHS TO FILES OR DIRECTORIES...]`
 				return err
 			}
 
+			if o.confirm == nil && c.Bool("confirm-each") {
+				o.confirm = op.promptConfirm()
+			}
+
+			o.configure(op)
+
 			return op.run()
 		},
 	}
@@ -0,0 +1,144 @@
+package f2
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// archiveEntries returns the names of the entries in a zip or tar archive
+// (optionally compressed with gzip). The archive type is determined by the
+// extension and false is returned if the file is not a supported archive.
+func archiveEntries(sourcePath string) ([]string, bool, error) {
+	lower := strings.ToLower(sourcePath)
+
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		r, err := zip.OpenReader(sourcePath)
+		if err != nil {
+			return nil, true, err
+		}
+
+		defer r.Close()
+
+		names := make([]string, 0, len(r.File))
+		for _, f := range r.File {
+			names = append(names, f.Name)
+		}
+
+		return names, true, nil
+	case strings.HasSuffix(lower, ".tar"),
+		strings.HasSuffix(lower, ".tar.gz"),
+		strings.HasSuffix(lower, ".tgz"):
+		f, err := os.Open(sourcePath)
+		if err != nil {
+			return nil, true, err
+		}
+
+		defer f.Close()
+
+		var r io.Reader = f
+
+		if !strings.HasSuffix(lower, ".tar") {
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				return nil, true, err
+			}
+
+			defer gz.Close()
+
+			r = gz
+		}
+
+		var names []string
+
+		tr := tar.NewReader(r)
+
+		for {
+			header, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			if err != nil {
+				return nil, true, err
+			}
+
+			names = append(names, header.Name)
+		}
+
+		return names, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// commonEntryPrefix derives a name from the entries of an archive. If all
+// the entries are in the same top-level directory, the name of the
+// directory is returned. Otherwise, the common prefix of the entry names
+// (excluding their extensions) is returned without any trailing separators
+// or digits since a partial number (e.g. 'scan_0' for 'scan_01' and
+// 'scan_02') is not meaningful.
+// Metadata entries such as __MACOSX/ are ignored.
+func commonEntryPrefix(entries []string) string {
+	var names []string
+
+	for _, v := range entries {
+		v = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(v)), "/")
+		if v == "" || v == "__MACOSX" || strings.HasPrefix(v, "__MACOSX/") {
+			continue
+		}
+
+		names = append(names, v)
+	}
+
+	if len(names) == 0 {
+		return ""
+	}
+
+	top := strings.Split(names[0], "/")[0]
+	shared, isDir := true, false
+
+	for _, v := range names {
+		parts := strings.SplitN(v, "/", 2)
+		shared = shared && parts[0] == top
+		isDir = isDir || len(parts) > 1
+	}
+
+	if shared && isDir {
+		return top
+	}
+
+	prefix := filenameWithoutExtension(path.Base(names[0]))
+
+	for _, v := range names[1:] {
+		name := filenameWithoutExtension(path.Base(v))
+		prefix = prefix[:commonPrefixLength(prefix, name)]
+	}
+
+	// the prefix may end in the middle of a multi-byte character
+	for !utf8.ValidString(prefix) {
+		prefix = prefix[:len(prefix)-1]
+	}
+
+	return strings.TrimRight(prefix, " -_.0123456789")
+}
+
+// archiveCommonPrefix returns the name derived from the entries of the
+// archive at the specified path. An empty string is returned if the file
+// is not a supported archive.
+func archiveCommonPrefix(sourcePath string) (string, error) {
+	entries, ok, err := archiveEntries(sourcePath)
+	if !ok || err != nil {
+		return "", err
+	}
+
+	return commonEntryPrefix(entries), nil
+}
@@ -0,0 +1,45 @@
+package f2
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// byteSizeRegex matches a number of bytes with an optional
+// unit suffix such as 512, 64k, 1M, 2GiB, or 1.5G.
+var byteSizeRegex = regexp.MustCompile(`(?i)^(\d+(?:\.\d+)?)\s*([kmgt]?)(?:i?b)?$`)
+
+// byteSizeUnits maps each size suffix to its number of bytes.
+// The units are binary so 1k is 1024 bytes.
+var byteSizeUnits = map[string]float64{
+	"":  1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+	"t": 1 << 40,
+}
+
+// parseByteSize parses a human-friendly number of bytes such as '64k',
+// '1M', or '2G'. The suffixes are case-insensitive and may be followed
+// by 'B' or 'iB'. A plain number is a count of bytes.
+func parseByteSize(input string) (int64, error) {
+	match := byteSizeRegex.FindStringSubmatch(strings.TrimSpace(input))
+	if match == nil {
+		return 0, fmt.Errorf("%w: '%s'", errInvalidByteSize, input)
+	}
+
+	n, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: '%s'", errInvalidByteSize, input)
+	}
+
+	size := n * byteSizeUnits[strings.ToLower(match[2])]
+	if size >= math.MaxInt64 || size != math.Trunc(size) {
+		return 0, fmt.Errorf("%w: '%s'", errInvalidByteSize, input)
+	}
+
+	return int64(size), nil
+}
@@ -0,0 +1,233 @@
+package f2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pterm/pterm"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	errConfigReadFailed = errors.New("Unable to read config file")
+
+	errInvalidConfig = errors.New("Invalid config file")
+)
+
+// configPathsKey is the key used to specify the paths to
+// files or directories in a config file.
+const configPathsKey = "paths"
+
+// configAliasesKey is the key used to define the variable aliases that
+// can be referenced in the replacement (e.g. {{@album}}).
+const configAliasesKey = "aliases"
+
+// readConfigFile parses a JSON or YAML config file into a map.
+// YAML is assumed for files with a .yml or .yaml extension.
+func readConfigFile(path string) (map[string]interface{}, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := make(map[string]interface{})
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(b, &config)
+	default:
+		err = json.Unmarshal(b, &config)
+	}
+
+	return config, err
+}
+
+// configString converts a scalar value from a config file to a string
+// that is suitable for the specified flag. An error is returned if the
+// type of the value does not match the type of the flag.
+func configString(flag cli.Flag, value interface{}) (string, error) {
+	switch flag.(type) {
+	case *cli.BoolFlag:
+		if b, ok := value.(bool); ok {
+			return strconv.FormatBool(b), nil
+		}
+
+		return "", errors.New("must be a boolean")
+	case *cli.IntFlag, *cli.UintFlag, *cli.Int64Flag:
+		var n float64
+
+		switch v := value.(type) {
+		case int:
+			n = float64(v)
+		case int64:
+			n = float64(v)
+		case uint64:
+			n = float64(v)
+		case float64:
+			n = v
+		default:
+			return "", errors.New("must be an integer")
+		}
+
+		if n != math.Trunc(n) {
+			return "", errors.New("must be an integer")
+		}
+
+		return strconv.FormatInt(int64(n), 10), nil
+	}
+
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+
+	return "", errors.New("must be a string")
+}
+
+// configStrings converts a value from a config file that may be a single
+// string or a list of strings to a slice.
+func configStrings(value interface{}) ([]string, error) {
+	if s, ok := value.(string); ok {
+		return []string{s}, nil
+	}
+
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, errors.New("must be a string or a list of strings")
+	}
+
+	slice := make([]string, 0, len(list))
+
+	for _, v := range list {
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.New("must be a string or a list of strings")
+		}
+
+		slice = append(slice, s)
+	}
+
+	return slice, nil
+}
+
+// configAliases converts the aliases in a config file to a map of alias
+// names to the expressions that they stand for.
+func configAliases(value interface{}) (map[string]string, error) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("must be a map of names to strings")
+	}
+
+	aliases := make(map[string]string, len(m))
+
+	for name, v := range m {
+		if !aliasNameRegex.MatchString(name) {
+			return nil, fmt.Errorf(
+				"has an invalid name '%s' (only letters, digits, underscores, and hyphens are allowed)",
+				name,
+			)
+		}
+
+		expr, ok := v.(string)
+		if !ok {
+			return nil, errors.New("must be a map of names to strings")
+		}
+
+		aliases[name] = expr
+	}
+
+	return aliases, nil
+}
+
+// loadConfig populates the command line context from the config file
+// specified with the `--config` flag. The keys in the file correspond to
+// the long names of the command line flags and any flag that is set on the
+// command line takes precedence over the file. The paths in the file are
+// returned so that they can be used if none are specified on the command line
+// along with the variable aliases.
+func loadConfig(c *cli.Context) (paths []string, aliases map[string]string, err error) {
+	config, err := readConfigFile(c.String("config"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", errConfigReadFailed, err.Error())
+	}
+
+	flags := make(map[string]cli.Flag)
+
+	for _, f := range c.App.Flags {
+		flags[f.Names()[0]] = f
+	}
+
+	keys := make([]string, 0, len(config))
+	for k := range config {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := config[key]
+
+		if key == configPathsKey {
+			paths, err = configStrings(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: '%s' %s", errInvalidConfig, key, err)
+			}
+
+			continue
+		}
+
+		if key == configAliasesKey {
+			aliases, err = configAliases(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: '%s' %s", errInvalidConfig, key, err)
+			}
+
+			continue
+		}
+
+		flag, ok := flags[key]
+		if !ok || key == "config" {
+			pterm.Warning.Printfln(
+				"Unknown key '%s' in config file was ignored",
+				key,
+			)
+
+			continue
+		}
+
+		if c.IsSet(key) {
+			continue
+		}
+
+		var values []string
+
+		if _, ok := flag.(*cli.StringSliceFlag); ok {
+			values, err = configStrings(value)
+		} else {
+			var s string
+
+			s, err = configString(flag, value)
+			values = []string{s}
+		}
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: '%s' %s", errInvalidConfig, key, err)
+		}
+
+		for _, v := range values {
+			err = c.Set(key, v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: '%s' %s", errInvalidConfig, key, err)
+			}
+		}
+	}
+
+	return paths, aliases, nil
+}
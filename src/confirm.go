@@ -0,0 +1,68 @@
+package f2
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// ConfirmAction is the response to a request to confirm a change.
+type ConfirmAction int
+
+const (
+	// ConfirmApply renames the file.
+	ConfirmApply ConfirmAction = iota
+	// ConfirmSkip leaves the file unchanged and continues with the next one.
+	ConfirmSkip
+	// ConfirmAbort stops the operation. Files that have already been
+	// renamed are not reverted but can be undone as usual.
+	ConfirmAbort
+)
+
+// ConfirmFunc is called with each change before it is applied so that
+// it can be confirmed individually. Unchanged files, files skipped by the
+// overwrite policy, and operations that have conflicts are never confirmed
+// since they are not applied.
+type ConfirmFunc func(ch Change) ConfirmAction
+
+// WithConfirm calls the provided function to confirm each change before it
+// is applied. The changes are applied without the -x flag since each one
+// is confirmed.
+func WithConfirm(confirm ConfirmFunc) Option {
+	return func(o *options) {
+		o.confirm = confirm
+	}
+}
+
+// promptConfirm returns a ConfirmFunc that asks for confirmation of each
+// change on the operation's writer and reads the response from its reader.
+// The operation is aborted if no more input is available.
+func (op *Operation) promptConfirm() ConfirmFunc {
+	reader := bufio.NewReader(op.reader)
+
+	return func(ch Change) ConfirmAction {
+		fmt.Fprintf(
+			op.writer,
+			"Rename '%s' to '%s'? [y/N/q] ",
+			filepath.Join(ch.BaseDir, ch.Source),
+			filepath.Join(ch.BaseDir, ch.Target),
+		)
+
+		answer, err := reader.ReadString('\n')
+		if err != nil && (!errors.Is(err, io.EOF) || answer == "") {
+			return ConfirmAbort
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return ConfirmApply
+		case "q", "quit":
+			return ConfirmAbort
+		}
+
+		return ConfirmSkip
+	}
+}
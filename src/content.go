@@ -0,0 +1,52 @@
+package f2
+
+import "io"
+
+// ContentFunc returns the content that the hash variables of a change are
+// computed from in place of the file on disk. This allows programs that
+// embed f2 to hash content that does not exist yet, such as the output of
+// a transformation that is applied after the file is copied. The file on
+// disk (and its sidecar) is hashed if the returned reader is nil. The
+// reader is closed after it is read if it implements io.Closer.
+type ContentFunc func(ch Change) (io.Reader, error)
+
+// WithContent computes the hash variables from the content returned by the
+// provided function instead of the file on disk. This is an advanced
+// integration point for programs that copy files and transform their
+// content, so that the new names reflect content that has not been
+// written yet.
+func WithContent(content ContentFunc) Option {
+	return func(o *options) {
+		o.content = content
+	}
+}
+
+// customContent reads the content that is provided for the change by the
+// content function. ok is false if there is no content function or if it
+// does not provide content for the change. Only the first --hash-head
+// bytes are read if it is set.
+func (op *Operation) customContent(ch *Change) (content []byte, ok bool, err error) {
+	if op.content == nil {
+		return nil, false, nil
+	}
+
+	r, err := op.content(*ch)
+	if err != nil || r == nil {
+		return nil, false, err
+	}
+
+	if c, isCloser := r.(io.Closer); isCloser {
+		defer c.Close()
+	}
+
+	if op.hashHead > 0 {
+		r = io.LimitReader(r, op.hashHead)
+	}
+
+	content, err = io.ReadAll(r)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return content, true, nil
+}
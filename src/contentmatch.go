@@ -0,0 +1,60 @@
+package f2
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// matchesContent reports whether the start of a file matches the content
+// pattern. Text is decoded first so that UTF-16 files can be matched
+// (see decodeText). Binary files are never matched if they are skipped,
+// and their raw bytes are matched otherwise.
+func (op *Operation) matchesContent(sourcePath string) (bool, error) {
+	f, err := os.Open(sourcePath)
+	if err != nil {
+		return false, err
+	}
+
+	defer f.Close()
+
+	b, err := io.ReadAll(io.LimitReader(f, op.contentMatchLimit))
+	if err != nil {
+		return false, err
+	}
+
+	if text, ok := decodeText(b); ok {
+		return op.contentMatch.MatchString(text), nil
+	}
+
+	if op.skipBinary {
+		return false, nil
+	}
+
+	return op.contentMatch.Match(b), nil
+}
+
+// filterContentMatches leaves only the files whose contents match the
+// content pattern in the matches. Directories are always excluded.
+func (op *Operation) filterContentMatches() error {
+	var filtered []Change
+
+	for _, ch := range op.matches {
+		if ch.IsDir {
+			continue
+		}
+
+		matched, err := op.matchesContent(filepath.Join(ch.BaseDir, ch.Source))
+		if err != nil {
+			return err
+		}
+
+		if matched {
+			filtered = append(filtered, ch)
+		}
+	}
+
+	op.matches = filtered
+
+	return nil
+}
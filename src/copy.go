@@ -0,0 +1,137 @@
+package f2
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// copySize returns the total size in bytes of the files that will be
+// copied so that the progress of the copies can be reported.
+func (op *Operation) copySize() int64 {
+	var total int64
+
+	for _, ch := range op.matches {
+		if ch.Source == ch.Target || ch.action == overwritePolicySkip {
+			continue
+		}
+
+		fi, err := os.Stat(filepath.Join(ch.BaseDir, ch.Source))
+		if err != nil || fi.IsDir() {
+			continue
+		}
+
+		total += fi.Size()
+	}
+
+	return total
+}
+
+// copyToTarget copies the source to the target instead of renaming it.
+// The number of bytes copied so far across all the files is reported
+// through the progress function (if set) as the copy proceeds.
+func (op *Operation) copyToTarget(source, target string) error {
+	var progress func(n int64)
+
+	if op.progress != nil {
+		progress = func(n int64) {
+			op.copiedBytes += n
+			op.progress(int(op.copiedBytes), int(op.copyTotalBytes))
+		}
+	}
+
+	err := copyFile(source, target, progress)
+	if err != nil {
+		return err
+	}
+
+	if !op.preserveStreams {
+		return nil
+	}
+
+	err = copyStreams(source, target)
+	if err != nil {
+		return err
+	}
+
+	// writing the streams updates the modification time of the target
+	fi, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(target, fi.ModTime(), fi.ModTime())
+}
+
+// copyStreams copies the alternate data streams of the source file to the
+// target. The streams of a file are addressed as `file:stream` on Windows
+// and there are none on other platforms.
+func copyStreams(source, target string) error {
+	streams, err := alternateStreams(source)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range streams {
+		err = copyStream(source+":"+name, target+":"+name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyStream copies the contents of a single stream.
+func copyStream(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// detectStreams records the alternate data streams of the files that
+// will be copied, either in copy mode or because they are moved across
+// devices, since only the main stream of a file is copied by default.
+func (op *Operation) detectStreams() {
+	for i := range op.matches {
+		ch := &op.matches[i]
+		ch.streams = nil
+
+		if ch.IsDir || ch.Source == ch.Target ||
+			(!op.copyMode && !ch.crossDevice) {
+			continue
+		}
+
+		// files whose streams cannot be read are treated as having none
+		streams, err := alternateStreams(filepath.Join(ch.BaseDir, ch.Source))
+		if err == nil {
+			ch.streams = streams
+		}
+	}
+}
+
+// losesStreams reports if the alternate data streams of a change will not
+// be present at its target. They are only preserved by copies made in copy
+// mode with --preserve-streams.
+func (op *Operation) losesStreams(ch *Change) bool {
+	if len(ch.streams) == 0 {
+		return false
+	}
+
+	return ch.crossDevice || !op.preserveStreams
+}
@@ -0,0 +1,110 @@
+package f2
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// csvMatchType determines how the key column of a CSV lookup table
+// is compared with the name of each file.
+type csvMatchType string
+
+const (
+	csvMatchEquals   csvMatchType = "equals"
+	csvMatchContains csvMatchType = "contains"
+	csvMatchRegex    csvMatchType = "regex"
+)
+
+// csvMissingPolicy determines what happens to a file whose target contains
+// CSV variables when no row in the lookup table matches its name.
+type csvMissingPolicy string
+
+const (
+	csvMissingEmpty csvMissingPolicy = "empty"
+	csvMissingSkip  csvMissingPolicy = "skip"
+)
+
+// errCSVRowNotFound is returned when no row in the CSV lookup table matches
+// a file whose target contains CSV variables and the policy is 'skip'.
+var errCSVRowNotFound = errors.New("No matching CSV row")
+
+// loadCSVLookup reads the CSV file as a lookup table in which the
+// key column is matched against the name of each file instead of
+// listing the source files. Rows without the key column are ignored.
+func (op *Operation) loadCSVLookup() error {
+	records, err := readCSVFile(op.csvFilename)
+	if err != nil {
+		return err
+	}
+
+	column := op.csvKey - 1
+
+	for i, v := range records {
+		if len(v) <= column {
+			continue
+		}
+
+		var pattern *regexp.Regexp
+
+		if op.csvMatch == csvMatchRegex {
+			expr := strings.TrimSpace(v[column])
+			if op.ignoreCase {
+				expr = "(?i)" + expr
+			}
+
+			pattern, err = regexp.Compile(expr)
+			if err != nil {
+				return fmt.Errorf("row %d has an invalid key: %w", i+1, err)
+			}
+		}
+
+		op.csvRows = append(op.csvRows, v)
+		op.csvPatterns = append(op.csvPatterns, pattern)
+	}
+
+	return nil
+}
+
+// csvKeyMatches reports whether the key of a row in the lookup
+// table matches the file name. The key equals the file name if it is
+// the same as the name with or without the extension.
+func (op *Operation) csvKeyMatches(row int, name string) bool {
+	if op.csvMatch == csvMatchRegex {
+		return op.csvPatterns[row].MatchString(name)
+	}
+
+	key := strings.TrimSpace(op.csvRows[row][op.csvKey-1])
+	if key == "" {
+		return false
+	}
+
+	if op.ignoreCase {
+		key, name = strings.ToLower(key), strings.ToLower(name)
+	}
+
+	if op.csvMatch == csvMatchContains {
+		return strings.Contains(name, key)
+	}
+
+	return key == name || key == filenameWithoutExtension(name)
+}
+
+// csvLookup finds the row in the lookup table whose key matches the file
+// name. If several rows match, the first one in the file wins. If none
+// match, a nil row is returned so that the CSV variables are replaced with
+// empty strings or errCSVRowNotFound is returned depending on the policy.
+func (op *Operation) csvLookup(ch *Change) ([]string, error) {
+	for i := range op.csvRows {
+		if op.csvKeyMatches(i, ch.Source) {
+			return op.csvRows[i], nil
+		}
+	}
+
+	if op.csvMissing == csvMissingSkip {
+		return nil, errCSVRowNotFound
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,92 @@
+package f2
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// defaultDateSeqStep is the interval between the dates assigned by
+// {{dateseq}} if no interval is specified with `--dateseq-step`.
+const defaultDateSeqStep = "1d"
+
+// dateSeqLayouts are the accepted layouts of the `--dateseq-start` date.
+var dateSeqLayouts = []string{
+	"2006-01-02",
+	"2006-01-02T15:04",
+	"2006-01-02T15:04:05",
+}
+
+// dateSeqStep is the interval between consecutive dates in the sequence.
+// Days and weeks are calendar days so that the time of day is kept across
+// daylight saving time changes.
+type dateSeqStep struct {
+	n    int
+	unit string
+}
+
+// parseDateSeqStart parses the date that the sequence starts from in the
+// local time zone. An empty input is left as the zero time so that the
+// sequence starts at midnight on the current day.
+func parseDateSeqStart(input string) (time.Time, error) {
+	if input == "" {
+		return time.Time{}, nil
+	}
+
+	for _, layout := range dateSeqLayouts {
+		t, err := time.ParseInLocation(layout, input, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%w: '%s'", errInvalidDateSeqStart, input)
+}
+
+// parseDateSeqStep parses an interval such as 12h, 1d, or 2w.
+func parseDateSeqStep(input string) (dateSeqStep, error) {
+	match := ageBucketUnitRegex.FindStringSubmatch(input)
+	if match == nil {
+		return dateSeqStep{}, fmt.Errorf("%w: '%s'", errInvalidDateSeqStep, input)
+	}
+
+	n, err := strconv.Atoi(match[1])
+	if err != nil || n == 0 {
+		return dateSeqStep{}, fmt.Errorf("%w: '%s'", errInvalidDateSeqStep, input)
+	}
+
+	return dateSeqStep{n: n, unit: match[2]}, nil
+}
+
+// advance returns the date that is the specified number of steps
+// after the start date.
+func (s dateSeqStep) advance(start time.Time, steps int) time.Time {
+	switch s.unit {
+	case "h":
+		return start.Add(time.Duration(s.n*steps) * time.Hour)
+	case "w":
+		return start.AddDate(0, 0, 7*s.n*steps)
+	}
+
+	return start.AddDate(0, 0, s.n*steps)
+}
+
+// replaceDateSeqVariables replaces the date sequence variables in the
+// target with the date at the specified index in the sequence. The first
+// file is assigned the start date and each subsequent file is one step
+// later.
+func (op *Operation) replaceDateSeqVariables(target string, index int) string {
+	start := op.dateSeqStart
+	if start.IsZero() {
+		year, month, day := op.now.Date()
+		start = time.Date(year, month, day, 0, 0, 0, 0, op.now.Location())
+	}
+
+	date := op.dateSeqStep.advance(start, index)
+
+	return dateSeqRegex.ReplaceAllStringFunc(target, func(match string) string {
+		submatch := dateSeqRegex.FindStringSubmatch(match)
+
+		return formatDate(date, splitDateFormat(submatch[1]))
+	})
+}
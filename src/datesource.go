@@ -0,0 +1,221 @@
+package f2
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/djherbis/times.v1"
+)
+
+// dateSourcePattern matches a single source of {{date.<sources>.<format>}}
+// with an optional exif tag (e.g. mtime or exif:CreateDate).
+const dateSourcePattern = `[a-z0-9]+(?::[A-Za-z0-9]+)?`
+
+const (
+	// id3DateSource uses the year in the id3 tags of an audio file.
+	id3DateSource = "id3"
+	// defaultExifDateTag is the exif tag used by the exif source
+	// if none is specified.
+	defaultExifDateTag = "DateTimeOriginal"
+)
+
+var errInvalidDateSource = errors.New(
+	"Invalid date source: must be one of 'exif[:<tag>]', 'id3', 'mtime', 'btime', 'atime', 'ctime', or 'now'",
+)
+
+// dateSource is a place that the date of a file can be taken from.
+// The tag is only used by the exif source.
+type dateSource struct {
+	name string
+	tag  string
+}
+
+// dateFormatTokens contains the date tokens from
+// the longest to the shortest so that they are
+// matched greedily in a format.
+var dateFormatTokens = func() []string {
+	tokens := make([]string, 0, len(dateTokens))
+	for k := range dateTokens {
+		tokens = append(tokens, k)
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		if len(tokens[i]) != len(tokens[j]) {
+			return len(tokens[i]) > len(tokens[j])
+		}
+
+		return tokens[i] < tokens[j]
+	})
+
+	return tokens
+}()
+
+// parseDateSources parses a chain of date sources separated
+// by '|' such as 'exif:CreateDate|id3|mtime'.
+func parseDateSources(input string) ([]dateSource, error) {
+	var sources []dateSource
+
+	for _, v := range strings.Split(input, "|") {
+		var src dateSource
+
+		src.name = v
+		if i := strings.Index(v, ":"); i != -1 {
+			src.name, src.tag = v[:i], v[i+1:]
+		}
+
+		switch src.name {
+		case exifDateSource:
+			if src.tag == "" {
+				src.tag = defaultExifDateTag
+			}
+		case id3DateSource, modTime, birthTime, accessTime, changeTime, currentTime:
+			if src.tag != "" {
+				return nil, fmt.Errorf("%w: '%s'", errInvalidDateSource, v)
+			}
+		default:
+			return nil, fmt.Errorf("%w: '%s'", errInvalidDateSource, v)
+		}
+
+		sources = append(sources, src)
+	}
+
+	return sources, nil
+}
+
+// splitDateFormat splits a format such as 'YYYY-MM-DD' into its
+// date tokens and the characters between them.
+func splitDateFormat(format string) []string {
+	var parts []string
+
+	for len(format) > 0 {
+		token := ""
+
+		for _, v := range dateFormatTokens {
+			if strings.HasPrefix(format, v) {
+				token = v
+				break
+			}
+		}
+
+		if token == "" {
+			token = string([]rune(format)[0])
+		}
+
+		parts = append(parts, token)
+		format = format[len(token):]
+	}
+
+	return parts
+}
+
+// formatDate formats a date according to the parts of a format. Each date
+// token is replaced with its value and other characters are kept as is.
+func formatDate(date time.Time, format []string) string {
+	var b strings.Builder
+
+	for _, v := range format {
+		if layout, ok := dateTokens[v]; ok {
+			b.WriteString(date.Format(layout))
+			continue
+		}
+
+		b.WriteString(v)
+	}
+
+	return b.String()
+}
+
+// sourceDate retrieves the date of a file from the specified source.
+// False is returned if the source does not have a date for the file
+// (e.g. a file without exif data or a platform without birth times).
+func (op *Operation) sourceDate(
+	sourcePath string,
+	src dateSource,
+) (time.Time, bool, error) {
+	switch src.name {
+	case currentTime:
+		return op.now, true, nil
+	case exifDateSource:
+		exifData, err := getExifData(sourcePath)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+
+		date, ok := parseExifDateTime(getExifRawTag(exifData, src.tag))
+
+		return date, ok, nil
+	case id3DateSource:
+		tags, err := getID3Tags(sourcePath)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+
+		if tags.Year == 0 {
+			return time.Time{}, false, nil
+		}
+
+		return time.Date(tags.Year, time.January, 1, 0, 0, 0, 0, time.UTC), true, nil
+	}
+
+	t, err := times.Stat(sourcePath)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	switch src.name {
+	case birthTime:
+		if !t.HasBirthTime() {
+			return time.Time{}, false, nil
+		}
+
+		return t.BirthTime(), true, nil
+	case changeTime:
+		if !t.HasChangeTime() {
+			return time.Time{}, false, nil
+		}
+
+		return t.ChangeTime(), true, nil
+	case accessTime:
+		return t.AccessTime(), true, nil
+	}
+
+	return t.ModTime(), true, nil
+}
+
+// replaceDateSourceVariables replaces each {{date.<sources>.<format>}}
+// variable in the target with the date from the first source that has
+// a value for the file. The variable is replaced with an empty string
+// if none of the sources have a value.
+func (op *Operation) replaceDateSourceVariables(
+	target string,
+	ch *Change,
+	dv dateSourceVar,
+) (string, error) {
+	sourcePath := filepath.Join(ch.BaseDir, ch.originalSource)
+
+	for i := range dv.submatches {
+		current := dv.values[i]
+
+		var value string
+
+		for _, src := range current.sources {
+			date, ok, err := op.sourceDate(sourcePath, src)
+			if err != nil {
+				return target, err
+			}
+
+			if ok {
+				value = formatDate(date, current.format)
+				break
+			}
+		}
+
+		target = current.regex.ReplaceAllLiteralString(target, value)
+	}
+
+	return target, nil
+}
@@ -0,0 +1,82 @@
+package f2
+
+import (
+	"path/filepath"
+	"time"
+
+	"gopkg.in/djherbis/times.v1"
+)
+
+// exifDateSource uses the exif original date of a file
+// and falls back to its modification time.
+const exifDateSource = "exif"
+
+// dateTreeFormats maps each depth of a date tree
+// to the layout of the folders at each level.
+var dateTreeFormats = map[string][]string{
+	"year":  {"2006"},
+	"month": {"2006", "2006-01"},
+	"day":   {"2006", "2006-01", "2006-01-02"},
+}
+
+// fileDate retrieves the date of a file from the specified source.
+func fileDate(sourcePath, source string) (time.Time, error) {
+	if source == exifDateSource {
+		exifData, err := getExifData(sourcePath)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if date, ok := parseExifDate(exifData); ok {
+			return date, nil
+		}
+
+		source = modTime
+	}
+
+	t, err := times.Stat(sourcePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	switch source {
+	case birthTime:
+		if t.HasBirthTime() {
+			return t.BirthTime(), nil
+		}
+	case accessTime:
+		return t.AccessTime(), nil
+	case changeTime:
+		if t.HasChangeTime() {
+			return t.ChangeTime(), nil
+		}
+	}
+
+	return t.ModTime(), nil
+}
+
+// buildDateTree places the target of each match in a date-based folder
+// hierarchy (e.g. 2021/2021-06/2021-06-12) according to the depth
+// specified with the `--date-tree` flag. The folders are created
+// relative to the directory of the source file (or the destination root).
+func (op *Operation) buildDateTree() error {
+	formats := dateTreeFormats[op.dateTree]
+
+	for i, ch := range op.matches {
+		sourcePath := filepath.Join(ch.BaseDir, ch.originalSource)
+
+		date, err := fileDate(sourcePath, op.dateTreeSource)
+		if err != nil {
+			return err
+		}
+
+		elem := make([]string, 0, len(formats)+1)
+		for _, f := range formats {
+			elem = append(elem, date.Format(f))
+		}
+
+		op.matches[i].Target = filepath.Join(append(elem, ch.Target)...)
+	}
+
+	return nil
+}
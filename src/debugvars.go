@@ -0,0 +1,54 @@
+package f2
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+// variableTokenRegex matches a single variable token in the replacement
+// including the tokens whose arguments contain braces
+// (e.g. {{f.match:\d{4}}}).
+var variableTokenRegex = regexp.MustCompile(`{{(?:[^{}]|\{[^{}]*\})*}}`)
+
+// printVariableValues writes the value that each variable token in the
+// target of the change resolves to before the values are assembled into
+// the new name. Each token is resolved on its own so random variables may
+// not match the values that are used in the target.
+func (op *Operation) printVariableValues(ch Change, vars *variables) {
+	tokens := variableTokenRegex.FindAllString(ch.Target, -1)
+	if len(tokens) == 0 {
+		return
+	}
+
+	fmt.Fprintf(op.writer, "%s\n", filepath.Join(ch.BaseDir, ch.Source))
+
+	seen := make(map[string]bool)
+
+	for _, token := range tokens {
+		if seen[token] {
+			continue
+		}
+
+		seen[token] = true
+
+		tokenChange := ch
+		tokenChange.Target = token
+
+		var value string
+
+		err := op.replaceVariables(&tokenChange, vars)
+
+		switch {
+		case err != nil:
+			value = "error: " + err.Error()
+		case tokenChange.Target == token:
+			value = "not a variable"
+		default:
+			value = strconv.Quote(tokenChange.Target)
+		}
+
+		fmt.Fprintf(op.writer, "  %s = %s\n", token, value)
+	}
+}
@@ -0,0 +1,87 @@
+package f2
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// usesTimestamp reports whether any of the replacements contains a date
+// variable such as {{mtime.YYYY}}, {{exif.dt.YYYY}}, {{date.exif|mtime.YYYY}},
+// {{dateseq.YYYY-MM-DD}}, or {{video.creationdate.YYYY}}.
+func (op *Operation) usesTimestamp() bool {
+	for _, v := range op.replacementSlice {
+		if dateRegex.MatchString(v) || dateSourceRegex.MatchString(v) ||
+			dateSeqRegex.MatchString(v) {
+			return true
+		}
+
+		for _, submatch := range exifRegex.FindAllStringSubmatch(v, -1) {
+			if submatch[2] == "dt" {
+				return true
+			}
+		}
+
+		for _, submatch := range videoRegex.FindAllStringSubmatch(v, -1) {
+			if submatch[1] == "creationdate" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// suffixTimestampCollisions appends '_1', '_2', etc. to the file name of
+// changes whose targets are identical because they were named by a date
+// that is shared by several files (e.g. photos taken in a burst). The
+// files in each group are ordered by their source name and the first one
+// is left without a suffix so that the numbering is stable. Nothing
+// happens if none of the replacements contains a date variable.
+func (op *Operation) suffixTimestampCollisions() {
+	if !op.usesTimestamp() {
+		return
+	}
+
+	groups := make(map[string][]int)
+
+	var targets []string
+
+	for i, ch := range op.matches {
+		target := filepath.Join(ch.BaseDir, ch.Target)
+		if target == filepath.Join(ch.BaseDir, ch.Source) {
+			continue
+		}
+
+		if _, ok := groups[target]; !ok {
+			targets = append(targets, target)
+		}
+
+		groups[target] = append(groups[target], i)
+	}
+
+	for _, target := range targets {
+		group := groups[target]
+		if len(group) < 2 {
+			continue
+		}
+
+		sort.SliceStable(group, func(i, j int) bool {
+			a, b := op.matches[group[i]], op.matches[group[j]]
+			if a.Source != b.Source {
+				return a.Source < b.Source
+			}
+
+			return a.BaseDir < b.BaseDir
+		})
+
+		for n, index := range group[1:] {
+			ch := &op.matches[index]
+			ext := filepath.Ext(ch.Target)
+			name := strings.TrimSuffix(ch.Target, ext)
+
+			ch.Target = name + "_" + strconv.Itoa(n+1) + ext
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package f2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+)
+
+// The formats of the {{duration}} variable.
+const (
+	durationMinutes = "mm-ss"
+	durationHours   = "hh-mm-ss"
+	durationSeconds = "s"
+)
+
+// flacDuration computes the duration of a FLAC file from the total number
+// of samples and the sample rate in its STREAMINFO block.
+func flacDuration(r io.Reader) float64 {
+	// the signature is followed by the header of the STREAMINFO block
+	b := make([]byte, 4+4+34)
+
+	if _, err := io.ReadFull(r, b); err != nil ||
+		!bytes.Equal(b[:4], []byte("fLaC")) || b[4]&0x7F != 0 {
+		return 0
+	}
+
+	info := b[8:]
+	sampleRate := uint64(info[10])<<12 | uint64(info[11])<<4 | uint64(info[12])>>4
+	samples := uint64(info[13]&0x0F)<<32 | uint64(binary.BigEndian.Uint32(info[14:18]))
+
+	if sampleRate == 0 {
+		return 0
+	}
+
+	return float64(samples) / float64(sampleRate)
+}
+
+// wavDuration computes the duration of a WAV file from the size of its
+// data chunk and the byte rate in its format chunk.
+func wavDuration(r io.Reader) float64 {
+	header := make([]byte, 12)
+
+	if _, err := io.ReadFull(r, header); err != nil ||
+		!bytes.Equal(header[:4], []byte("RIFF")) ||
+		!bytes.Equal(header[8:], []byte("WAVE")) {
+		return 0
+	}
+
+	var byteRate uint32
+
+	chunk := make([]byte, 8)
+
+	for {
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return 0
+		}
+
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+
+		switch string(chunk[:4]) {
+		case "fmt ":
+			format := make([]byte, 12)
+			if size < int64(len(format)) {
+				return 0
+			}
+
+			if _, err := io.ReadFull(r, format); err != nil {
+				return 0
+			}
+
+			byteRate = binary.LittleEndian.Uint32(format[8:])
+			size -= int64(len(format))
+		case "data":
+			if byteRate == 0 {
+				return 0
+			}
+
+			return float64(size) / float64(byteRate)
+		}
+
+		// chunks are padded to an even number of bytes
+		if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+			return 0
+		}
+	}
+}
+
+// getDuration retrieves the duration of a media file in seconds. MP4 and
+// QuickTime containers (including M4A audio), FLAC and WAV files are read
+// directly, and the ID3 length frame is used for other audio files. Zero
+// is returned if the duration cannot be determined.
+func getDuration(sourcePath string) (float64, error) {
+	videoData, err := getVideoData(sourcePath)
+	if err != nil {
+		return 0, err
+	}
+
+	if videoData.Duration > 0 {
+		return videoData.Duration, nil
+	}
+
+	f, err := os.Open(sourcePath)
+	if err != nil {
+		return 0, err
+	}
+
+	defer f.Close()
+
+	for _, read := range []func(io.Reader) float64{flacDuration, wavDuration} {
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+
+		if d := read(f); d > 0 {
+			return d, nil
+		}
+	}
+
+	tags, err := getID3Tags(sourcePath)
+	if err != nil {
+		return 0, err
+	}
+
+	return float64(tags.Length) / 1000, nil
+}
+
+// formatDuration formats a duration in seconds which is rounded to the
+// nearest second. The minutes and hours are not limited so a duration of
+// 75 minutes is 75-00 in the mm-ss format.
+func formatDuration(seconds float64, format string) string {
+	total := int(math.Round(seconds))
+
+	switch format {
+	case durationSeconds:
+		return strconv.Itoa(total)
+	case durationHours:
+		return fmt.Sprintf("%02d-%02d-%02d", total/3600, total%3600/60, total%60)
+	default:
+		return fmt.Sprintf("%02d-%02d", total/60, total%60)
+	}
+}
+
+// replaceDurationVariables replaces {{duration}} in the target with the
+// duration of the media file in the format specified in the variable
+// (mm-ss by default). It resolves to an empty string for other files.
+func replaceDurationVariables(target, sourcePath string) (string, error) {
+	seconds, err := getDuration(sourcePath)
+	if err != nil {
+		return target, err
+	}
+
+	return durationRegex.ReplaceAllStringFunc(target, func(match string) string {
+		if seconds <= 0 {
+			return ""
+		}
+
+		format := durationRegex.FindStringSubmatch(match)[1]
+
+		return formatDuration(seconds, format)
+	}), nil
+}
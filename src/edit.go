@@ -0,0 +1,191 @@
+package f2
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+var (
+	errEditorFailed = errors.New("Unable to edit the targets")
+
+	errEditLineCount = errors.New(
+		"The number of targets in the edited file does not match the number of files",
+	)
+)
+
+// editHeader explains the format of the file that the targets are edited in.
+const editHeader = `# Edit the target of each file below and save the file to continue.
+# The targets are matched to the files by their order so lines must not
+# be added, removed, or reordered. Lines that start with '#' are ignored
+# so relative targets are written with a leading './' which must be kept
+# if the name of the target starts with '#'.
+`
+
+// editPath returns the path written to the edit file for a file. Relative
+// paths are prefixed with './' so that a path can never be mistaken for a
+// comment even if the name of the file starts with '#'.
+func editPath(baseDir, name string) string {
+	p := filepath.Join(baseDir, name)
+	if filepath.IsAbs(p) || filepath.VolumeName(p) != "" ||
+		strings.HasPrefix(p, string(filepath.Separator)) {
+		return p
+	}
+
+	return "." + string(filepath.Separator) + p
+}
+
+// editorCommand returns the command used to edit the targets. It is the
+// specified editor, $VISUAL, or $EDITOR in that order with a platform
+// default if none is set.
+func editorCommand(editor string) []string {
+	for _, v := range []string{editor, os.Getenv("VISUAL"), os.Getenv("EDITOR")} {
+		if fields := strings.Fields(v); len(fields) > 0 {
+			return fields
+		}
+	}
+
+	if runtime.GOOS == windows {
+		return []string{"notepad"}
+	}
+
+	return []string{"vi"}
+}
+
+// writeEditList writes the target of each change on its own line preceded
+// by a comment with its source.
+func writeEditList(w io.Writer, changes []Change) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprint(bw, editHeader)
+
+	for _, ch := range changes {
+		fmt.Fprintf(
+			bw,
+			"\n# %s\n%s\n",
+			editPath(ch.BaseDir, ch.Source),
+			editPath(ch.BaseDir, ch.Target),
+		)
+	}
+
+	return bw.Flush()
+}
+
+// parseEditList reads the edited targets and assigns them to the changes
+// by their order. Blank lines and comments are ignored, and an error is
+// returned without modifying any change if the number of targets differs
+// from the number of changes.
+func parseEditList(r io.Reader, changes []Change) error {
+	var targets []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		targets = append(targets, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(targets) != len(changes) {
+		return fmt.Errorf(
+			"%w: expected %d, got %d",
+			errEditLineCount,
+			len(changes),
+			len(targets),
+		)
+	}
+
+	for i := range changes {
+		// the targets are resolved relative to the working directory
+		// like the paths that were written to the file
+		baseDir, err := filepath.Abs(changes[i].BaseDir)
+		if err != nil {
+			return err
+		}
+
+		targetPath, err := filepath.Abs(targets[i])
+		if err != nil {
+			return err
+		}
+
+		changes[i].Target, err = filepath.Rel(baseDir, targetPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// editTargets writes the targets of the changes to a temporary file, opens
+// it in an editor, and reads the edited targets back into the changes once
+// the editor exits.
+func editTargets(changes []Change, editor string) error {
+	f, err := os.CreateTemp("", "f2-edit-*.txt")
+	if err != nil {
+		return fmt.Errorf("%w: %s", errEditorFailed, err.Error())
+	}
+
+	defer os.Remove(f.Name())
+
+	err = writeEditList(f, changes)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %s", errEditorFailed, err.Error())
+	}
+
+	command := editorCommand(editor)
+
+	//nolint:gosec // the editor is chosen by the user
+	cmd := exec.Command(command[0], append(command[1:], f.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("%w: %s", errEditorFailed, err.Error())
+	}
+
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		return fmt.Errorf("%w: %s", errEditorFailed, err.Error())
+	}
+
+	return parseEditList(bytes.NewReader(b), changes)
+}
+
+// EditPlan opens the targets of the changes in the plan in an editor so
+// that they can be modified by hand before the plan is applied. Each target
+// is on its own line below a comment with its source. The editor is the
+// specified command (e.g. "code --wait") or $VISUAL or $EDITOR if it is
+// empty. The plan is left unchanged if the editor fails or if lines are
+// added or removed.
+func EditPlan(plan *Plan, editor string) error {
+	changes := append([]Change(nil), plan.Changes...)
+
+	err := editTargets(changes, editor)
+	if err != nil {
+		return err
+	}
+
+	plan.Changes = changes
+
+	return nil
+}
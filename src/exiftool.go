@@ -0,0 +1,52 @@
+package f2
+
+import (
+	"fmt"
+	"strings"
+
+	exiftool "github.com/barasher/go-exiftool"
+)
+
+// parseExiftoolOpts converts the options specified with `--exiftool-opt`
+// (e.g. '-api largefilesupport=1') to the corresponding exiftool options.
+// Only the options that do not change the output format are allowed so
+// that the output can always be parsed.
+func parseExiftoolOpts(opts []string) ([]func(*exiftool.Exiftool) error, error) {
+	result := make([]func(*exiftool.Exiftool) error, 0, len(opts))
+
+	for _, opt := range opts {
+		fields := strings.Fields(opt)
+		if len(fields) == 0 {
+			continue
+		}
+
+		name, args := strings.ToLower(fields[0]), fields[1:]
+
+		switch name {
+		case "-api", "-charset":
+			if len(args) != 1 || strings.HasPrefix(args[0], "-") {
+				return nil, fmt.Errorf("%w: '%s'", errInvalidExiftoolOpt, opt)
+			}
+
+			if name == "-api" {
+				result = append(result, exiftool.Api(args[0]))
+			} else {
+				result = append(result, exiftool.Charset(args[0]))
+			}
+		case "-ee", "-extractembedded", "-n":
+			if len(args) != 0 {
+				return nil, fmt.Errorf("%w: '%s'", errInvalidExiftoolOpt, opt)
+			}
+
+			if name == "-n" {
+				result = append(result, exiftool.NoPrintConversion())
+			} else {
+				result = append(result, exiftool.ExtractEmbedded())
+			}
+		default:
+			return nil, fmt.Errorf("%w: '%s'", errInvalidExiftoolOpt, opt)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,192 @@
+package f2
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLength is the number of bytes used to detect the content type
+// of a file.
+const sniffLength = 512
+
+// contentTypeExtensions maps the content types that can be detected from
+// the contents of a file to their extensions. The first extension is the
+// preferred one while the others are also considered correct. Text types
+// are not included since they cannot be reliably told apart.
+var contentTypeExtensions = map[string][]string{
+	"image/jpeg":                   {".jpg", ".jpeg", ".jpe"},
+	"image/png":                    {".png"},
+	"image/gif":                    {".gif"},
+	"image/webp":                   {".webp"},
+	"image/bmp":                    {".bmp"},
+	"image/x-icon":                 {".ico"},
+	"application/pdf":              {".pdf"},
+	"application/postscript":       {".ps", ".eps"},
+	"application/zip":              {".zip", ".docx", ".xlsx", ".pptx", ".odt", ".ods", ".odp", ".epub", ".jar", ".apk", ".cbz"},
+	"application/x-gzip":           {".gz", ".tgz"},
+	"application/x-rar-compressed": {".rar", ".cbr"},
+	"application/ogg":              {".ogg", ".oga", ".ogv", ".opus"},
+	"application/wasm":             {".wasm"},
+	"audio/mpeg":                   {".mp3"},
+	"audio/wave":                   {".wav"},
+	"audio/aiff":                   {".aiff", ".aif"},
+	"audio/midi":                   {".mid", ".midi"},
+	"video/mp4":                    {".mp4", ".m4v", ".m4a", ".m4b"},
+	"video/webm":                   {".webm", ".mkv", ".mka"},
+	"video/avi":                    {".avi"},
+	"font/ttf":                     {".ttf"},
+	"font/otf":                     {".otf"},
+	"font/woff":                    {".woff"},
+	"font/woff2":                   {".woff2"},
+}
+
+// detectContentType sniffs the content type of a file from its first
+// few bytes. Parameters such as the charset are not included.
+func detectContentType(sourcePath string) (string, error) {
+	f, err := os.Open(sourcePath)
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	buf := make([]byte, sniffLength)
+
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.EOF) &&
+		!errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+
+	contentType := http.DetectContentType(buf[:n])
+
+	return strings.TrimSpace(strings.Split(contentType, ";")[0]), nil
+}
+
+// normalizeExtension ensures that an extension is in lowercase
+// and starts with a dot.
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+
+	return ext
+}
+
+// loadExtensionMap sets up the extensions of each content type. Entries in
+// the file specified with the `--ext-map` flag replace the defaults. It is a
+// CSV file in which the first column is the content type, the second column
+// is the preferred extension, and any other columns are alternative
+// extensions that are also considered correct.
+func (op *Operation) loadExtensionMap() error {
+	op.extensionMap = make(map[string][]string, len(contentTypeExtensions))
+
+	for k, v := range contentTypeExtensions {
+		op.extensionMap[k] = v
+	}
+
+	if op.extMapFilename == "" {
+		return nil
+	}
+
+	records, err := readCSVFile(op.extMapFilename)
+	if err != nil {
+		return err
+	}
+
+	for i, v := range records {
+		minColumns := 2
+		if len(v) < minColumns {
+			return fmt.Errorf("row %d must have a content type and extension", i+1)
+		}
+
+		var exts []string
+
+		for _, ext := range v[1:] {
+			if ext = normalizeExtension(ext); ext != "" {
+				exts = append(exts, ext)
+			}
+		}
+
+		if len(exts) == 0 {
+			return fmt.Errorf("row %d must have a content type and extension", i+1)
+		}
+
+		op.extensionMap[strings.ToLower(strings.TrimSpace(v[0]))] = exts
+	}
+
+	return nil
+}
+
+// correctExtension returns the preferred extension of a file if its
+// current extension disagrees with its content type. An empty string is
+// returned if the extension is correct or the content type is unknown.
+func (op *Operation) correctExtension(ch *Change) (string, error) {
+	contentType, err := detectContentType(
+		filepath.Join(ch.BaseDir, ch.originalSource),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	exts, ok := op.extensionMap[contentType]
+	if !ok {
+		return "", nil
+	}
+
+	current := strings.ToLower(filepath.Ext(ch.originalSource))
+
+	for _, ext := range exts {
+		if ext == current {
+			return "", nil
+		}
+	}
+
+	return exts[0], nil
+}
+
+// filterMismatchedExtensions leaves only the files whose extension
+// disagrees with their content type in the matches. Directories
+// are always excluded.
+func (op *Operation) filterMismatchedExtensions() error {
+	var filtered []Change
+
+	for _, ch := range op.matches {
+		if ch.IsDir {
+			continue
+		}
+
+		ext, err := op.correctExtension(&ch)
+		if err != nil {
+			return err
+		}
+
+		if ext != "" {
+			ch.correctExt = ext
+			filtered = append(filtered, ch)
+		}
+	}
+
+	op.matches = filtered
+
+	return nil
+}
+
+// fixExtensions replaces the extension in the target of each match
+// with the one that corresponds to its content type.
+func (op *Operation) fixExtensions() {
+	for i, ch := range op.matches {
+		if ch.correctExt == "" {
+			continue
+		}
+
+		target := strings.TrimSuffix(ch.Target, filepath.Ext(ch.Target))
+		op.matches[i].Target = target + ch.correctExt
+	}
+}
@@ -0,0 +1,150 @@
+package f2
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	// defaultFirstLineLength is the maximum number of characters used
+	// for {{firstline}} if no length is specified.
+	defaultFirstLineLength = 50
+	// firstLineReadLimit is the number of bytes that are read from the
+	// start of a file to find its first non-empty line.
+	firstLineReadLimit = 64 * 1024
+)
+
+// Byte order marks that identify the encoding of a text file.
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// decodeText converts the start of a text file to a string. UTF-16 is
+// detected by its byte order mark and UTF-8 is assumed otherwise. False
+// is returned if the content is binary (i.e. it contains NUL characters
+// or is not valid UTF-8). A character that is cut off at the end of the
+// content is ignored.
+func decodeText(b []byte) (string, bool) {
+	var text string
+
+	switch {
+	case bytes.HasPrefix(b, utf16LEBOM), bytes.HasPrefix(b, utf16BEBOM):
+		littleEndian := b[0] == utf16LEBOM[0]
+		b = b[2:]
+
+		units := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			if littleEndian {
+				units = append(units, uint16(b[i])|uint16(b[i+1])<<8)
+			} else {
+				units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+			}
+		}
+
+		text = string(utf16.Decode(units))
+	default:
+		b = bytes.TrimPrefix(b, utf8BOM)
+
+		// drop an incomplete character at the end of the content
+		for i := 0; i < utf8.UTFMax && len(b) > 0; i++ {
+			if r, size := utf8.DecodeLastRune(b); r != utf8.RuneError || size != 1 {
+				break
+			}
+
+			b = b[:len(b)-1]
+		}
+
+		if !utf8.Valid(b) {
+			return "", false
+		}
+
+		text = string(b)
+	}
+
+	if strings.ContainsRune(text, 0) {
+		return "", false
+	}
+
+	return text, true
+}
+
+// firstLine returns the first non-empty line of a text file with its
+// whitespace collapsed and truncated to the specified number of
+// characters. Path separators are removed so that the line does not
+// create directories. An empty string is returned for directories,
+// empty files, and binary files.
+func firstLine(sourcePath string, length int) (string, error) {
+	f, err := os.Open(sourcePath)
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	if info.IsDir() {
+		return "", nil
+	}
+
+	b, err := io.ReadAll(io.LimitReader(f, firstLineReadLimit))
+	if err != nil {
+		return "", err
+	}
+
+	text, ok := decodeText(b)
+	if !ok {
+		return "", nil
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.NewReplacer("/", "", `\`, "").Replace(line)
+
+		if line = strings.TrimSpace(line); line != "" {
+			return flattenText(line, length), nil
+		}
+	}
+
+	return "", nil
+}
+
+// replaceFirstLineVariables replaces {{firstline}} in the target with the
+// first non-empty line of the file. The line is truncated to the length
+// in the variable (e.g. {{firstline.30}}) or the default length.
+func replaceFirstLineVariables(target, sourcePath string) (string, error) {
+	var err error
+
+	lines := make(map[int]string)
+
+	target = firstLineRegex.ReplaceAllStringFunc(target, func(match string) string {
+		submatch := firstLineRegex.FindStringSubmatch(match)
+
+		length := defaultFirstLineLength
+		if submatch[1] != "" {
+			length, _ = strconv.Atoi(submatch[1])
+		}
+
+		if line, ok := lines[length]; ok {
+			return line
+		}
+
+		var line string
+
+		line, err = firstLine(sourcePath, length)
+		lines[length] = line
+
+		return line
+	})
+
+	return target, err
+}
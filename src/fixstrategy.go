@@ -0,0 +1,129 @@
+package f2
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fixStrategy determines how a conflicting target is changed when
+// conflicts are being fixed.
+type fixStrategy string
+
+const (
+	// fixStrategyDir moves the file into a directory named after the
+	// parent directory of its source (e.g. trip/photo.jpg).
+	fixStrategyDir fixStrategy = "dir"
+	// fixStrategyHash appends the first characters of the sha256 hash of
+	// the contents of the file to its name (e.g. photo_1a2b3c4d.jpg).
+	fixStrategyHash fixStrategy = "hash"
+	// fixStrategyNumber appends the next free number to the name of the
+	// file (e.g. photo (2).jpg). It always succeeds.
+	fixStrategyNumber fixStrategy = "number"
+)
+
+// fixHashLength is the number of characters of the hash that are used to
+// disambiguate a target.
+const fixHashLength = 8
+
+// parseFixStrategies parses a comma-separated list of fix strategies in
+// the order in which they are tried.
+func parseFixStrategies(input string) ([]fixStrategy, error) {
+	if input == "" {
+		return nil, nil
+	}
+
+	var strategies []fixStrategy
+
+	for _, v := range strings.Split(input, ",") {
+		s := fixStrategy(strings.TrimSpace(v))
+
+		switch s {
+		case fixStrategyDir, fixStrategyHash, fixStrategyNumber:
+		default:
+			return nil, fmt.Errorf("%w: '%s'", errInvalidFixStrategy, v)
+		}
+
+		strategies = append(strategies, s)
+	}
+
+	return strategies, nil
+}
+
+// strategyTarget returns the target of a change according to a strategy.
+// False is returned if the strategy cannot be applied to the change.
+func strategyTarget(ch *Change, strategy fixStrategy) (string, bool) {
+	dir, name := filepath.Split(ch.Target)
+
+	switch strategy {
+	case fixStrategyDir:
+		parent := filepath.Base(ch.BaseDir)
+		if parent == "." || parent == string(filepath.Separator) {
+			return "", false
+		}
+
+		return filepath.Join(dir, parent, name), true
+	case fixStrategyHash:
+		if ch.IsDir {
+			return "", false
+		}
+
+		sum, err := getHash(filepath.Join(ch.BaseDir, ch.Source), sha256Hash)
+		if err != nil {
+			return "", false
+		}
+
+		ext := filepath.Ext(name)
+
+		return filepath.Join(
+			dir,
+			strings.TrimSuffix(name, ext)+"_"+sum[:fixHashLength]+ext,
+		), true
+	}
+
+	return "", false
+}
+
+// fixTarget returns a target for a conflicting change using the first of
+// the fix strategies whose target is free, i.e. it does not exist on the
+// filesystem and is not the target of another change. The strategy is
+// recorded on the change so that it can be reported. The file is numbered
+// if no strategies are specified or none of them succeeds.
+func (op *Operation) fixTarget(ch *Change, renamedPaths map[string][]struct {
+	sourcePath string
+	index      int
+}) string {
+	for _, strategy := range op.fixStrategies {
+		if strategy == fixStrategyNumber {
+			break
+		}
+
+		target, ok := strategyTarget(ch, strategy)
+		if !ok {
+			continue
+		}
+
+		targetPath := filepath.Join(ch.BaseDir, target)
+
+		if _, taken := renamedPaths[targetPath]; taken {
+			continue
+		}
+
+		if _, err := os.Stat(targetPath); err == nil ||
+			!errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		ch.fixedBy = strategy
+
+		return target
+	}
+
+	if op.fixStrategies != nil {
+		ch.fixedBy = fixStrategyNumber
+	}
+
+	return newTarget(ch, renamedPaths)
+}
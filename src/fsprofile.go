@@ -0,0 +1,106 @@
+package f2
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+)
+
+// fsProfile describes the names that are allowed on a destination
+// filesystem so that the targets can be made valid for it regardless
+// of the filesystem that the files are renamed on.
+type fsProfile struct {
+	// forbidden matches the characters that are not allowed in a name
+	forbidden *regexp.Regexp
+	// maxLength is the maximum length of each name in the path
+	maxLength int
+	// utf16 reports whether the length is measured in UTF-16 code
+	// units instead of bytes
+	utf16 bool
+	// trimTrailing reports whether trailing periods and spaces are
+	// removed from each name
+	trimTrailing bool
+}
+
+// windowsFSProfile applies the rules that Windows enforces on FAT32,
+// exFAT and NTFS volumes.
+var windowsFSProfile = fsProfile{
+	forbidden:    regexp.MustCompile(`[<>:"|?*\\\x00-\x1f]`),
+	maxLength:    255,
+	utf16:        true,
+	trimTrailing: true,
+}
+
+// fsProfiles are the filesystems that can be specified with --target-fs.
+var fsProfiles = map[string]fsProfile{
+	"fat32": windowsFSProfile,
+	"exfat": windowsFSProfile,
+	"ntfs":  windowsFSProfile,
+	"ext4": {
+		forbidden: regexp.MustCompile(`\x00`),
+		maxLength: unixMaxBytes,
+	},
+}
+
+// length measures a name in the unit of the filesystem.
+func (p *fsProfile) length(name string) int {
+	if p.utf16 {
+		return len(utf16.Encode([]rune(name)))
+	}
+
+	return len(name)
+}
+
+// truncate shortens the name to the maximum length of the filesystem.
+// Characters are removed from the end of the name before the extension
+// and from the extension itself only if that is not enough.
+func (p *fsProfile) truncate(name string) string {
+	if p.length(name) <= p.maxLength {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	stem := []rune(strings.TrimSuffix(name, ext))
+
+	for len(stem) > 0 && p.length(string(stem)+ext) > p.maxLength {
+		stem = stem[:len(stem)-1]
+	}
+
+	r := []rune(string(stem) + ext)
+	for p.length(string(r)) > p.maxLength {
+		r = r[:len(r)-1]
+	}
+
+	return string(r)
+}
+
+// sanitize removes the forbidden characters from a name along with the
+// trailing periods and spaces if necessary before truncating it.
+func (p *fsProfile) sanitize(name string) string {
+	name = p.forbidden.ReplaceAllString(name, "")
+
+	if p.trimTrailing {
+		name = strings.TrimRight(name, ". ")
+	}
+
+	return p.truncate(name)
+}
+
+// applyFSProfile makes each name in the target paths valid on the
+// filesystem specified with --target-fs.
+func (op *Operation) applyFSProfile() {
+	for i := range op.matches {
+		names := strings.Split(filepath.ToSlash(op.matches[i].Target), "/")
+
+		for j, name := range names {
+			if name == "" || name == "." || name == ".." {
+				continue
+			}
+
+			names[j] = op.fsProfile.sanitize(name)
+		}
+
+		op.matches[i].Target = filepath.FromSlash(strings.Join(names, "/"))
+	}
+}
@@ -0,0 +1,66 @@
+package f2
+
+// excludedStatuses are the statuses of the files
+// that are left unchanged by the operation.
+var excludedStatuses = map[changeStatus]bool{
+	statusUnchanged:  true,
+	statusMismatched: true,
+	statusSkipped:    true,
+	statusFailed:     true,
+}
+
+// numberIndex returns the index used by the numbering variables for the
+// match at the specified position. It is the position itself unless the
+// matches have been renumbered with `--gapless-index`.
+func (op *Operation) numberIndex(i int) int {
+	if i < len(op.sequence) {
+		return op.sequence[i]
+	}
+
+	return i
+}
+
+// renumber resolves the targets again from the original matches so that
+// the indices are only assigned to the files that will be renamed. Files
+// that are left unchanged (e.g. skipped by the overwrite policy) keep
+// their original index so that they remain unchanged. Nothing happens if
+// every file will be renamed.
+func (op *Operation) renumber(original []Change) error {
+	resolved := append([]Change(nil), op.matches...)
+
+	// the overwrite policy is applied when conflicts are detected
+	op.detectConflicts()
+
+	sequence := make([]int, len(op.matches))
+	excluded := false
+	n := 0
+
+	for i := range op.matches {
+		if excludedStatuses[op.changeStatus(&op.matches[i])] {
+			sequence[i] = op.matches[i].index
+			excluded = true
+
+			continue
+		}
+
+		sequence[i] = n
+		n++
+	}
+
+	op.conflicts = nil
+
+	if !excluded {
+		op.matches = resolved
+		return nil
+	}
+
+	op.matches = original
+	op.sequence = sequence
+
+	err := op.setFindStringRegex(0)
+	if err != nil {
+		return err
+	}
+
+	return op.resolveTargets()
+}
@@ -0,0 +1,132 @@
+package f2
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// jsonSidecarPatterns are the paths checked for the JSON sidecar of a file
+// if no pattern is specified with the `--json-sidecar` flag.
+var jsonSidecarPatterns = []string{"{name}.json", "{stem}.json"}
+
+// jsonSidecarPath returns the path to the JSON sidecar of a file or an
+// empty string if it does not exist. In each pattern, {name} is replaced
+// with the file name and {stem} with the file name without the extension.
+// Relative patterns are resolved from the directory of the file.
+func (op *Operation) jsonSidecarPath(sourcePath string) (string, error) {
+	patterns := jsonSidecarPatterns
+	if op.jsonSidecar != "" {
+		patterns = []string{op.jsonSidecar}
+	}
+
+	dir, name := filepath.Split(sourcePath)
+
+	for _, p := range patterns {
+		p = strings.ReplaceAll(p, "{name}", name)
+		p = strings.ReplaceAll(p, "{stem}", filenameWithoutExtension(name))
+
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	return "", nil
+}
+
+// readJSONSidecar decodes the JSON sidecar of a file. Nil is returned
+// if the file does not have a sidecar.
+func (op *Operation) readJSONSidecar(sourcePath string) (interface{}, error) {
+	path, err := op.jsonSidecarPath(sourcePath)
+	if err != nil || path == "" {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var data interface{}
+
+	decoder := json.NewDecoder(f)
+	decoder.UseNumber()
+
+	err = decoder.Decode(&data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// lookupJSONPath resolves a dotted key path (e.g. 'album.tracks.0.title')
+// in decoded JSON data. Numeric keys index into arrays. False is returned
+// if the key is missing or does not refer to a string, number, or boolean.
+func lookupJSONPath(data interface{}, path string) (string, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch v := data.(type) {
+		case map[string]interface{}:
+			value, ok := v[key]
+			if !ok {
+				return "", false
+			}
+
+			data = value
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", false
+			}
+
+			data = v[i]
+		default:
+			return "", false
+		}
+	}
+
+	switch v := data.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+
+	return "", false
+}
+
+// replaceJSONVariables replaces {{json.<key path>}} in the target with the
+// corresponding value in the JSON sidecar of the file. Missing keys are
+// replaced with the default value after '|' (e.g. {{json.artist|Unknown}})
+// or an empty string.
+func (op *Operation) replaceJSONVariables(
+	target, sourcePath string,
+) (string, error) {
+	data, err := op.readJSONSidecar(sourcePath)
+	if err != nil {
+		return target, err
+	}
+
+	return jsonRegex.ReplaceAllStringFunc(target, func(match string) string {
+		submatch := jsonRegex.FindStringSubmatch(match)
+
+		if value, ok := lookupJSONPath(data, submatch[1]); ok {
+			return value
+		}
+
+		return submatch[2]
+	}), nil
+}
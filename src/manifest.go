@@ -0,0 +1,73 @@
+package f2
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// loadManifest reads the manifest file which is a CSV file in which the
+// first column is the expected hash of a file's contents and the second
+// column is the name that the file should be renamed to. Hashes are
+// matched case-insensitively.
+func (op *Operation) loadManifest() error {
+	records, err := readCSVFile(op.manifestFilename)
+	if err != nil {
+		return err
+	}
+
+	op.manifest = make(map[string]string)
+
+	for i, v := range records {
+		minColumns := 2
+		if len(v) < minColumns {
+			return fmt.Errorf("row %d must have a hash and target", i+1)
+		}
+
+		hash := strings.ToLower(strings.TrimSpace(v[0]))
+		target := strings.TrimSpace(v[1])
+
+		if hash == "" || target == "" {
+			return fmt.Errorf("row %d must have a hash and target", i+1)
+		}
+
+		op.manifest[hash] = target
+	}
+
+	return nil
+}
+
+// manifestTarget retrieves the target listed in the manifest for the hash
+// of a file's contents. False is returned if the hash is not in the
+// manifest which means that the file failed verification.
+func (op *Operation) manifestTarget(ch *Change) (string, bool, error) {
+	sourcePath := filepath.Join(ch.BaseDir, ch.originalSource)
+
+	files, err := op.hashSources(sourcePath)
+	if err != nil {
+		return "", false, err
+	}
+
+	hash, err := getFilesHash(files, op.manifestHash, 0)
+	if err != nil {
+		return "", false, err
+	}
+
+	target, ok := op.manifest[hash]
+
+	return target, ok, nil
+}
+
+// checksumMismatches returns the number of files that were
+// left unchanged because they failed manifest verification.
+func (op *Operation) checksumMismatches() int {
+	var count int
+
+	for i := range op.matches {
+		if op.matches[i].mismatched {
+			count++
+		}
+	}
+
+	return count
+}
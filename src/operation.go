@@ -7,21 +7,24 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/adrg/xdg"
+	exiftool "github.com/barasher/go-exiftool"
 	"github.com/pterm/pterm"
 	"github.com/urfave/cli/v2"
 )
 
 var (
 	errInvalidArgument = errors.New(
-		"Invalid argument: one of `-f`, `-r`, `-csv` or `-u` must be present and set to a non empty string value. Use 'f2 --help' for more information",
+		"Invalid argument: one of `-f`, `-r`, `-csv`, `--date-tree`, `--fix-ext` or `-u` must be present and set to a non empty string value. Use 'f2 --help' for more information",
 	)
 
 	errInvalidSimpleModeArgs = errors.New(
@@ -34,9 +37,169 @@ var (
 
 	errCSVReadFailed = errors.New("Unable to read CSV file")
 
+	errInvalidCSVKey = errors.New(
+		"Invalid CSV key: must be a column number starting from 1",
+	)
+
+	errInvalidCSVMatch = errors.New(
+		"Invalid CSV match type: must be one of 'equals', 'contains', or 'regex'",
+	)
+
+	errInvalidCSVMissing = errors.New(
+		"Invalid CSV missing policy: must be one of 'empty' or 'skip'",
+	)
+
+	errOverridesReadFailed = errors.New("Unable to read overrides file")
+
+	errPathsReadFailed = errors.New("Unable to read paths")
+
+	errExtMapReadFailed = errors.New("Unable to read extension map file")
+
+	errMakeMapReadFailed = errors.New("Unable to read make map file")
+
+	errExtFoldersReadFailed = errors.New("Unable to read extension folders file")
+
+	errInvalidExtFolder = errors.New(
+		"Invalid folder: must be a relative path within the directory of the file",
+	)
+
+	errManifestReadFailed = errors.New("Unable to read manifest file")
+
+	errInvalidManifestHash = errors.New(
+		"Invalid manifest hash: must be one of 'sha1', 'sha256', 'sha512', or 'md5'",
+	)
+
 	errBackupNotFound = errors.New(
 		"Unable to find the backup file for the current directory",
 	)
+
+	errPlanUndo = errors.New("An undo operation cannot be planned")
+
+	errRenameFailed = errors.New("Some files could not be renamed")
+
+	errRollbackFailed = errors.New(
+		"Unable to revert a change after another change failed",
+	)
+
+	errExecRequired = errors.New(
+		"The plan was not applied because the -x flag is required to rename the files",
+	)
+
+	errInvalidScriptShell = errors.New(
+		"Invalid script shell: must be one of 'posix' or 'powershell'",
+	)
+
+	errInvalidOverwritePolicy = errors.New(
+		"Invalid overwrite policy: must be one of 'skip', 'overwrite', or 'backup'",
+	)
+
+	errInvalidSiblingPolicy = errors.New(
+		"Invalid sibling policy: must be one of 'empty' or 'skip'",
+	)
+
+	errInvalidSiblingPattern = errors.New("Invalid sibling pattern")
+
+	errInvalidContentMatch = errors.New("Invalid content pattern")
+
+	errCycleReverted = errors.New(
+		"Reverted since another file in the same rename cycle could not be renamed",
+	)
+
+	errCycleRevertFailed = errors.New(
+		"Unable to revert a rename cycle that could not be completed",
+	)
+
+	errTargetNotVacated = errors.New(
+		"Target belongs to another file that was not renamed",
+	)
+
+	errInvalidFixStrategy = errors.New(
+		"Invalid fix strategy: must be a comma-separated list of 'dir', 'hash', or 'number'",
+	)
+
+	errInvalidCrossDevicePolicy = errors.New(
+		"Invalid cross-device policy: must be one of 'error' or 'copy'",
+	)
+
+	errCrossDeviceDir = errors.New(
+		"Directories cannot be moved across devices",
+	)
+
+	errCopyDir = errors.New("Directories cannot be copied")
+
+	errInvalidChunkSize = errors.New(
+		"Invalid chunk size: must be a positive integer",
+	)
+
+	errInvalidTrimCount = errors.New(
+		"Invalid trim count: must be zero or a positive integer",
+	)
+
+	errTrimOutOfRange = errors.New(
+		"The trim count is out of range for the file name",
+	)
+
+	errInvalidRenumberWidth = errors.New(
+		"Invalid renumber width: must be zero or a positive integer",
+	)
+
+	errRenumberOptions = errors.New(
+		"--renumber cannot be used with a replacement, a sort, or more than one find pattern",
+	)
+
+	errInvalidSort = errors.New(
+		"Invalid sort: must be one of 'default', 'size', 'mtime', 'btime', 'atime', 'ctime', or 'exifdate'",
+	)
+
+	errInvalidDateTree = errors.New(
+		"Invalid date tree: must be one of 'year', 'month', or 'day'",
+	)
+
+	errInvalidDateTreeSource = errors.New(
+		"Invalid date tree source: must be one of 'exif', 'mtime', 'btime', 'atime', or 'ctime'",
+	)
+
+	errInvalidTargetFS = errors.New(
+		"Invalid target filesystem: must be one of 'fat32', 'exfat', 'ntfs', or 'ext4'",
+	)
+
+	errInvalidKeepCategories = errors.New("Invalid Unicode category")
+
+	errInvalidPadChar = errors.New(
+		"Invalid pad character: must be a single character other than a path separator",
+	)
+
+	errInvalidPadSide = errors.New(
+		"Invalid pad side: must be one of 'left' or 'right'",
+	)
+
+	errInvalidExiftoolOpt = errors.New(
+		"Invalid exiftool option: must be one of '-api <value>', '-charset <value>', '-ee', or '-n'",
+	)
+
+	errInvalidDateSeqStart = errors.New(
+		"Invalid date sequence start: must be a date such as '2021-05-01' or '2021-05-01T09:30'",
+	)
+
+	errInvalidDateSeqStep = errors.New(
+		"Invalid date sequence step: must be a number of hours, days, or weeks (e.g. '12h', '1d', '2w')",
+	)
+
+	errInvalidArtLabels = errors.New(
+		"Invalid art labels: must be two labels separated by a comma",
+	)
+
+	errInvalidExifOffset = errors.New(
+		"Invalid exif offset: must be a timezone offset such as '+01:00' or '-05:30'",
+	)
+
+	errInvalidByteSize = errors.New(
+		"Invalid size: must be a number of bytes with an optional suffix such as 'k', 'M', 'G', or 'T'",
+	)
+
+	errInvalidAgeBuckets = errors.New(
+		"Invalid age buckets: must be a comma-separated list of 'today' or durations such as '12h', '7d', or '2w'",
+	)
 )
 
 const (
@@ -48,16 +211,69 @@ const (
 	dotCharacter = 46
 )
 
+const (
+	padLeft  = "left"
+	padRight = "right"
+)
+
+// deterministicSeed is the seed of the random number generator
+// when the `--deterministic` flag is set.
+const deterministicSeed = 1
+
+// deterministicTime is used as the current time when the
+// `--deterministic` flag is set.
+var deterministicTime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// overwritePolicy determines what happens when the target of a
+// change is an existing file that is not part of the operation.
+type overwritePolicy string
+
+const (
+	overwritePolicySkip      overwritePolicy = "skip"
+	overwritePolicyOverwrite overwritePolicy = "overwrite"
+	overwritePolicyBackup    overwritePolicy = "backup"
+)
+
+// crossDevicePolicy determines what happens when the target of a change
+// is on a different device from the source.
+type crossDevicePolicy string
+
+const (
+	crossDevicePolicyError crossDevicePolicy = "error"
+	crossDevicePolicyCopy  crossDevicePolicy = "copy"
+)
+
+// siblingPolicy determines what happens to a file whose target contains
+// {{sibling.name}} when no sibling matches the configured rule.
+type siblingPolicy string
+
+const (
+	siblingPolicyEmpty siblingPolicy = "empty"
+	siblingPolicySkip  siblingPolicy = "skip"
+)
+
 // Change represents a single filename change.
 type Change struct {
 	index          int
 	originalSource string
 	csvRow         []string
-	BaseDir        string `json:"base_dir"`
-	Source         string `json:"source"`
-	Target         string `json:"target"`
-	IsDir          bool   `json:"is_dir"`
-	WillOverwrite  bool   `json:"-"`
+	action         overwritePolicy // applied to an existing target
+	backupPath     string          // where an existing target is moved to
+	captures       [][]string      // find pattern submatches in each pass
+	crossDevice    bool            // the target is on a different device
+	streams        []string        // alternate data streams (Windows only)
+	correctExt     string          // the extension that matches the content
+	segments       []string        // renamed directories below the search root
+	tempOut        bool            // moves the source to a temporary name
+	tempFor        string          // the source moved to a temporary name
+	mismatched     bool            // the content hash is not in the manifest
+	fixedBy        fixStrategy     // how a conflicting target was changed
+	err            error           // the target could not be resolved
+	BaseDir        string          `json:"base_dir"`
+	Source         string          `json:"source"`
+	Target         string          `json:"target"`
+	IsDir          bool            `json:"is_dir"`
+	WillOverwrite  bool            `json:"-"`
 }
 
 // renameError represents an error that occurs when
@@ -67,6 +283,47 @@ type renameError struct {
 	err   error
 }
 
+// fileError records that the target of the change at the specified index
+// could not be resolved. The error is returned unless the `--no-op-on-error`
+// flag is set, in which case the file is left unchanged and the error is
+// reported alongside the other changes.
+func (op *Operation) fileError(i int, ch Change, err error) error {
+	if !op.noOpOnError {
+		return err
+	}
+
+	ch.err = err
+	ch.Target = ch.Source
+	op.matches[i] = ch
+	op.reportProgress(i)
+
+	return nil
+}
+
+// resetFailedTargets restores the target of each file whose target
+// could not be resolved since later steps may have modified it.
+func (op *Operation) resetFailedTargets() {
+	for i, ch := range op.matches {
+		if ch.err != nil {
+			op.matches[i].Target = ch.Source
+		}
+	}
+}
+
+// failedTargets returns the errors of the files whose
+// target could not be resolved.
+func (op *Operation) failedTargets() []error {
+	var errs []error
+
+	for i := range op.matches {
+		if op.matches[i].err != nil {
+			errs = append(errs, op.matches[i].err)
+		}
+	}
+
+	return errs
+}
+
 // Operation represents a batch renaming operation.
 type Operation struct {
 	paths              []Change
@@ -78,27 +335,110 @@ type Operation struct {
 	startNumber        int
 	exec               bool
 	fixConflicts       bool
+	fixStrategies      []fixStrategy
 	includeHidden      bool
 	includeDir         bool
 	onlyDir            bool
 	ignoreCase         bool
 	ignoreExt          bool
+	preserveExt        bool
 	searchRegex        *regexp.Regexp
 	pathsToFilesOrDirs []string
 	recursive          bool
 	workingDir         string
 	stringLiteralMode  bool
+	goTemplate         bool
 	excludeFilter      []string
+	excludePathFilter  []string
 	maxDepth           int
 	sort               string
 	reverseSort        bool
+	keepOrder          bool
+	undatedFirst       bool
+	unratedZero        bool
+	normalizeVariables bool
+	aliases            map[string]string
+	debugVariables     bool
+	rng                *rand.Rand
+	destRoot           string
+	overwritePolicy    overwritePolicy
 	errors             []renameError
 	revert             bool
-	numberOffset       []int
 	replaceLimit       int
 	allowOverwrites    bool
 	verbose            bool
 	csvFilename        string
+	overridesFilename  string
+	overrides          map[string]string
+	pathsFrom          string
+	nullDelimited      bool
+	siblingExt         string
+	siblingPattern     *regexp.Regexp
+	siblingPolicy      siblingPolicy
+	dateTree           string
+	dateTreeSource     string
+	confirm            ConfirmFunc
+	progress           ProgressFunc
+	content            ContentFunc
+	pass               int
+	hashSidecar        string
+	hashHead           int64
+	dirCountHidden     bool
+	dirCounts          map[string]int
+	dirIndexes         []int
+	crossDevicePolicy  crossDevicePolicy
+	copyMode           bool
+	interactiveEdit    bool
+	preserveStreams    bool
+	noMatchError       bool
+	copiedBytes        int64
+	copyTotalBytes     int64
+	trimStart          int
+	trimEnd            int
+	padWidth           int
+	padChar            rune
+	padSide            string
+	fixExt             bool
+	extMapFilename     string
+	extensionMap       map[string][]string
+	segmentMode        bool
+	makeMapFilename    string
+	exifOffset         *time.Location
+	contentMatch       *regexp.Regexp
+	contentMatchLimit  int64
+	skipBinary         bool
+	makeMap            map[string]string
+	caseConflicts      bool
+	ageBuckets         []ageBucket
+	artLabels          [2]string
+	dateSeqStart       time.Time
+	dateSeqStep        dateSeqStep
+	jsonSidecar        string
+	tempRenames        int
+	stranded           []string
+	manifestFilename   string
+	manifest           map[string]string
+	manifestHash       hashAlgorithm
+	symbolFilter       *symbolFilter
+	fsProfile          *fsProfile
+	exiftoolOpts       []func(*exiftool.Exiftool) error
+	csvKey             int
+	csvMatch           csvMatchType
+	csvMissing         csvMissingPolicy
+	csvRows            [][]string
+	csvPatterns        []*regexp.Regexp
+	noOpOnError        bool
+	timestampSuffix    bool
+	gaplessIndex       bool
+	renumberSeries     bool
+	renumberWidth      int
+	extFoldersFilename string
+	extFolders         map[string]string
+	extFolderDefault   string
+	sequence           []int
+	now                time.Time
+	roots              []string
+	chunkSize          int
 	quiet              bool
 	writer             io.Writer
 	reader             io.Reader
@@ -129,7 +469,7 @@ func (op *Operation) writeToFile(outputFile string) (err error) {
 
 	mf := backupFile{
 		WorkingDir: op.workingDir,
-		Date:       time.Now().Format(time.RFC3339),
+		Date:       op.now.Format(time.RFC3339),
 		Operations: op.matches,
 	}
 
@@ -208,13 +548,27 @@ func (op *Operation) printChanges() {
 		source := filepath.Join(v.BaseDir, v.Source)
 		target := filepath.Join(v.BaseDir, v.Target)
 
-		status := pterm.Green("ok")
-		if source == target {
-			status = pterm.Yellow("unchanged")
-		}
-
-		if v.WillOverwrite {
-			status = pterm.Yellow("overwriting")
+		var status string
+
+		switch s := op.changeStatus(&op.matches[i]); s {
+		case statusOK:
+			status = pterm.Green(s)
+		case statusMismatched:
+			status = pterm.Red(s)
+		case statusFailed:
+			status = pterm.Red(string(s) + ": " + v.err.Error())
+		case statusBackup:
+			status = pterm.Yellow(
+				string(s) + " to " + filepath.Base(v.backupPath),
+			)
+		case statusFixed:
+			status = pterm.Yellow(string(s) + " by " + string(v.fixedBy))
+		case statusStreams:
+			status = pterm.Yellow(
+				string(s) + ": " + strings.Join(v.streams, ", "),
+			)
+		default:
+			status = pterm.Yellow(s)
 		}
 
 		d := []string{source, target, status}
@@ -232,40 +586,52 @@ func (op *Operation) rename() {
 
 	renamed := []Change{}
 
+	if op.copyMode {
+		op.copyTotalBytes = op.copySize()
+	}
+
+	// kept contains the paths of the files that remain in place
+	// so that they are not overwritten by another file in the batch
+	kept := make(map[string]bool)
+
+	// cycle contains the steps of a cycle that were applied since its first
+	// file was moved to a temporary name so that they can be reverted if
+	// the cycle cannot be completed
+	var cycle []Change
+
+renameLoop:
 	for _, ch := range op.matches {
 		var source, target = ch.Source, ch.Target
 		source = filepath.Join(ch.BaseDir, source)
 		target = filepath.Join(ch.BaseDir, target)
 
 		// skip unchanged file names
-		if source == target {
+		if source == target || ch.action == overwritePolicySkip {
 			continue
 		}
 
-		renameErr := renameError{
-			entry: ch,
-		}
-
-		// If target contains a slash, create all missing
-		// directories before renaming the file
-		if strings.Contains(ch.Target, "/") ||
-			strings.Contains(ch.Target, `\`) && runtime.GOOS == windows {
-			// No need to check if the `dir` exists or if there are several
-			// consecutive slashes since `os.MkdirAll` handles that
-			dir := filepath.Dir(ch.Target)
-
-			err := os.MkdirAll(filepath.Join(ch.BaseDir, dir), 0750)
-			if err != nil {
-				renameErr.err = err
-				errs = append(errs, renameErr)
+		if op.confirm != nil {
+			switch op.confirm(ch) {
+			case ConfirmApply:
+			case ConfirmSkip:
+				kept[source] = true
+
+				// the other files in the cycle are moved back since
+				// this one cannot reach its target
+				if ch.tempFor != "" {
+					errs = append(errs, op.revertCycle(cycle, &renamed)...)
+					cycle = nil
+				}
 
 				continue
+			case ConfirmAbort:
+				break renameLoop
 			}
 		}
 
-		if err := os.Rename(source, target); err != nil {
-			renameErr.err = err
-			errs = append(errs, renameErr)
+		err := op.renameFile(ch, source, target, kept)
+		if err != nil {
+			kept[source] = true
 
 			if op.verbose {
 				pterm.Error.Printfln(
@@ -274,17 +640,149 @@ func (op *Operation) rename() {
 					target,
 				)
 			}
+		} else if op.verbose && op.copyMode {
+			pterm.Success.Printfln("Copied %s to %s", source, target)
+		} else if op.verbose && ch.crossDevice {
+			pterm.Success.Printfln("Moved %s to %s across devices", source, target)
 		} else if op.verbose {
 			pterm.Success.Printfln("Renamed %s to %s", source, target)
 		}
 
+		switch {
+		case ch.tempOut:
+			if err != nil {
+				errs = append(errs, renameError{entry: ch, err: err})
+			} else {
+				cycle = []Change{ch}
+			}
+
+			// a file moved to a temporary name is recorded once it
+			// reaches its target so that the operation can be undone
+			// as usual
+			continue
+		case ch.tempFor != "":
+			if err != nil {
+				ch.Source = ch.tempFor
+				errs = append(errs, renameError{entry: ch, err: err})
+				errs = append(errs, op.revertCycle(cycle, &renamed)...)
+				cycle = nil
+
+				continue
+			}
+
+			cycle = nil
+			ch.Source = ch.tempFor
+		case err != nil:
+			errs = append(errs, renameError{entry: ch, err: err})
+
+			continue
+		case cycle != nil:
+			cycle = append(cycle, ch)
+		}
+
 		renamed = append(renamed, ch)
 	}
 
+	// an aborted operation must not leave a file at a temporary name
+	errs = append(errs, op.revertCycle(cycle, &renamed)...)
+
 	op.matches = renamed
 	op.errors = errs
 }
 
+// renameFile renames the source of a change to its target. The target
+// must not be a file that remains in place, and any missing directories
+// in the target are created first.
+func (op *Operation) renameFile(
+	ch Change,
+	source, target string,
+	kept map[string]bool,
+) error {
+	if kept[target] {
+		return errTargetNotVacated
+	}
+
+	// Move the existing file out of the way
+	if ch.action == overwritePolicyBackup {
+		if err := os.Rename(target, ch.backupPath); err != nil {
+			return err
+		}
+	}
+
+	// If target contains a slash, create all missing
+	// directories before renaming the file
+	if strings.Contains(ch.Target, "/") ||
+		strings.Contains(ch.Target, `\`) && runtime.GOOS == windows {
+		// No need to check if the `dir` exists or if there are several
+		// consecutive slashes since `os.MkdirAll` handles that
+		dir := filepath.Dir(ch.Target)
+
+		err := os.MkdirAll(filepath.Join(ch.BaseDir, dir), 0750)
+		if err != nil {
+			return err
+		}
+	}
+
+	rename := os.Rename
+	if ch.crossDevice {
+		rename = moveAcrossDevices
+	}
+
+	if op.copyMode {
+		rename = op.copyToTarget
+	}
+
+	return rename(source, target)
+}
+
+// revertCycle undoes the steps of a rename cycle that could not be
+// completed in reverse order and moves the file at the temporary name
+// back to its source so that no file is left at a temporary name. The
+// reverted steps are removed from the renamed changes and reported as
+// errors. If a step cannot be reverted, the files that remain at a
+// temporary name are recorded in the stranded paths.
+func (op *Operation) revertCycle(cycle []Change, renamed *[]Change) []renameError {
+	if len(cycle) == 0 {
+		return nil
+	}
+
+	var errs []renameError
+
+	for i := len(cycle) - 1; i >= 0; i-- {
+		ch := cycle[i]
+		source := filepath.Join(ch.BaseDir, ch.Source)
+		target := filepath.Join(ch.BaseDir, ch.Target)
+
+		err := os.Rename(target, source)
+		if err != nil {
+			temp := filepath.Join(cycle[0].BaseDir, cycle[0].Target)
+			op.stranded = append(op.stranded, temp)
+
+			return append(errs, renameError{
+				entry: ch,
+				err:   fmt.Errorf("%w: %s", errCycleRevertFailed, err.Error()),
+			})
+		}
+
+		// the temporary move is not part of the renamed changes
+		if i == 0 {
+			break
+		}
+
+		for j := len(*renamed) - 1; j >= 0; j-- {
+			r := (*renamed)[j]
+			if r.BaseDir == ch.BaseDir && r.Target == ch.Target {
+				*renamed = append((*renamed)[:j], (*renamed)[j+1:]...)
+				break
+			}
+		}
+
+		errs = append(errs, renameError{entry: ch, err: errCycleReverted})
+	}
+
+	return errs
+}
+
 // reportErrors displays the errors that occur during a renaming operation.
 func (op *Operation) reportErrors() {
 	var data = make([][]string, len(op.errors)+len(op.matches))
@@ -316,11 +814,9 @@ func (op *Operation) reportErrors() {
 	printTable(data, op.writer)
 }
 
-// handleErrors is used to report the errors and write any successful
-// operations to a file.
-func (op *Operation) handleErrors() error {
-	// first remove the error entries from the matches so they are not confused
-	// with successful operations
+// removeFailed removes the error entries from the matches so they are not
+// confused with successful operations.
+func (op *Operation) removeFailed() {
 	for _, v := range op.errors {
 		target := v.entry.Target
 		for j := len(op.matches) - 1; j >= 0; j-- {
@@ -329,16 +825,26 @@ func (op *Operation) handleErrors() error {
 			}
 		}
 	}
+}
+
+// handleErrors is used to report the errors and write any successful
+// operations to a file.
+func (op *Operation) handleErrors() error {
+	op.removeFailed()
 
 	op.reportErrors()
 
 	var err error
-	if len(op.matches) > 0 && !op.revert {
+	if len(op.matches) > 0 && !op.revert && !op.copyMode {
 		err = op.backup()
 	}
 
 	msg := "Some files could not be renamed. To revert the changes, run: f2 -u"
 
+	if op.copyMode {
+		msg = "Some files could not be copied. See above table for the full explanation."
+	}
+
 	if op.revert {
 		msg = "Some files could not be reverted. See above table for the full explanation."
 	}
@@ -381,21 +887,63 @@ func (op *Operation) noMatches() {
 	pterm.Info.Println(msg)
 }
 
+// commit renames the matches on the filesystem in an order that avoids
+// overwriting each other without reporting the outcome.
+func (op *Operation) commit() {
+	if op.includeDir || op.revert {
+		op.sortMatches()
+	}
+
+	op.planRenames()
+
+	op.rename()
+}
+
 // execute applies the renaming operation to the filesystem.
 // A backup file is auto created as long as at least one file
 // was renamed and it wasn't an undo operation.
 func (op *Operation) execute() error {
-	if op.includeDir || op.revert {
-		op.sortMatches()
+	op.commit()
+
+	if op.tempRenames > 0 {
+		pterm.Info.Printfln(
+			"%d file(s) were moved through a temporary name to resolve rename cycles",
+			op.tempRenames,
+		)
 	}
 
-	op.rename()
+	if mismatches := op.checksumMismatches(); mismatches > 0 {
+		pterm.Warning.Printfln(
+			"%d file(s) were not renamed because their checksum is not in the manifest",
+			mismatches,
+		)
+	}
+
+	if len(op.stranded) > 0 {
+		pterm.Warning.Printfln(
+			"%d file(s) could not be moved back from a temporary name: %s",
+			len(op.stranded),
+			strings.Join(op.stranded, ", "),
+		)
+	}
+
+	if failed := op.failedTargets(); len(failed) > 0 {
+		pterm.Warning.Printfln(
+			"%d file(s) were not renamed because their target could not be resolved",
+			len(failed),
+		)
+	}
 
 	if len(op.errors) > 0 {
 		return op.handleErrors()
 	}
 
+	// copies cannot be undone since the originals are left in place
 	if len(op.matches) > 0 && !op.revert {
+		if op.copyMode {
+			return nil
+		}
+
 		return op.backup()
 	}
 
@@ -410,6 +958,7 @@ func (op *Operation) execute() error {
 func (op *Operation) dryRun() {
 	if !op.quiet {
 		op.printChanges()
+		pterm.Info.Println(op.summarize())
 	}
 
 	pterm.Info.Printfln(
@@ -424,6 +973,11 @@ func (op *Operation) dryRun() {
 func (op *Operation) apply() error {
 	if len(op.matches) == 0 {
 		op.noMatches()
+
+		if op.noMatchError && !op.revert {
+			return ErrNoMatches
+		}
+
 		return nil
 	}
 
@@ -435,7 +989,8 @@ func (op *Operation) apply() error {
 		return errConflictDetected
 	}
 
-	if op.simpleMode {
+	// Each change is confirmed individually instead
+	if op.simpleMode && op.confirm == nil {
 		op.printChanges()
 
 		if op.writer == os.Stdout {
@@ -493,6 +1048,11 @@ func (op *Operation) findMatches() error {
 			f = filenameWithoutExtension(f)
 		}
 
+		// directories are renamed through the paths of their contents
+		if op.segmentMode && v.IsDir {
+			continue
+		}
+
 		matched := op.searchRegex.MatchString(f)
 		if matched {
 			op.matches = append(op.matches, v)
@@ -525,6 +1085,50 @@ func (op *Operation) filterMatches() error {
 	return nil
 }
 
+// relativePath returns the path to the source of a change relative to the
+// current working directory. Forward slashes are used as the path separator
+// on all platforms, and the path is left absolute if it cannot be made
+// relative to the working directory (e.g. on a different volume).
+func (op *Operation) relativePath(ch *Change) string {
+	path := filepath.Join(ch.BaseDir, ch.Source)
+
+	if absPath, err := filepath.Abs(path); err == nil {
+		if rel, err := filepath.Rel(op.workingDir, absPath); err == nil {
+			path = rel
+		}
+	}
+
+	return filepath.ToSlash(path)
+}
+
+// filterPaths excludes any files or directories whose relative path
+// (see relativePath) matches one of the provided exclude path patterns.
+// The patterns are not anchored implicitly, so `^` and `$` must be used to
+// match the start and end of the relative path respectively.
+func (op *Operation) filterPaths() error {
+	patterns := make([]string, len(op.excludePathFilter))
+	for i, v := range op.excludePathFilter {
+		patterns[i] = "(?:" + v + ")"
+	}
+
+	regex, err := regexp.Compile(strings.Join(patterns, "|"))
+	if err != nil {
+		return err
+	}
+
+	var filtered []Change
+
+	for i := range op.paths {
+		if !regex.MatchString(op.relativePath(&op.paths[i])) {
+			filtered = append(filtered, op.paths[i])
+		}
+	}
+
+	op.paths = filtered
+
+	return nil
+}
+
 // setPaths creates a Change struct for each path.
 func (op *Operation) setPaths(paths map[string][]os.DirEntry) {
 	if op.exec {
@@ -536,7 +1140,7 @@ func (op *Operation) setPaths(paths map[string][]os.DirEntry) {
 
 	// Don't bother sorting the paths in alphabetical order
 	// if a different sort has been set that's not the default
-	if op.sort != "" && op.sort != "default" {
+	if op.sort != "" && op.sort != defaultSort {
 		op.paths = op.sortPaths(paths, false)
 		return
 	}
@@ -578,6 +1182,7 @@ func (op *Operation) retrieveBackupFile() (string, error) {
 func (op *Operation) handleReplacementChain() error {
 	for i, v := range op.replacementSlice {
 		op.replacement = v
+		op.pass = i
 
 		err := op.replace()
 		if err != nil {
@@ -609,44 +1214,298 @@ func (op *Operation) handleReplacementChain() error {
 	return nil
 }
 
-// run executes the operation sequence.
-func (op *Operation) run() error {
-	if op.revert {
-		path, err := op.retrieveBackupFile()
-		if err != nil {
-			return errBackupNotFound
+// preserveExtensions replaces the extension in the target of each file
+// with the exact extension of its source (including its case) so that
+// only the rest of the name is changed by the replacement. The extension
+// is appended if the target does not have one. Directories and unchanged
+// files are skipped.
+func (op *Operation) preserveExtensions() {
+	for i, ch := range op.matches {
+		if ch.IsDir || ch.err != nil || ch.Target == ch.Source {
+			continue
 		}
 
-		return op.undo(path)
-	}
-
-	err := op.findMatches()
-	if err != nil {
-		return err
+		target := strings.TrimSuffix(ch.Target, filepath.Ext(ch.Target))
+		op.matches[i].Target = target + filepath.Ext(ch.Source)
 	}
+}
 
-	if len(op.excludeFilter) != 0 {
-		err = op.filterMatches()
-		if err != nil {
-			return err
+// trimTargets removes the number of characters specified with the
+// `--trim-start` and `--trim-end` flags from the start and end of the
+// file name in each target. The extension and any directories in the target
+// are preserved. An error is returned if the counts leave nothing of a file
+// name unless the file is to be skipped with --no-op-on-error.
+func (op *Operation) trimTargets() error {
+	for i, ch := range op.matches {
+		if ch.err != nil {
+			continue
 		}
-	}
 
-	if op.sort != "" {
-		err = op.sortBy()
+		dir, base := filepath.Split(ch.Target)
+		ext := filepath.Ext(base)
+		name := []rune(strings.TrimSuffix(base, ext))
+
+		if op.trimStart+op.trimEnd >= len(name) {
+			err := fmt.Errorf(
+				"%w: '%s' (%d characters)",
+				errTrimOutOfRange,
+				filepath.Join(ch.BaseDir, ch.Source),
+				len(name),
+			)
+			if !op.noOpOnError {
+				return err
+			}
+
+			op.matches[i].err = err
+
+			continue
+		}
+
+		name = name[op.trimStart : len(name)-op.trimEnd]
+
+		op.matches[i].Target = dir + string(name) + ext
+	}
+
+	return nil
+}
+
+// padTargets pads the file name in each target to the width specified
+// with the `--pad-width` flag. The extension is not counted and names
+// that are already as wide are left unchanged.
+func (op *Operation) padTargets() {
+	for i, ch := range op.matches {
+		dir, base := filepath.Split(ch.Target)
+		ext := filepath.Ext(base)
+		name := strings.TrimSuffix(base, ext)
+
+		n := op.padWidth - utf8.RuneCountInString(name)
+		if n <= 0 {
+			continue
+		}
+
+		padding := strings.Repeat(string(op.padChar), n)
+		if op.padSide == padRight {
+			name += padding
+		} else {
+			name = padding + name
+		}
+
+		op.matches[i].Target = dir + name + ext
+	}
+}
+
+// relocateTargets resolves each target relative to the destination root
+// instead of the directory of the source file. The target is rewritten
+// relative to the source directory so that the merged destination
+// paths are checked for conflicts like every other target.
+func (op *Operation) relocateTargets() error {
+	destRoot, err := filepath.Abs(op.destRoot)
+	if err != nil {
+		return err
+	}
+
+	for i, ch := range op.matches {
+		baseDir, err := filepath.Abs(ch.BaseDir)
 		if err != nil {
 			return err
 		}
+
+		target, err := filepath.Rel(
+			baseDir,
+			filepath.Join(destRoot, ch.Target),
+		)
+		if err != nil {
+			return err
+		}
+
+		op.matches[i].Target = target
 	}
 
-	err = op.handleReplacementChain()
+	return nil
+}
+
+// run executes the operation sequence.
+func (op *Operation) run() error {
+	if op.revert {
+		path, err := op.retrieveBackupFile()
+		if err != nil {
+			return errBackupNotFound
+		}
+
+		return op.undo(path)
+	}
+
+	err := op.resolveChanges()
 	if err != nil {
 		return err
 	}
 
+	if op.interactiveEdit && len(op.matches) > 0 {
+		err = editTargets(op.matches, "")
+		if err != nil {
+			return err
+		}
+	}
+
 	return op.apply()
 }
 
+// resolveChanges finds the matches and resolves their targets in the
+// order in which they are presented without renaming any files.
+func (op *Operation) resolveChanges() error {
+	if len(op.excludePathFilter) != 0 {
+		err := op.filterPaths()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := op.findMatches()
+	if err != nil {
+		return err
+	}
+
+	if len(op.excludeFilter) != 0 {
+		err = op.filterMatches()
+		if err != nil {
+			return err
+		}
+	}
+
+	if op.contentMatch != nil {
+		err = op.filterContentMatches()
+		if err != nil {
+			return err
+		}
+	}
+
+	if op.fixExt {
+		err = op.filterMismatchedExtensions()
+		if err != nil {
+			return err
+		}
+	}
+
+	var order map[string]int
+
+	if op.sort != "" {
+		if op.keepOrder {
+			order = op.matchOrder()
+		}
+
+		err = op.sortBy()
+		if err != nil {
+			return err
+		}
+	}
+
+	if op.renumberSeries {
+		op.sortBySeries()
+	}
+
+	// The matches are kept so that the targets can be resolved again
+	var original []Change
+	if op.gaplessIndex {
+		original = append([]Change(nil), op.matches...)
+	}
+
+	err = op.resolveTargets()
+	if err != nil {
+		return err
+	}
+
+	if op.gaplessIndex {
+		err = op.renumber(original)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The sort only affects the assigned indices
+	if order != nil {
+		op.restoreOrder(order)
+	}
+
+	return nil
+}
+
+// resolveTargets computes the target of each match by applying the
+// replacements followed by the options that modify the targets.
+func (op *Operation) resolveTargets() error {
+	var err error
+
+	if op.renumberSeries {
+		op.renumberTargets()
+	} else {
+		err = op.handleReplacementChain()
+		if err != nil {
+			return err
+		}
+	}
+
+	if op.preserveExt {
+		op.preserveExtensions()
+	}
+
+	if op.fixExt {
+		op.fixExtensions()
+	}
+
+	if op.trimStart != 0 || op.trimEnd != 0 {
+		err = op.trimTargets()
+		if err != nil {
+			return err
+		}
+	}
+
+	if op.symbolFilter != nil {
+		op.stripSymbols()
+	}
+
+	if op.padWidth > 0 {
+		op.padTargets()
+	}
+
+	if op.fsProfile != nil {
+		op.applyFSProfile()
+	}
+
+	if op.dateTree != "" {
+		err = op.buildDateTree()
+		if err != nil {
+			return err
+		}
+	}
+
+	if op.extFolders != nil || op.extFolderDefault != "" {
+		op.routeByExtension()
+	}
+
+	if op.segmentMode {
+		err = op.rebuildSegmentTargets()
+		if err != nil {
+			return err
+		}
+	}
+
+	if op.destRoot != "" {
+		err = op.relocateTargets()
+		if err != nil {
+			return err
+		}
+	}
+
+	if op.noOpOnError {
+		op.resetFailedTargets()
+	}
+
+	if op.timestampSuffix {
+		op.suffixTimestampCollisions()
+	}
+
+	return nil
+}
+
 // setFindStringRegex compiles a regular expression for the
 // find string of the corresponding replacement index (if any).
 // Otherwise, the created regex will match the entire file name.
@@ -682,9 +1541,14 @@ func (op *Operation) setFindStringRegex(replacementIndex int) error {
 // and include their contents in the pool of paths in
 // which to find matches. It respects the following properties
 // set on the operation: whether hidden files should be
-// included, and the maximum depth limit (0 for no limit).
+// included, and the maximum depth limit (0 for only the top-level
+// entries, and a negative value for no limit).
 // The paths argument is modified in place.
 func (op *Operation) walk(paths map[string][]os.DirEntry) error {
+	if op.maxDepth == 0 {
+		return nil
+	}
+
 	var recursedPaths []string
 
 	var currentDepth int
@@ -735,7 +1599,7 @@ loop:
 		}
 
 		currentDepth++
-		if !(op.maxDepth > 0 && currentDepth == op.maxDepth) {
+		if op.maxDepth < 0 || currentDepth < op.maxDepth {
 			goto loop
 		}
 	}
@@ -832,12 +1696,93 @@ func (op *Operation) handleCSV(paths map[string][]fs.DirEntry) error {
 	return nil
 }
 
+// loadOverrides reads the overrides file which is a CSV file in which
+// the first column is the path to a source file (relative to the current
+// working directory or absolute), and the second column is its exact target.
+func (op *Operation) loadOverrides() error {
+	records, err := readCSVFile(op.overridesFilename)
+	if err != nil {
+		return err
+	}
+
+	op.overrides = make(map[string]string)
+
+	for i, v := range records {
+		minColumns := 2
+		if len(v) < minColumns {
+			return fmt.Errorf("row %d must have a source and target", i+1)
+		}
+
+		source := strings.TrimSpace(v[0])
+		if !filepath.IsAbs(source) {
+			source = filepath.Join(op.workingDir, source)
+		}
+
+		op.overrides[filepath.Clean(source)] = strings.TrimSpace(v[1])
+	}
+
+	return nil
+}
+
+// loadMakeMap reads the make map file which is a CSV file in which the
+// first column is an exif Make value and the second column is the short
+// name used for {{exif.make.short}}. The makes are matched case-insensitively.
+func (op *Operation) loadMakeMap() error {
+	records, err := readCSVFile(op.makeMapFilename)
+	if err != nil {
+		return err
+	}
+
+	op.makeMap = make(map[string]string)
+
+	for i, v := range records {
+		minColumns := 2
+		if len(v) < minColumns {
+			return fmt.Errorf("row %d must have a make and short name", i+1)
+		}
+
+		op.makeMap[strings.ToUpper(normalizeSpace(v[0]))] = strings.TrimSpace(v[1])
+	}
+
+	return nil
+}
+
+// loadPathsFrom reads the list of paths specified with the `--paths-from`
+// flag and adds them to the paths to be operated on. The list is
+// read from the standard input if the filename is '-'.
+func (op *Operation) loadPathsFrom() error {
+	r := op.reader
+
+	if op.pathsFrom != "-" {
+		f, err := os.Open(op.pathsFrom)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		r = f
+	}
+
+	paths, err := readPaths(r, op.nullDelimited)
+	if err != nil {
+		return err
+	}
+
+	op.pathsToFilesOrDirs = append(op.pathsToFilesOrDirs, paths...)
+
+	return nil
+}
+
 // setOptions applies the command line arguments
 // onto the operation.
 func setOptions(op *Operation, c *cli.Context) error {
 	if len(c.StringSlice("find")) == 0 &&
 		len(c.StringSlice("replace")) == 0 &&
 		c.String("csv") == "" &&
+		c.String("date-tree") == "" &&
+		!c.IsSet("renumber") &&
+		!c.Bool("fix-ext") &&
 		!c.Bool("undo") {
 		return errInvalidArgument
 	}
@@ -854,14 +1799,234 @@ func setOptions(op *Operation, c *cli.Context) error {
 	op.pathsToFilesOrDirs = c.Args().Slice()
 	op.onlyDir = c.Bool("only-dir")
 	op.stringLiteralMode = c.Bool("string-mode")
+	op.goTemplate = c.Bool("go-template")
 	op.excludeFilter = c.StringSlice("exclude")
-	op.maxDepth = int(c.Uint("max-depth"))
+	op.excludePathFilter = c.StringSlice("exclude-path")
+	op.maxDepth = c.Int("max-depth")
 	op.revert = c.Bool("undo")
 	op.verbose = c.Bool("verbose")
 	op.allowOverwrites = c.Bool("allow-overwrites")
+	op.copyMode = c.Bool("copy") && !op.revert
+	op.interactiveEdit = c.Bool("interactive-edit")
+	op.preserveStreams = c.Bool("preserve-streams")
+	op.noMatchError = c.Bool("no-match-error")
 	op.replaceLimit = c.Int("replace-limit")
 	op.csvFilename = c.String("csv")
+	op.noOpOnError = c.Bool("no-op-on-error")
+	op.timestampSuffix = c.Bool("timestamp-suffix")
+	op.gaplessIndex = c.Bool("gapless-index")
+	op.extFoldersFilename = c.String("ext-folders")
+
+	op.extFolderDefault = strings.TrimSpace(c.String("ext-folder-default"))
+	if op.extFolderDefault != "" && !isRelativeFolder(op.extFolderDefault) {
+		return fmt.Errorf("%w: '%s'", errInvalidExtFolder, op.extFolderDefault)
+	}
+
+	op.csvKey = c.Int("csv-key")
+	if c.IsSet("csv-key") && op.csvKey < 1 {
+		return errInvalidCSVKey
+	}
+
+	op.csvMatch = csvMatchType(c.String("csv-match"))
+	switch op.csvMatch {
+	case csvMatchEquals, csvMatchContains, csvMatchRegex:
+	default:
+		return errInvalidCSVMatch
+	}
+
+	op.csvMissing = csvMissingPolicy(c.String("csv-missing"))
+	switch op.csvMissing {
+	case csvMissingEmpty, csvMissingSkip:
+	default:
+		return errInvalidCSVMissing
+	}
+
+	op.overridesFilename = c.String("overrides")
+	op.pathsFrom = c.String("paths-from")
+	op.nullDelimited = c.Bool("null")
 	op.quiet = c.Bool("quiet")
+	op.normalizeVariables = c.Bool("normalize-variables")
+	op.debugVariables = c.Bool("debug-variables")
+	op.destRoot = c.String("dest-root")
+	op.hashSidecar = c.String("hash-sidecar")
+	op.dirCountHidden = c.Bool("dirsize-hidden")
+	op.chunkSize = c.Int("chunk-size")
+	if c.IsSet("chunk-size") && op.chunkSize <= 0 {
+		return errInvalidChunkSize
+	}
+
+	op.trimStart = c.Int("trim-start")
+	op.trimEnd = c.Int("trim-end")
+	if op.trimStart < 0 || op.trimEnd < 0 {
+		return errInvalidTrimCount
+	}
+
+	op.padWidth = c.Int("pad-width")
+
+	padChar := []rune(c.String("pad-char"))
+	if len(padChar) != 1 || padChar[0] == '/' || padChar[0] == filepath.Separator {
+		return errInvalidPadChar
+	}
+
+	op.padChar = padChar[0]
+
+	op.padSide = c.String("pad-side")
+	switch op.padSide {
+	case padLeft, padRight:
+	default:
+		return errInvalidPadSide
+	}
+
+	op.fixExt = c.Bool("fix-ext")
+	op.preserveExt = c.Bool("preserve-ext")
+	op.segmentMode = c.Bool("path-segments")
+	op.makeMapFilename = c.String("make-map")
+	op.caseConflicts = c.Bool("case-conflicts")
+	op.jsonSidecar = c.String("json-sidecar")
+	op.manifestFilename = c.String("manifest")
+
+	op.manifestHash = hashAlgorithm(c.String("manifest-hash"))
+	switch op.manifestHash {
+	case sha1Hash, sha256Hash, sha512Hash, md5Hash:
+	default:
+		return errInvalidManifestHash
+	}
+
+	var err error
+
+	op.ageBuckets, err = parseAgeBuckets(c.String("age-buckets"))
+	if err != nil {
+		return err
+	}
+
+	op.dateSeqStart, err = parseDateSeqStart(c.String("dateseq-start"))
+	if err != nil {
+		return err
+	}
+
+	op.dateSeqStep, err = parseDateSeqStep(c.String("dateseq-step"))
+	if err != nil {
+		return err
+	}
+
+	artLabels := strings.Split(c.String("art-labels"), ",")
+	if len(artLabels) != 2 {
+		return fmt.Errorf("%w: '%s'", errInvalidArtLabels, c.String("art-labels"))
+	}
+
+	op.artLabels = [2]string{artLabels[0], artLabels[1]}
+
+	op.fixStrategies, err = parseFixStrategies(c.String("fix-strategy"))
+	if err != nil {
+		return err
+	}
+
+	if c.IsSet("exif-offset") {
+		offset, ok := parseExifOffset(c.String("exif-offset"))
+		if !ok {
+			return fmt.Errorf("%w: '%s'", errInvalidExifOffset, c.String("exif-offset"))
+		}
+
+		op.exifOffset = offset
+	}
+
+	if c.IsSet("hash-head") {
+		op.hashHead, err = parseByteSize(c.String("hash-head"))
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Bool("strip-symbols") {
+		op.symbolFilter, err = newSymbolFilter(
+			c.String("keep-categories"),
+			c.String("keep-chars"),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if targetFS := c.String("target-fs"); targetFS != "" {
+		profile, ok := fsProfiles[strings.ToLower(targetFS)]
+		if !ok {
+			return fmt.Errorf("%w: '%s'", errInvalidTargetFS, targetFS)
+		}
+
+		op.fsProfile = &profile
+	}
+
+	op.exiftoolOpts, err = parseExiftoolOpts(c.StringSlice("exiftool-opt"))
+	if err != nil {
+		return err
+	}
+
+	op.extMapFilename = c.String("ext-map")
+
+	op.overwritePolicy = overwritePolicy(c.String("overwrite-policy"))
+	switch op.overwritePolicy {
+	case "", overwritePolicySkip, overwritePolicyOverwrite, overwritePolicyBackup:
+	default:
+		return errInvalidOverwritePolicy
+	}
+
+	op.siblingExt = c.String("sibling-ext")
+
+	if c.String("content-match") != "" {
+		op.contentMatch, err = regexp.Compile(c.String("content-match"))
+		if err != nil {
+			return fmt.Errorf("%w: %s", errInvalidContentMatch, err.Error())
+		}
+
+		op.contentMatchLimit, err = parseByteSize(c.String("content-limit"))
+		if err != nil {
+			return err
+		}
+
+		op.skipBinary = c.Bool("skip-binary")
+	}
+
+	if c.String("sibling-pattern") != "" {
+		op.siblingPattern, err = regexp.Compile(c.String("sibling-pattern"))
+		if err != nil {
+			return fmt.Errorf("%w: %s", errInvalidSiblingPattern, err.Error())
+		}
+	}
+
+	op.crossDevicePolicy = crossDevicePolicy(c.String("cross-device"))
+	switch op.crossDevicePolicy {
+	case "", crossDevicePolicyError, crossDevicePolicyCopy:
+	default:
+		return errInvalidCrossDevicePolicy
+	}
+
+	op.siblingPolicy = siblingPolicy(c.String("sibling-missing"))
+	switch op.siblingPolicy {
+	case "", siblingPolicyEmpty, siblingPolicySkip:
+	default:
+		return errInvalidSiblingPolicy
+	}
+
+	op.dateTree = c.String("date-tree")
+	if _, ok := dateTreeFormats[op.dateTree]; !ok && op.dateTree != "" {
+		return errInvalidDateTree
+	}
+
+	op.dateTreeSource = c.String("date-tree-source")
+	switch op.dateTreeSource {
+	case exifDateSource, modTime, birthTime, accessTime, changeTime:
+	default:
+		return errInvalidDateTreeSource
+	}
+
+	if c.Bool("deterministic") {
+		op.rng = rand.New(rand.NewSource(deterministicSeed)) //nolint:gosec // appropriate use of math.rand
+		op.now = deterministicTime
+	}
+
+	if c.IsSet("seed") {
+		op.rng = rand.New(rand.NewSource(c.Int64("seed"))) //nolint:gosec // appropriate use of math.rand
+	}
 
 	// Sorting
 	if c.String("sort") != "" {
@@ -871,10 +2036,55 @@ func setOptions(op *Operation, c *cli.Context) error {
 		op.reverseSort = true
 	}
 
+	switch op.sort {
+	case "", defaultSort, sizeSort, modTime, birthTime, accessTime, changeTime, exifDateSort:
+	default:
+		return fmt.Errorf("%w: '%s'", errInvalidSort, op.sort)
+	}
+
+	op.keepOrder = c.Bool("keep-order")
+	op.undatedFirst = c.Bool("undated-first")
+	op.unratedZero = c.Bool("unrated-zero")
+
 	if op.onlyDir {
 		op.includeDir = true
 	}
 
+	// The filenames are preserved if only the date tree
+	// or extension fixing is specified
+	if (op.dateTree != "" || op.fixExt) &&
+		len(op.findSlice) == 0 &&
+		len(op.replacementSlice) == 0 {
+		op.replacementSlice = []string{"{{f}}{{ext}}"}
+	}
+
+	if c.IsSet("renumber") {
+		op.renumberSeries = true
+		op.renumberWidth = c.Int("renumber")
+		// the extension is never renumbered
+		op.ignoreExt = true
+
+		if op.renumberWidth < 0 {
+			return errInvalidRenumberWidth
+		}
+
+		if len(op.replacementSlice) != 0 || op.sort != "" ||
+			len(op.findSlice) > 1 {
+			return errRenumberOptions
+		}
+
+		if len(op.findSlice) == 0 {
+			op.findSlice = []string{defaultSeriesPattern}
+		}
+	}
+
+	for i, v := range op.replacementSlice {
+		op.replacementSlice[i], err = expandAliases(v, op.aliases)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Ensure that each findString has a corresponding replacement.
 	// The replacement defaults to an empty string if unset
 	for len(op.findSlice) > len(op.replacementSlice) {
@@ -919,15 +2129,30 @@ func newOperation(c *cli.Context) (*Operation, error) {
 	op := &Operation{
 		writer: os.Stdout,
 		reader: os.Stdin,
+		rng:    rand.New(rand.NewSource(time.Now().UnixNano())), //nolint:gosec // appropriate use of math.rand
+		now:    time.Now(),
 	}
 
 	var err error
 
 	if c.NumFlags() > 0 {
+		var configPaths []string
+
+		if c.String("config") != "" {
+			configPaths, op.aliases, err = loadConfig(c)
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		err = setOptions(op, c)
 		if err != nil {
 			return nil, err
 		}
+
+		if len(op.pathsToFilesOrDirs) == 0 {
+			op.pathsToFilesOrDirs = configPaths
+		}
 	} else {
 		err = setSimpleModeOptions(op, c)
 		if err != nil {
@@ -946,6 +2171,55 @@ func newOperation(c *cli.Context) (*Operation, error) {
 		return op, nil
 	}
 
+	if op.overridesFilename != "" {
+		err = op.loadOverrides()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errOverridesReadFailed, err.Error())
+		}
+	}
+
+	if op.fixExt {
+		err = op.loadExtensionMap()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errExtMapReadFailed, err.Error())
+		}
+	}
+
+	if op.makeMapFilename != "" {
+		err = op.loadMakeMap()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errMakeMapReadFailed, err.Error())
+		}
+	}
+
+	if op.extFoldersFilename != "" {
+		err = op.loadExtensionFolders()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errExtFoldersReadFailed, err.Error())
+		}
+	}
+
+	if op.manifestFilename != "" {
+		err = op.loadManifest()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errManifestReadFailed, err.Error())
+		}
+	}
+
+	if op.csvFilename != "" && op.csvKey > 0 {
+		err = op.loadCSVLookup()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errCSVReadFailed, err.Error())
+		}
+	}
+
+	if op.pathsFrom != "" {
+		err = op.loadPathsFrom()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errPathsReadFailed, err.Error())
+		}
+	}
+
 	var paths = make(map[string][]os.DirEntry)
 
 	for _, v := range op.pathsToFilesOrDirs {
@@ -992,14 +2266,20 @@ func newOperation(c *cli.Context) (*Operation, error) {
 		}
 	}
 
-	// Use current directory
-	if len(paths) == 0 {
+	// Use current directory unless the paths were provided
+	// through --paths-from, even if the list is empty
+	if len(paths) == 0 && op.pathsFrom == "" {
 		paths["."], err = os.ReadDir(".")
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	// The search roots are used to rename the directories below them
+	for k := range paths {
+		op.roots = append(op.roots, filepath.Clean(k))
+	}
+
 	if op.recursive {
 		err = op.walk(paths)
 		if err != nil {
@@ -1009,7 +2289,7 @@ func newOperation(c *cli.Context) (*Operation, error) {
 
 	op.setPaths(paths)
 
-	if op.csvFilename != "" {
+	if op.csvFilename != "" && op.csvKey == 0 {
 		err = op.handleCSV(paths)
 		if err != nil {
 			return nil, fmt.Errorf("%w: %s", errCSVReadFailed, err.Error())
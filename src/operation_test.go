@@ -2,12 +2,17 @@ package f2
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"sort"
@@ -382,7 +387,21 @@ func TestRecursive(t *testing.T) {
 			args: []string{"-f", "jpg", "-r", "jpeg", "-R", testDir},
 		},
 		{
-			name: "Recursively match jpg files with max depth set to zero",
+			name: "Recursively match only top-level entries with max depth set to zero",
+			want: []Change{
+				{
+					Source:  "morepics",
+					BaseDir: testDir,
+					Target:  "morephotos",
+					IsDir:   true,
+				},
+			},
+			args: []string{
+				"-f", "pics", "-r", "photos", "-d", "-R", "-m", "0", testDir,
+			},
+		},
+		{
+			name: "Recursively match jpg files with no max depth",
 			want: []Change{
 				{
 					Source:  "a.jpg",
@@ -400,7 +419,7 @@ func TestRecursive(t *testing.T) {
 					Target:  "img.jpeg",
 				},
 			},
-			args: []string{"-f", "jpg", "-r", "jpeg", "-R", "-m", "0", testDir},
+			args: []string{"-f", "jpg", "-r", "jpeg", "-R", "-m", "-1", testDir},
 		},
 		{
 			name: "Recursively match jpg files with max depth of 1",
@@ -644,6 +663,207 @@ func TestStringLiteralMode(t *testing.T) {
 	runFindReplace(t, cases)
 }
 
+func TestPlanRenames(t *testing.T) {
+	testDir := t.TempDir()
+
+	for _, v := range []string{"a", "b", "c", "d"} {
+		err := os.WriteFile(
+			filepath.Join(testDir, v+".txt"),
+			[]byte(v),
+			0o600,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	overrides := filepath.Join(t.TempDir(), "overrides.csv")
+
+	var csv strings.Builder
+
+	for _, v := range [][]string{
+		{"a.txt", "b.txt"},
+		{"b.txt", "a.txt"},
+		{"c.txt", "d.txt"},
+		{"d.txt", "e.txt"},
+	} {
+		csv.WriteString(filepath.Join(testDir, v[0]) + "," + v[1] + "\n")
+	}
+
+	err := os.WriteFile(overrides, []byte(csv.String()), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := func(want map[string]string) {
+		t.Helper()
+
+		entries, err := os.ReadDir(testDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != len(want) {
+			t.Fatalf("Expected %d files, got: %v", len(want), entries)
+		}
+
+		for name, content := range want {
+			b, err := os.ReadFile(filepath.Join(testDir, name))
+			if err != nil || string(b) != content {
+				t.Fatalf("Expected %s to contain %q, got: %q (%v)", name, content, b, err)
+			}
+		}
+	}
+
+	result, err := action([]string{
+		os.Args[0], "-f", "txt", "--overrides", overrides, "-x", testDir,
+	})
+	if err != nil || result.applyError != nil || len(result.conflicts) > 0 {
+		t.Fatalf(
+			"Unexpected error: %v, %v, %v",
+			err,
+			result.applyError,
+			result.conflicts,
+		)
+	}
+
+	contents(map[string]string{"a.txt": "b", "b.txt": "a", "d.txt": "c", "e.txt": "d"})
+
+	for _, ch := range result.changes {
+		if strings.Contains(ch.Source, "f2tmp") || strings.Contains(ch.Target, "f2tmp") {
+			t.Fatalf("Expected temporary names to be excluded from the changes: %+v", ch)
+		}
+	}
+
+	result, err = action([]string{os.Args[0], "-u", "-x"})
+	if err != nil || result.applyError != nil {
+		t.Fatalf("Unexpected error: %v, %v", err, result.applyError)
+	}
+
+	contents(map[string]string{"a.txt": "a", "b.txt": "b", "c.txt": "c", "d.txt": "d"})
+}
+
+func TestRevertCycle(t *testing.T) {
+	// setup creates the files with their names as their content
+	setup := func(names ...string) string {
+		t.Helper()
+
+		dir := t.TempDir()
+
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+
+			err := os.MkdirAll(filepath.Dir(path), 0o755)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = os.WriteFile(path, []byte(name), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return dir
+	}
+
+	// unchanged checks that each file is back at its source
+	unchanged := func(dir string, names ...string) {
+		t.Helper()
+
+		for _, name := range names {
+			b, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil || string(b) != name {
+				t.Fatalf("Expected %s to be unchanged, got: %q (%v)", name, b, err)
+			}
+		}
+
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if strings.Contains(d.Name(), "f2tmp") {
+				t.Fatalf("Expected no temporary files, got: %s", path)
+			}
+
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the last file in a cycle cannot reach its target if the
+	// middle step is skipped so the applied steps are reverted
+	dir := setup("a.txt", "b.txt", "c.txt")
+
+	op := &Operation{
+		matches: []Change{
+			{BaseDir: dir, Source: "a.txt", Target: "b.txt"},
+			{BaseDir: dir, Source: "b.txt", Target: "c.txt"},
+			{BaseDir: dir, Source: "c.txt", Target: "a.txt"},
+		},
+		confirm: func(ch Change) ConfirmAction {
+			if ch.Source == "b.txt" {
+				return ConfirmSkip
+			}
+
+			return ConfirmApply
+		},
+	}
+
+	op.commit()
+
+	unchanged(dir, "a.txt", "b.txt", "c.txt")
+
+	var reverted int
+
+	for _, v := range op.errors {
+		if errors.Is(v.err, errCycleReverted) {
+			reverted++
+		}
+	}
+
+	if reverted != 1 || len(op.errors) != 2 || len(op.matches) != 0 ||
+		len(op.stranded) != 0 {
+		t.Fatalf("Unexpected result: %v, %+v, %v", op.errors, op.matches, op.stranded)
+	}
+
+	if runtime.GOOS == windows || os.Geteuid() == 0 {
+		return
+	}
+
+	// a file cannot be moved out of a read-only directory
+	dir = setup(filepath.Join("rw", "a.txt"), filepath.Join("ro", "b.txt"))
+
+	err := os.Chmod(filepath.Join(dir, "ro"), 0o555)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Chmod(filepath.Join(dir, "ro"), 0o755)
+
+	op = &Operation{
+		matches: []Change{
+			{
+				BaseDir: dir,
+				Source:  filepath.Join("rw", "a.txt"),
+				Target:  filepath.Join("ro", "b.txt"),
+			},
+			{
+				BaseDir: dir,
+				Source:  filepath.Join("ro", "b.txt"),
+				Target:  filepath.Join("rw", "a.txt"),
+			},
+		},
+	}
+
+	op.commit()
+
+	unchanged(dir, filepath.Join("rw", "a.txt"), filepath.Join("ro", "b.txt"))
+
+	if len(op.errors) != 2 || len(op.matches) != 0 || len(op.stranded) != 0 {
+		t.Fatalf("Unexpected result: %v, %+v, %v", op.errors, op.matches, op.stranded)
+	}
+}
+
 func TestApplyUndo(t *testing.T) {
 	table := []testCase{
 		{
@@ -845,6 +1065,208 @@ func TestCSV(t *testing.T) {
 			},
 			args: []string{"-csv", csv, "-r", "{{csv.3}}{{ext}}", testDir},
 		},
+		{
+			name: "Rename from CSV file with a row format",
+			want: []Change{
+				{
+					Source:  "ios.mp4",
+					BaseDir: filepath.Join(testDir, "images", "pics"),
+					Target:  "a podcast on ios 15 (ios15.mp4).mp4",
+				},
+				{
+					Source:  "abc.pdf",
+					BaseDir: testDir,
+					Target:  "A book about africa ().pdf",
+				},
+			},
+			args: []string{
+				"-csv",
+				csv,
+				"-r",
+				`{{csv.fmt:"{3}{5} ({2})"}}{{ext}}`,
+				testDir,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+}
+
+func TestCSVLookup(t *testing.T) {
+	testDir := t.TempDir()
+
+	for _, name := range []string{"IMG_001.jpg", "IMG_002.jpg", "holiday-003.jpg"} {
+		err := os.WriteFile(filepath.Join(testDir, name), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	csv := filepath.Join(t.TempDir(), "lookup.csv")
+
+	err := os.WriteFile(
+		csv,
+		[]byte("Beach,IMG_001\nGeneric,IMG_00\nHoliday,003\n"),
+		0o600,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patterns := filepath.Join(t.TempDir(), "patterns.csv")
+
+	err = os.WriteFile(
+		patterns,
+		[]byte("Photo,^img_\\d+\\.jpg$\nTrip,^HOLIDAY\n"),
+		0o600,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []testCase{
+		{
+			name: "Match the key column against the name without the extension",
+			want: []Change{
+				{Source: "IMG_001.jpg", BaseDir: testDir, Target: "IMG_001-Beach.jpg"},
+				{Source: "IMG_002.jpg", BaseDir: testDir, Target: "IMG_002-.jpg"},
+				{Source: "holiday-003.jpg", BaseDir: testDir, Target: "holiday-003-.jpg"},
+			},
+			args: []string{
+				"-f", "^(.+)\\.jpg$", "-r", "$1-{{csv.1}}{{ext}}",
+				"--csv", csv, "--csv-key", "2", testDir,
+			},
+		},
+		{
+			name: "Leave unmatched files unchanged",
+			want: []Change{
+				{Source: "IMG_001.jpg", BaseDir: testDir, Target: "Beach.jpg"},
+				{Source: "IMG_002.jpg", BaseDir: testDir, Target: "IMG_002.jpg"},
+				{Source: "holiday-003.jpg", BaseDir: testDir, Target: "holiday-003.jpg"},
+			},
+			args: []string{
+				"-f", "^.+$", "-r", "{{csv.1}}{{ext}}", "--csv", csv,
+				"--csv-key", "2", "--csv-missing", "skip", testDir,
+			},
+		},
+		{
+			name: "Use the first row whose key is contained in the name",
+			want: []Change{
+				{Source: "IMG_001.jpg", BaseDir: testDir, Target: "Beach.jpg"},
+				{Source: "IMG_002.jpg", BaseDir: testDir, Target: "Generic.jpg"},
+				{Source: "holiday-003.jpg", BaseDir: testDir, Target: "Holiday.jpg"},
+			},
+			args: []string{
+				"-f", "^.+$", "-r", "{{csv.1}}{{ext}}", "--csv", csv,
+				"--csv-key", "2", "--csv-match", "contains", testDir,
+			},
+		},
+		{
+			name: "Match the key column as a case-insensitive regex",
+			want: []Change{
+				{Source: "IMG_001.jpg", BaseDir: testDir, Target: "Photo IMG_001.jpg"},
+				{Source: "IMG_002.jpg", BaseDir: testDir, Target: "Photo IMG_002.jpg"},
+				{Source: "holiday-003.jpg", BaseDir: testDir, Target: "Trip holiday-003.jpg"},
+			},
+			args: []string{
+				"-f", "^.+$", "-r", "{{csv.1}} {{f}}{{ext}}", "--csv", patterns,
+				"--csv-key", "2", "--csv-match", "regex", "-i", testDir,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+
+	_, err = action([]string{
+		os.Args[0], "-f", "jpg", "--csv", csv, "--csv-key", "2",
+		"--csv-match", "prefix", testDir,
+	})
+	if !errors.Is(err, errInvalidCSVMatch) {
+		t.Fatalf("Expected: %v, but got: %v", errInvalidCSVMatch, err)
+	}
+}
+
+func TestCSVLiteralValues(t *testing.T) {
+	testDir := t.TempDir()
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		err := os.WriteFile(filepath.Join(testDir, name), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	csv := filepath.Join(t.TempDir(), "values.csv")
+
+	err := os.WriteFile(csv, []byte("a,price $1\nb,${name}\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []testCase{
+		{
+			name: "Insert CSV values containing $ without expanding them",
+			want: []Change{
+				{Source: "a.txt", BaseDir: testDir, Target: "price $1.txt"},
+				{Source: "b.txt", BaseDir: testDir, Target: "${name}.txt"},
+			},
+			args: []string{
+				"-f", "^.+$", "-r", "{{csv.2}}{{ext}}", "--csv", csv,
+				"--csv-key", "1", testDir,
+			},
+		},
+		{
+			name: "Insert CSV values containing $ in a row format",
+			want: []Change{
+				{Source: "a.txt", BaseDir: testDir, Target: "a - price $1.txt"},
+				{Source: "b.txt", BaseDir: testDir, Target: "b - ${name}.txt"},
+			},
+			args: []string{
+				"-f", "^.+$", "-r", `{{csv.fmt:"{1} - {2}"}}{{ext}}`, "--csv", csv,
+				"--csv-key", "1", testDir,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+}
+
+func TestOverrides(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	overrides := filepath.Join(testDir, "overrides.csv")
+	content := filepath.Join(testDir, "abc.pdf") + ",book.pdf\n"
+
+	err := os.WriteFile(overrides, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []testCase{
+		{
+			name: "Override the target of abc.pdf",
+			want: []Change{
+				{
+					Source:  "abc.epub",
+					BaseDir: testDir,
+					Target:  "xyz.epub",
+				},
+				{
+					Source:  "abc.pdf",
+					BaseDir: testDir,
+					Target:  "book.pdf",
+				},
+			},
+			args: []string{
+				"-f",
+				"abc",
+				"-r",
+				"xyz",
+				"--overrides",
+				overrides,
+				testDir,
+			},
+		},
 	}
 
 	runFindReplace(t, cases)
@@ -856,3 +1278,2467 @@ func TestShortHelp(t *testing.T) {
 	g := goldie.New(t, goldie.WithFixtureDir(fixtures))
 	g.Assert(t, "help", []byte(help))
 }
+
+func TestExcludePathFilter(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	cases := []testCase{
+		{
+			name: "Exclude jpg files in images/pics",
+			want: []Change{
+				{
+					Source:  "a.jpg",
+					BaseDir: filepath.Join(testDir, "images"),
+					Target:  "a.jpeg",
+				},
+				{
+					Source:  "img.jpg",
+					BaseDir: filepath.Join(testDir, "morepics", "nested"),
+					Target:  "img.jpeg",
+				},
+			},
+			args: []string{
+				"-f",
+				"jpg",
+				"-r",
+				"jpeg",
+				"-R",
+				"--exclude-path",
+				`^[^/]+/images/pics/.*\.jpg$`,
+				testDir,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+}
+
+func TestDestRoot(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	merged := filepath.Join(testDir, "merged")
+
+	cases := []testCase{
+		{
+			name: "Resolve targets relative to the destination root",
+			want: []Change{
+				{
+					Source:  "pic-1.avif",
+					BaseDir: filepath.Join(testDir, "morepics"),
+					Target:  filepath.Join("..", "merged", "avif", "1.avif"),
+				},
+				{
+					Source:  "pic-2.avif",
+					BaseDir: filepath.Join(testDir, "morepics"),
+					Target:  filepath.Join("..", "merged", "avif", "2.avif"),
+				},
+			},
+			args: []string{
+				"-f",
+				"pic-(\\d)",
+				"-r",
+				"avif/$1",
+				"--dest-root",
+				merged,
+				filepath.Join(testDir, "morepics"),
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+
+	args := []string{
+		os.Args[0],
+		"-f",
+		"^(a|img)$",
+		"-r",
+		"photo",
+		"-e",
+		"-R",
+		"--dest-root",
+		merged,
+		testDir,
+	}
+
+	result, err := action(args)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	conflicts := result.conflicts[overwritingNewPath]
+	if len(conflicts) != 1 ||
+		conflicts[0].target != filepath.Join(merged, "photo.jpg") {
+		t.Fatalf(
+			"Expected a single conflict for the merged target, got: %+v",
+			result.conflicts,
+		)
+	}
+}
+
+func TestPathSegments(t *testing.T) {
+	testDir := t.TempDir()
+
+	for _, v := range []string{
+		"Summer Photos/Beach Day/IMG 1.jpg",
+		"Summer Photos/IMG 2.jpg",
+		"Top.txt",
+	} {
+		path := filepath.Join(testDir, v)
+
+		err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.WriteFile(path, nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	photos := filepath.Join(testDir, "Summer Photos")
+	beach := filepath.Join(photos, "Beach Day")
+
+	cases := []testCase{
+		{
+			name: "Apply the replacement to each directory in the path",
+			want: []Change{
+				{
+					Source:  "IMG 1.jpg",
+					BaseDir: beach,
+					Target: filepath.Join(
+						"..",
+						"..",
+						"summer-photos",
+						"beach-day",
+						"img-1.jpg",
+					),
+				},
+				{
+					Source:  "IMG 2.jpg",
+					BaseDir: photos,
+					Target:  filepath.Join("..", "summer-photos", "img-2.jpg"),
+				},
+				{
+					Source:  "Top.txt",
+					BaseDir: testDir,
+					Target:  "top.txt",
+				},
+			},
+			args: []string{
+				"-f",
+				"(\\w+) ?(\\w*)",
+				"-r",
+				"{{tr.lw}}",
+				"-f",
+				" ",
+				"-r",
+				"-",
+				"-R",
+				"--path-segments",
+				testDir,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+
+	// Both directories are renamed to the same name
+	err := os.MkdirAll(filepath.Join(testDir, "Summer-Photos"), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(
+		filepath.Join(testDir, "Summer-Photos", "IMG 2.jpg"),
+		nil,
+		0o600,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := action([]string{
+		os.Args[0],
+		"-f",
+		" ",
+		"-r",
+		"-",
+		"-R",
+		"--path-segments",
+		testDir,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	conflicts := result.conflicts[overwritingNewPath]
+	if len(conflicts) != 1 || conflicts[0].target !=
+		filepath.Join(testDir, "Summer-Photos", "IMG-2.jpg") {
+		t.Fatalf(
+			"Expected a single conflict for the merged directory, got: %+v",
+			result.conflicts,
+		)
+	}
+}
+
+func TestOverwritePolicy(t *testing.T) {
+	table := []struct {
+		policy string
+		exists []string
+		absent []string
+	}{
+		{
+			policy: "skip",
+			exists: []string{"abc.pdf", "abc.epub"},
+		},
+		{
+			policy: "overwrite",
+			exists: []string{"abc.epub"},
+			absent: []string{"abc.pdf", "abc.epub.bak"},
+		},
+		{
+			policy: "backup",
+			exists: []string{"abc.epub", "abc.epub.bak"},
+			absent: []string{"abc.pdf"},
+		},
+	}
+
+	for _, v := range table {
+		testDir := setupFileSystem(t)
+
+		args := []string{
+			os.Args[0],
+			"-f",
+			"pdf",
+			"-r",
+			"epub",
+			"--overwrite-policy",
+			v.policy,
+			"-x",
+			testDir,
+		}
+
+		result, err := action(args)
+		if err != nil {
+			t.Fatalf("Test (%s) — Unexpected error: %v", v.policy, err)
+		}
+
+		if len(result.conflicts) > 0 {
+			t.Fatalf(
+				"Test (%s) — Expected no conflicts but got some: %v",
+				v.policy,
+				result.conflicts,
+			)
+		}
+
+		if result.applyError != nil {
+			t.Fatalf(
+				"Test (%s) — Unexpected apply error: %v",
+				v.policy,
+				result.applyError,
+			)
+		}
+
+		for _, f := range v.exists {
+			if _, err := os.Stat(filepath.Join(testDir, f)); err != nil {
+				t.Fatalf("Test (%s) — Expected %s to exist: %v", v.policy, f, err)
+			}
+		}
+
+		for _, f := range v.absent {
+			if _, err := os.Stat(filepath.Join(testDir, f)); err == nil {
+				t.Fatalf("Test (%s) — Expected %s to not exist", v.policy, f)
+			}
+		}
+	}
+
+	_, err := action([]string{
+		os.Args[0],
+		"-f",
+		"pdf",
+		"--overwrite-policy",
+		"ignore",
+	})
+	if !errors.Is(err, errInvalidOverwritePolicy) {
+		t.Fatalf("Expected an invalid overwrite policy error, got: %v", err)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	jsonConfig := filepath.Join(testDir, "config.json")
+	yamlConfig := filepath.Join(testDir, "config.yml")
+	invalidConfig := filepath.Join(testDir, "invalid.json")
+
+	files := map[string]string{
+		jsonConfig: `{"find": "abc", "replace": ["xyz"], "ignore-ext": true, "paths": "` +
+			filepath.ToSlash(testDir) + `", "unknown": 1}`,
+		yamlConfig: "find: pdf\nreplace:\n  - epub\npaths:\n  - " +
+			filepath.ToSlash(filepath.Join(testDir, ".dir")) + "\n",
+		invalidConfig: `{"find": "abc", "ignore-ext": "yes"}`,
+	}
+
+	for k, v := range files {
+		err := os.WriteFile(k, []byte(v), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []testCase{
+		{
+			name: "Load options from a JSON config file",
+			want: []Change{
+				{
+					Source:  "abc.epub",
+					BaseDir: testDir,
+					Target:  "xyz.epub",
+				},
+				{
+					Source:  "abc.pdf",
+					BaseDir: testDir,
+					Target:  "xyz.pdf",
+				},
+			},
+			args: []string{"--config", jsonConfig},
+		},
+		{
+			name: "Command line options take precedence over the config file",
+			want: []Change{
+				{
+					Source:  "abc.epub",
+					BaseDir: testDir,
+					Target:  "123.epub",
+				},
+				{
+					Source:  "abc.pdf",
+					BaseDir: testDir,
+					Target:  "123.pdf",
+				},
+			},
+			args: []string{"--config", jsonConfig, "-r", "123"},
+		},
+		{
+			name: "Load options from a YAML config file",
+			want: []Change{
+				{
+					Source:  "sample.pdf",
+					BaseDir: filepath.Join(testDir, ".dir"),
+					Target:  "sample.epub",
+				},
+			},
+			args: []string{"--config", yamlConfig},
+		},
+	}
+
+	runFindReplace(t, cases)
+
+	_, err := action([]string{os.Args[0], "--config", invalidConfig})
+	if !errors.Is(err, errInvalidConfig) ||
+		!strings.Contains(err.Error(), "'ignore-ext'") {
+		t.Fatalf("Expected an invalid config error for 'ignore-ext', got: %v", err)
+	}
+}
+
+func TestConfigAliases(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	configs := map[string]string{
+		"aliases.json":   `{"aliases": {"name": "{{@upper}}_{{@upper}}", "upper": "{{f.up}}"}}`,
+		"undefined.json": `{"aliases": {"name": "{{f}}"}}`,
+		"cycle.json":     `{"aliases": {"a": "{{@b}}", "b": "x{{@a}}"}}`,
+		"invalid.json":   `{"aliases": {"bad name": "{{f}}"}}`,
+	}
+
+	for name, content := range configs {
+		err := os.WriteFile(filepath.Join(testDir, name), []byte(content), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runFindReplace(t, []testCase{
+		{
+			name: "Expand nested aliases in the replacement",
+			want: []Change{
+				{Source: "abc.epub", BaseDir: testDir, Target: "ABC_ABC.epub"},
+				{Source: "abc.pdf", BaseDir: testDir, Target: "ABC_ABC.pdf"},
+			},
+			args: []string{
+				"--config", filepath.Join(testDir, "aliases.json"),
+				"-f", "abc.*", "-r", "{{@name}}{{ext}}", testDir,
+			},
+		},
+	})
+
+	cases := []struct {
+		config string
+		want   error
+	}{
+		{"undefined.json", errUndefinedAlias},
+		{"cycle.json", errAliasCycle},
+		{"invalid.json", errInvalidConfig},
+	}
+
+	for _, tc := range cases {
+		_, err := action([]string{
+			os.Args[0],
+			"--config", filepath.Join(testDir, tc.config),
+			"-f", "abc", "-r", "{{@a}}{{@name}}", testDir,
+		})
+		if !errors.Is(err, tc.want) {
+			t.Fatalf("Test (%s) — Expected error '%v', got: %v", tc.config, tc.want, err)
+		}
+	}
+}
+
+func TestPathsFrom(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	paths := []string{
+		filepath.Join(testDir, "images", "a.jpg"),
+		filepath.Join(testDir, "morepics", "pic-1.avif"),
+	}
+
+	newlineList := filepath.Join(testDir, "paths.txt")
+	nullList := filepath.Join(testDir, "paths.bin")
+	emptyList := filepath.Join(testDir, "empty.txt")
+
+	lists := map[string]string{
+		newlineList: strings.Join(paths, "\n") + "\n",
+		nullList:    strings.Join(paths, "\x00") + "\x00",
+		emptyList:   "",
+	}
+
+	for name, content := range lists {
+		err := os.WriteFile(name, []byte(content), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []Change{
+		{
+			Source:  "a.jpg",
+			BaseDir: filepath.Join(testDir, "images"),
+			Target:  "a.png",
+		},
+		{
+			Source:  "pic-1.avif",
+			BaseDir: filepath.Join(testDir, "morepics"),
+			Target:  "pic-1.png",
+		},
+	}
+
+	cases := []testCase{
+		{
+			name: "Read newline delimited paths from a file",
+			want: want,
+			args: []string{
+				"-f",
+				"(jpg|avif)",
+				"-r",
+				"png",
+				"--paths-from",
+				newlineList,
+			},
+		},
+		{
+			name: "Read NUL delimited paths from a file",
+			want: want,
+			args: []string{
+				"-f",
+				"(jpg|avif)",
+				"-r",
+				"png",
+				"--paths-from",
+				nullList,
+				"--null",
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+
+	result, err := action([]string{
+		os.Args[0],
+		"-f",
+		"(jpg|avif)",
+		"-r",
+		"png",
+		"--paths-from",
+		emptyList,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(result.changes) != 0 {
+		t.Fatalf(
+			"Expected no changes for an empty list, got: %+v",
+			prettyPrint(result.changes),
+		)
+	}
+}
+
+func TestDateTree(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	morepics := filepath.Join(testDir, "morepics")
+
+	dates := map[string]time.Time{
+		"pic-1.avif": time.Date(2021, 6, 12, 10, 0, 0, 0, time.Local),
+		"pic-2.avif": time.Date(2020, 12, 31, 23, 0, 0, 0, time.Local),
+	}
+
+	for k, v := range dates {
+		err := os.Chtimes(filepath.Join(morepics, k), v, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []testCase{
+		{
+			name: "Place files in a date tree using the exif date or mtime",
+			want: []Change{
+				{
+					Source:  "pic-1.avif",
+					BaseDir: morepics,
+					Target: filepath.Join(
+						"2021",
+						"2021-06",
+						"2021-06-12",
+						"pic-1.avif",
+					),
+				},
+				{
+					Source:  "pic-2.avif",
+					BaseDir: morepics,
+					Target: filepath.Join(
+						"2020",
+						"2020-12",
+						"2020-12-31",
+						"pic-2.avif",
+					),
+				},
+			},
+			args: []string{
+				"--date-tree",
+				"day",
+				morepics,
+			},
+		},
+		{
+			name: "Rename files into a year folder using the modification time",
+			want: []Change{
+				{
+					Source:  "pic-1.avif",
+					BaseDir: morepics,
+					Target:  filepath.Join("2021", "photo-1.avif"),
+				},
+				{
+					Source:  "pic-2.avif",
+					BaseDir: morepics,
+					Target:  filepath.Join("2020", "photo-2.avif"),
+				},
+			},
+			args: []string{
+				"-f",
+				"pic",
+				"-r",
+				"photo",
+				"--date-tree",
+				"year",
+				"--date-tree-source",
+				"mtime",
+				morepics,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+
+	_, err := action([]string{os.Args[0], "--date-tree", "week", morepics})
+	if !errors.Is(err, errInvalidDateTree) {
+		t.Fatalf("Expected an invalid date tree error, got: %v", err)
+	}
+}
+
+func TestConfirmEach(t *testing.T) {
+	var buf bytes.Buffer
+
+	op := &Operation{
+		reader: strings.NewReader("y\nn\nq\n"),
+		writer: &buf,
+	}
+
+	confirm := op.promptConfirm()
+
+	want := []ConfirmAction{ConfirmApply, ConfirmSkip, ConfirmAbort, ConfirmAbort}
+	for i, v := range want {
+		if got := confirm(Change{}); got != v {
+			t.Fatalf("Expected action %d to be %d, got: %d", i, v, got)
+		}
+	}
+
+	testDir := setupFileSystem(t)
+
+	pterm.DisableOutput()
+
+	skipFirst := func(ch Change) ConfirmAction {
+		if ch.Source == "pic-1.avif" {
+			return ConfirmSkip
+		}
+
+		return ConfirmApply
+	}
+
+	app := GetApp(WithConfirm(skipFirst))
+
+	err := app.Run([]string{
+		os.Args[0],
+		"-f",
+		"pic",
+		"-r",
+		"photo",
+		filepath.Join(testDir, "morepics"),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, v := range []string{"pic-1.avif", "photo-2.avif"} {
+		if _, err = os.Stat(filepath.Join(testDir, "morepics", v)); err != nil {
+			t.Fatalf("Expected %s to exist: %v", v, err)
+		}
+	}
+
+	abort := func(ch Change) ConfirmAction {
+		return ConfirmAbort
+	}
+
+	app = GetApp(WithConfirm(abort))
+
+	err = app.Run([]string{
+		os.Args[0],
+		"-f",
+		"js",
+		"-r",
+		"ts",
+		filepath.Join(testDir, "scripts"),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, v := range []string{"index.js", "main.js"} {
+		if _, err = os.Stat(filepath.Join(testDir, "scripts", v)); err != nil {
+			t.Fatalf("Expected %s to exist: %v", v, err)
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	pterm.DisableOutput()
+
+	var got [][2]int
+
+	app := GetApp(WithProgress(func(processed, total int) {
+		got = append(got, [2]int{processed, total})
+	}))
+
+	err := app.Run([]string{
+		os.Args[0],
+		"-f",
+		"js",
+		"-r",
+		"ts",
+		"-f",
+		"ts",
+		"-r",
+		"mjs",
+		filepath.Join(testDir, "scripts"),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := [][2]int{{1, 4}, {2, 4}, {3, 4}, {4, 4}}
+	if !cmp.Equal(got, want) {
+		t.Fatalf("Expected progress: %v, got: %v", want, got)
+	}
+
+	// progress is not reported without a progress function
+	op := &Operation{matches: []Change{{}}}
+	op.reportProgress(0)
+}
+
+func TestContentHash(t *testing.T) {
+	testDir := t.TempDir()
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		err := os.WriteFile(filepath.Join(testDir, name), []byte("on disk"), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	op := &Operation{
+		content: func(ch Change) (io.Reader, error) {
+			if ch.Source == "b.txt" {
+				return nil, nil
+			}
+
+			return strings.NewReader("new content"), nil
+		},
+	}
+
+	sum := func(content string) string {
+		h := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(h[:])
+	}
+
+	cases := map[string]string{
+		"a.txt": sum("new content") + ".txt",
+		"b.txt": sum("on disk") + ".txt",
+	}
+
+	for source, want := range cases {
+		target := "{{hash.sha256}}{{ext}}"
+
+		vars, err := extractVariables(target)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		ch := Change{
+			BaseDir:        testDir,
+			Source:         source,
+			originalSource: source,
+			Target:         target,
+		}
+
+		err = op.replaceVariables(&ch, &vars)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if ch.Target != want {
+			t.Fatalf("Test (%s) — Expected: %s, got: %s", source, want, ch.Target)
+		}
+	}
+
+	op.content = func(ch Change) (io.Reader, error) {
+		return nil, errors.New("not ready")
+	}
+
+	vars, _ := extractVariables("{{hash.md5}}")
+	ch := Change{BaseDir: testDir, Source: "a.txt", Target: "{{hash.md5}}"}
+
+	var readErr *MetadataReadError
+	if err := op.replaceVariables(&ch, &vars); !errors.As(err, &readErr) {
+		t.Fatalf("Expected a MetadataReadError, got: %v", err)
+	}
+
+	// the content hook is used when planning as well
+	plan, err := NewPlan(
+		[]string{"-f", `^a\.txt$`, "-r", "{{hash.sha256}}{{ext}}", testDir},
+		WithContent(func(ch Change) (io.Reader, error) {
+			return strings.NewReader("new content"), nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if plan.Changes[0].Target != cases["a.txt"] {
+		t.Fatalf("Expected: %s, got: %s", cases["a.txt"], plan.Changes[0].Target)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	testDir := t.TempDir()
+
+	files := map[string]string{
+		"a.txt": "alpha",
+		"b.txt": "beta",
+		"c.txt": "gamma",
+	}
+
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(testDir, name), []byte(content), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hash := func(content string) string {
+		sum := sha256.Sum256([]byte(content))
+
+		return strings.ToUpper(hex.EncodeToString(sum[:]))
+	}
+
+	manifest := filepath.Join(t.TempDir(), "manifest.csv")
+
+	err := os.WriteFile(
+		manifest,
+		[]byte(hash("alpha")+",first.txt\n"+hash("beta")+",second.txt\n"),
+		0o600,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := action([]string{
+		os.Args[0], "-f", "txt", "--manifest", manifest, testDir,
+	})
+	if err != nil || result.applyError != nil {
+		t.Fatalf("Unexpected error: %v, %v", err, result.applyError)
+	}
+
+	sortChanges(result.changes)
+
+	want := []Change{
+		{BaseDir: testDir, Source: "a.txt", Target: "first.txt"},
+		{BaseDir: testDir, Source: "b.txt", Target: "second.txt"},
+		{BaseDir: testDir, Source: "c.txt", Target: "c.txt"},
+	}
+
+	if !cmp.Equal(result.changes, want, cmpopts.IgnoreUnexported(Change{})) {
+		t.Fatalf("Expected: %+v, but got: %+v", want, result.changes)
+	}
+
+	if !result.changes[2].mismatched || result.changes[0].mismatched {
+		t.Fatalf("Expected only c.txt to be flagged as mismatched")
+	}
+
+	_, err = action([]string{
+		os.Args[0], "-f", "txt", "--manifest", manifest,
+		"--manifest-hash", "crc32", testDir,
+	})
+	if !errors.Is(err, errInvalidManifestHash) {
+		t.Fatalf("Expected: %v, but got: %v", errInvalidManifestHash, err)
+	}
+}
+
+func TestStripSymbols(t *testing.T) {
+	testDir := t.TempDir()
+
+	for _, name := range []string{"Hits 🔥 #1 (2021).mp3", "notes ✏️.txt"} {
+		err := os.WriteFile(filepath.Join(testDir, name), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		args []string
+		want []Change
+	}{
+		{
+			args: []string{"-f", "^", "--strip-symbols", testDir},
+			want: []Change{
+				{BaseDir: testDir, Source: "Hits 🔥 #1 (2021).mp3", Target: "Hits 1 (2021).mp3"},
+				{BaseDir: testDir, Source: "notes ✏️.txt", Target: "notes.txt"},
+			},
+		},
+		{
+			args: []string{
+				"-f", "^", "--strip-symbols", "--keep-categories", "L,Nd",
+				"--keep-chars", "#.", testDir,
+			},
+			want: []Change{
+				{BaseDir: testDir, Source: "Hits 🔥 #1 (2021).mp3", Target: "Hits#12021.mp3"},
+				{BaseDir: testDir, Source: "notes ✏️.txt", Target: "notes.txt"},
+			},
+		},
+	}
+
+	for _, v := range cases {
+		result, err := action(append([]string{os.Args[0]}, v.args...))
+		if err != nil || result.applyError != nil {
+			t.Fatalf("Unexpected error: %v, %v", err, result.applyError)
+		}
+
+		sortChanges(result.changes)
+
+		if !cmp.Equal(result.changes, v.want, cmpopts.IgnoreUnexported(Change{})) {
+			t.Fatalf("Expected: %+v, but got: %+v", v.want, result.changes)
+		}
+	}
+
+	_, err := action([]string{
+		os.Args[0], "-f", "^", "--strip-symbols", "--keep-categories", "Xx",
+		testDir,
+	})
+	if !errors.Is(err, errInvalidKeepCategories) {
+		t.Fatalf("Expected: %v, but got: %v", errInvalidKeepCategories, err)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	args := []string{
+		os.Args[0],
+		"-f",
+		"index",
+		"-r",
+		"{{r.8}}_{{now.YYYY}}",
+		"--deterministic",
+		filepath.Join(testDir, "scripts"),
+	}
+
+	first, err := action(args)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	second, err := action(args)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(first.changes) == 0 ||
+		!cmp.Equal(first.changes, second.changes, cmpopts.IgnoreUnexported(Change{})) {
+		t.Fatalf(
+			"Expected identical changes, got: %v and %v",
+			first.changes,
+			second.changes,
+		)
+	}
+
+	target := first.changes[0].Target
+	if !strings.HasSuffix(target, "_2000.js") {
+		t.Fatalf("Expected the frozen year in the target, got: %s", target)
+	}
+}
+
+func TestMoveAcrossDevices(t *testing.T) {
+	testDir := t.TempDir()
+
+	source := filepath.Join(testDir, "a.txt")
+	target := filepath.Join(testDir, "b.txt")
+	modTime := time.Date(2021, 6, 12, 10, 0, 0, 0, time.UTC)
+
+	err := os.WriteFile(source, []byte("content"), 0o640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chtimes(source, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = moveAcrossDevices(source, target)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err = os.Stat(source); !os.IsNotExist(err) {
+		t.Fatalf("Expected the source to be removed, got: %v", err)
+	}
+
+	b, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "content" || !fi.ModTime().Equal(modTime) {
+		t.Fatalf("Expected the contents and modification time to be preserved")
+	}
+
+	err = moveAcrossDevices(testDir, filepath.Join(testDir, "dir"))
+	if !errors.Is(err, errCrossDeviceDir) {
+		t.Fatalf("Expected a cross-device directory error, got: %v", err)
+	}
+}
+
+func TestCopyMode(t *testing.T) {
+	testDir := t.TempDir()
+	modTime := time.Date(2021, 6, 12, 10, 0, 0, 0, time.UTC)
+
+	for name, content := range map[string]string{
+		"a.txt": "abc",
+		"b.txt": "de",
+	} {
+		path := filepath.Join(testDir, name)
+
+		err := os.WriteFile(path, []byte(content), 0o640)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.Chtimes(path, modTime, modTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pterm.DisableOutput()
+
+	var last [2]int
+
+	app := GetApp(WithProgress(func(processed, total int) {
+		last = [2]int{processed, total}
+	}))
+
+	err := app.Run([]string{
+		os.Args[0],
+		"-f",
+		`(.*)\.txt`,
+		"-r",
+		"copies/$1.bak",
+		"--copy",
+		"-x",
+		testDir,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for name, content := range map[string]string{
+		"a.txt":        "abc",
+		"b.txt":        "de",
+		"copies/a.bak": "abc",
+		"copies/b.bak": "de",
+	} {
+		path := filepath.Join(testDir, name)
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Expected %s to exist: %v", name, err)
+		}
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != content || !fi.ModTime().Equal(modTime) {
+			t.Fatalf("Expected %s to have the original contents and modification time", name)
+		}
+	}
+
+	if want := [2]int{5, 5}; last != want {
+		t.Fatalf("Expected the final progress to be %v, got: %v", want, last)
+	}
+
+	// the other files in the batch are not overwritten since they remain
+	batchDir := t.TempDir()
+
+	for _, name := range []string{"a.txt", "a.txt.txt"} {
+		err = os.WriteFile(filepath.Join(batchDir, name), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := action([]string{
+		os.Args[0],
+		"-f",
+		`\.txt$`,
+		"-r",
+		".txt.txt",
+		"--copy",
+		"--allow-overwrites",
+		batchDir,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(result.conflicts[sourceExists]) != 1 {
+		t.Fatalf("Expected a conflict with another file in the batch, got: %v", result.conflicts)
+	}
+}
+
+func TestFixExtensions(t *testing.T) {
+	testDir := t.TempDir()
+
+	png := []byte("\x89PNG\x0D\x0A\x1A\x0Aimage data")
+	gif := []byte("GIF89aimage data")
+
+	files := map[string][]byte{
+		"photo.jpg":  png,
+		"anim.GIF":   gif,
+		"image.png":  png,
+		"notes.txt":  []byte("plain text"),
+		"clip.gif":   png,
+		"noext":      gif,
+		"config.ini": []byte("[section]"),
+	}
+
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(testDir, name), content, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	extMap := filepath.Join(t.TempDir(), "extmap.csv")
+
+	err := os.WriteFile(extMap, []byte("image/png,apng,png\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []testCase{
+		{
+			name: "Fix the extensions of mislabeled files",
+			want: []Change{
+				{Source: "photo.jpg", BaseDir: testDir, Target: "photo.png"},
+				{Source: "clip.gif", BaseDir: testDir, Target: "clip.png"},
+				{Source: "noext", BaseDir: testDir, Target: "noext.gif"},
+			},
+			args: []string{"--fix-ext", testDir},
+		},
+		{
+			name: "Fix extensions combined with a replacement",
+			want: []Change{
+				{Source: "photo.jpg", BaseDir: testDir, Target: "picture.png"},
+			},
+			args: []string{"-f", "photo", "-r", "picture", "--fix-ext", testDir},
+		},
+		{
+			name: "Use a custom extension map",
+			want: []Change{
+				{Source: "photo.jpg", BaseDir: testDir, Target: "photo.apng"},
+				{Source: "clip.gif", BaseDir: testDir, Target: "clip.apng"},
+				{Source: "noext", BaseDir: testDir, Target: "noext.gif"},
+			},
+			args: []string{"--fix-ext", "--ext-map", extMap, testDir},
+		},
+	}
+
+	runFindReplace(t, cases)
+}
+
+func TestContentMatch(t *testing.T) {
+	testDir := t.TempDir()
+
+	files := map[string][]byte{
+		"a.conf": []byte("listen 80\nserver_name example.com\n"),
+		"b.conf": []byte("listen 443\n"),
+		"c.conf": append([]byte{0xFF, 0xFE}, []byte("s\x00e\x00r\x00v\x00e\x00r\x00_\x00")...),
+		"d.conf": []byte("\x00\x01server_name"),
+		"e.conf": append(bytes.Repeat([]byte(" "), 64), []byte("server_name")...),
+	}
+
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(testDir, name), content, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := os.Mkdir(filepath.Join(testDir, "server_name.conf"), 0o750)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []testCase{
+		{
+			name: "Rename files whose contents match",
+			want: []Change{
+				{Source: "a.conf", BaseDir: testDir, Target: "a.bak"},
+				{Source: "c.conf", BaseDir: testDir, Target: "c.bak"},
+				{Source: "d.conf", BaseDir: testDir, Target: "d.bak"},
+				{Source: "e.conf", BaseDir: testDir, Target: "e.bak"},
+			},
+			args: []string{"-f", "conf", "-r", "bak", "-d", "--content-match", "server_", testDir},
+		},
+		{
+			name: "Skip binary files",
+			want: []Change{
+				{Source: "a.conf", BaseDir: testDir, Target: "a.bak"},
+				{Source: "c.conf", BaseDir: testDir, Target: "c.bak"},
+				{Source: "e.conf", BaseDir: testDir, Target: "e.bak"},
+			},
+			args: []string{"-f", "conf", "-r", "bak", "--content-match", "server_", "--skip-binary", testDir},
+		},
+		{
+			name: "Only scan the start of each file",
+			want: []Change{
+				{Source: "a.conf", BaseDir: testDir, Target: "a.bak"},
+				{Source: "c.conf", BaseDir: testDir, Target: "c.bak"},
+				{Source: "d.conf", BaseDir: testDir, Target: "d.bak"},
+			},
+			args: []string{"-f", "conf", "-r", "bak", "--content-match", "server_", "--content-limit", "32", testDir},
+		},
+	}
+
+	runFindReplace(t, cases)
+
+	_, err = action([]string{os.Args[0], "-f", "conf", "--content-match", "("})
+	if !errors.Is(err, errInvalidContentMatch) {
+		t.Fatalf("Expected an invalid content pattern error, got: %v", err)
+	}
+}
+
+func TestPadTargets(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	scripts := filepath.Join(testDir, "scripts")
+
+	cases := []testCase{
+		{
+			name: "Pad the name to a fixed width",
+			want: []Change{
+				{
+					Source:  "index.js",
+					BaseDir: scripts,
+					Target:  "000index.js",
+				},
+				{
+					Source:  "main.js",
+					BaseDir: scripts,
+					Target:  "0000main.js",
+				},
+			},
+			args: []string{
+				"-f",
+				"(index|main)",
+				"-r",
+				"$1",
+				"--pad-width",
+				"8",
+				scripts,
+			},
+		},
+		{
+			name: "Pad the right side of the name with a custom character",
+			want: []Change{
+				{
+					Source:  "index.js",
+					BaseDir: scripts,
+					Target:  "index--.js",
+				},
+				{
+					Source:  "main.js",
+					BaseDir: scripts,
+					Target:  "main---.js",
+				},
+			},
+			args: []string{
+				"-f",
+				"(index|main)",
+				"-r",
+				"$1",
+				"--pad-width",
+				"7",
+				"--pad-char",
+				"-",
+				"--pad-side",
+				"right",
+				scripts,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+
+	op := &Operation{
+		padWidth: 3,
+		padChar:  '_',
+		padSide:  padLeft,
+		matches: []Change{
+			{Target: filepath.Join("dir", "é.js")},
+			{Target: "long.txt"},
+		},
+	}
+
+	op.padTargets()
+
+	want := []string{filepath.Join("dir", "__é.js"), "long.txt"}
+	for i, ch := range op.matches {
+		if ch.Target != want[i] {
+			t.Fatalf("Expected: %s, but got: %s", want[i], ch.Target)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"--pad-char", "ab"},
+		{"--pad-side", "center"},
+	} {
+		args = append(
+			append([]string{os.Args[0], "-f", "js", "--pad-width", "5"}, args...),
+			scripts,
+		)
+
+		_, err := action(args)
+		if !errors.Is(err, errInvalidPadChar) && !errors.Is(err, errInvalidPadSide) {
+			t.Fatalf("Expected an invalid padding error, but got: %v", err)
+		}
+	}
+}
+
+func TestTargetFS(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	scripts := filepath.Join(testDir, "scripts")
+
+	cases := []testCase{
+		{
+			name: "Remove the characters that are forbidden on FAT32",
+			want: []Change{
+				{
+					Source:  "index.js",
+					BaseDir: scripts,
+					Target:  "index - copy.js",
+				},
+				{
+					Source:  "main.js",
+					BaseDir: scripts,
+					Target:  "main - copy.js",
+				},
+			},
+			args: []string{
+				"-f",
+				"(index|main)",
+				"-r",
+				"$1 - <copy>?",
+				"--target-fs",
+				"fat32",
+				scripts,
+			},
+		},
+		{
+			name: "Keep the characters that are allowed on ext4",
+			want: []Change{
+				{
+					Source:  "index.js",
+					BaseDir: scripts,
+					Target:  "index - <copy>?.js",
+				},
+				{
+					Source:  "main.js",
+					BaseDir: scripts,
+					Target:  "main - <copy>?.js",
+				},
+			},
+			args: []string{
+				"-f",
+				"(index|main)",
+				"-r",
+				"$1 - <copy>?",
+				"--target-fs",
+				"ext4",
+				scripts,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+
+	long := strings.Repeat("é", 200)
+
+	cases2 := []struct {
+		profile string
+		target  string
+		want    string
+	}{
+		{"ntfs", filepath.Join("a:b. ", "c*d..txt"), filepath.Join("ab", "cd..txt")},
+		{"ntfs", long + ".txt", long + ".txt"},
+		{"ntfs", long + long + ".txt", strings.Repeat("é", 251) + ".txt"},
+		{"ext4", long + ".txt", strings.Repeat("é", 125) + ".txt"},
+		{"fat32", strings.Repeat("a", 300), strings.Repeat("a", 255)},
+	}
+
+	for _, tc := range cases2 {
+		profile := fsProfiles[tc.profile]
+		op := &Operation{
+			fsProfile: &profile,
+			matches:   []Change{{Target: tc.target}},
+		}
+
+		op.applyFSProfile()
+
+		if got := op.matches[0].Target; got != tc.want {
+			t.Fatalf("Test (%s) — Expected: %s, got: %s", tc.profile, tc.want, got)
+		}
+	}
+
+	_, err := action([]string{os.Args[0], "-f", "js", "--target-fs", "hfs", scripts})
+	if !errors.Is(err, errInvalidTargetFS) {
+		t.Fatalf("Expected errInvalidTargetFS, got: %v", err)
+	}
+}
+
+func TestPreserveExtensions(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	images := filepath.Join(testDir, "images")
+
+	cases := []testCase{
+		{
+			name: "Keep the case of the original extension",
+			want: []Change{
+				{
+					Source:  "b.jPg",
+					BaseDir: images,
+					Target:  "photo.jPg",
+				},
+			},
+			args: []string{
+				"-f",
+				`^b\.jpg$`,
+				"-r",
+				"photo.jpeg",
+				"-i",
+				"--preserve-ext",
+				images,
+			},
+		},
+		{
+			name: "Append the extension if the replacement removes it",
+			want: []Change{
+				{
+					Source:  "abc.png",
+					BaseDir: images,
+					Target:  "xyz.png",
+				},
+			},
+			args: []string{
+				"-f",
+				`^abc\.png$`,
+				"-r",
+				"xyz",
+				"--preserve-ext",
+				images,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+
+	op := &Operation{
+		matches: []Change{
+			{Source: "dir.v1", Target: "dir.v2", IsDir: true},
+			{Source: "a.TXT", Target: "a.TXT"},
+		},
+	}
+
+	op.preserveExtensions()
+
+	want := []string{"dir.v2", "a.TXT"}
+	for i, ch := range op.matches {
+		if ch.Target != want[i] {
+			t.Fatalf("Expected: %s, but got: %s", want[i], ch.Target)
+		}
+	}
+}
+
+func TestTrimTargets(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	scripts := filepath.Join(testDir, "scripts")
+
+	cases := []testCase{
+		{
+			name: "Trim characters from the start and end of the name",
+			want: []Change{
+				{
+					Source:  "index.js",
+					BaseDir: scripts,
+					Target:  "inde.js",
+				},
+				{
+					Source:  "main.js",
+					BaseDir: scripts,
+					Target:  "mai.js",
+				},
+			},
+			args: []string{
+				"-f",
+				"(index|main)",
+				"-r",
+				"2021-$1",
+				"--trim-start",
+				"5",
+				"--trim-end",
+				"1",
+				scripts,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+
+	for _, flag := range []string{"--trim-start", "--trim-end"} {
+		_, err := action([]string{
+			os.Args[0], "-f", "index", "-r", "idx", flag, "-1", scripts,
+		})
+		if !errors.Is(err, errInvalidTrimCount) {
+			t.Fatalf("Test (%s) — Expected: %v, got: %v", flag, errInvalidTrimCount, err)
+		}
+	}
+
+	// nothing would be left of the name of main.js
+	result, err := action([]string{
+		os.Args[0], "-f", "(index|main)", "-r", "$1", "--trim-end", "4", scripts,
+	})
+	if err != nil || !errors.Is(result.applyError, errTrimOutOfRange) {
+		t.Fatalf("Expected: %v, got: %v, %v", errTrimOutOfRange, err, result.applyError)
+	}
+
+	op := &Operation{
+		trimStart:   1,
+		trimEnd:     2,
+		noOpOnError: true,
+		matches: []Change{
+			{Source: "index.js", Target: filepath.Join("dir", "index.js")},
+			{Source: "ab", Target: "abc"},
+		},
+	}
+
+	err = op.trimTargets()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if op.matches[0].Target != filepath.Join("dir", "nd.js") ||
+		!errors.Is(op.matches[1].err, errTrimOutOfRange) {
+		t.Fatalf("Unexpected changes: %+v", op.matches)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	op := &Operation{
+		matches: []Change{
+			{Source: "a.txt", Target: "b.txt"},
+			{Source: "c.txt", Target: "c.txt"},
+			{Source: "d.txt", Target: "e.txt", WillOverwrite: true},
+			{Source: "f.txt", Target: "g.txt", mismatched: true},
+			{Source: "h.txt", Target: "i.txt", action: overwritePolicySkip},
+			{Source: "j.txt", Target: "k.txt"},
+			{Source: "l.txt", Target: "m_1a2b3c4d.txt", fixedBy: fixStrategyHash},
+		},
+		conflicts: map[conflictType][]Conflict{
+			fileExists: {{}, {}},
+		},
+	}
+
+	s := op.summarize()
+
+	if len(s.counts) != len(changeStatuses) {
+		t.Fatalf(
+			"Expected %d statuses, but got: %d",
+			len(changeStatuses),
+			len(s.counts),
+		)
+	}
+
+	want := map[changeStatus]int{
+		statusOK:          2,
+		statusFixed:       1,
+		statusUnchanged:   1,
+		statusOverwriting: 1,
+		statusCrossDevice: 0,
+		statusStreams:     0,
+		statusMismatched:  1,
+		statusSkipped:     1,
+		statusBackup:      0,
+		statusFailed:      0,
+	}
+
+	if !cmp.Equal(want, s.counts) {
+		t.Fatalf("Expected: %v, but got: %v", want, s.counts)
+	}
+
+	if s.total != 7 || s.conflicts != 2 {
+		t.Fatalf(
+			"Expected 7 files and 2 conflicts, but got: %d and %d",
+			s.total,
+			s.conflicts,
+		)
+	}
+
+	wantStr := "7 file(s), 2 ok, 1 conflict fixed, 1 unchanged, 1 overwriting, 1 skipped: checksum mismatch, 1 skipped: path already exists, 2 conflict(s)"
+	if got := s.String(); got != wantStr {
+		t.Fatalf("Expected: %s, but got: %s", wantStr, got)
+	}
+}
+
+func TestStreamsStatus(t *testing.T) {
+	streams := []string{"Zone.Identifier"}
+
+	cases := []struct {
+		name string
+		op   *Operation
+		ch   Change
+		want changeStatus
+	}{
+		{
+			name: "Streams are lost when copying",
+			op:   &Operation{copyMode: true},
+			ch:   Change{Source: "a.txt", Target: "b.txt", streams: streams},
+			want: statusStreams,
+		},
+		{
+			name: "Streams are preserved when copying",
+			op:   &Operation{copyMode: true, preserveStreams: true},
+			ch:   Change{Source: "a.txt", Target: "b.txt", streams: streams},
+			want: statusOK,
+		},
+		{
+			name: "Streams are lost when moving across devices",
+			op:   &Operation{preserveStreams: true},
+			ch: Change{
+				Source:      "a.txt",
+				Target:      "b.txt",
+				streams:     streams,
+				crossDevice: true,
+			},
+			want: statusStreams,
+		},
+		{
+			name: "Files without streams are unaffected",
+			op:   &Operation{copyMode: true},
+			ch:   Change{Source: "a.txt", Target: "b.txt"},
+			want: statusOK,
+		},
+	}
+
+	for _, tc := range cases {
+		if got := tc.op.changeStatus(&tc.ch); got != tc.want {
+			t.Fatalf("Test (%s) — Expected status '%s', got: '%s'", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestNoOpOnError(t *testing.T) {
+	testDir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(testDir, "a.txt"), []byte("a"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// hashing a directory fails
+	err = os.Mkdir(filepath.Join(testDir, "dir.txt"), 0o750)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{
+		os.Args[0], "-f", "^.+$", "-r", "{{hash.md5}}", "-d", "--pad-width", "40",
+	}
+
+	result, err := action(append(args, testDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.applyError == nil {
+		t.Fatal("Expected an error without --no-op-on-error")
+	}
+
+	result, err = action(append(args, "--no-op-on-error", testDir))
+	if err != nil || result.applyError != nil {
+		t.Fatalf("Unexpected error: %v, %v", err, result.applyError)
+	}
+
+	sortChanges(result.changes)
+
+	want := []Change{
+		{
+			BaseDir: testDir,
+			Source:  "a.txt",
+			Target:  "000000000cc175b9c0f1b6a831c399e269772661",
+		},
+		{BaseDir: testDir, Source: "dir.txt", Target: "dir.txt", IsDir: true},
+	}
+
+	if !cmp.Equal(result.changes, want, cmpopts.IgnoreUnexported(Change{})) {
+		t.Fatalf("Expected: %+v, but got: %+v", want, result.changes)
+	}
+
+	if result.changes[0].err != nil || result.changes[1].err == nil {
+		t.Fatalf("Expected only dir.txt to have an error")
+	}
+}
+
+func TestTimestampSuffix(t *testing.T) {
+	testDir := t.TempDir()
+
+	burst := time.Date(2021, 6, 12, 15, 4, 5, 0, time.Local)
+	later := burst.Add(time.Hour)
+
+	files := map[string]time.Time{
+		"IMG_3.jpg": burst,
+		"IMG_1.jpg": burst,
+		"IMG_2.jpg": burst,
+		"IMG_4.jpg": later,
+	}
+
+	for name, modTime := range files {
+		path := filepath.Join(testDir, name)
+
+		err := os.WriteFile(path, nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.Chtimes(path, modTime, modTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []testCase{
+		{
+			name: "Number files that share a timestamp by their source name",
+			want: []Change{
+				{Source: "IMG_1.jpg", BaseDir: testDir, Target: "150405.jpg"},
+				{Source: "IMG_2.jpg", BaseDir: testDir, Target: "150405_1.jpg"},
+				{Source: "IMG_3.jpg", BaseDir: testDir, Target: "150405_2.jpg"},
+				{Source: "IMG_4.jpg", BaseDir: testDir, Target: "160405.jpg"},
+			},
+			args: []string{
+				"-f", "IMG_\\d", "-r", "{{mtime.H}}{{mtime.mm}}{{mtime.ss}}",
+				"--timestamp-suffix", "--sortr", "default", testDir,
+			},
+		},
+		{
+			name: "Number files that share a date from a date source",
+			want: []Change{
+				{Source: "IMG_1.jpg", BaseDir: testDir, Target: "150405.jpg"},
+				{Source: "IMG_2.jpg", BaseDir: testDir, Target: "150405_1.jpg"},
+				{Source: "IMG_3.jpg", BaseDir: testDir, Target: "150405_2.jpg"},
+				{Source: "IMG_4.jpg", BaseDir: testDir, Target: "160405.jpg"},
+			},
+			args: []string{
+				"-f", "IMG_\\d", "-r", "{{date.exif|mtime.Hmmss}}",
+				"--timestamp-suffix", testDir,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+
+	dateVars := []struct {
+		replacement string
+		want        bool
+	}{
+		{"{{mtime.YYYY}}", true},
+		{"{{exif.dt.YYYY}}", true},
+		{"{{date.exif|mtime.YYYY}}", true},
+		{"{{dateseq.YYYY-MM-DD}}", true},
+		{"{{video.creationdate.YYYY}}", true},
+		{"{{video.duration}}", false},
+		{"{{exif.iso}}", false},
+	}
+
+	for _, v := range dateVars {
+		op := &Operation{replacementSlice: []string{v.replacement}}
+		if got := op.usesTimestamp(); got != v.want {
+			t.Fatalf("Test (%s) — Expected: %t, got: %t", v.replacement, v.want, got)
+		}
+	}
+
+	result, err := action([]string{
+		os.Args[0], "-f", "IMG_\\d", "-r", "photo", "--timestamp-suffix", testDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.conflicts) == 0 {
+		t.Fatal("Expected conflicts for targets that are not named by a date")
+	}
+}
+
+func TestGaplessIndex(t *testing.T) {
+	testDir := t.TempDir()
+
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg"} {
+		err := os.WriteFile(filepath.Join(testDir, name), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	csv := filepath.Join(t.TempDir(), "names.csv")
+
+	err := os.WriteFile(csv, []byte("a,Alpha\nc,Gamma\nd,Delta\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{
+		"-f", "^.+$", "-r", "{{csv.2}}_%02d{{ext}}", "--csv", csv,
+		"--csv-key", "1", "--csv-missing", "skip",
+	}
+
+	cases := []testCase{
+		{
+			name: "Indices are assigned before the unchanged files are excluded",
+			want: []Change{
+				{Source: "a.jpg", BaseDir: testDir, Target: "Alpha_01.jpg"},
+				{Source: "b.jpg", BaseDir: testDir, Target: "b.jpg"},
+				{Source: "c.jpg", BaseDir: testDir, Target: "Gamma_03.jpg"},
+				{Source: "d.jpg", BaseDir: testDir, Target: "Delta_04.jpg"},
+			},
+			args: append(append([]string{}, args...), testDir),
+		},
+		{
+			name: "Indices are only assigned to the files that are renamed",
+			want: []Change{
+				{Source: "a.jpg", BaseDir: testDir, Target: "Alpha_01.jpg"},
+				{Source: "b.jpg", BaseDir: testDir, Target: "b.jpg"},
+				{Source: "c.jpg", BaseDir: testDir, Target: "Gamma_02.jpg"},
+				{Source: "d.jpg", BaseDir: testDir, Target: "Delta_03.jpg"},
+			},
+			args: append(append([]string{}, args...), "--gapless-index", testDir),
+		},
+		{
+			name: "Number files with no gaps in reverse order",
+			want: []Change{
+				{Source: "a.jpg", BaseDir: testDir, Target: "Alpha_03.jpg"},
+				{Source: "b.jpg", BaseDir: testDir, Target: "b.jpg"},
+				{Source: "c.jpg", BaseDir: testDir, Target: "Gamma_02.jpg"},
+				{Source: "d.jpg", BaseDir: testDir, Target: "Delta_01.jpg"},
+			},
+			args: append(
+				append([]string{}, args...),
+				"--gapless-index", "--sortr", "default", testDir,
+			),
+		},
+	}
+
+	runFindReplace(t, cases)
+}
+
+func TestExtensionFolders(t *testing.T) {
+	testDir := t.TempDir()
+
+	for _, name := range []string{"a.jpg", "b.mp4", "c.txt", "d.PNG"} {
+		err := os.WriteFile(filepath.Join(testDir, name), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	folders := filepath.Join(t.TempDir(), "folders.csv")
+
+	err := os.WriteFile(folders, []byte("images,jpg,.png\nvideos,mp4\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"-f", "^.+$", "-r", "{{f}}{{ext}}", "--ext-folders", folders}
+
+	cases := []testCase{
+		{
+			name: "Move files into the folder of their extension",
+			want: []Change{
+				{Source: "a.jpg", BaseDir: testDir, Target: filepath.Join("images", "a.jpg")},
+				{Source: "b.mp4", BaseDir: testDir, Target: filepath.Join("videos", "b.mp4")},
+				{Source: "c.txt", BaseDir: testDir, Target: "c.txt"},
+				{Source: "d.PNG", BaseDir: testDir, Target: filepath.Join("images", "d.PNG")},
+			},
+			args: append(append([]string{}, args...), testDir),
+		},
+		{
+			name: "Move files with other extensions into the default folder",
+			want: []Change{
+				{Source: "a.jpg", BaseDir: testDir, Target: filepath.Join("images", "a.jpg")},
+				{Source: "b.mp4", BaseDir: testDir, Target: filepath.Join("videos", "b.mp4")},
+				{Source: "c.txt", BaseDir: testDir, Target: filepath.Join("other", "c.txt")},
+				{Source: "d.PNG", BaseDir: testDir, Target: filepath.Join("images", "d.PNG")},
+			},
+			args: append(
+				append([]string{}, args...),
+				"--ext-folder-default", "other", testDir,
+			),
+		},
+	}
+
+	runFindReplace(t, cases)
+
+	_, err = action([]string{
+		os.Args[0], "-f", "a", "--ext-folder-default", "../other", testDir,
+	})
+	if !errors.Is(err, errInvalidExtFolder) {
+		t.Fatalf("Expected: %v, but got: %v", errInvalidExtFolder, err)
+	}
+
+	result, err := action([]string{
+		os.Args[0], "-f", "^a", "-r", "a", "--ext-folders", folders, "-x", testDir,
+	})
+	if err != nil || result.applyError != nil {
+		t.Fatalf("Unexpected error: %v, %v", err, result.applyError)
+	}
+
+	if _, err := os.Stat(filepath.Join(testDir, "images", "a.jpg")); err != nil {
+		t.Fatalf("Expected the file to be moved into the folder: %v", err)
+	}
+}
+
+func TestPlanApply(t *testing.T) {
+	testDir := t.TempDir()
+
+	pterm.DisableOutput()
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		err := os.WriteFile(filepath.Join(testDir, name), []byte(name), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plan, err := NewPlan([]string{"-f", "txt", "-r", "md", testDir})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []string{"a.md", "b.md", "c.md"}
+	for i, ch := range plan.Changes {
+		if ch.Target != want[i] {
+			t.Fatalf("Expected: %s, got: %s", want[i], ch.Target)
+		}
+	}
+
+	// planning does not rename any files
+	if _, err = os.Stat(filepath.Join(testDir, "a.txt")); err != nil {
+		t.Fatalf("Expected a.txt to exist: %v", err)
+	}
+
+	// a plan that requires -x is only previewed without it
+	plan.RequireExec = true
+
+	_, err = Apply(plan)
+	if !errors.Is(err, errExecRequired) {
+		t.Fatalf("Expected errExecRequired, got: %v", err)
+	}
+
+	if _, err = os.Stat(filepath.Join(testDir, "a.txt")); err != nil {
+		t.Fatalf("Expected a.txt to exist: %v", err)
+	}
+
+	plan, err = NewPlan([]string{"-f", "txt", "-r", "md", "-x", testDir})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	plan.RequireExec = true
+
+	// a conflicting plan is not applied
+	plan.Changes[1].Target = "a.md"
+
+	_, err = Apply(plan)
+	if !errors.Is(err, errConflictDetected) {
+		t.Fatalf("Expected errConflictDetected, got: %v", err)
+	}
+
+	plan.Changes[1].Target = "b.markdown"
+	plan.Changes = append(plan.Changes[:2:2], plan.Changes[3:]...)
+
+	// other tests may leave a backup file behind
+	os.Remove(backupFilePath)
+
+	result, err := Apply(plan)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(result.Renamed) != 2 || len(result.Errors) != 0 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+
+	for _, name := range []string{"a.md", "b.markdown", "c.txt"} {
+		if _, err = os.Stat(filepath.Join(testDir, name)); err != nil {
+			t.Fatalf("Expected %s to exist: %v", name, err)
+		}
+	}
+
+	// the operation is only recorded if a backup is requested
+	if _, err = os.Stat(backupFilePath); err == nil {
+		t.Fatalf("Expected no backup file at %s", backupFilePath)
+	}
+
+	plan, err = NewPlan([]string{"-f", "md", "-r", "txt", testDir})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+
+	plan.op.writer = &buf
+	plan.Backup = true
+
+	// a missing source fails without printing the errors
+	err = os.Remove(filepath.Join(testDir, "a.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = Apply(plan)
+	if !errors.Is(err, errRenameFailed) {
+		t.Fatalf("Expected errRenameFailed, got: %v", err)
+	}
+
+	if len(result.Renamed) != 0 || len(result.Errors) != 1 || buf.Len() != 0 {
+		t.Fatalf("Unexpected result: %+v, output: %s", result, buf.String())
+	}
+
+	plan, err = NewPlan([]string{"-f", "markdown", "-r", "txt", testDir})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	plan.op.writer = &buf
+	plan.Backup = true
+
+	_, err = Apply(plan)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	defer os.Remove(backupFilePath)
+
+	if _, err = os.Stat(backupFilePath); err != nil || buf.Len() != 0 {
+		t.Fatalf("Expected a backup file without any output: %v, %s", err, buf.String())
+	}
+
+	_, err = NewPlan([]string{"-u"})
+	if !errors.Is(err, errPlanUndo) {
+		t.Fatalf("Expected errPlanUndo, got: %v", err)
+	}
+
+	_, err = NewPlan([]string{"-f", "typo", "-r", "md", testDir})
+	if !errors.Is(err, ErrNoMatches) {
+		t.Fatalf("Expected ErrNoMatches, got: %v", err)
+	}
+
+	// files removed by the filters are not matched either
+	_, err = NewPlan([]string{"-f", "md", "-E", "md", testDir})
+	if !errors.Is(err, ErrNoMatches) {
+		t.Fatalf("Expected ErrNoMatches, got: %v", err)
+	}
+
+	actionResult, err := action([]string{os.Args[0], "-f", "typo", "--no-match-error", testDir})
+	if err != nil || !errors.Is(actionResult.applyError, ErrNoMatches) {
+		t.Fatalf("Expected ErrNoMatches, got: %v, %v", err, actionResult.applyError)
+	}
+}
+
+func TestPlanRollback(t *testing.T) {
+	testDir := t.TempDir()
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		err := os.WriteFile(filepath.Join(testDir, name), []byte(name), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plan, err := NewPlan([]string{"-f", "txt", "-r", "md", testDir})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// a and b are swapped which is only possible through a temporary name
+	plan.Changes[0].Target = "b.txt"
+	plan.Changes[1].Target = "a.txt"
+
+	// the source of c is removed so that it fails after the others
+	// have been renamed
+	err = os.Remove(filepath.Join(testDir, "c.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Apply(plan)
+	if !errors.Is(err, errRenameFailed) {
+		t.Fatalf("Expected errRenameFailed, got: %v", err)
+	}
+
+	if len(result.Renamed) != 0 || len(result.RolledBack) != 3 ||
+		len(result.Stranded) != 0 || len(result.Errors) != 1 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+
+	entries, err := os.ReadDir(testDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 files, got: %v", entries)
+	}
+
+	for _, name := range []string{"a.txt", "b.txt", "d.txt"} {
+		b, err := os.ReadFile(filepath.Join(testDir, name))
+		if err != nil || string(b) != name {
+			t.Fatalf("Expected %s to be unchanged, got: %q (%v)", name, b, err)
+		}
+	}
+
+	// applying the plan again does not count the previous attempt
+	tempRenames := plan.op.tempRenames
+
+	_, err = Apply(plan)
+	if !errors.Is(err, errRenameFailed) || plan.op.tempRenames != tempRenames {
+		t.Fatalf(
+			"Expected %d temporary renames, got: %d (%v)",
+			tempRenames,
+			plan.op.tempRenames,
+			err,
+		)
+	}
+}
+
+func TestPlanOptions(t *testing.T) {
+	testDir := t.TempDir()
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		err := os.WriteFile(filepath.Join(testDir, name), []byte(name), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var progress [][2]int
+
+	var confirmed []string
+
+	plan, err := NewPlan(
+		[]string{"-f", "txt", "-r", "md", testDir},
+		WithProgress(func(processed, total int) {
+			progress = append(progress, [2]int{processed, total})
+		}),
+		WithConfirm(func(ch Change) ConfirmAction {
+			confirmed = append(confirmed, ch.Source)
+
+			if ch.Source == "a.txt" {
+				return ConfirmSkip
+			}
+
+			return ConfirmApply
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(progress) != 2 || progress[1] != [2]int{2, 2} {
+		t.Fatalf("Unexpected progress: %v", progress)
+	}
+
+	// confirmed plans do not require the -x flag
+	plan.RequireExec = true
+
+	result, err := Apply(plan)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(confirmed) != 2 || len(result.Renamed) != 1 ||
+		result.Renamed[0].Source != "b.txt" {
+		t.Fatalf("Unexpected result: %v, %+v", confirmed, result)
+	}
+
+	for _, name := range []string{"a.txt", "b.md"} {
+		if _, err = os.Stat(filepath.Join(testDir, name)); err != nil {
+			t.Fatalf("Expected %s to exist: %v", name, err)
+		}
+	}
+}
+
+func TestPlanScript(t *testing.T) {
+	testDir := t.TempDir()
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		err := os.WriteFile(filepath.Join(testDir, name), []byte(name), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plan, err := NewPlan([]string{"-f", "txt", "-r", "md", testDir})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// a.txt and b.txt are swapped through a temporary name
+	plan.Changes[0].Target = "b.txt"
+	plan.Changes[1].Target = "a.txt"
+	plan.Changes[2].Target = filepath.Join("sub dir", "it's.txt")
+
+	_, err = Script(plan, "bash")
+	if !errors.Is(err, errInvalidScriptShell) {
+		t.Fatalf("Expected errInvalidScriptShell, got: %v", err)
+	}
+
+	ps, err := Script(plan, ScriptPowerShell)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !strings.Contains(ps, "Move-Item -Force -LiteralPath "+
+		powerShellQuote(filepath.Join(testDir, "c.txt"))+" -Destination '"+
+		filepath.Join(testDir, "sub dir", "it''s.txt")+"'") {
+		t.Fatalf("Expected the PowerShell script to move c.txt, got:\n%s", ps)
+	}
+
+	script, err := Script(plan, ScriptPOSIX)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// generating the script does not rename any files
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if _, err = os.Stat(filepath.Join(testDir, name)); err != nil {
+			t.Fatalf("Expected %s to exist: %v", name, err)
+		}
+	}
+
+	if runtime.GOOS == windows {
+		return
+	}
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not available")
+	}
+
+	out, err := exec.Command(sh, "-c", script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Unexpected error running the script: %v\n%s\n%s", err, out, script)
+	}
+
+	for name, content := range map[string]string{
+		"a.txt":                              "b.txt",
+		"b.txt":                              "a.txt",
+		filepath.Join("sub dir", "it's.txt"): "c.txt",
+	} {
+		b, err := os.ReadFile(filepath.Join(testDir, name))
+		if err != nil || string(b) != content {
+			t.Fatalf("Expected %s to contain %s, got: %s (%v)", name, content, b, err)
+		}
+	}
+}
+
+func TestRenumber(t *testing.T) {
+	testDir := t.TempDir()
+
+	for _, name := range []string{
+		"img_007.jpg", "img_001.jpg", "img_3.jpg", "img_x.jpg", "img_010.mp3",
+	} {
+		err := os.WriteFile(filepath.Join(testDir, name), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name string
+		args []string
+		want []Change
+	}{
+		{
+			name: "Renumber the first number in each name",
+			args: []string{"--renumber", "0"},
+			want: []Change{
+				{Source: "img_001.jpg", BaseDir: testDir, Target: "img_001.jpg"},
+				{Source: "img_3.jpg", BaseDir: testDir, Target: "img_002.jpg"},
+				{Source: "img_007.jpg", BaseDir: testDir, Target: "img_003.jpg"},
+				{Source: "img_010.mp3", BaseDir: testDir, Target: "img_004.mp3"},
+			},
+		},
+		{
+			name: "Renumber the capture group with the specified width",
+			args: []string{"-f", `^img_(\d*|x)$`, "--renumber", "2"},
+			want: []Change{
+				{Source: "img_001.jpg", BaseDir: testDir, Target: "img_01.jpg"},
+				{Source: "img_3.jpg", BaseDir: testDir, Target: "img_02.jpg"},
+				{Source: "img_007.jpg", BaseDir: testDir, Target: "img_03.jpg"},
+				{Source: "img_010.mp3", BaseDir: testDir, Target: "img_04.mp3"},
+				{Source: "img_x.jpg", BaseDir: testDir, Target: "img_x.jpg"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		args := append(append([]string{os.Args[0]}, tc.args...), testDir)
+
+		result, err := action(args)
+		if err != nil {
+			t.Fatalf("Test (%s) — Unexpected error: %v", tc.name, err)
+		}
+
+		if !cmp.Equal(tc.want, result.changes, cmpopts.IgnoreUnexported(Change{})) {
+			t.Fatalf(
+				"Test (%s) — Expected: %s, got: %s",
+				tc.name,
+				prettyPrint(tc.want),
+				prettyPrint(result.changes),
+			)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"--renumber", "0", "-r", "x"},
+		{"--renumber", "0", "--sort", "size"},
+	} {
+		_, err := action(append(append([]string{os.Args[0]}, args...), testDir))
+		if !errors.Is(err, errRenumberOptions) {
+			t.Fatalf("Expected error '%v', got: %v", errRenumberOptions, err)
+		}
+	}
+
+	_, err := action([]string{os.Args[0], "--renumber", "-1", testDir})
+	if !errors.Is(err, errInvalidRenumberWidth) {
+		t.Fatalf("Expected error '%v', got: %v", errInvalidRenumberWidth, err)
+	}
+
+	result, err := action([]string{os.Args[0], "--renumber", "0", "-x", testDir})
+	if err != nil || result.applyError != nil {
+		t.Fatalf("Unexpected error: %v, %v", err, result.applyError)
+	}
+
+	for _, name := range []string{
+		"img_001.jpg", "img_002.jpg", "img_003.jpg", "img_004.mp3", "img_x.jpg",
+	} {
+		if _, err := os.Stat(filepath.Join(testDir, name)); err != nil {
+			t.Fatalf("Expected '%s' to exist after renumbering: %v", name, err)
+		}
+	}
+}
+
+func TestEditPlan(t *testing.T) {
+	testDir := t.TempDir()
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		err := os.WriteFile(filepath.Join(testDir, name), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes := []Change{
+		{Source: "a.txt", BaseDir: testDir, Target: "a.md"},
+		{Source: "b.txt", BaseDir: testDir, Target: "b.md"},
+	}
+
+	var buf bytes.Buffer
+
+	err := writeEditList(&buf, changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edited := strings.Replace(buf.String(), "a.md\n", "sub/c.md\r\n\n", 1)
+
+	err = parseEditList(strings.NewReader(edited), changes)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if changes[0].Target != filepath.Join("sub", "c.md") || changes[1].Target != "b.md" {
+		t.Fatalf("Unexpected targets: %s", prettyPrint(changes))
+	}
+
+	err = parseEditList(strings.NewReader("# comment\nx.md\n"), changes)
+	if !errors.Is(err, errEditLineCount) {
+		t.Fatalf("Expected error '%v', got: %v", errEditLineCount, err)
+	}
+
+	// targets whose name starts with '#' are not mistaken for comments
+	hashChanges := []Change{
+		{Source: "intro.mp3", BaseDir: ".", Target: "#1 intro.mp3"},
+	}
+
+	buf.Reset()
+
+	err = writeEditList(&buf, hashChanges)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = parseEditList(&buf, hashChanges)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if hashChanges[0].Target != "#1 intro.mp3" {
+		t.Fatalf("Unexpected targets: %s", prettyPrint(hashChanges))
+	}
+
+	if runtime.GOOS == windows {
+		return
+	}
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not available")
+	}
+
+	// the editors rewrite the file that is passed to them
+	editors := map[string]string{
+		"rename.sh": `sed 's/a\.md$/c.md/' "$1" > "$1.tmp" && mv "$1.tmp" "$1"`,
+		"remove.sh": `grep -v 'b\.md$' "$1" > "$1.tmp"; mv "$1.tmp" "$1"`,
+	}
+
+	scriptDir := t.TempDir()
+
+	for name, script := range editors {
+		path := filepath.Join(scriptDir, name)
+
+		err = os.WriteFile(path, []byte(script), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		editors[name] = sh + " " + path
+	}
+
+	plan, err := NewPlan([]string{"-f", `\.txt$`, "-r", ".md", testDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = EditPlan(plan, editors["remove.sh"])
+	if !errors.Is(err, errEditLineCount) {
+		t.Fatalf("Expected error '%v', got: %v", errEditLineCount, err)
+	}
+
+	if plan.Changes[0].Target != "a.md" || plan.Changes[1].Target != "b.md" {
+		t.Fatalf("Expected the plan to be unchanged, got: %s", prettyPrint(plan.Changes))
+	}
+
+	visual, ok := os.LookupEnv("VISUAL")
+	defer func() {
+		if ok {
+			os.Setenv("VISUAL", visual)
+		} else {
+			os.Unsetenv("VISUAL")
+		}
+	}()
+
+	os.Setenv("VISUAL", editors["rename.sh"])
+
+	runFindReplace(t, []testCase{
+		{
+			name: "Edit the targets before they are presented",
+			want: []Change{
+				{Source: "a.txt", BaseDir: testDir, Target: "c.md"},
+				{Source: "b.txt", BaseDir: testDir, Target: "b.md"},
+			},
+			args: []string{"-f", `\.txt$`, "-r", ".md", "--interactive-edit", testDir},
+		},
+	})
+}
@@ -2,6 +2,13 @@
 
 package f2
 
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
 const pathSeperator = "/"
 
 // isHidden checks if a file is hidden on Unix operating systems
@@ -10,3 +17,52 @@ const pathSeperator = "/"
 func isHidden(filename, baseDir string) (bool, error) {
 	return filename[0] == dotCharacter, nil
 }
+
+// deviceID returns an identifier for the device that contains the
+// specified path. An empty string is returned if it cannot be determined.
+func deviceID(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", nil
+	}
+
+	return strconv.FormatUint(uint64(stat.Dev), 10), nil //nolint:unconvert // the type of Dev differs between platforms
+}
+
+// fileOwner returns the names of the user and group that own the specified
+// path. The numeric ids are returned if the names cannot be looked up.
+func fileOwner(path string) (owner, group string, err error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", "", errOwnerUnsupported
+	}
+
+	owner = strconv.FormatUint(uint64(stat.Uid), 10)
+	group = strconv.FormatUint(uint64(stat.Gid), 10)
+
+	if u, err := user.LookupId(owner); err == nil {
+		owner = u.Username
+	}
+
+	if g, err := user.LookupGroupId(group); err == nil {
+		group = g.Name
+	}
+
+	return owner, group, nil
+}
+
+// alternateStreams always returns no streams since alternate data streams
+// are specific to NTFS on Windows.
+func alternateStreams(path string) ([]string, error) {
+	return nil, nil
+}
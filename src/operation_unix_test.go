@@ -2,7 +2,14 @@
 
 package f2
 
-import "testing"
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
 
 func TestAutoDir(t *testing.T) {
 	testDir := setupFileSystem(t)
@@ -27,3 +34,121 @@ func TestAutoDir(t *testing.T) {
 
 	runFindReplace(t, cases)
 }
+
+func TestCrossDevice(t *testing.T) {
+	otherDevice := "/dev/shm"
+
+	testDir := setupFileSystem(t)
+
+	id, err := deviceID(testDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherID, err := deviceID(otherDevice)
+	if err != nil || otherID == id {
+		t.Skipf("%s is not available on a different device", otherDevice)
+	}
+
+	destDir, err := os.MkdirTemp(otherDevice, "f2")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	t.Cleanup(func() {
+		os.RemoveAll(destDir)
+	})
+
+	result, err := action([]string{
+		os.Args[0],
+		"-f",
+		"abc",
+		"-r",
+		"abc",
+		"--dest-root",
+		destDir,
+		testDir,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(result.conflicts[crossDevice]) != 2 {
+		t.Fatalf(
+			"Expected 2 cross-device conflicts, got: %v",
+			result.conflicts,
+		)
+	}
+
+	result, err = action([]string{
+		os.Args[0],
+		"-f",
+		"abc",
+		"-r",
+		"abc",
+		"--dest-root",
+		destDir,
+		"--cross-device",
+		"copy",
+		"-x",
+		testDir,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(result.conflicts) != 0 || len(result.operationErrors) != 0 {
+		t.Fatalf(
+			"Expected no conflicts or errors, got: %v %v",
+			result.conflicts,
+			result.operationErrors,
+		)
+	}
+
+	for _, v := range []string{"abc.pdf", "abc.epub"} {
+		if _, err = os.Stat(filepath.Join(destDir, v)); err != nil {
+			t.Fatalf("Expected %s to be moved: %v", v, err)
+		}
+
+		if _, err = os.Stat(filepath.Join(testDir, v)); !os.IsNotExist(err) {
+			t.Fatalf("Expected %s to be removed from the source", v)
+		}
+	}
+}
+
+func TestOwnerVariables(t *testing.T) {
+	testDir := t.TempDir()
+
+	source := filepath.Join(testDir, "a.txt")
+
+	err := os.WriteFile(source, nil, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owner, group, err := fileOwner(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantOwner := strconv.Itoa(os.Getuid())
+	if u, err := user.LookupId(wantOwner); err == nil {
+		wantOwner = u.Username
+	}
+
+	if owner != wantOwner {
+		t.Fatalf("Expected owner: %s, got: %s", wantOwner, owner)
+	}
+
+	result, err := action([]string{
+		os.Args[0], "-f", "a", "-r", "{{owner.up}}-{{owner.group}}", testDir,
+	})
+	if err != nil || result.applyError != nil {
+		t.Fatalf("Unexpected error: %v, %v", err, result.applyError)
+	}
+
+	want := strings.ToUpper(owner) + "-" + group + ".txt"
+	if len(result.changes) != 1 || result.changes[0].Target != want {
+		t.Fatalf("Expected target: %s, got: %+v", want, result.changes)
+	}
+}
@@ -3,12 +3,28 @@
 package f2
 
 import (
+	"errors"
+	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
+	"unsafe"
 )
 
 const pathSeperator = `\`
 
+var (
+	modkernel32          = syscall.NewLazyDLL("kernel32.dll")
+	procFindFirstStreamW = modkernel32.NewProc("FindFirstStreamW")
+	procFindNextStreamW  = modkernel32.NewProc("FindNextStreamW")
+)
+
+// findStreamData mirrors the WIN32_FIND_STREAM_DATA structure.
+type findStreamData struct {
+	size int64
+	name [syscall.MAX_PATH + 36]uint16
+}
+
 // isHidden checks if a file is hidden on Windows.
 func isHidden(filename, baseDir string) (bool, error) {
 	// dotfiles also count as hidden
@@ -37,3 +53,85 @@ func isHidden(filename, baseDir string) (bool, error) {
 
 	return attributes&syscall.FILE_ATTRIBUTE_HIDDEN != 0, nil
 }
+
+// deviceID returns the volume name of the specified path which
+// identifies the device that contains it.
+func deviceID(path string) (string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.ToUpper(filepath.VolumeName(absPath)), nil
+}
+
+// fileOwner is not supported on Windows where files are owned by
+// security identifiers instead of users and groups.
+func fileOwner(path string) (owner, group string, err error) {
+	if _, err := os.Stat(path); err != nil {
+		return "", "", err
+	}
+
+	return "", "", errOwnerUnsupported
+}
+
+// alternateStreams returns the names of the alternate data streams of the
+// specified file (e.g. Zone.Identifier) excluding its main stream.
+func alternateStreams(path string) ([]string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pointer, err := syscall.UTF16PtrFromString(`\\?\` + absPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var data findStreamData
+
+	handle, _, err := procFindFirstStreamW.Call(
+		uintptr(unsafe.Pointer(pointer)),
+		0, // FindStreamInfoStandard
+		uintptr(unsafe.Pointer(&data)),
+		0,
+	)
+	if syscall.Handle(handle) == syscall.InvalidHandle {
+		if errors.Is(err, syscall.ERROR_HANDLE_EOF) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer syscall.FindClose(syscall.Handle(handle)) //nolint:errcheck // the streams were read
+
+	var streams []string
+
+	for {
+		// The names have the form `:name:$DATA` and the main
+		// stream is the one without a name
+		name := syscall.UTF16ToString(data.name[:])
+		name = strings.TrimSuffix(strings.TrimPrefix(name, ":"), ":$DATA")
+
+		if name != "" {
+			streams = append(streams, name)
+		}
+
+		ok, _, err := procFindNextStreamW.Call(
+			handle,
+			uintptr(unsafe.Pointer(&data)),
+		)
+		if ok == 0 {
+			if errors.Is(err, syscall.ERROR_HANDLE_EOF) {
+				return streams, nil
+			}
+
+			return streams, err
+		}
+	}
+}
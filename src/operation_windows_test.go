@@ -3,9 +3,12 @@
 package f2
 
 import (
+	"os"
 	"path/filepath"
 	"syscall"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func setHidden(path string) error {
@@ -129,3 +132,48 @@ func TestHiddenWindows(t *testing.T) {
 
 	runFindReplace(t, cases)
 }
+
+func TestAlternateStreams(t *testing.T) {
+	testDir := t.TempDir()
+	source := filepath.Join(testDir, "a.txt")
+
+	err := os.WriteFile(source, []byte("a"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(source+":Zone.Identifier", []byte("[ZoneTransfer]"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	streams, err := alternateStreams(source)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !cmp.Equal(streams, []string{"Zone.Identifier"}) {
+		t.Fatalf("Expected the Zone.Identifier stream, got: %v", streams)
+	}
+
+	args := []string{os.Args[0], "-f", "a", "-r", "b", "--copy"}
+
+	result, err := action(append(args, testDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := result.changes[0].streams; !cmp.Equal(got, streams) {
+		t.Fatalf("Expected the streams to be detected, got: %v", got)
+	}
+
+	result, err = action(append(args, "--preserve-streams", "-x", testDir))
+	if err != nil || result.applyError != nil {
+		t.Fatalf("Unexpected error: %v, %v", err, result.applyError)
+	}
+
+	b, err := os.ReadFile(filepath.Join(testDir, "b.txt") + ":Zone.Identifier")
+	if err != nil || string(b) != "[ZoneTransfer]" {
+		t.Fatalf("Expected the stream to be copied, got: %q, %v", b, err)
+	}
+}
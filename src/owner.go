@@ -0,0 +1,51 @@
+package f2
+
+import (
+	"errors"
+
+	"github.com/pterm/pterm"
+)
+
+// errOwnerUnsupported is returned when the owner of a file cannot be
+// determined on the current platform.
+var errOwnerUnsupported = errors.New(
+	"File ownership is not supported on this platform",
+)
+
+// replaceOwnerVariables replaces {{owner}} and {{owner.group}} in the
+// target with the names of the user and group that own the file. The
+// variables resolve to an empty string if ownership is not supported on
+// the current platform (e.g. Windows).
+func (op *Operation) replaceOwnerVariables(
+	target, sourcePath string,
+	ov ownerVar,
+) (string, error) {
+	owner, group, err := fileOwner(sourcePath)
+	if errors.Is(err, errOwnerUnsupported) {
+		if op.verbose {
+			pterm.Warning.Printfln(
+				"The owner of '%s' could not be determined: %v",
+				sourcePath,
+				err,
+			)
+		}
+	} else if err != nil {
+		return target, err
+	}
+
+	for i := range ov.submatches {
+		current := ov.values[i]
+
+		value := owner
+		if current.group {
+			value = group
+		}
+
+		target = current.regex.ReplaceAllLiteralString(
+			target,
+			applyTransforms(value, current.transforms),
+		)
+	}
+
+	return target, nil
+}
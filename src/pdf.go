@@ -0,0 +1,312 @@
+package f2
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pterm/pterm"
+)
+
+// pdfReadLimit is the maximum number of bytes that are read from a PDF
+// file to find its document information.
+const pdfReadLimit = 64 << 20
+
+var (
+	errPDFMalformed = errors.New("The file is not a valid PDF document")
+
+	errPDFEncrypted = errors.New("The PDF document is encrypted")
+)
+
+var (
+	pdfInfoRefRegex  = regexp.MustCompile(`/Info\s+(\d+)\s+(\d+)\s+R`)
+	pdfRootRefRegex  = regexp.MustCompile(`/Root\s+(\d+)\s+(\d+)\s+R`)
+	pdfPagesRefRegex = regexp.MustCompile(`/Pages\s+(\d+)\s+(\d+)\s+R`)
+	pdfCountRegex    = regexp.MustCompile(`/Count\s+(\d+)`)
+	pdfEncryptRegex  = regexp.MustCompile(`/Encrypt\b`)
+)
+
+// PDF represents the document information of a PDF file.
+type PDF struct {
+	Title  string
+	Author string
+	Pages  int
+}
+
+// pdfObject returns the contents of the specified indirect object. The
+// last definition is used since incremental updates append new versions
+// of an object to the end of the file. False is returned if the object
+// is not found (e.g. because it is compressed in an object stream).
+func pdfObject(b []byte, ref []string) ([]byte, bool) {
+	re, err := regexp.Compile(`(?:^|[^\d])` + ref[1] + `\s+` + ref[2] + `\s+obj\b`)
+	if err != nil {
+		return nil, false
+	}
+
+	locs := re.FindAllIndex(b, -1)
+	if locs == nil {
+		return nil, false
+	}
+
+	obj := b[locs[len(locs)-1][1]:]
+	if end := bytes.Index(obj, []byte("endobj")); end != -1 {
+		obj = obj[:end]
+	}
+
+	return obj, true
+}
+
+// pdfLiteralString decodes a literal string (e.g. `(Title)`) that starts
+// at the beginning of b including its escape sequences and balanced
+// parentheses.
+func pdfLiteralString(b []byte) []byte {
+	var out []byte
+
+	depth := 0
+
+	for i := 1; i < len(b); i++ {
+		c := b[i]
+
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return out
+			}
+
+			depth--
+		case '\\':
+			i++
+			if i == len(b) {
+				return out
+			}
+
+			switch e := b[i]; e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// a backslash at the end of a line continues the string
+				if e == '\r' && i+1 < len(b) && b[i+1] == '\n' {
+					i++
+				}
+
+				continue
+			default:
+				if e < '0' || e > '7' {
+					c = e
+					break
+				}
+
+				n := 0
+				for j := 0; j < 3 && i < len(b) && b[i] >= '0' && b[i] <= '7'; j++ {
+					n = n*8 + int(b[i]-'0')
+					i++
+				}
+
+				i--
+				c = byte(n)
+			}
+		}
+
+		out = append(out, c)
+	}
+
+	return out
+}
+
+// pdfHexString decodes a hexadecimal string (e.g. `<FEFF0041>`) that
+// starts at the beginning of b. A missing final digit is treated as zero.
+func pdfHexString(b []byte) []byte {
+	end := bytes.IndexByte(b, '>')
+	if end == -1 {
+		return nil
+	}
+
+	digits := strings.Join(strings.Fields(string(b[1:end])), "")
+	if len(digits)%2 == 1 {
+		digits += "0"
+	}
+
+	out := make([]byte, 0, len(digits)/2)
+
+	for i := 0; i < len(digits); i += 2 {
+		n, err := strconv.ParseUint(digits[i:i+2], 16, 8)
+		if err != nil {
+			return nil
+		}
+
+		out = append(out, byte(n))
+	}
+
+	return out
+}
+
+// pdfTextString converts a PDF text string to UTF-8. Strings that start
+// with a UTF-16 byte order mark are decoded as UTF-16, and the others use
+// PDFDocEncoding which matches Latin-1 for printable characters.
+func pdfTextString(b []byte) string {
+	if bytes.HasPrefix(b, utf16BEBOM) {
+		b = b[2:]
+
+		units := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+
+		return string(utf16.Decode(units))
+	}
+
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+
+	return string(runes)
+}
+
+// pdfDictString returns the text string value of a key in a dictionary
+// or an empty string if the key is not present.
+func pdfDictString(dict []byte, key string) string {
+	re := regexp.MustCompile(`/` + key + `\s*([(<])`)
+
+	loc := re.FindSubmatchIndex(dict)
+	if loc == nil {
+		return ""
+	}
+
+	value := dict[loc[2]:]
+
+	var s []byte
+	if value[0] == '(' {
+		s = pdfLiteralString(value)
+	} else {
+		s = pdfHexString(value)
+	}
+
+	// the value is used in a file name so path separators are replaced
+	text := strings.Join(strings.Fields(pdfTextString(s)), " ")
+
+	return strings.NewReplacer("/", "_", `\`, "_").Replace(text)
+}
+
+// getPDFInfo retrieves the title and author from the document information
+// dictionary of a PDF file and the number of pages from its page tree.
+// Values that cannot be found (e.g. because the objects are compressed)
+// are left empty.
+func getPDFInfo(sourcePath string) (*PDF, error) {
+	f, err := os.Open(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	b, err := io.ReadAll(io.LimitReader(f, pdfReadLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	header := b
+	if len(header) > 1024 {
+		header = header[:1024]
+	}
+
+	if !bytes.Contains(header, []byte("%PDF-")) {
+		return &PDF{}, errPDFMalformed
+	}
+
+	if pdfEncryptRegex.Match(b) {
+		return &PDF{}, errPDFEncrypted
+	}
+
+	info := &PDF{}
+
+	if refs := pdfInfoRefRegex.FindAllStringSubmatch(string(b), -1); refs != nil {
+		if dict, ok := pdfObject(b, refs[len(refs)-1]); ok {
+			info.Title = pdfDictString(dict, "Title")
+			info.Author = pdfDictString(dict, "Author")
+		}
+	}
+
+	if refs := pdfRootRefRegex.FindAllStringSubmatch(string(b), -1); refs != nil {
+		catalog, ok := pdfObject(b, refs[len(refs)-1])
+		if !ok {
+			return info, nil
+		}
+
+		ref := pdfPagesRefRegex.FindStringSubmatch(string(catalog))
+		if ref == nil {
+			return info, nil
+		}
+
+		pages, ok := pdfObject(b, ref)
+		if !ok {
+			return info, nil
+		}
+
+		if count := pdfCountRegex.FindSubmatch(pages); count != nil {
+			info.Pages, _ = strconv.Atoi(string(count[1]))
+		}
+	}
+
+	return info, nil
+}
+
+// replacePDFVariables replaces the pdf variables in the target with the
+// corresponding values from the document. Encrypted and malformed files
+// resolve to an empty string instead of failing the operation.
+func (op *Operation) replacePDFVariables(
+	target, sourcePath string,
+	pv pdfVar,
+) (string, error) {
+	info, err := getPDFInfo(sourcePath)
+	if errors.Is(err, errPDFMalformed) || errors.Is(err, errPDFEncrypted) {
+		if op.verbose {
+			pterm.Warning.Printfln(
+				"The document information of '%s' could not be read: %v",
+				sourcePath,
+				err,
+			)
+		}
+	} else if err != nil {
+		return target, err
+	}
+
+	for i := range pv.submatches {
+		current := pv.values[i]
+
+		var value string
+
+		switch current.attr {
+		case "title":
+			value = info.Title
+		case "author":
+			value = info.Author
+		case "pages":
+			if info.Pages != 0 {
+				value = strconv.Itoa(info.Pages)
+			}
+		}
+
+		target = current.regex.ReplaceAllLiteralString(
+			target,
+			applyTransforms(value, current.transforms),
+		)
+	}
+
+	return target, nil
+}
@@ -0,0 +1,156 @@
+package f2
+
+import (
+	"encoding/hex"
+	"image"
+	"image/color"
+	_ "image/gif"  // register the gif decoder
+	_ "image/jpeg" // register the jpeg decoder
+	_ "image/png"  // register the png decoder
+	"os"
+)
+
+type phashAlgorithm string
+
+const (
+	averageHash    phashAlgorithm = "ahash"
+	differenceHash phashAlgorithm = "dhash"
+)
+
+const defaultPhashSize = 8
+
+// grayscaleGrid scales the image down to a grid of the specified
+// width and height by averaging the luminance of the pixels
+// that fall into each cell.
+func grayscaleGrid(img image.Image, width, height int) [][]float64 {
+	bounds := img.Bounds()
+	grid := make([][]float64, height)
+
+	for row := 0; row < height; row++ {
+		grid[row] = make([]float64, width)
+
+		y0 := bounds.Min.Y + row*bounds.Dy()/height
+		y1 := bounds.Min.Y + (row+1)*bounds.Dy()/height
+
+		if y1 == y0 {
+			y1++
+		}
+
+		for col := 0; col < width; col++ {
+			x0 := bounds.Min.X + col*bounds.Dx()/width
+			x1 := bounds.Min.X + (col+1)*bounds.Dx()/width
+
+			if x1 == x0 {
+				x1++
+			}
+
+			var sum float64
+
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					gray, _ := color.GrayModel.Convert(img.At(x, y)).(color.Gray)
+					sum += float64(gray.Y)
+				}
+			}
+
+			grid[row][col] = sum / float64((x1-x0)*(y1-y0))
+		}
+	}
+
+	return grid
+}
+
+// packBits converts a slice of bits to a hexadecimal string.
+func packBits(bits []bool) string {
+	b := make([]byte, (len(bits)+7)/8)
+
+	for i, bit := range bits {
+		if bit {
+			b[i/8] |= 1 << (7 - uint(i%8))
+		}
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// perceptualHash computes the perceptual hash of an image using the
+// specified algorithm. The size determines the dimensions of the grid
+// that the image is reduced to so the resulting hash has size*size bits.
+func perceptualHash(img image.Image, algorithm phashAlgorithm, size int) string {
+	var bits []bool
+
+	switch algorithm {
+	case differenceHash:
+		// each pixel is compared to its neighbour on the right
+		grid := grayscaleGrid(img, size+1, size)
+
+		for row := 0; row < size; row++ {
+			for col := 0; col < size; col++ {
+				bits = append(bits, grid[row][col] < grid[row][col+1])
+			}
+		}
+	default:
+		// each pixel is compared to the mean of all the pixels
+		grid := grayscaleGrid(img, size, size)
+
+		var mean float64
+
+		for _, row := range grid {
+			for _, v := range row {
+				mean += v
+			}
+		}
+
+		mean /= float64(size * size)
+
+		for _, row := range grid {
+			for _, v := range row {
+				bits = append(bits, v > mean)
+			}
+		}
+	}
+
+	return packBits(bits)
+}
+
+// getPerceptualHash retrieves the perceptual hash of the specified file.
+// An empty string is returned for files that are not decodable images.
+func getPerceptualHash(
+	file string,
+	algorithm phashAlgorithm,
+	size int,
+) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return "", nil
+	}
+
+	return perceptualHash(img, algorithm, size), nil
+}
+
+// replacePerceptualHash replaces all perceptual hash variables in the
+// target with the perceptual hash of the source image.
+func replacePerceptualHash(
+	target, sourcePath string,
+	pv phashVar,
+) (string, error) {
+	for i := range pv.submatches {
+		current := pv.values[i]
+
+		value, err := getPerceptualHash(sourcePath, current.algorithm, current.size)
+		if err != nil {
+			return "", err
+		}
+
+		target = current.regex.ReplaceAllLiteralString(target, value)
+	}
+
+	return target, nil
+}
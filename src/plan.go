@@ -0,0 +1,97 @@
+package f2
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// tempName returns a name in the same directory as the source of a change
+// that does not exist on the filesystem. It is used to move a file out of
+// the way when the renames in a batch form a cycle (e.g. a.txt -> b.txt
+// and b.txt -> a.txt).
+func tempName(ch *Change) string {
+	dir, name := filepath.Split(ch.Source)
+
+	for num := 1; ; num++ {
+		temp := filepath.Join(dir, "."+name+".f2tmp"+strconv.Itoa(num))
+
+		if _, err := os.Stat(filepath.Join(ch.BaseDir, temp)); err != nil &&
+			errors.Is(err, os.ErrNotExist) {
+			return temp
+		}
+	}
+}
+
+// planRenames orders the matches so that a file whose target is the current
+// path of another file in the batch is renamed after that file. Since each
+// target can only be the source of one other file, the renames form chains
+// which are applied from the end, or cycles which are broken by moving one
+// of the files to a temporary name first and into its target last.
+func (op *Operation) planRenames() {
+	// sources maps the path of each file that will be renamed to its index
+	sources := make(map[string]int, len(op.matches))
+
+	for i, ch := range op.matches {
+		source := filepath.Join(ch.BaseDir, ch.Source)
+		if source != filepath.Join(ch.BaseDir, ch.Target) &&
+			ch.action != overwritePolicySkip {
+			sources[source] = i
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make([]int, len(op.matches))
+	broken := make(map[int]string)
+	planned := make([]Change, 0, len(op.matches))
+
+	var visit func(i int)
+
+	visit = func(i int) {
+		switch state[i] {
+		case visited:
+			return
+		case visiting:
+			// i is part of a cycle so it is moved out of the way first
+			ch := op.matches[i]
+			temp := tempName(&ch)
+			broken[i] = temp
+
+			out := ch
+			out.Target = temp
+			out.tempOut = true
+			planned = append(planned, out)
+
+			return
+		}
+
+		state[i] = visiting
+
+		ch := op.matches[i]
+		if dep, ok := sources[filepath.Join(ch.BaseDir, ch.Target)]; ok && dep != i {
+			visit(dep)
+		}
+
+		state[i] = visited
+
+		if temp, ok := broken[i]; ok {
+			ch.tempFor = ch.Source
+			ch.Source = temp
+			op.tempRenames++
+		}
+
+		planned = append(planned, ch)
+	}
+
+	for i := range op.matches {
+		visit(i)
+	}
+
+	op.matches = planned
+}
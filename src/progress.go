@@ -0,0 +1,36 @@
+package f2
+
+// ProgressFunc is called as the target of each match is resolved with the
+// number of files that have been processed so far and the total. When
+// several replacements are chained, each file is counted once per
+// replacement so that the total is the number of matches multiplied
+// by the number of replacements. In copy mode, it is also called as the
+// files are copied with the number of bytes copied so far and the total.
+type ProgressFunc func(processed, total int)
+
+// WithProgress calls the provided function as the target of each file is
+// resolved so that the progress of long operations can be displayed.
+func WithProgress(progress ProgressFunc) Option {
+	return func(o *options) {
+		o.progress = progress
+	}
+}
+
+// reportProgress reports that the match at the specified index has been
+// processed in the current replacement. It does nothing if no progress
+// function is set.
+func (op *Operation) reportProgress(index int) {
+	if op.progress == nil {
+		return
+	}
+
+	passes := len(op.replacementSlice)
+	if passes == 0 {
+		passes = 1
+	}
+
+	op.progress(
+		op.pass*len(op.matches)+index+1,
+		passes*len(op.matches),
+	)
+}
@@ -0,0 +1,114 @@
+package f2
+
+import (
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// xmpReadLimit is the maximum number of bytes that are read from a file
+// to find its embedded XMP packet.
+const xmpReadLimit = 4 << 20
+
+// xmpRatingRegex matches the rating in an XMP packet which is either an
+// attribute (xmp:Rating="5") or an element (<xmp:Rating>5</xmp:Rating>).
+var xmpRatingRegex = regexp.MustCompile(
+	`xmp:Rating(?:\s*=\s*["']\s*(-?\d+)\s*["']|>\s*(-?\d+)\s*<)`,
+)
+
+// xmpRating returns the rating in XMP data. False is returned if there
+// is no rating.
+func xmpRating(b []byte) (int, bool) {
+	m := xmpRatingRegex.FindSubmatch(b)
+	if m == nil {
+		return 0, false
+	}
+
+	value := m[1]
+	if value == nil {
+		value = m[2]
+	}
+
+	n, err := strconv.Atoi(string(value))
+	if err != nil {
+		return 0, false
+	}
+
+	return n, true
+}
+
+// xmpSidecarPaths returns the paths checked for the XMP sidecar of a file
+// in order. Both `photo.xmp` and `photo.jpg.xmp` are in common use.
+func xmpSidecarPaths(sourcePath string) []string {
+	return []string{
+		filenameWithoutExtension(sourcePath) + ".xmp",
+		sourcePath + ".xmp",
+	}
+}
+
+// getRating retrieves the star rating of a file. The XMP sidecar is
+// checked first since it holds the edits made to files that are not
+// modified in place, followed by the XMP packet embedded in the file and
+// the EXIF rating tag. Ratings outside 1–5 (0 is unrated and -1 is
+// rejected) are reported as unrated.
+func getRating(sourcePath string, exifData *Exif) (int, error) {
+	rating, ok := 0, false
+
+	for _, path := range xmpSidecarPaths(sourcePath) {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return 0, err
+		}
+
+		rating, ok = xmpRating(b)
+
+		break
+	}
+
+	if !ok {
+		f, err := os.Open(sourcePath)
+		if err != nil {
+			return 0, err
+		}
+
+		defer f.Close()
+
+		b, err := io.ReadAll(io.LimitReader(f, xmpReadLimit))
+		if err != nil {
+			return 0, err
+		}
+
+		rating, ok = xmpRating(b)
+	}
+
+	if !ok {
+		rating, _ = strconv.Atoi(getExifRawTag(exifData, "Rating"))
+	}
+
+	if rating < 1 || rating > 5 {
+		return 0, nil
+	}
+
+	return rating, nil
+}
+
+// exifRating formats the star rating of a file for {{exif.rating}}.
+// Unrated files resolve to an empty string unless `--unrated-zero`
+// is set.
+func (op *Operation) exifRating(sourcePath string, exifData *Exif) (string, error) {
+	rating, err := getRating(sourcePath, exifData)
+	if err != nil {
+		return "", err
+	}
+
+	if rating == 0 && !op.unratedZero {
+		return "", nil
+	}
+
+	return strconv.Itoa(rating), nil
+}
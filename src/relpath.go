@@ -0,0 +1,38 @@
+package f2
+
+import (
+	"strings"
+)
+
+// relPath returns the path of the source of a change relative to its
+// search root with forward slashes as the separator on all platforms
+// (e.g. 'photos/2021/a.jpg'). The file name alone is returned if the
+// source is not below a search root.
+func (op *Operation) relPath(ch *Change) string {
+	_, dirs := op.pathSegments(ch)
+
+	return strings.Join(append(dirs, ch.Source), "/")
+}
+
+// replaceRelPathVariables replaces {{relpath}} in the target with the
+// path of the file relative to its search root. The separators can be
+// replaced with a transform (e.g. {{relpath.replace:'/'/'__'}}) to
+// flatten a directory tree without losing the original locations.
+func (op *Operation) replaceRelPathVariables(
+	target string,
+	ch *Change,
+	rv relPathVar,
+) string {
+	path := op.relPath(ch)
+
+	for i := range rv.submatches {
+		current := rv.values[i]
+
+		target = current.regex.ReplaceAllLiteralString(
+			target,
+			applyTransforms(path, current.transforms),
+		)
+	}
+
+	return target
+}
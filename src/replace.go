@@ -2,11 +2,13 @@ package f2
 
 import (
 	"errors"
+	"fmt"
 	"math"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 type numbersToSkip struct {
@@ -23,14 +25,50 @@ type numberVar struct {
 		format      string
 		step        int
 		skip        []numbersToSkip
+		transforms  []string
 	}
 }
 
 type transformVar struct {
 	submatches [][]string
 	values     []struct {
-		regex *regexp.Regexp
-		token string
+		regex      *regexp.Regexp
+		transforms []string
+	}
+}
+
+type ownerVar struct {
+	submatches [][]string
+	values     []struct {
+		regex      *regexp.Regexp
+		group      bool
+		transforms []string
+	}
+}
+
+type pdfVar struct {
+	submatches [][]string
+	values     []struct {
+		regex      *regexp.Regexp
+		attr       string
+		transforms []string
+	}
+}
+
+type relPathVar struct {
+	submatches [][]string
+	values     []struct {
+		regex      *regexp.Regexp
+		transforms []string
+	}
+}
+
+type dateSourceVar struct {
+	submatches [][]string
+	values     []struct {
+		regex   *regexp.Regexp
+		sources []dateSource
+		format  []string
 	}
 }
 
@@ -43,6 +81,20 @@ type exiftoolVar struct {
 }
 
 type exifVar struct {
+	submatches [][]string
+	values     []struct {
+		regex      *regexp.Regexp
+		attr       string
+		timeStr    string
+		subsec     bool
+		tag        string
+		transforms []string
+		decimals   int
+		unit       string
+	}
+}
+
+type videoVar struct {
 	submatches [][]string
 	values     []struct {
 		regex   *regexp.Regexp
@@ -54,8 +106,11 @@ type exifVar struct {
 type id3Var struct {
 	submatches [][]string
 	values     []struct {
-		regex *regexp.Regexp
-		tag   string
+		regex      *regexp.Regexp
+		tag        string
+		length     int
+		width      int
+		transforms []string
 	}
 }
 
@@ -76,6 +131,15 @@ type hashVar struct {
 	}
 }
 
+type phashVar struct {
+	submatches [][]string
+	values     []struct {
+		regex     *regexp.Regexp
+		algorithm phashAlgorithm
+		size      int
+	}
+}
+
 type randomVar struct {
 	submatches [][]string
 	values     []struct {
@@ -85,37 +149,106 @@ type randomVar struct {
 	}
 }
 
+type randomPickVar struct {
+	submatches [][]string
+	values     []struct {
+		regex   *regexp.Regexp
+		options []string
+	}
+}
+
 type csvVar struct {
 	submatches [][]string
 	values     []struct {
 		regex  *regexp.Regexp
 		column int
+		format string
 	}
 }
 
+// filenameVar contains the compiled regular expressions
+// of the match transforms in the filename variables.
+type filenameVar struct {
+	patterns map[string]*regexp.Regexp
+}
+
 type variables struct {
-	exif      exifVar
-	exiftool  exiftoolVar
-	number    numberVar
-	id3       id3Var
-	hash      hashVar
-	date      dateVar
-	random    randomVar
-	transform transformVar
-	csv       csvVar
+	filename   filenameVar
+	exif       exifVar
+	exiftool   exiftoolVar
+	number     numberVar
+	id3        id3Var
+	hash       hashVar
+	phash      phashVar
+	video      videoVar
+	date       dateVar
+	random     randomVar
+	randomPick randomPickVar
+	transform  transformVar
+	csv        csvVar
+	owner      ownerVar
+	relPath    relPathVar
+	pdf        pdfVar
+	dateSource dateSourceVar
 }
 
 var (
 	errInvalidSubmatches = errors.New("Invalid number of submatches")
+
+	errInvalidTransform = errors.New("Invalid transform token")
+
+	errInvalidMatchGroup = errors.New(
+		"The capture group does not exist in the match pattern",
+	)
+
+	errInvalidPhashSize = errors.New(
+		"The size of a perceptual hash must be greater than zero",
+	)
 )
 
+// UnknownVariableError is returned when a variable in the replacement
+// string cannot be parsed (e.g. because of an invalid transform token).
+type UnknownVariableError struct {
+	Variable string
+	Err      error
+}
+
+func (e *UnknownVariableError) Error() string {
+	return fmt.Sprintf("Unable to parse variable '%s': %v", e.Variable, e.Err)
+}
+
+func (e *UnknownVariableError) Unwrap() error {
+	return e.Err
+}
+
+// MetadataReadError is returned when the value of a variable cannot be
+// resolved because the file or its metadata could not be read.
+type MetadataReadError struct {
+	Path     string
+	Variable string
+	Err      error
+}
+
+func (e *MetadataReadError) Error() string {
+	return fmt.Sprintf(
+		"Unable to resolve variable '%s' for '%s': %v",
+		e.Variable,
+		e.Path,
+		e.Err,
+	)
+}
+
+func (e *MetadataReadError) Unwrap() error {
+	return e.Err
+}
+
 // getCsvVar retrieves all the csv variables in the replacement
 // string if any.
 func getCsvVar(replacementInput string) (csvVar, error) {
 	var c csvVar
 	if csvRegex.MatchString(replacementInput) {
 		c.submatches = csvRegex.FindAllStringSubmatch(replacementInput, -1)
-		expectedLength := 2
+		expectedLength := 3
 
 		for _, submatch := range c.submatches {
 			if len(submatch) < expectedLength {
@@ -125,15 +258,24 @@ func getCsvVar(replacementInput string) (csvVar, error) {
 			var x struct {
 				regex  *regexp.Regexp
 				column int
+				format string
 			}
 
-			regex, err := regexp.Compile(submatch[0])
+			// the row format may contain regex metacharacters such as `{`
+			regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
 			if err != nil {
 				return c, err
 			}
 
 			x.regex = regex
 
+			if submatch[1] == "" {
+				x.format = submatch[2]
+				c.values = append(c.values, x)
+
+				continue
+			}
+
 			n, err := strconv.Atoi(submatch[1])
 			if err != nil {
 				return c, err
@@ -214,6 +356,59 @@ func getHashVar(replacementInput string) (hashVar, error) {
 	return h, nil
 }
 
+// getPhashVar retrieves all the perceptual hash variables in the
+// replacement string if any.
+func getPhashVar(replacementInput string) (phashVar, error) {
+	var p phashVar
+	if phashRegex.MatchString(replacementInput) {
+		p.submatches = phashRegex.FindAllStringSubmatch(replacementInput, -1)
+		expectedLength := 3
+
+		for _, submatch := range p.submatches {
+			if len(submatch) < expectedLength {
+				return p, errInvalidSubmatches
+			}
+
+			var x struct {
+				regex     *regexp.Regexp
+				algorithm phashAlgorithm
+				size      int
+			}
+
+			regex, err := regexp.Compile(submatch[0])
+			if err != nil {
+				return p, err
+			}
+
+			x.regex = regex
+			x.algorithm = averageHash
+			x.size = defaultPhashSize
+
+			if submatch[1] != "" {
+				x.algorithm = phashAlgorithm(submatch[1])
+			}
+
+			if submatch[2] != "" {
+				x.size, err = strconv.Atoi(submatch[2])
+				if err != nil {
+					return p, err
+				}
+
+				if x.size == 0 {
+					return p, &UnknownVariableError{
+						Variable: submatch[0],
+						Err:      errInvalidPhashSize,
+					}
+				}
+			}
+
+			p.values = append(p.values, x)
+		}
+	}
+
+	return p, nil
+}
+
 // getTransformVar retrieves all the string transformation variables
 // in the replacement string if any.
 func getTransformVar(replacementInput string) (transformVar, error) {
@@ -231,17 +426,25 @@ func getTransformVar(replacementInput string) (transformVar, error) {
 			}
 
 			var x struct {
-				regex *regexp.Regexp
-				token string
+				regex      *regexp.Regexp
+				transforms []string
 			}
 
-			regex, err := regexp.Compile(submatch[0])
+			regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
 			if err != nil {
 				return t, err
 			}
 
 			x.regex = regex
-			x.token = submatch[1]
+
+			x.transforms, err = parseTransforms(submatch[1])
+			if err != nil {
+				return t, &UnknownVariableError{
+					Variable: submatch[0],
+					Err:      err,
+				}
+			}
+
 			t.values = append(t.values, x)
 		}
 	}
@@ -249,6 +452,149 @@ func getTransformVar(replacementInput string) (transformVar, error) {
 	return t, nil
 }
 
+// getOwnerVar retrieves all the owner variables in the
+// replacement string if any.
+func getOwnerVar(replacementInput string) (ownerVar, error) {
+	var ov ownerVar
+
+	ov.submatches = ownerRegex.FindAllStringSubmatch(replacementInput, -1)
+
+	for _, submatch := range ov.submatches {
+		var val struct {
+			regex      *regexp.Regexp
+			group      bool
+			transforms []string
+		}
+
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
+		if err != nil {
+			return ov, err
+		}
+
+		val.regex = regex
+		val.group = submatch[1] != ""
+
+		val.transforms, err = parseTransforms(submatch[2])
+		if err != nil {
+			return ov, &UnknownVariableError{
+				Variable: submatch[0],
+				Err:      err,
+			}
+		}
+
+		ov.values = append(ov.values, val)
+	}
+
+	return ov, nil
+}
+
+// getPDFVar retrieves all the pdf variables in the
+// replacement string if any.
+func getPDFVar(replacementInput string) (pdfVar, error) {
+	var pv pdfVar
+
+	pv.submatches = pdfRegex.FindAllStringSubmatch(replacementInput, -1)
+
+	for _, submatch := range pv.submatches {
+		var val struct {
+			regex      *regexp.Regexp
+			attr       string
+			transforms []string
+		}
+
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
+		if err != nil {
+			return pv, err
+		}
+
+		val.regex = regex
+		val.attr = submatch[1]
+
+		val.transforms, err = parseTransforms(submatch[2])
+		if err != nil {
+			return pv, &UnknownVariableError{
+				Variable: submatch[0],
+				Err:      err,
+			}
+		}
+
+		pv.values = append(pv.values, val)
+	}
+
+	return pv, nil
+}
+
+// getRelPathVar retrieves all the relative path variables in the
+// replacement string if any.
+func getRelPathVar(replacementInput string) (relPathVar, error) {
+	var rv relPathVar
+
+	rv.submatches = relPathRegex.FindAllStringSubmatch(replacementInput, -1)
+
+	for _, submatch := range rv.submatches {
+		var val struct {
+			regex      *regexp.Regexp
+			transforms []string
+		}
+
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
+		if err != nil {
+			return rv, err
+		}
+
+		val.regex = regex
+
+		val.transforms, err = parseTransforms(submatch[1])
+		if err != nil {
+			return rv, &UnknownVariableError{
+				Variable: submatch[0],
+				Err:      err,
+			}
+		}
+
+		rv.values = append(rv.values, val)
+	}
+
+	return rv, nil
+}
+
+// getDateSourceVar retrieves all the date variables with a source
+// selector in the replacement string if any.
+func getDateSourceVar(replacementInput string) (dateSourceVar, error) {
+	var dv dateSourceVar
+
+	dv.submatches = dateSourceRegex.FindAllStringSubmatch(replacementInput, -1)
+
+	for _, submatch := range dv.submatches {
+		var val struct {
+			regex   *regexp.Regexp
+			sources []dateSource
+			format  []string
+		}
+
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
+		if err != nil {
+			return dv, err
+		}
+
+		val.regex = regex
+
+		val.sources, err = parseDateSources(submatch[1])
+		if err != nil {
+			return dv, &UnknownVariableError{
+				Variable: submatch[0],
+				Err:      err,
+			}
+		}
+
+		val.format = splitDateFormat(submatch[2])
+
+		dv.values = append(dv.values, val)
+	}
+
+	return dv, nil
+}
+
 // getExifVar retrieves all the exif variables in the replacement
 // string if any.
 func getExifVar(replacementInput string) (exifVar, error) {
@@ -256,7 +602,7 @@ func getExifVar(replacementInput string) (exifVar, error) {
 
 	if exifRegex.MatchString(replacementInput) {
 		ex.submatches = exifRegex.FindAllStringSubmatch(replacementInput, -1)
-		expectedLength := 3
+		expectedLength := 13
 
 		for _, submatch := range ex.submatches {
 			if len(submatch) < expectedLength {
@@ -264,18 +610,69 @@ func getExifVar(replacementInput string) (exifVar, error) {
 			}
 
 			var val struct {
-				regex   *regexp.Regexp
-				attr    string
-				timeStr string
+				regex      *regexp.Regexp
+				attr       string
+				timeStr    string
+				subsec     bool
+				tag        string
+				transforms []string
+				decimals   int
+				unit       string
 			}
 
-			regex, err := regexp.Compile(submatch[0])
+			regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
 			if err != nil {
 				return ex, err
 			}
 
 			val.regex = regex
 
+			// raw tags (e.g. {{exif.raw:Artist.up}})
+			if submatch[5] == "raw" {
+				val.attr = submatch[5]
+				val.tag = submatch[6]
+
+				val.transforms, err = parseTransforms(submatch[7])
+				if err != nil {
+					return ex, &UnknownVariableError{
+						Variable: submatch[0],
+						Err:      err,
+					}
+				}
+
+				ex.values = append(ex.values, val)
+
+				continue
+			}
+
+			// labels of enumerated tags (e.g. {{exif.wb.lw}})
+			if submatch[8] != "" {
+				val.attr = submatch[8]
+
+				val.transforms, err = parseTransforms(submatch[9])
+				if err != nil {
+					return ex, &UnknownVariableError{
+						Variable: submatch[0],
+						Err:      err,
+					}
+				}
+
+				ex.values = append(ex.values, val)
+
+				continue
+			}
+
+			// derived focal length (e.g. {{exif.focallength35.1mm}})
+			if submatch[10] != "" {
+				val.attr = submatch[10]
+				val.decimals, _ = strconv.Atoi(submatch[11])
+				val.unit = submatch[12]
+
+				ex.values = append(ex.values, val)
+
+				continue
+			}
+
 			if strings.Contains(submatch[0], "exif.dt") ||
 				strings.Contains(submatch[0], "x.dt") {
 				submatch = append(submatch[:1], submatch[1+1:]...)
@@ -284,6 +681,7 @@ func getExifVar(replacementInput string) (exifVar, error) {
 			val.attr = submatch[1]
 			if val.attr == "dt" {
 				val.timeStr = submatch[2]
+				val.subsec = submatch[3] != ""
 			}
 
 			ex.values = append(ex.values, val)
@@ -300,7 +698,7 @@ func getNumberVar(replacementInput string) (numberVar, error) {
 
 	if indexRegex.MatchString(replacementInput) {
 		nv.submatches = indexRegex.FindAllStringSubmatch(replacementInput, -1)
-		expectedLength := 7
+		expectedLength := 14
 
 		for _, submatch := range nv.submatches {
 			if len(submatch) < expectedLength {
@@ -314,19 +712,38 @@ func getNumberVar(replacementInput string) (numberVar, error) {
 				format      string
 				step        int
 				skip        []numbersToSkip
+				transforms  []string
 			}
 
-			regex, err := regexp.Compile(submatch[0])
+			regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
 			if err != nil {
 				return nv, err
 			}
 
 			val.regex = regex
 
-			if submatch[1] != "" {
-				val.startNumber, err = strconv.Atoi(submatch[1])
+			// The submatches of an index variable that is not wrapped
+			// in braces are in the second set of capture groups
+			if submatch[2] != "" {
+				val.transforms, err = parseTransforms(submatch[7])
 				if err != nil {
-					return nv, err
+					return nv, &UnknownVariableError{
+						Variable: submatch[0],
+						Err:      err,
+					}
+				}
+			} else {
+				submatch = append(submatch[:1], submatch[8:]...)
+			}
+
+			if submatch[1] != "" {
+				if unicode.IsLetter(rune(submatch[1][0])) {
+					val.startNumber = lettersToInteger(submatch[1])
+				} else {
+					val.startNumber, err = strconv.Atoi(submatch[1])
+					if err != nil {
+						return nv, err
+					}
 				}
 			} else {
 				val.startNumber = 1
@@ -429,7 +846,7 @@ func getID3Var(replacementInput string) (id3Var, error) {
 	var iv id3Var
 	if id3Regex.MatchString(replacementInput) {
 		iv.submatches = id3Regex.FindAllStringSubmatch(replacementInput, -1)
-		expectedLength := 2
+		expectedLength := 7
 
 		for _, submatch := range iv.submatches {
 			if len(submatch) < expectedLength {
@@ -437,11 +854,14 @@ func getID3Var(replacementInput string) (id3Var, error) {
 			}
 
 			var x struct {
-				regex *regexp.Regexp
-				tag   string
+				regex      *regexp.Regexp
+				tag        string
+				length     int
+				width      int
+				transforms []string
 			}
 
-			regex, err := regexp.Compile(submatch[0])
+			regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
 			if err != nil {
 				return iv, err
 			}
@@ -449,6 +869,45 @@ func getID3Var(replacementInput string) (id3Var, error) {
 			x.regex = regex
 			x.tag = submatch[1]
 
+			// multi-line tags are truncated to the specified length
+			if submatch[2] != "" {
+				x.tag = submatch[2]
+				x.length = defaultID3TextLength
+
+				if submatch[3] != "" {
+					x.length, err = strconv.Atoi(submatch[3])
+					if err != nil {
+						return iv, &UnknownVariableError{
+							Variable: submatch[0],
+							Err:      err,
+						}
+					}
+				}
+			}
+
+			// the tempo is zero-padded to the specified width
+			if submatch[4] != "" {
+				x.tag = submatch[4]
+
+				if submatch[5] != "" {
+					x.width, err = strconv.Atoi(submatch[5])
+					if err != nil {
+						return iv, &UnknownVariableError{
+							Variable: submatch[0],
+							Err:      err,
+						}
+					}
+				}
+			}
+
+			x.transforms, err = parseTransforms(submatch[6])
+			if err != nil {
+				return iv, &UnknownVariableError{
+					Variable: submatch[0],
+					Err:      err,
+				}
+			}
+
 			iv.values = append(iv.values, x)
 		}
 	}
@@ -456,6 +915,79 @@ func getID3Var(replacementInput string) (id3Var, error) {
 	return iv, nil
 }
 
+// getVideoVar retrieves all the video variables in the replacement
+// string if any.
+func getVideoVar(replacementInput string) (videoVar, error) {
+	var vv videoVar
+	if videoRegex.MatchString(replacementInput) {
+		vv.submatches = videoRegex.FindAllStringSubmatch(replacementInput, -1)
+		expectedLength := 3
+
+		for _, submatch := range vv.submatches {
+			if len(submatch) < expectedLength {
+				return vv, errInvalidSubmatches
+			}
+
+			var x struct {
+				regex   *regexp.Regexp
+				attr    string
+				timeStr string
+			}
+
+			regex, err := regexp.Compile(submatch[0])
+			if err != nil {
+				return vv, err
+			}
+
+			x.regex = regex
+			x.attr = submatch[1]
+			x.timeStr = submatch[2]
+
+			vv.values = append(vv.values, x)
+		}
+	}
+
+	return vv, nil
+}
+
+// getRandomPickVar retrieves all the random pick variables in the
+// replacement string if any.
+func getRandomPickVar(replacementInput string) (randomPickVar, error) {
+	var rpv randomPickVar
+
+	if randomPickRegex.MatchString(replacementInput) {
+		rpv.submatches = randomPickRegex.FindAllStringSubmatch(
+			replacementInput,
+			-1,
+		)
+		expectedLength := 2
+
+		for _, submatch := range rpv.submatches {
+			if len(submatch) < expectedLength {
+				return rpv, errInvalidSubmatches
+			}
+
+			var val struct {
+				regex   *regexp.Regexp
+				options []string
+			}
+
+			// the options may contain regex metacharacters such as `|`
+			regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
+			if err != nil {
+				return rpv, err
+			}
+
+			val.regex = regex
+			val.options = strings.Split(submatch[1], "|")
+
+			rpv.values = append(rpv.values, val)
+		}
+	}
+
+	return rpv, nil
+}
+
 // getRandomVar retrieves all the random variables in the
 // replacement string if any.
 func getRandomVar(replacementInput string) (randomVar, error) {
@@ -506,6 +1038,50 @@ func getRandomVar(replacementInput string) (randomVar, error) {
 	return rv, nil
 }
 
+// getFilenameVar compiles the patterns of the match transforms in the
+// filename variables (e.g. {{f.match:\d{4}}}) and validates their
+// transform chains.
+func getFilenameVar(replacementInput string) (filenameVar, error) {
+	var fv filenameVar
+
+	for _, submatch := range filenameRegex.FindAllStringSubmatch(replacementInput, -1) {
+		if _, err := parseTransforms(submatch[9]); err != nil {
+			return fv, &UnknownVariableError{
+				Variable: submatch[0],
+				Err:      err,
+			}
+		}
+
+		if submatch[6] == "" {
+			continue
+		}
+
+		regex, err := regexp.Compile(submatch[8])
+		if err != nil {
+			return fv, &UnknownVariableError{
+				Variable: submatch[0],
+				Err:      err,
+			}
+		}
+
+		group, _ := strconv.Atoi(submatch[7])
+		if group > regex.NumSubexp() {
+			return fv, &UnknownVariableError{
+				Variable: submatch[0],
+				Err:      errInvalidMatchGroup,
+			}
+		}
+
+		if fv.patterns == nil {
+			fv.patterns = make(map[string]*regexp.Regexp)
+		}
+
+		fv.patterns[submatch[8]] = regex
+	}
+
+	return fv, nil
+}
+
 // extractVariables retrieves all the variables present in the replacement
 // string.
 func extractVariables(replacementInput string) (variables, error) {
@@ -513,6 +1089,11 @@ func extractVariables(replacementInput string) (variables, error) {
 
 	var err error
 
+	v.filename, err = getFilenameVar(replacementInput)
+	if err != nil {
+		return v, err
+	}
+
 	v.exif, err = getExifVar(replacementInput)
 	if err != nil {
 		return v, err
@@ -533,6 +1114,16 @@ func extractVariables(replacementInput string) (variables, error) {
 		return v, err
 	}
 
+	v.phash, err = getPhashVar(replacementInput)
+	if err != nil {
+		return v, err
+	}
+
+	v.video, err = getVideoVar(replacementInput)
+	if err != nil {
+		return v, err
+	}
+
 	v.date, err = getDateVar(replacementInput)
 	if err != nil {
 		return v, err
@@ -543,6 +1134,11 @@ func extractVariables(replacementInput string) (variables, error) {
 		return v, err
 	}
 
+	v.randomPick, err = getRandomPickVar(replacementInput)
+	if err != nil {
+		return v, err
+	}
+
 	v.exiftool, err = getExifToolVar(replacementInput)
 	if err != nil {
 		return v, err
@@ -558,9 +1154,86 @@ func extractVariables(replacementInput string) (variables, error) {
 		return v, err
 	}
 
+	v.owner, err = getOwnerVar(replacementInput)
+	if err != nil {
+		return v, err
+	}
+
+	v.relPath, err = getRelPathVar(replacementInput)
+	if err != nil {
+		return v, err
+	}
+
+	v.pdf, err = getPDFVar(replacementInput)
+	if err != nil {
+		return v, err
+	}
+
+	v.dateSource, err = getDateSourceVar(replacementInput)
+	if err != nil {
+		return v, err
+	}
+
 	return v, nil
 }
 
+// numberedRegexReplace is like regexReplace but replaces the match
+// number variables in the replacement with the position of each match
+// among all the matches in the input (starting from 1). Matches that are
+// not replaced due to the replacement limit are still counted so that
+// a negative limit numbers the matches from the end of the input.
+func numberedRegexReplace(
+	r *regexp.Regexp,
+	input, replacement string,
+	replaceLimit int,
+) string {
+	matches := r.FindAllStringSubmatchIndex(input, -1)
+
+	// only the matches in [first, last) are replaced
+	first, last := 0, len(matches)
+	if replaceLimit > 0 && replaceLimit < last {
+		last = replaceLimit
+	}
+
+	if replaceLimit < 0 && len(matches)+replaceLimit > 0 {
+		first = len(matches) + replaceLimit
+	}
+
+	var b strings.Builder
+
+	prev := 0
+
+	for i, m := range matches {
+		b.WriteString(input[prev:m[0]])
+
+		if i < first || i >= last {
+			b.WriteString(input[m[0]:m[1]])
+		} else {
+			expanded := string(r.ExpandString(nil, replacement, input, m))
+
+			b.WriteString(replaceMatchNumVariables(expanded, i+1))
+		}
+
+		prev = m[1]
+	}
+
+	b.WriteString(input[prev:])
+
+	return b.String()
+}
+
+// replaceMatchNumVariables replaces the match number variables in the
+// target with the number of the match, zero padded to the specified width.
+func replaceMatchNumVariables(target string, num int) string {
+	return matchNumRegex.ReplaceAllStringFunc(target, func(match string) string {
+		submatch := matchNumRegex.FindStringSubmatch(match)
+
+		width, _ := strconv.Atoi(submatch[1])
+
+		return fmt.Sprintf("%0*d", width, num)
+	})
+}
+
 // regexReplace replaces matched substrings in the input with the replacement.
 // It respects the specified replacement limit. A negative limit indicates that
 // replacement should start from the end of the fileName.
@@ -569,6 +1242,10 @@ func regexReplace(
 	input, replacement string,
 	replaceLimit int,
 ) string {
+	if matchNumRegex.MatchString(replacement) {
+		return numberedRegexReplace(r, input, replacement, replaceLimit)
+	}
+
 	var output string
 
 	switch limit := replaceLimit; {
@@ -609,27 +1286,114 @@ func regexReplace(
 }
 
 // replaceString replaces all matches in the filename
-// with the replacement string.
+// with the replacement string. The capture references in pass
+// variables (e.g. {{pass1.$1}}) are escaped so that they are not
+// expanded with the submatches of the current pass.
 func (op *Operation) replaceString(originalName string) string {
+	replacement := passCaptureRegex.ReplaceAllStringFunc(
+		op.replacement,
+		func(match string) string {
+			return strings.ReplaceAll(match, "$", "$$")
+		},
+	)
+
 	return regexReplace(
 		op.searchRegex,
 		originalName,
-		op.replacement,
+		replacement,
 		op.replaceLimit,
 	)
 }
 
+// override retrieves the target specified for a change in the
+// overrides file (if any).
+func (op *Operation) override(ch *Change) (string, bool) {
+	if len(op.overrides) == 0 {
+		return "", false
+	}
+
+	sourcePath, err := filepath.Abs(filepath.Join(ch.BaseDir, ch.originalSource))
+	if err != nil {
+		return "", false
+	}
+
+	target, ok := op.overrides[sourcePath]
+
+	return target, ok
+}
+
 // replace handles the replacement of matches in each file with the
 // replacement string.
 func (op *Operation) replace() (err error) {
+	if op.goTemplate {
+		return op.replaceWithTemplate()
+	}
+
 	vars, err := extractVariables(op.replacement)
 	if err != nil {
 		return err
 	}
 
+	err = checkCaptureNames(op.replacement, op.searchRegex)
+	if err != nil {
+		return err
+	}
+
+	// the matches may differ between replacement passes
+	op.dirIndexes = nil
+
 	for i, ch := range op.matches {
 		ch := ch // prevent memory aliasing problem when ch is referenced
 		ch.index = i
+
+		// Files that failed in a previous pass are left unchanged
+		if ch.err != nil {
+			op.reportProgress(i)
+
+			continue
+		}
+
+		name := ch.Source
+		if op.ignoreExt {
+			name = filenameWithoutExtension(name)
+		}
+
+		// Record the submatches so that they can be referenced in later passes
+		ch.captures = append(ch.captures, op.searchRegex.FindStringSubmatch(name))
+
+		// Overridden files are renamed to the exact target
+		// specified in the overrides file
+		if target, ok := op.override(&ch); ok {
+			ch.Target = target
+			op.matches[i] = ch
+			op.reportProgress(i)
+
+			continue
+		}
+
+		// Files in a manifest are renamed to the listed target only
+		// if the hash of their contents is present in the manifest
+		if op.manifest != nil {
+			target, ok, err := op.manifestTarget(&ch)
+			if err != nil {
+				if err = op.fileError(i, ch, err); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			ch.Target, ch.mismatched = target, !ok
+			if !ok {
+				ch.Target = ch.Source
+			}
+
+			op.matches[i] = ch
+			op.reportProgress(i)
+
+			continue
+		}
+
 		originalName := ch.Source
 		fileExt := filepath.Ext(originalName)
 
@@ -639,10 +1403,28 @@ func (op *Operation) replace() (err error) {
 
 		ch.Target = op.replaceString(originalName)
 
+		if op.debugVariables {
+			op.printVariableValues(ch, &vars)
+		}
+
 		// Replace any variables present with their corresponding values
 		err = op.replaceVariables(&ch, &vars)
+		if errors.Is(err, errSiblingNotFound) ||
+			errors.Is(err, errCSVRowNotFound) {
+			// leave the file unchanged
+			ch.Target = ch.Source
+			op.matches[i] = ch
+			op.reportProgress(i)
+
+			continue
+		}
+
 		if err != nil {
-			return err
+			if err = op.fileError(i, ch, err); err != nil {
+				return err
+			}
+
+			continue
 		}
 
 		// Reattach the original extension to the new file name
@@ -651,7 +1433,20 @@ func (op *Operation) replace() (err error) {
 		}
 
 		ch.Target = strings.TrimSpace(filepath.Clean(ch.Target))
+
+		if op.segmentMode {
+			err = op.replaceSegments(&ch, &vars)
+			if err != nil {
+				if err = op.fileError(i, ch, err); err != nil {
+					return err
+				}
+
+				continue
+			}
+		}
+
 		op.matches[i] = ch
+		op.reportProgress(i)
 	}
 
 	return nil
@@ -1,8 +1,11 @@
 package f2
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"testing"
 )
@@ -368,6 +371,61 @@ func TestReplacementChaining(t *testing.T) {
 	runFindReplace(t, cases)
 }
 
+func TestPassCaptureVariables(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	cases := []testCase{
+		{
+			name: "Reference the captures of the first pass in the second pass",
+			want: []Change{
+				{
+					Source:  "No Pressure (2021) S1.E1.1080p.mkv",
+					Target:  "No Pressure 2021 s1e1.mkv",
+					BaseDir: testDir,
+				},
+				{
+					Source:  "No Pressure (2021) S1.E2.1080p.mkv",
+					Target:  "No Pressure 2021 s1e2.mkv",
+					BaseDir: testDir,
+				},
+				{
+					Source:  "No Pressure (2021) S1.E3.1080p.mkv",
+					Target:  "No Pressure 2021 s1e3.mkv",
+					BaseDir: testDir,
+				},
+			},
+			args: []string{
+				"-f",
+				`(No Pressure) \((\d+)\) S(\d)\.E(\d)`,
+				"-r",
+				"$1",
+				"-f",
+				`\.1080p`,
+				"-r",
+				" {{pass1.$2}} s{{pass1.$3}}e{{pass1.$4}}{{pass1.$9}}{{pass3.$1}}",
+				testDir,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+
+	captures := [][]string{
+		nil,
+		{"ab", "a", ""},
+	}
+
+	got := replacePassCaptureVariables(
+		"{{pass1.$0}}-{{pass2.$1}}-{{pass2.$2}}-{{pass2.$0}}",
+		captures,
+	)
+
+	want := "-a--ab"
+	if got != want {
+		t.Fatalf("Expected: %s, but got: %s", want, got)
+	}
+}
+
 func TestOverwritingFiles(t *testing.T) {
 	testDir := setupFileSystem(t)
 
@@ -470,3 +528,307 @@ func TestReplaceLongPath(t *testing.T) {
 
 	runFindReplace(t, cases)
 }
+
+func TestGoTemplate(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	cases := []testCase{
+		{
+			name: "Use a Go template as the replacement",
+			want: []Change{
+				{
+					BaseDir: testDir,
+					Source:  "abc.epub",
+					Target:  "ABC_001.epub",
+				},
+				{
+					BaseDir: testDir,
+					Source:  "abc.pdf",
+					Target:  "ABC_002.pdf",
+				},
+			},
+			args: []string{
+				"-f",
+				"abc",
+				"-r",
+				"{{up .Name}}_{{pad 3 .Index}}",
+				"--go-template",
+				testDir,
+			},
+		},
+		{
+			name: "Reference capture groups in a Go template",
+			want: []Change{
+				{
+					BaseDir: filepath.Join(testDir, "scripts"),
+					Source:  "index.js",
+					Target:  "js-index",
+				},
+				{
+					BaseDir: filepath.Join(testDir, "scripts"),
+					Source:  "main.js",
+					Target:  "js-main",
+				},
+			},
+			args: []string{
+				"-f",
+				`(.*)\.(js)`,
+				"-r",
+				`{{index .Matches 2}}-{{index .Matches 1}}`,
+				"--go-template",
+				filepath.Join(testDir, "scripts"),
+			},
+		},
+		{
+			name: "Keep a dollar sign in the output of a Go template",
+			want: []Change{
+				{
+					BaseDir: filepath.Join(testDir, "scripts"),
+					Source:  "index.js",
+					Target:  "$1-index.js",
+				},
+				{
+					BaseDir: filepath.Join(testDir, "scripts"),
+					Source:  "main.js",
+					Target:  "$1-main.js",
+				},
+			},
+			args: []string{
+				"-f",
+				`(.*)\.js`,
+				"-r",
+				`{{printf "$%d" 1}}-{{index .Matches 1}}.js`,
+				"--go-template",
+				filepath.Join(testDir, "scripts"),
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+}
+
+func TestVariableErrors(t *testing.T) {
+	_, err := extractVariables("{{tr.up.foo}}_{{f}}")
+
+	var unknownErr *UnknownVariableError
+	if !errors.As(err, &unknownErr) {
+		t.Fatalf("Expected an UnknownVariableError, got: %v", err)
+	}
+
+	if unknownErr.Variable != "{{tr.up.foo}}" ||
+		!errors.Is(err, errInvalidTransform) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	testDir := t.TempDir()
+
+	vars, err := extractVariables("{{f}}_{{hash.md5}}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ch := Change{
+		BaseDir:        testDir,
+		Source:         "missing.txt",
+		originalSource: "missing.txt",
+		Target:         "{{f}}_{{hash.md5}}",
+	}
+
+	op := &Operation{}
+
+	err = op.replaceVariables(&ch, &vars)
+
+	var readErr *MetadataReadError
+	if !errors.As(err, &readErr) {
+		t.Fatalf("Expected a MetadataReadError, got: %v", err)
+	}
+
+	if readErr.Path != filepath.Join(testDir, "missing.txt") ||
+		readErr.Variable != "{{hash.md5}}" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestSuggestPattern(t *testing.T) {
+	cases := []struct {
+		name        string
+		examples    []RenameExample
+		find        string
+		replacement string
+		ok          bool
+	}{
+		{
+			name: "Replace the same text in each name",
+			examples: []RenameExample{
+				{"IMG_001.jpg", "photo-001.jpg"},
+				{"IMG_002.jpg", "photo-002.jpg"},
+			},
+			find:        "IMG_",
+			replacement: "photo-",
+			ok:          true,
+		},
+		{
+			name: "Add a prefix",
+			examples: []RenameExample{
+				{"a.txt", "2021-a.txt"},
+				{"b.txt", "2021-b.txt"},
+			},
+			find:        "^",
+			replacement: "2021-",
+			ok:          true,
+		},
+		{
+			name: "Add a suffix before the extension",
+			examples: []RenameExample{
+				{"a.txt", "a_final.txt"},
+				{"notes.md", "notes_final.md"},
+			},
+			find:        `(\.[^.]*)$`,
+			replacement: "_final${1}",
+			ok:          true,
+		},
+		{
+			name: "Remove the same text from each name",
+			examples: []RenameExample{
+				{"a (copy).txt", "a.txt"},
+				{"b.txt", "b.txt"},
+				{"c (copy).pdf", "c.pdf"},
+			},
+			find:        ` \(copy\)`,
+			replacement: "",
+			ok:          true,
+		},
+		{
+			name: "Escape the dollar sign in the replacement",
+			examples: []RenameExample{
+				{"cost.txt", "cost$.txt"},
+			},
+			find:        `(\.[^.]*)$`,
+			replacement: "$$${1}",
+			ok:          true,
+		},
+		{
+			name: "Report that no simple pattern fits",
+			examples: []RenameExample{
+				{"a.txt", "b.txt"},
+				{"c.txt", "z.txt"},
+			},
+		},
+		{
+			name: "Reject replacements that would be parsed as variables",
+			examples: []RenameExample{
+				{"a.txt", "a%03d.txt"},
+			},
+		},
+	}
+
+	for _, v := range cases {
+		find, replacement, ok := SuggestPattern(v.examples)
+		if ok != v.ok || find != v.find || replacement != v.replacement {
+			t.Fatalf(
+				"Test (%s) — Expected: %q, %q, %t, but got: %q, %q, %t",
+				v.name,
+				v.find,
+				v.replacement,
+				v.ok,
+				find,
+				replacement,
+				ok,
+			)
+		}
+	}
+
+	testDir := setupFileSystem(t)
+
+	find, replacement, _ := SuggestPattern([]RenameExample{
+		{"abc.pdf", "abc_v2.pdf"},
+		{"abc.epub", "abc_v2.epub"},
+	})
+
+	runFindReplace(t, []testCase{
+		{
+			name: "Apply a suggested pattern",
+			want: []Change{
+				{BaseDir: testDir, Source: "abc.epub", Target: "abc_v2.epub"},
+				{BaseDir: testDir, Source: "abc.pdf", Target: "abc_v2.pdf"},
+			},
+			args: []string{"-f", find, "-r", replacement, "-E", "^[^a]", testDir},
+		},
+	})
+}
+
+func TestMatchNumber(t *testing.T) {
+	cases := []struct {
+		find        string
+		input       string
+		replacement string
+		limit       int
+		want        string
+	}{
+		{`\s`, "a b c d", "_{{matchnum}}_", 0, "a_1_b_2_c_3_d"},
+		{`(\d+)`, "v1 v22 v3", "$1.{{matchnum.2}}", 0, "v1.01 v22.02 v3.03"},
+		{`(\d+)`, "v1 v22 v3", "${1}{{matchnum}}", 2, "v11 v222 v3"},
+		{`(\d+)`, "v1 v22 v3", "[{{matchnum}}]", -1, "v1 v22 v[3]"},
+		{`(\d+)`, "v1 v22 v3", "[{{matchnum}}]", -5, "v[1] v[2] v[3]"},
+		{`^v`, "v1 v2", "{{matchnum}}", 0, "11 v2"},
+		{`x`, "abc", "{{matchnum}}", 0, "abc"},
+	}
+
+	for _, tc := range cases {
+		got := regexReplace(regexp.MustCompile(tc.find), tc.input, tc.replacement, tc.limit)
+		if got != tc.want {
+			t.Fatalf("Test (%s, %d) — Expected: %s, got: %s", tc.replacement, tc.limit, tc.want, got)
+		}
+	}
+}
+
+func TestNamedCaptures(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	cases := []testCase{
+		{
+			name: "Reference named capture groups as variables",
+			want: []Change{
+				{
+					Source:  "No Pressure (2021) S1.E1.1080p.mkv",
+					BaseDir: testDir,
+					Target:  "2021 - S1E1.mkv",
+				},
+				{
+					Source:  "No Pressure (2021) S1.E2.1080p.mkv",
+					BaseDir: testDir,
+					Target:  "2021 - S1E2.mkv",
+				},
+				{
+					Source:  "No Pressure (2021) S1.E3.1080p.mkv",
+					BaseDir: testDir,
+					Target:  "2021 - S1E3.mkv",
+				},
+			},
+			args: []string{
+				"-f",
+				`.*\((?P<year>\d{4})\) S(?P<season>\d)\.E(?P<episode>\d)(?P<missing>x)?.*`,
+				"-r",
+				"{{capture.year}}{{capture.missing}} - S${season}E{{capture.episode}}",
+				"-e",
+				testDir,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+
+	var unknownErr *UnknownVariableError
+
+	result, err := action([]string{
+		os.Args[0], "-f", `(?P<year>\d{4})`, "-r", "{{capture.month}}", testDir,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = result.applyError
+	if !errors.As(err, &unknownErr) || !errors.Is(err, errInvalidMatchGroup) {
+		t.Fatalf("Expected an UnknownVariableError, got: %v", err)
+	}
+}
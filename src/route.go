@@ -0,0 +1,78 @@
+package f2
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// isRelativeFolder reports whether the folder is a relative
+// path that does not leave the directory of a file.
+func isRelativeFolder(folder string) bool {
+	folder = filepath.Clean(folder)
+
+	return folder != "." && !filepath.IsAbs(folder) && folder != ".." &&
+		!strings.HasPrefix(folder, ".."+string(filepath.Separator))
+}
+
+// loadExtensionFolders reads the file specified with the `--ext-folders`
+// flag which is a CSV file in which each row has a folder followed by the
+// extensions of the files that are moved into it (e.g. 'images,jpg,png').
+// An extension that is listed more than once uses the first folder.
+func (op *Operation) loadExtensionFolders() error {
+	records, err := readCSVFile(op.extFoldersFilename)
+	if err != nil {
+		return err
+	}
+
+	op.extFolders = make(map[string]string)
+
+	for i, v := range records {
+		minColumns := 2
+		if len(v) < minColumns {
+			return fmt.Errorf("row %d must have a folder and extension", i+1)
+		}
+
+		folder := strings.TrimSpace(v[0])
+		if !isRelativeFolder(folder) {
+			return fmt.Errorf("%w: '%s'", errInvalidExtFolder, folder)
+		}
+
+		for _, ext := range v[1:] {
+			ext = normalizeExtension(ext)
+			if ext == "" {
+				continue
+			}
+
+			if _, ok := op.extFolders[ext]; !ok {
+				op.extFolders[ext] = filepath.Clean(folder)
+			}
+		}
+	}
+
+	return nil
+}
+
+// routeByExtension places the target of each file in the folder that its
+// extension is mapped to. Files whose extension is not mapped are placed in
+// the default folder (if specified) or left in place. The folders are
+// created relative to the directory of the source file (or the
+// destination root). Directories are not routed.
+func (op *Operation) routeByExtension() {
+	for i, ch := range op.matches {
+		if ch.IsDir {
+			continue
+		}
+
+		folder, ok := op.extFolders[normalizeExtension(filepath.Ext(ch.Target))]
+		if !ok {
+			folder = op.extFolderDefault
+		}
+
+		if folder == "" {
+			continue
+		}
+
+		op.matches[i].Target = filepath.Join(folder, ch.Target)
+	}
+}
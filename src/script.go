@@ -0,0 +1,154 @@
+package f2
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// ScriptShell is the kind of shell script that is generated by Script.
+type ScriptShell string
+
+const (
+	// ScriptPOSIX generates a script for POSIX shells such as sh and bash.
+	ScriptPOSIX ScriptShell = "posix"
+	// ScriptPowerShell generates a PowerShell script.
+	ScriptPowerShell ScriptShell = "powershell"
+)
+
+// posixQuote quotes a string for a POSIX shell. Single quotes within the
+// string are closed, escaped, and reopened.
+func posixQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// powerShellQuote quotes a string for PowerShell. PowerShell treats the
+// typographic single quotes as quotes as well so all of them are doubled.
+func powerShellQuote(s string) string {
+	var b strings.Builder
+
+	b.WriteRune('\'')
+
+	for _, r := range s {
+		switch r {
+		case '\'', '‘', '’', '‚', '‛':
+			b.WriteRune(r)
+		}
+
+		b.WriteRune(r)
+	}
+
+	b.WriteRune('\'')
+
+	return b.String()
+}
+
+// scriptWriter generates the commands of a shell script.
+type scriptWriter struct {
+	shell ScriptShell
+	lines []string
+	dirs  map[string]bool
+}
+
+func (w *scriptWriter) mkdir(dir string) {
+	if w.dirs[dir] {
+		return
+	}
+
+	w.dirs[dir] = true
+
+	if w.shell == ScriptPowerShell {
+		w.lines = append(w.lines, "New-Item -ItemType Directory -Force -Path "+
+			powerShellQuote(dir)+" | Out-Null")
+
+		return
+	}
+
+	w.lines = append(w.lines, "mkdir -p -- "+posixQuote(dir))
+}
+
+func (w *scriptWriter) move(source, target string) {
+	if w.shell == ScriptPowerShell {
+		w.lines = append(w.lines, "Move-Item -Force -LiteralPath "+
+			powerShellQuote(source)+" -Destination "+powerShellQuote(target))
+
+		return
+	}
+
+	w.lines = append(w.lines, "mv -f -- "+posixQuote(source)+" "+posixQuote(target))
+}
+
+func (w *scriptWriter) copy(source, target string) {
+	if w.shell == ScriptPowerShell {
+		w.lines = append(w.lines, "Copy-Item -Force -LiteralPath "+
+			powerShellQuote(source)+" -Destination "+powerShellQuote(target))
+
+		return
+	}
+
+	w.lines = append(w.lines, "cp -p -- "+posixQuote(source)+" "+posixQuote(target))
+}
+
+func (w *scriptWriter) String() string {
+	header := []string{"#!/bin/sh", "set -e"}
+	if w.shell == ScriptPowerShell {
+		header = []string{"$ErrorActionPreference = 'Stop'"}
+	}
+
+	return strings.Join(append(header, w.lines...), "\n") + "\n"
+}
+
+// Script returns the changes in the plan as a shell script which renames
+// the files when it is run instead of renaming them directly. The changes
+// are checked for conflicts in the same way as Apply and ordered so that
+// the files do not overwrite each other, with any rename cycles broken by
+// moving a file to a temporary name. Missing directories are created
+// before the files are moved into them.
+func Script(plan *Plan, shell ScriptShell) (string, error) {
+	if shell != ScriptPOSIX && shell != ScriptPowerShell {
+		return "", errInvalidScriptShell
+	}
+
+	op := plan.op
+	op.matches = append([]Change(nil), plan.Changes...)
+
+	op.detectConflicts()
+
+	if len(op.conflicts) > 0 && !op.fixConflicts {
+		return "", errConflictDetected
+	}
+
+	// the changes are ordered separately so that the number of temporary
+	// renames is not added to that of the operation
+	ordered := &Operation{matches: op.matches}
+	ordered.planRenames()
+
+	w := &scriptWriter{
+		shell: shell,
+		dirs:  make(map[string]bool),
+	}
+
+	for _, ch := range ordered.matches {
+		source := filepath.Join(ch.BaseDir, ch.Source)
+		target := filepath.Join(ch.BaseDir, ch.Target)
+
+		if source == target || ch.action == overwritePolicySkip {
+			continue
+		}
+
+		if ch.action == overwritePolicyBackup {
+			w.move(target, ch.backupPath)
+		}
+
+		if dir := filepath.Dir(target); dir != filepath.Dir(source) {
+			w.mkdir(dir)
+		}
+
+		if op.copyMode {
+			w.copy(source, target)
+		} else {
+			w.move(source, target)
+		}
+	}
+
+	return w.String(), nil
+}
@@ -0,0 +1,130 @@
+package f2
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// segmentRoot returns the search root that contains the specified
+// directory. The deepest root is chosen if several roots contain it.
+func (op *Operation) segmentRoot(dir string) (string, bool) {
+	var root string
+
+	found := false
+
+	for _, r := range op.roots {
+		rel, err := filepath.Rel(r, dir)
+		if err != nil || rel == ".." ||
+			strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		if !found || len(r) > len(root) {
+			root, found = r, true
+		}
+	}
+
+	return root, found
+}
+
+// pathSegments returns the search root of a change and the directories
+// between the root and the source file.
+func (op *Operation) pathSegments(ch *Change) (string, []string) {
+	root, ok := op.segmentRoot(filepath.Clean(ch.BaseDir))
+	if !ok {
+		return "", nil
+	}
+
+	rel, err := filepath.Rel(root, filepath.Clean(ch.BaseDir))
+	if err != nil || rel == "." {
+		return root, nil
+	}
+
+	return root, strings.Split(rel, string(filepath.Separator))
+}
+
+// replaceSegments applies the current replacement to each directory
+// between the search root and the source file as if the directory was
+// matched itself. The new names are kept on the change so that later
+// replacements in the chain operate on the result of earlier ones.
+func (op *Operation) replaceSegments(ch *Change, vars *variables) error {
+	root, original := op.pathSegments(ch)
+	if len(original) == 0 {
+		return nil
+	}
+
+	if ch.segments == nil {
+		ch.segments = append([]string(nil), original...)
+	}
+
+	for i, name := range ch.segments {
+		seg := Change{
+			index:          ch.index,
+			originalSource: original[i],
+			BaseDir:        filepath.Join(append([]string{root}, original[:i]...)...),
+			Source:         name,
+			IsDir:          true,
+		}
+
+		if !op.searchRegex.MatchString(name) {
+			continue
+		}
+
+		seg.Target = op.replaceString(name)
+
+		err := op.replaceVariables(&seg, vars)
+		if errors.Is(err, errSiblingNotFound) ||
+			errors.Is(err, errCSVRowNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		target := strings.TrimSpace(filepath.Clean(seg.Target))
+		if target == "." || target == "" {
+			continue
+		}
+
+		ch.segments[i] = target
+	}
+
+	return nil
+}
+
+// rebuildSegmentTargets places the target of each match in the renamed
+// directories. The target is rewritten relative to the source directory
+// so that files from directories that are renamed to the same name are
+// checked for conflicts like every other target. If a destination root is
+// specified, the renamed directories are recreated under it instead.
+func (op *Operation) rebuildSegmentTargets() error {
+	for i, ch := range op.matches {
+		if ch.segments == nil {
+			continue
+		}
+
+		if op.destRoot != "" {
+			op.matches[i].Target = filepath.Join(
+				append(ch.segments, ch.Target)...,
+			)
+
+			continue
+		}
+
+		root, _ := op.pathSegments(&ch)
+
+		target, err := filepath.Rel(
+			ch.BaseDir,
+			filepath.Join(append(append([]string{root}, ch.segments...), ch.Target)...),
+		)
+		if err != nil {
+			return err
+		}
+
+		op.matches[i].Target = target
+	}
+
+	return nil
+}
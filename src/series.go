@@ -0,0 +1,111 @@
+package f2
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// defaultSeriesPattern is the find pattern used by `--renumber` when none
+// is specified. It matches the first number in the name.
+const defaultSeriesPattern = `\d+`
+
+// seriesNumber locates the existing number in the name of a change. It is
+// matched by the first capture group of the find pattern or by the entire
+// match if the pattern has no groups. The extension is ignored as it is
+// when the matches are found. False is returned if the name is not
+// numbered.
+func (op *Operation) seriesNumber(ch *Change) (loc []int, n uint64, ok bool) {
+	name := filenameWithoutExtension(ch.Source)
+
+	m := op.searchRegex.FindStringSubmatchIndex(name)
+	if m == nil {
+		return nil, 0, false
+	}
+
+	if len(m) > 2 {
+		m = m[2:4]
+	}
+
+	if m[0] < 0 {
+		return nil, 0, false
+	}
+
+	n, err := strconv.ParseUint(name[m[0]:m[1]], 10, 64)
+	if err != nil {
+		return nil, 0, false
+	}
+
+	return m[:2], n, true
+}
+
+// sortBySeries sorts the numbered matches by their existing number
+// followed by the matches that are not numbered. Matches with the same
+// number are ordered by their path.
+func (op *Operation) sortBySeries() {
+	type key struct {
+		n        uint64
+		numbered bool
+	}
+
+	keys := make(map[string]key, len(op.matches))
+
+	for i := range op.matches {
+		ch := &op.matches[i]
+		_, n, ok := op.seriesNumber(ch)
+		keys[filepath.Join(ch.BaseDir, ch.Source)] = key{n, ok}
+	}
+
+	sort.SliceStable(op.matches, func(i, j int) bool {
+		pathI := filepath.Join(op.matches[i].BaseDir, op.matches[i].Source)
+		pathJ := filepath.Join(op.matches[j].BaseDir, op.matches[j].Source)
+		keyI, keyJ := keys[pathI], keys[pathJ]
+
+		if keyI.numbered != keyJ.numbered {
+			return keyI.numbered
+		}
+
+		if keyI.n != keyJ.n {
+			return keyI.n < keyJ.n
+		}
+
+		return pathI < pathJ
+	})
+}
+
+// renumberTargets replaces the existing number in the name of each
+// numbered match with its position in a gapless sequence that starts at 1
+// and spans all the matches. The numbers are padded with zeros to the
+// renumber width or to the length of the longest existing number if the
+// width is zero. Matches that are not numbered are left unchanged.
+func (op *Operation) renumberTargets() {
+	width := op.renumberWidth
+
+	if width == 0 {
+		for i := range op.matches {
+			if loc, _, ok := op.seriesNumber(&op.matches[i]); ok &&
+				loc[1]-loc[0] > width {
+				width = loc[1] - loc[0]
+			}
+		}
+	}
+
+	seq := 0
+
+	for i := range op.matches {
+		ch := &op.matches[i]
+		ch.Target = ch.Source
+
+		loc, _, ok := op.seriesNumber(ch)
+		if !ok {
+			continue
+		}
+
+		seq++
+
+		ch.Target = ch.Source[:loc[0]] +
+			fmt.Sprintf("%0*d", width, seq) +
+			ch.Source[loc[1]:]
+	}
+}
@@ -0,0 +1,107 @@
+package f2
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// errSiblingNotFound is returned when no sibling matches a file whose
+// target contains {{sibling.name}} and the sibling policy is 'skip'.
+var errSiblingNotFound = errors.New("No matching sibling")
+
+// isSibling reports whether the named file satisfies the sibling rules
+// specified with the `--sibling-ext` and `--sibling-pattern` flags.
+// Any file matches if neither rule is specified.
+func (op *Operation) isSibling(name string) bool {
+	if op.siblingExt != "" {
+		ext := strings.TrimPrefix(filepath.Ext(name), ".")
+		if !strings.EqualFold(ext, strings.TrimPrefix(op.siblingExt, ".")) {
+			return false
+		}
+	}
+
+	if op.siblingPattern != nil && !op.siblingPattern.MatchString(name) {
+		return false
+	}
+
+	return true
+}
+
+// commonPrefixLength returns the length of the common prefix
+// of two strings in bytes.
+func commonPrefixLength(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+
+	return n
+}
+
+// findSibling returns the name of the file in the same directory as the
+// source that satisfies the sibling rules. If several files match, the
+// one that shares the longest prefix with the source is chosen and ties
+// are broken alphabetically. An empty string is returned if no file matches.
+func (op *Operation) findSibling(ch *Change) (string, error) {
+	entries, err := os.ReadDir(ch.BaseDir)
+	if err != nil {
+		return "", err
+	}
+
+	var candidates []string
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		if entry.IsDir() || name == ch.originalSource || !op.isSibling(name) {
+			continue
+		}
+
+		candidates = append(candidates, name)
+	}
+
+	if len(candidates) == 0 {
+		return "", nil
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ilen := commonPrefixLength(candidates[i], ch.originalSource)
+		jlen := commonPrefixLength(candidates[j], ch.originalSource)
+
+		if ilen != jlen {
+			return ilen > jlen
+		}
+
+		return candidates[i] < candidates[j]
+	})
+
+	return candidates[0], nil
+}
+
+// replaceSiblingVariables replaces {{sibling.name}} in the target with the
+// name of the matching sibling (excluding the extension). If there is no
+// match, the variable is replaced with an empty string or errSiblingNotFound
+// is returned depending on the sibling policy.
+func (op *Operation) replaceSiblingVariables(
+	target string,
+	ch *Change,
+) (string, error) {
+	sibling, err := op.findSibling(ch)
+	if err != nil {
+		return target, err
+	}
+
+	if sibling == "" && op.siblingPolicy == siblingPolicySkip {
+		return target, errSiblingNotFound
+	}
+
+	return regexReplace(
+		siblingRegex,
+		target,
+		filenameWithoutExtension(sibling),
+		0,
+	), nil
+}
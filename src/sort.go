@@ -1,7 +1,6 @@
 package f2
 
 import (
-	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
@@ -11,6 +10,15 @@ import (
 	"gopkg.in/djherbis/times.v1"
 )
 
+const (
+	// defaultSort sorts the matches in alphabetical order.
+	defaultSort = "default"
+	// sizeSort sorts the matches by their file size.
+	sizeSort = "size"
+	// exifDateSort sorts the matches by the original date in their exif data.
+	exifDateSort = "exifdate"
+)
+
 // sortMatches is used to sort files to avoid renaming conflicts.
 func (op *Operation) sortMatches() {
 	sort.SliceStable(op.matches, func(i, j int) bool {
@@ -29,78 +37,146 @@ func (op *Operation) sortMatches() {
 	})
 }
 
-// sortBySize sorts the matches according to their file size.
-func (op *Operation) sortBySize() (err error) {
+// sortBySize sorts the matches according to their file size. Files of
+// the same size are ordered by their source path in either direction.
+func (op *Operation) sortBySize() error {
+	sizes := make(map[string]int64, len(op.matches))
+
+	for _, ch := range op.matches {
+		path := filepath.Join(ch.BaseDir, ch.Source)
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		sizes[path] = info.Size()
+	}
+
+	op.sortByKey(func(path string) int64 {
+		return sizes[path]
+	})
+
+	return nil
+}
+
+// fileTime retrieves the specified file attribute (mtime, atime, btime or
+// ctime). The modification time is used if the birth or change time is
+// not available.
+func fileTime(t times.Timespec, attr string) time.Time {
+	switch attr {
+	case birthTime:
+		if t.HasBirthTime() {
+			return t.BirthTime()
+		}
+	case accessTime:
+		return t.AccessTime()
+	case changeTime:
+		if t.HasChangeTime() {
+			return t.ChangeTime()
+		}
+	}
+
+	return t.ModTime()
+}
+
+// sortByTime sorts the matches by the specified file attribute
+// (mtime, atime, btime or ctime). Files with the same time are ordered by
+// their source path in either direction.
+func (op *Operation) sortByTime() error {
+	stamps := make(map[string]int64, len(op.matches))
+
+	for _, ch := range op.matches {
+		path := filepath.Join(ch.BaseDir, ch.Source)
+
+		t, err := times.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		stamps[path] = fileTime(t, op.sort).UnixNano()
+	}
+
+	op.sortByKey(func(path string) int64 {
+		return stamps[path]
+	})
+
+	return nil
+}
+
+// sortByKey sorts the matches by the key of their path with the largest
+// key first, or the smallest first if the sort is reversed. Only the key
+// comparison is reversed so that ties are always ordered by the source path
+// and the result is the same on every run.
+func (op *Operation) sortByKey(key func(path string) int64) {
 	sort.SliceStable(op.matches, func(i, j int) bool {
 		ipath := filepath.Join(op.matches[i].BaseDir, op.matches[i].Source)
 		jpath := filepath.Join(op.matches[j].BaseDir, op.matches[j].Source)
 
-		var ifile, jfile fs.FileInfo
-		ifile, err = os.Stat(ipath)
-		jfile, err = os.Stat(jpath)
+		ikey, jkey := key(ipath), key(jpath)
 
-		isize := ifile.Size()
-		jsize := jfile.Size()
+		if ikey == jkey {
+			return ipath < jpath
+		}
 
 		if op.reverseSort {
-			return isize < jsize
+			return ikey < jkey
 		}
 
-		return isize > jsize
+		return ikey > jkey
 	})
-
-	return err
 }
 
-// sortByTime sorts the matches by the specified file attribute
-// (mtime, atime, btime or ctime).
-func (op *Operation) sortByTime() (err error) {
+// sortByExifDate sorts the matches by the original date in their exif data.
+// Files without a valid exif date are grouped at the end (or the start
+// if --undated-first is set) regardless of the sort direction and ordered
+// by their source path so that the result is the same on every run.
+// Files with the same date are also ordered by their source path.
+func (op *Operation) sortByExifDate() (err error) {
+	dates := make(map[string]time.Time, len(op.matches))
+
+	for _, ch := range op.matches {
+		path := filepath.Join(ch.BaseDir, ch.Source)
+
+		var exifData *Exif
+
+		exifData, err = getExifData(path)
+		if err != nil {
+			return err
+		}
+
+		if date, ok := exifDateInUTC(exifData, op.exifOffset); ok {
+			dates[path] = date
+		}
+	}
+
 	sort.SliceStable(op.matches, func(i, j int) bool {
 		ipath := filepath.Join(op.matches[i].BaseDir, op.matches[i].Source)
 		jpath := filepath.Join(op.matches[j].BaseDir, op.matches[j].Source)
 
-		var ifile, jfile times.Timespec
-		ifile, err = times.Stat(ipath)
-		jfile, err = times.Stat(jpath)
-
-		var itime, jtime time.Time
-		switch op.sort {
-		case modTime:
-			itime = ifile.ModTime()
-			jtime = jfile.ModTime()
-		case birthTime:
-			itime = ifile.ModTime()
-			jtime = jfile.ModTime()
-			if ifile.HasBirthTime() {
-				itime = ifile.BirthTime()
-			}
-			if jfile.HasBirthTime() {
-				jtime = jfile.BirthTime()
-			}
-		case accessTime:
-			itime = ifile.AccessTime()
-			jtime = jfile.AccessTime()
-		case changeTime:
-			itime = ifile.ModTime()
-			jtime = jfile.ModTime()
-			if ifile.HasChangeTime() {
-				itime = ifile.ChangeTime()
-			}
-			if jfile.HasChangeTime() {
-				jtime = jfile.ChangeTime()
+		itime, iok := dates[ipath]
+		jtime, jok := dates[jpath]
+
+		if iok != jok {
+			if op.undatedFirst {
+				return jok
 			}
+
+			return iok
 		}
 
-		it, jt := itime.UnixNano(), jtime.UnixNano()
+		if !iok || itime.Equal(jtime) {
+			return ipath < jpath
+		}
 
 		if op.reverseSort {
-			return it < jt
+			return itime.Before(jtime)
 		}
 
-		return it > jt
+		return itime.After(jtime)
 	})
 
-	return err
+	return nil
 }
 
 func (op *Operation) sortPaths(
@@ -186,11 +262,36 @@ func (op *Operation) sortPaths(
 // sortBy delegates the sorting of matches to the appropriate method.
 func (op *Operation) sortBy() (err error) {
 	switch op.sort {
-	case "size":
+	case sizeSort:
 		return op.sortBySize()
 	case accessTime, modTime, birthTime, changeTime:
 		return op.sortByTime()
+	case exifDateSort:
+		return op.sortByExifDate()
 	}
 
 	return nil
 }
+
+// matchOrder records the position of each match before sorting so that
+// the original order can be restored afterwards.
+func (op *Operation) matchOrder() map[string]int {
+	order := make(map[string]int, len(op.matches))
+
+	for i, ch := range op.matches {
+		order[filepath.Join(ch.BaseDir, ch.originalSource)] = i
+	}
+
+	return order
+}
+
+// restoreOrder returns the matches to the order recorded by matchOrder
+// without affecting the indices that have already been assigned.
+func (op *Operation) restoreOrder(order map[string]int) {
+	sort.SliceStable(op.matches, func(i, j int) bool {
+		ipath := filepath.Join(op.matches[i].BaseDir, op.matches[i].originalSource)
+		jpath := filepath.Join(op.matches[j].BaseDir, op.matches[j].originalSource)
+
+		return order[ipath] < order[jpath]
+	})
+}
@@ -1,6 +1,15 @@
 package f2
 
-import "testing"
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
 
 func TestSortBySize(t *testing.T) {
 	testDir := "../testdata/images"
@@ -207,3 +216,290 @@ func TestDefaultSort(t *testing.T) {
 
 	runFindReplace(t, cases)
 }
+
+func TestKeepOrder(t *testing.T) {
+	testDir := "../testdata/images"
+
+	want := []Change{
+		{
+			Source:  "bike.jpeg",
+			BaseDir: testDir,
+			Target:  "003.jpeg",
+		},
+		{
+			Source:  "bike.json",
+			BaseDir: testDir,
+			Target:  "006.json",
+		},
+		{
+			Source:  "proraw.dng",
+			BaseDir: testDir,
+			Target:  "002.dng",
+		},
+		{
+			Source:  "proraw.json",
+			BaseDir: testDir,
+			Target:  "005.json",
+		},
+		{
+			Source:  "tractor-raw.cr2",
+			BaseDir: testDir,
+			Target:  "001.cr2",
+		},
+		{
+			Source:  "tractor-raw.json",
+			BaseDir: testDir,
+			Target:  "004.json",
+		},
+	}
+
+	args := []string{
+		os.Args[0],
+		"-f",
+		".*",
+		"-r",
+		"%03d",
+		"-e",
+		"-sort",
+		"size",
+		"--keep-order",
+		"-E",
+		"exiftool",
+		testDir,
+	}
+
+	result, err := action(args)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !cmp.Equal(want, result.changes, cmpopts.IgnoreUnexported(Change{})) {
+		t.Fatalf(
+			"Expected: %+v, got: %+v\n",
+			prettyPrint(want),
+			prettyPrint(result.changes),
+		)
+	}
+}
+
+func TestSortByExifDate(t *testing.T) {
+	testDir := "../testdata/images"
+
+	cases := []testCase{
+		{
+			name: "Sort files by exif date with undated files at the end",
+			want: []Change{
+				{
+					Source:  "proraw.dng",
+					BaseDir: testDir,
+					Target:  "001.dng",
+				},
+				{
+					Source:  "bike.jpeg",
+					BaseDir: testDir,
+					Target:  "002.jpeg",
+				},
+				{
+					Source:  "tractor-raw.cr2",
+					BaseDir: testDir,
+					Target:  "003.cr2",
+				},
+				{
+					Source:  "bike.json",
+					BaseDir: testDir,
+					Target:  "004.json",
+				},
+				{
+					Source:  "proraw.json",
+					BaseDir: testDir,
+					Target:  "005.json",
+				},
+				{
+					Source:  "tractor-raw.json",
+					BaseDir: testDir,
+					Target:  "006.json",
+				},
+			},
+			args: []string{
+				"-f",
+				".*",
+				"-r",
+				"%03d",
+				"-e",
+				"-sort",
+				"exifdate",
+				"-E",
+				"exiftool",
+				testDir,
+			},
+		},
+		{
+			name: "Reverse sort files by exif date with undated files at the end",
+			want: []Change{
+				{
+					Source:  "tractor-raw.cr2",
+					BaseDir: testDir,
+					Target:  "001.cr2",
+				},
+				{
+					Source:  "bike.jpeg",
+					BaseDir: testDir,
+					Target:  "002.jpeg",
+				},
+				{
+					Source:  "proraw.dng",
+					BaseDir: testDir,
+					Target:  "003.dng",
+				},
+				{
+					Source:  "bike.json",
+					BaseDir: testDir,
+					Target:  "004.json",
+				},
+				{
+					Source:  "proraw.json",
+					BaseDir: testDir,
+					Target:  "005.json",
+				},
+				{
+					Source:  "tractor-raw.json",
+					BaseDir: testDir,
+					Target:  "006.json",
+				},
+			},
+			args: []string{
+				"-f",
+				".*",
+				"-r",
+				"%03d",
+				"-e",
+				"-sortr",
+				"exifdate",
+				"-E",
+				"exiftool",
+				testDir,
+			},
+		},
+		{
+			name: "Sort files by exif date with undated files at the start",
+			want: []Change{
+				{
+					Source:  "bike.json",
+					BaseDir: testDir,
+					Target:  "001.json",
+				},
+				{
+					Source:  "proraw.json",
+					BaseDir: testDir,
+					Target:  "002.json",
+				},
+				{
+					Source:  "tractor-raw.json",
+					BaseDir: testDir,
+					Target:  "003.json",
+				},
+				{
+					Source:  "proraw.dng",
+					BaseDir: testDir,
+					Target:  "004.dng",
+				},
+				{
+					Source:  "bike.jpeg",
+					BaseDir: testDir,
+					Target:  "005.jpeg",
+				},
+				{
+					Source:  "tractor-raw.cr2",
+					BaseDir: testDir,
+					Target:  "006.cr2",
+				},
+			},
+			args: []string{
+				"-f",
+				".*",
+				"-r",
+				"%03d",
+				"-e",
+				"-sort",
+				"exifdate",
+				"--undated-first",
+				"-E",
+				"exiftool",
+				testDir,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+}
+
+func TestSortTies(t *testing.T) {
+	testDir := t.TempDir()
+
+	mtime := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	files := map[string]string{
+		"c.txt": "aa",
+		"a.txt": "aa",
+		"b.txt": "aa",
+		"d.txt": "a",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(testDir, name)
+
+		err := os.WriteFile(path, []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if name == "d.txt" {
+			err = os.Chtimes(path, mtime, mtime.Add(-time.Hour))
+		} else {
+			err = os.Chtimes(path, mtime, mtime)
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		sort string
+		want []string
+	}{
+		{sort: "--sort=size", want: []string{"a.txt", "b.txt", "c.txt", "d.txt"}},
+		{sort: "--sortr=size", want: []string{"d.txt", "a.txt", "b.txt", "c.txt"}},
+		{sort: "--sort=mtime", want: []string{"a.txt", "b.txt", "c.txt", "d.txt"}},
+		{sort: "--sortr=mtime", want: []string{"d.txt", "a.txt", "b.txt", "c.txt"}},
+	}
+
+	for _, tc := range cases {
+		args := []string{
+			os.Args[0], "-f", ".*", "-r", "%03d{{ext}}", tc.sort, testDir,
+		}
+
+		result, err := action(args)
+		if err != nil {
+			t.Fatalf("Test (%s) — Unexpected error: %v", tc.sort, err)
+		}
+
+		var got []string
+
+		for _, ch := range result.changes {
+			got = append(got, ch.Source)
+		}
+
+		if !cmp.Equal(tc.want, got) {
+			t.Fatalf("Test (%s) — Expected: %v, got: %v", tc.sort, tc.want, got)
+		}
+	}
+}
+
+func TestInvalidSort(t *testing.T) {
+	args := []string{os.Args[0], "-f", "a", "--sort", "name", "."}
+
+	_, err := action(args)
+	if !errors.Is(err, errInvalidSort) {
+		t.Fatalf("Expected errInvalidSort, got: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package f2
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// RenameExample is an original file name and the name that
+// it should be renamed to.
+type RenameExample struct {
+	Source string
+	Target string
+}
+
+// extensionPattern matches the extension at the end of a file name.
+const extensionPattern = `(\.[^.]*)$`
+
+// nameDiff splits the source and target into their common prefix and
+// suffix and the differing parts in between (by characters).
+func nameDiff(source, target string) (prefix, from, to string) {
+	s, t := []rune(source), []rune(target)
+
+	p := 0
+	for p < len(s) && p < len(t) && s[p] == t[p] {
+		p++
+	}
+
+	n := 0
+	for n < len(s)-p && n < len(t)-p && s[len(s)-1-n] == t[len(t)-1-n] {
+		n++
+	}
+
+	return string(s[:p]), string(s[p : len(s)-n]), string(t[p : len(t)-n])
+}
+
+// patternCandidates returns the find patterns and replacements that
+// could transform the source of an example into its target.
+func patternCandidates(ex RenameExample) [][2]string {
+	prefix, from, to := nameDiff(ex.Source, ex.Target)
+	replacement := strings.ReplaceAll(to, "$", "$$")
+
+	var candidates [][2]string
+
+	if from != "" {
+		candidates = append(candidates, [2]string{
+			regexp.QuoteMeta(from),
+			replacement,
+		})
+	} else {
+		candidates = append(candidates,
+			[2]string{"^", replacement},
+			[2]string{"$", replacement},
+			[2]string{extensionPattern, replacement + "${1}"},
+		)
+	}
+
+	if prefix != "" {
+		candidates = append(candidates, [2]string{
+			"^" + regexp.QuoteMeta(prefix+from),
+			strings.ReplaceAll(prefix, "$", "$$") + replacement,
+		})
+	}
+
+	// the extension is compared separately so that
+	// a change at the end of the name is anchored to it
+	if ext := filepath.Ext(ex.Source); ext != "" && from != "" &&
+		strings.HasSuffix(ex.Source, from+ext) {
+		candidates = append(candidates, [2]string{
+			regexp.QuoteMeta(from) + extensionPattern,
+			replacement + "${1}",
+		})
+	}
+
+	return candidates
+}
+
+// SuggestPattern infers a find pattern (a regular expression) and a
+// replacement string that rename the source of each example to its
+// target so that programs which embed f2 can offer renaming by example.
+// Only simple changes are detected such as replacing, removing, or
+// inserting the same text in each name. False is returned if no such
+// pattern fits all the examples. Examples that are unchanged are ignored.
+func SuggestPattern(examples []RenameExample) (find, replacement string, ok bool) {
+	var changed []RenameExample
+
+	for _, v := range examples {
+		if v.Source != v.Target {
+			changed = append(changed, v)
+		}
+	}
+
+	if len(changed) == 0 {
+		return "", "", false
+	}
+
+	for _, ex := range changed {
+		for _, c := range patternCandidates(ex) {
+			if fitsExamples(c[0], c[1], examples) {
+				return c[0], c[1], true
+			}
+		}
+	}
+
+	return "", "", false
+}
+
+// fitsExamples reports whether replacing every match of the find pattern
+// in the source of each example produces its target. Replacements that
+// would be parsed as variables (e.g. '{{f}}' or '%03d') never fit.
+func fitsExamples(find, replacement string, examples []RenameExample) bool {
+	if strings.Contains(replacement, "{{") || indexRegex.MatchString(replacement) {
+		return false
+	}
+
+	re, err := regexp.Compile(find)
+	if err != nil {
+		return false
+	}
+
+	for _, v := range examples {
+		if re.ReplaceAllString(v.Source, replacement) != v.Target {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,133 @@
+package f2
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// changeStatus describes what happens to a file when the changes are applied.
+type changeStatus string
+
+const (
+	statusOK          changeStatus = "ok"
+	statusFixed       changeStatus = "conflict fixed"
+	statusUnchanged   changeStatus = "unchanged"
+	statusOverwriting changeStatus = "overwriting"
+	statusCrossDevice changeStatus = "moving across devices"
+	statusStreams     changeStatus = "alternate streams lost"
+	statusMismatched  changeStatus = "skipped: checksum mismatch"
+	statusSkipped     changeStatus = "skipped: path already exists"
+	statusBackup      changeStatus = "backing up existing file"
+	statusFailed      changeStatus = "failed"
+)
+
+// changeStatuses lists every status in the order in which they are reported.
+// New statuses must be added here so that they are included in the summary.
+var changeStatuses = []changeStatus{
+	statusOK,
+	statusFixed,
+	statusUnchanged,
+	statusOverwriting,
+	statusCrossDevice,
+	statusStreams,
+	statusMismatched,
+	statusSkipped,
+	statusBackup,
+	statusFailed,
+}
+
+// summary tallies the changes in an operation by their status.
+type summary struct {
+	counts    map[changeStatus]int
+	total     int
+	conflicts int
+}
+
+// changeStatus retrieves the status of a change. When more than one status
+// applies, the last one in the following order wins: conflict fixed by a
+// fix strategy, unchanged, overwriting, moving across devices, losing the
+// alternate data streams, checksum mismatch, the overwrite policy, and
+// failing to resolve the target.
+func (op *Operation) changeStatus(ch *Change) changeStatus {
+	status := statusOK
+
+	if ch.fixedBy != "" {
+		status = statusFixed
+	}
+
+	if filepath.Join(ch.BaseDir, ch.Source) == filepath.Join(ch.BaseDir, ch.Target) {
+		status = statusUnchanged
+	}
+
+	if ch.WillOverwrite {
+		status = statusOverwriting
+	}
+
+	if ch.crossDevice {
+		status = statusCrossDevice
+	}
+
+	if op.losesStreams(ch) {
+		status = statusStreams
+	}
+
+	if ch.mismatched {
+		status = statusMismatched
+	}
+
+	switch ch.action {
+	case overwritePolicySkip:
+		status = statusSkipped
+	case overwritePolicyBackup:
+		status = statusBackup
+	}
+
+	if ch.err != nil {
+		status = statusFailed
+	}
+
+	return status
+}
+
+// summarize counts the changes for each status and the number of
+// conflicts that were detected. Every status is present in the counts
+// even if no change has that status.
+func (op *Operation) summarize() summary {
+	s := summary{
+		counts: make(map[changeStatus]int, len(changeStatuses)),
+		total:  len(op.matches),
+	}
+
+	for _, status := range changeStatuses {
+		s.counts[status] = 0
+	}
+
+	for i := range op.matches {
+		s.counts[op.changeStatus(&op.matches[i])]++
+	}
+
+	for _, conflicts := range op.conflicts {
+		s.conflicts += len(conflicts)
+	}
+
+	return s
+}
+
+// String formats the summary as a comma-separated list of the
+// statuses that apply to at least one change.
+func (s summary) String() string {
+	parts := []string{fmt.Sprintf("%d file(s)", s.total)}
+
+	for _, status := range changeStatuses {
+		if n := s.counts[status]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, status))
+		}
+	}
+
+	if s.conflicts > 0 {
+		parts = append(parts, fmt.Sprintf("%d conflict(s)", s.conflicts))
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,148 @@
+package f2
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+const (
+	// defaultKeepCategories are the Unicode categories that are kept when
+	// stripping symbols: letters, marks, numbers, and spaces.
+	defaultKeepCategories = "L,M,N,Zs"
+	// defaultKeepChars are the punctuation characters that are kept
+	// when stripping symbols.
+	defaultKeepChars = "-_.,'()[]&+"
+)
+
+// Code points that make up emoji sequences.
+const (
+	zeroWidthJoiner  = '\u200D'
+	keycapCombiner   = '\u20E3'
+	textSelector     = '\uFE0E'
+	emojiSelector    = '\uFE0F'
+	skinToneFirst    = '\U0001F3FB'
+	skinToneLast     = '\U0001F3FF'
+	emojiTagFirst    = '\U000E0020'
+	emojiTagLast     = '\U000E007F'
+	regionalIndFirst = '\U0001F1E6'
+	regionalIndLast  = '\U0001F1FF'
+)
+
+// symbolFilter removes the characters that do not belong to one of the
+// allowed Unicode categories and are not explicitly allowed.
+type symbolFilter struct {
+	categories []*unicode.RangeTable
+	chars      string
+}
+
+// defaultSymbolFilter is used by the `safe` transform.
+var defaultSymbolFilter = symbolFilter{
+	categories: []*unicode.RangeTable{unicode.L, unicode.M, unicode.N, unicode.Zs},
+	chars:      defaultKeepChars,
+}
+
+// newSymbolFilter creates a filter from a comma-separated list of Unicode
+// categories (e.g. 'L,Nd,Zs') and the characters that are always kept.
+func newSymbolFilter(categories, chars string) (*symbolFilter, error) {
+	f := &symbolFilter{chars: chars}
+
+	for _, v := range strings.Split(categories, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		table, ok := unicode.Categories[v]
+		if !ok {
+			return nil, fmt.Errorf("%w: '%s'", errInvalidKeepCategories, v)
+		}
+
+		f.categories = append(f.categories, table)
+	}
+
+	return f, nil
+}
+
+// isEmojiComponent reports whether r modifies the preceding
+// character in an emoji sequence.
+func isEmojiComponent(r rune) bool {
+	return r == keycapCombiner || r == textSelector || r == emojiSelector ||
+		(r >= skinToneFirst && r <= skinToneLast) ||
+		(r >= emojiTagFirst && r <= emojiTagLast)
+}
+
+// keep reports whether r is allowed by the filter.
+func (f *symbolFilter) keep(r rune) bool {
+	return strings.ContainsRune(f.chars, r) || unicode.IsOneOf(f.categories, r)
+}
+
+// strip removes the disallowed characters from the input. Emoji sequences
+// (e.g. keycaps, flags, skin tones, and sequences joined with a zero-width
+// joiner) are removed as a whole even if some of their code points are
+// allowed. Whitespace is normalized if anything was removed.
+func (f *symbolFilter) strip(input string) string {
+	runes := []rune(input)
+
+	var b strings.Builder
+
+	removed := false
+
+	for i := 0; i < len(runes); {
+		base := runes[i]
+		emoji := base >= regionalIndFirst && base <= regionalIndLast
+
+		j := i + 1
+
+		for j < len(runes) {
+			switch r := runes[j]; {
+			case isEmojiComponent(r):
+				emoji = emoji || r == keycapCombiner ||
+					(r >= skinToneFirst && r <= skinToneLast)
+				j++
+
+				continue
+			case r == zeroWidthJoiner && j+1 < len(runes):
+				emoji = true
+				j += 2
+
+				continue
+			case emoji && r >= regionalIndFirst && r <= regionalIndLast:
+				j++
+
+				continue
+			}
+
+			break
+		}
+
+		if !emoji && f.keep(base) {
+			b.WriteRune(base)
+			removed = removed || j > i+1
+		} else {
+			removed = true
+		}
+
+		i = j
+	}
+
+	if !removed {
+		return input
+	}
+
+	return normalizeSpace(b.String())
+}
+
+// stripSymbols removes the disallowed characters from the file name in
+// each target. The extension and any directories in the target
+// are preserved.
+func (op *Operation) stripSymbols() {
+	for i, ch := range op.matches {
+		dir, base := filepath.Split(ch.Target)
+		ext := filepath.Ext(base)
+		name := op.symbolFilter.strip(strings.TrimSuffix(base, ext))
+
+		op.matches[i].Target = dir + name + ext
+	}
+}
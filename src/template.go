@@ -0,0 +1,156 @@
+package f2
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// templateData is the data that is made available to the replacement
+// string when it is executed as a Go text/template.
+type templateData struct {
+	// Source is the original file name (including the extension).
+	Source string
+	// Name is the original file name without its extension.
+	Name string
+	// Ext is the file extension (including the leading period).
+	Ext string
+	// Parent is the name of the parent directory.
+	Parent string
+	// Path is the path to the file.
+	Path string
+	// Index is the position of the file in the matches (starts at 1).
+	Index int
+	// IsDir reports whether the file is a directory.
+	IsDir bool
+	// Matches contains the find pattern match and its capture groups.
+	Matches []string
+	// CSV contains the columns of the corresponding CSV row (if any).
+	CSV []string
+}
+
+// Exif returns the exif data of the file. It is only retrieved
+// if referenced in the template.
+func (d *templateData) Exif() (*Exif, error) {
+	return getExifData(d.Path)
+}
+
+// ID3 returns the id3 tags of the file. It is only retrieved
+// if referenced in the template.
+func (d *templateData) ID3() (*ID3, error) {
+	return getID3Tags(d.Path)
+}
+
+// Video returns the metadata of an MP4 or QuickTime file. It is only
+// retrieved if referenced in the template.
+func (d *templateData) Video() (*Video, error) {
+	return getVideoData(d.Path)
+}
+
+// templateFuncs returns the helper functions that are available
+// to replacement templates. They mirror the built-in variables.
+func templateFuncs() template.FuncMap {
+	funcs := template.FuncMap{
+		"pad": func(width, n int) string {
+			return fmt.Sprintf("%0*d", width, n)
+		},
+		"hash": func(algorithm, path string) (string, error) {
+			return getHash(path, hashAlgorithm(algorithm))
+		},
+	}
+
+	for _, token := range strings.Split(transformTokens, "|") {
+		token := token
+		funcs[token] = func(input string) string {
+			return transformString(input, token)
+		}
+	}
+
+	return funcs
+}
+
+// newTemplateData creates the template data for the specified change.
+func (op *Operation) newTemplateData(
+	ch *Change,
+	originalName string,
+) *templateData {
+	parentDir := filepath.Base(ch.BaseDir)
+	if parentDir == "." {
+		parentDir = filepath.Base(op.workingDir)
+	}
+
+	return &templateData{
+		Source:  ch.Source,
+		Name:    filenameWithoutExtension(ch.Source),
+		Ext:     filepath.Ext(ch.Source),
+		Parent:  parentDir,
+		Path:    filepath.Join(ch.BaseDir, ch.originalSource),
+		Index:   op.numberIndex(ch.index) + 1,
+		IsDir:   ch.IsDir,
+		Matches: op.searchRegex.FindStringSubmatch(originalName),
+		CSV:     ch.csvRow,
+	}
+}
+
+// replaceWithTemplate handles the replacement of matches in each file
+// when the replacement string is a Go text/template. The built-in
+// variables are not parsed in this mode.
+func (op *Operation) replaceWithTemplate() error {
+	tmpl, err := template.New("replacement").
+		Funcs(templateFuncs()).
+		Parse(op.replacement)
+	if err != nil {
+		return err
+	}
+
+	for i, ch := range op.matches {
+		ch := ch // prevent memory aliasing problem when ch is referenced
+		ch.index = i
+
+		if target, ok := op.override(&ch); ok {
+			ch.Target = target
+			op.matches[i] = ch
+			op.reportProgress(i)
+
+			continue
+		}
+
+		originalName := ch.Source
+		fileExt := filepath.Ext(originalName)
+
+		if op.ignoreExt {
+			originalName = filenameWithoutExtension(originalName)
+		}
+
+		var out strings.Builder
+
+		err = tmpl.Execute(&out, op.newTemplateData(&ch, originalName))
+		if err != nil {
+			return fmt.Errorf(
+				"Failed to execute template for '%s': %w",
+				ch.Source,
+				err,
+			)
+		}
+
+		// the output is escaped so that a '$' in it is kept as is
+		// instead of being expanded as a capture group
+		ch.Target = regexReplace(
+			op.searchRegex,
+			originalName,
+			strings.ReplaceAll(out.String(), "$", "$$"),
+			op.replaceLimit,
+		)
+
+		if op.ignoreExt {
+			ch.Target += fileExt
+		}
+
+		ch.Target = strings.TrimSpace(filepath.Clean(ch.Target))
+		op.matches[i] = ch
+		op.reportProgress(i)
+	}
+
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/olekukonko/tablewriter"
 )
@@ -81,6 +82,9 @@ func readCSVFile(filePath string) ([][]string, error) {
 	defer f.Close()
 
 	csvReader := csv.NewReader(f)
+	// rows may have a different number of columns
+	// (e.g. a variable number of extensions)
+	csvReader.FieldsPerRecord = -1
 
 	records, err := csvReader.ReadAll()
 	if err != nil {
@@ -89,3 +93,118 @@ func readCSVFile(filePath string) ([][]string, error) {
 
 	return records, nil
 }
+
+// readPaths reads a list of paths separated by newlines or by NUL
+// characters if null is true. Empty entries are ignored.
+func readPaths(r io.Reader, null bool) ([]string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	sep := "\n"
+	if null {
+		sep = "\x00"
+	}
+
+	var paths []string
+
+	for _, v := range strings.Split(string(b), sep) {
+		if !null {
+			v = strings.TrimSuffix(v, "\r")
+		}
+
+		if v != "" {
+			paths = append(paths, v)
+		}
+	}
+
+	return paths, nil
+}
+
+// progressWriter reports the number of bytes written through it.
+type progressWriter struct {
+	w        io.Writer
+	progress func(n int64)
+}
+
+func (pw progressWriter) Write(b []byte) (int, error) {
+	n, err := pw.w.Write(b)
+	pw.progress(int64(n))
+
+	return n, err
+}
+
+// copyFile copies a file to the target while preserving its permissions and
+// modification time. The copy is removed if it is incomplete. If progress is
+// not nil, it receives the number of bytes written as the copy proceeds.
+func copyFile(source, target string, progress func(n int64)) (err error) {
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+
+	defer src.Close()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	if fi.IsDir() {
+		return errCopyDir
+	}
+
+	dst, err := os.OpenFile(
+		target,
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
+		fi.Mode().Perm(),
+	)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			os.Remove(target)
+		}
+	}()
+
+	var w io.Writer = dst
+	if progress != nil {
+		w = progressWriter{w: dst, progress: progress}
+	}
+
+	_, err = io.Copy(w, src)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+
+	err = dst.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(target, fi.ModTime(), fi.ModTime())
+}
+
+// moveAcrossDevices moves a file to a different device by copying it to
+// the target and removing the source.
+func moveAcrossDevices(source, target string) error {
+	fi, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+
+	if fi.IsDir() {
+		return errCrossDeviceDir
+	}
+
+	err = copyFile(source, target, nil)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(source)
+}
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -41,6 +42,15 @@ const (
 	maxFilenameLengthExceeded
 	invalidCharacters
 	trailingPeriod
+	// sourceExists is used when the target is the current path of another
+	// file in the same batch as opposed to an unrelated file on the disk
+	sourceExists
+	// crossDevice is used when the target is on a different device from
+	// the source which cannot be renamed without copying the file
+	crossDevice
+	// caseCollision is used when two or more targets differ only in case
+	// which is reported if --case-conflicts is set
+	caseCollision
 )
 
 // Conflict represents a renaming operation conflict
@@ -93,6 +103,22 @@ func newTarget(ch *Change, renamedPaths map[string][]struct {
 	}
 }
 
+// backupPath returns a path that does not exist on the filesystem
+// for moving an existing file out of the way. For example: image.png
+// becomes image.png.bak or image.png.bak2 if the former exists.
+func backupPath(path string) string {
+	backup := path + ".bak"
+
+	for num := 2; ; num++ {
+		if _, err := os.Stat(backup); err != nil &&
+			errors.Is(err, os.ErrNotExist) {
+			return backup
+		}
+
+		backup = path + ".bak" + strconv.Itoa(num)
+	}
+}
+
 // reportConflicts prints any detected conflicts to the standard error.
 func (op *Operation) reportConflicts() {
 	var data [][]string
@@ -134,6 +160,17 @@ func (op *Operation) reportConflicts() {
 		}
 	}
 
+	if slice, exists := op.conflicts[sourceExists]; exists {
+		for _, v := range slice {
+			slice := []string{
+				strings.Join(v.source, ""),
+				v.target,
+				pterm.Red("path belongs to another file being renamed"),
+			}
+			data = append(data, slice)
+		}
+	}
+
 	if slice, exists := op.conflicts[overwritingNewPath]; exists {
 		for _, v := range slice {
 			for _, s := range v.source {
@@ -147,6 +184,30 @@ func (op *Operation) reportConflicts() {
 		}
 	}
 
+	if slice, exists := op.conflicts[caseCollision]; exists {
+		for _, v := range slice {
+			for _, s := range v.source {
+				slice := []string{
+					s,
+					v.target,
+					pterm.Red("target differs from another only in case"),
+				}
+				data = append(data, slice)
+			}
+		}
+	}
+
+	if slice, exists := op.conflicts[crossDevice]; exists {
+		for _, v := range slice {
+			slice := []string{
+				strings.Join(v.source, ""),
+				v.target,
+				pterm.Red("target is on a different device"),
+			}
+			data = append(data, slice)
+		}
+	}
+
 	if slice, exists := op.conflicts[invalidCharacters]; exists {
 		for _, v := range slice {
 			for _, s := range v.source {
@@ -203,6 +264,16 @@ func (op *Operation) detectConflicts() {
 		index      int // helps keep track of source position in the op.matches slice
 	})
 
+	// sourcePaths is used to distinguish between targets that exist
+	// because they are part of the batch and unrelated files
+	sourcePaths := make(map[string]bool, len(op.matches))
+	for _, ch := range op.matches {
+		// unchanged files remain on the disk
+		if ch.Source != ch.Target {
+			sourcePaths[filepath.Join(ch.BaseDir, ch.Source)] = true
+		}
+	}
+
 	for i := 0; i < len(op.matches); i++ {
 		ch := op.matches[i]
 		sourcePath := filepath.Join(ch.BaseDir, ch.Source)
@@ -260,7 +331,22 @@ func (op *Operation) detectConflicts() {
 			continue
 		}
 
-		detected = op.checkPathExistsConflict(sourcePath, targetPath, &ch, i)
+		detected = op.checkCrossDeviceConflict(
+			sourcePath,
+			targetPath,
+			i,
+		)
+		if detected {
+			continue
+		}
+
+		detected = op.checkPathExistsConflict(
+			sourcePath,
+			targetPath,
+			&ch,
+			i,
+			sourcePaths,
+		)
 		if detected && op.fixConflicts {
 			i--
 			continue
@@ -276,14 +362,191 @@ func (op *Operation) detectConflicts() {
 	}
 
 	op.checkOverwritingPathConflict(renamedPaths)
+
+	if op.confirm == nil && !op.copyMode {
+		op.checkVacatedSourceConflict(sourcePaths)
+	}
+
+	if op.caseConflicts {
+		op.checkCaseCollisionConflict(renamedPaths)
+	}
+
+	op.detectStreams()
+}
+
+// checkVacatedSourceConflict reports targets that belong to another file in
+// the batch which will not be renamed after all (e.g. because it is skipped
+// by the overwrite policy or left unchanged to fix a conflict).
+func (op *Operation) checkVacatedSourceConflict(sourcePaths map[string]bool) {
+	kept := make(map[string]bool)
+
+	for _, ch := range op.matches {
+		sourcePath := filepath.Join(ch.BaseDir, ch.Source)
+
+		if sourcePaths[sourcePath] &&
+			(ch.Source == ch.Target || ch.action == overwritePolicySkip) {
+			kept[sourcePath] = true
+		}
+	}
+
+	for i, ch := range op.matches {
+		sourcePath := filepath.Join(ch.BaseDir, ch.Source)
+		targetPath := filepath.Join(ch.BaseDir, ch.Target)
+
+		if sourcePath == targetPath || !kept[targetPath] {
+			continue
+		}
+
+		op.conflicts[sourceExists] = append(
+			op.conflicts[sourceExists],
+			Conflict{
+				source: []string{sourcePath},
+				target: targetPath,
+			},
+		)
+
+		if op.fixConflicts {
+			op.matches[i].Target = op.fixTarget(&op.matches[i], nil)
+		}
+	}
+}
+
+// checkCaseCollisionConflict reports targets that differ only in case
+// (e.g. Song.mp3 and song.mp3) regardless of whether the filesystem is
+// case-insensitive. If conflicts are being fixed, the first target in
+// each group is kept while the others are numbered.
+func (op *Operation) checkCaseCollisionConflict(
+	renamedPaths map[string][]struct {
+		sourcePath string
+		index      int
+	},
+) {
+	folded := make(map[string][]string)
+
+	for k := range renamedPaths {
+		key := strings.ToLower(k)
+		folded[key] = append(folded[key], k)
+	}
+
+	for _, paths := range folded {
+		if len(paths) < 2 {
+			continue
+		}
+
+		sort.Strings(paths)
+
+		var sources []string
+
+		for _, p := range paths {
+			for _, v := range renamedPaths[p] {
+				sources = append(sources, v.sourcePath)
+			}
+		}
+
+		op.conflicts[caseCollision] = append(
+			op.conflicts[caseCollision],
+			Conflict{
+				source: sources,
+				target: paths[0],
+			},
+		)
+
+		if !op.fixConflicts {
+			continue
+		}
+
+		for _, p := range paths[1:] {
+			for _, v := range renamedPaths[p] {
+				ch := &op.matches[v.index]
+
+				for {
+					target := op.fixTarget(ch, renamedPaths)
+					pt := filepath.Join(ch.BaseDir, target)
+					renamedPaths[pt] = nil
+
+					// the numbered target may also differ only in case
+					if _, ok := folded[strings.ToLower(pt)]; !ok {
+						folded[strings.ToLower(pt)] = []string{pt}
+						ch.Target = target
+
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+// existingAncestor returns the path or its closest ancestor
+// that exists on the filesystem.
+func existingAncestor(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+
+		path = parent
+	}
+}
+
+// checkCrossDeviceConflict detects if the target of a change is on a
+// different device from the source. Such a change is reported as a conflict
+// unless the cross-device policy allows the file to be copied, and it is
+// left unchanged if conflicts are being fixed.
+func (op *Operation) checkCrossDeviceConflict(
+	sourcePath, targetPath string,
+	i int,
+) bool {
+	// copies are made across devices as a matter of course
+	if sourcePath == targetPath || op.copyMode {
+		return false
+	}
+
+	sourceDevice, err := deviceID(sourcePath)
+	if err != nil || sourceDevice == "" {
+		return false
+	}
+
+	targetDevice, err := deviceID(existingAncestor(filepath.Dir(targetPath)))
+	if err != nil || targetDevice == sourceDevice {
+		return false
+	}
+
+	if op.crossDevicePolicy == crossDevicePolicyCopy {
+		op.matches[i].crossDevice = true
+
+		return false
+	}
+
+	op.conflicts[crossDevice] = append(
+		op.conflicts[crossDevice],
+		Conflict{
+			source: []string{sourcePath},
+			target: targetPath,
+		},
+	)
+
+	if op.fixConflicts {
+		// The file is left unchanged
+		op.matches[i].Target = op.matches[i].Source
+	}
+
+	return true
 }
 
 // checkPathExistsConflict reports if the newly renamed path
-// already exists on the filesystem.
+// already exists on the filesystem. A path that belongs to another
+// file in the batch is reported separately from an unrelated file.
 func (op *Operation) checkPathExistsConflict(
 	sourcePath, targetPath string,
 	ch *Change,
 	i int,
+	sourcePaths map[string]bool,
 ) bool {
 	var conflictDetected bool
 	// Report if target path exists on the filesystem
@@ -295,14 +558,43 @@ func (op *Operation) checkPathExistsConflict(
 			return conflictDetected
 		}
 
+		// The other file is renamed first unless each change is
+		// confirmed since it may be skipped (see planRenames)
+		if sourcePaths[targetPath] && op.confirm == nil && !op.copyMode {
+			return conflictDetected
+		}
+
+		// The files in the batch are never overwritten when copying
+		// since they are supposed to remain in place
+		kept := op.copyMode && sourcePaths[targetPath]
+
 		// Don't report a conflict if overwriting files are allowed
-		if op.allowOverwrites {
+		if op.allowOverwrites && !kept {
 			op.matches[i].WillOverwrite = true
 			return conflictDetected
 		}
 
-		op.conflicts[fileExists] = append(
-			op.conflicts[fileExists],
+		// The overwrite policy only applies to unrelated files
+		if op.overwritePolicy != "" && !sourcePaths[targetPath] {
+			op.matches[i].action = op.overwritePolicy
+
+			switch op.overwritePolicy {
+			case overwritePolicyOverwrite:
+				op.matches[i].WillOverwrite = true
+			case overwritePolicyBackup:
+				op.matches[i].backupPath = backupPath(targetPath)
+			}
+
+			return conflictDetected
+		}
+
+		conflict := fileExists
+		if sourcePaths[targetPath] {
+			conflict = sourceExists
+		}
+
+		op.conflicts[conflict] = append(
+			op.conflicts[conflict],
 			Conflict{
 				source: []string{sourcePath},
 				target: targetPath,
@@ -312,7 +604,7 @@ func (op *Operation) checkPathExistsConflict(
 		conflictDetected = true
 
 		if op.fixConflicts {
-			op.matches[i].Target = newTarget(ch, nil)
+			op.matches[i].Target = op.fixTarget(&op.matches[i], nil)
 		}
 	}
 
@@ -320,56 +612,91 @@ func (op *Operation) checkPathExistsConflict(
 }
 
 // checkOverwritingPathConflict ensures that a newly renamed path
-// is not overwritten by another renamed file.
+// is not overwritten by another renamed file. When conflicts are being
+// fixed, the files that share a target are numbered in the order of the
+// assigned indices (i.e. the `--sort` order) so that the same files
+// receive the same numbers on every run regardless of the order in which
+// they were found or displayed.
 func (op *Operation) checkOverwritingPathConflict(
 	renamedPaths map[string][]struct {
 		sourcePath string
 		index      int
 	},
 ) {
-	// Report duplicate targets if any
+	// before reports whether the match at position i comes
+	// before the match at position j in the sort order
+	before := func(i, j int) bool {
+		if op.matches[i].index != op.matches[j].index {
+			return op.matches[i].index < op.matches[j].index
+		}
+
+		return i < j
+	}
+
+	var targets []string
+
 	for k, v := range renamedPaths {
 		if len(v) > 1 {
-			var sources []string
-			for _, s := range v {
-				sources = append(sources, s.sourcePath)
-			}
+			sort.SliceStable(v, func(i, j int) bool {
+				return before(v[i].index, v[j].index)
+			})
 
-			op.conflicts[overwritingNewPath] = append(
-				op.conflicts[overwritingNewPath],
-				Conflict{
-					source: sources,
-					target: k,
-				},
-			)
+			targets = append(targets, k)
+		}
+	}
 
-			if op.fixConflicts {
-				for i := 0; i < len(v); i++ {
-					item := v[i]
+	sort.Slice(targets, func(i, j int) bool {
+		return before(
+			renamedPaths[targets[i]][0].index,
+			renamedPaths[targets[j]][0].index,
+		)
+	})
 
-					if i == 0 {
-						continue
-					}
+	// Report duplicate targets if any
+	for _, k := range targets {
+		v := renamedPaths[k]
 
-					target := newTarget(
-						&op.matches[item.index],
-						renamedPaths,
-					)
-					pt := filepath.Join(op.matches[item.index].BaseDir, target)
-
-					if _, ok := renamedPaths[pt]; !ok {
-						renamedPaths[pt] = []struct {
-							sourcePath string
-							index      int
-						}{}
-						op.matches[item.index].Target = target
-					} else {
-						// repeat the last iteration to generate a new path
-						op.matches[item.index].Target = target
-						i--
-						continue
-					}
-				}
+		var sources []string
+		for _, s := range v {
+			sources = append(sources, s.sourcePath)
+		}
+
+		op.conflicts[overwritingNewPath] = append(
+			op.conflicts[overwritingNewPath],
+			Conflict{
+				source: sources,
+				target: k,
+			},
+		)
+
+		if !op.fixConflicts {
+			continue
+		}
+
+		for i := 0; i < len(v); i++ {
+			item := v[i]
+
+			if i == 0 {
+				continue
+			}
+
+			target := op.fixTarget(
+				&op.matches[item.index],
+				renamedPaths,
+			)
+			pt := filepath.Join(op.matches[item.index].BaseDir, target)
+
+			if _, ok := renamedPaths[pt]; !ok {
+				renamedPaths[pt] = []struct {
+					sourcePath string
+					index      int
+				}{}
+				op.matches[item.index].Target = target
+			} else {
+				// repeat the last iteration to generate a new path
+				op.matches[item.index].Target = target
+				i--
+				continue
 			}
 		}
 	}
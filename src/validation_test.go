@@ -2,6 +2,7 @@ package f2
 
 import (
 	"bytes"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -124,6 +125,139 @@ func TestDetectConflicts(t *testing.T) {
 	}
 
 	runConflictCheck(t, table)
+
+	batchDir := t.TempDir()
+
+	for _, v := range []string{"a.txt", "b.txt", "c.log"} {
+		err := os.WriteFile(filepath.Join(batchDir, v), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	overrides := filepath.Join(t.TempDir(), "overrides.csv")
+
+	err := os.WriteFile(overrides, []byte(
+		filepath.Join(batchDir, "a.txt")+",c.log\n"+
+			filepath.Join(batchDir, "b.txt")+",a.txt\n",
+	), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runConflictCheck(t, []conflictTable{
+		{
+			name: "Target is the source of another file that is not renamed",
+			want: map[conflictType][]Conflict{
+				sourceExists: {
+					{
+						source: []string{filepath.Join(batchDir, "b.txt")},
+						target: filepath.Join(batchDir, "a.txt"),
+					},
+				},
+			},
+			args: []string{
+				"-f",
+				"txt",
+				"--overrides",
+				overrides,
+				"--overwrite-policy",
+				"skip",
+				batchDir,
+			},
+		},
+	})
+}
+
+func TestCaseCollisionConflicts(t *testing.T) {
+	testDir := t.TempDir()
+
+	for _, v := range []string{"a-Song.mp3", "b-song.mp3"} {
+		err := os.WriteFile(filepath.Join(testDir, v), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	args := []string{"-f", "^[ab]-", "-r", "", testDir}
+
+	result, err := action(append(os.Args[0:1], args...))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(result.conflicts[caseCollision]) != 0 {
+		t.Fatalf("Expected no case conflicts by default, got: %+v", result.conflicts)
+	}
+
+	args = append([]string{"--case-conflicts"}, args...)
+
+	runConflictCheck(t, []conflictTable{
+		{
+			name: "Targets differ only in case",
+			want: map[conflictType][]Conflict{
+				caseCollision: {
+					{
+						source: []string{
+							filepath.Join(testDir, "a-Song.mp3"),
+							filepath.Join(testDir, "b-song.mp3"),
+						},
+						target: filepath.Join(testDir, "Song.mp3"),
+					},
+				},
+			},
+			args: args,
+		},
+	})
+
+	runFixConflict(t, []testCase{
+		{
+			name: "Number targets that differ only in case",
+			want: []Change{
+				{Source: "a-Song.mp3", BaseDir: testDir, Target: "Song.mp3"},
+				{Source: "b-song.mp3", BaseDir: testDir, Target: "song (2).mp3"},
+			},
+			args: append([]string{"-F"}, args...),
+		},
+	})
+}
+
+func TestFixConflictsSortOrder(t *testing.T) {
+	testDir := t.TempDir()
+
+	for name, content := range map[string]string{
+		"a.txt": "aaa",
+		"b.txt": "b",
+		"c.txt": "cc",
+	} {
+		err := os.WriteFile(filepath.Join(testDir, name), []byte(content), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []Change{
+		{Source: "a.txt", BaseDir: testDir, Target: "same (3).txt"},
+		{Source: "b.txt", BaseDir: testDir, Target: "same.txt"},
+		{Source: "c.txt", BaseDir: testDir, Target: "same (2).txt"},
+	}
+
+	runFixConflict(t, []testCase{
+		{
+			name: "Number the files that share a target in the sort order",
+			want: want,
+			args: []string{
+				"-f", ".*", "-r", "same.txt", "-F", "--sortr", "size", testDir,
+			},
+		},
+		{
+			name: "Number the files in the sort order when it is not kept",
+			want: want,
+			args: []string{
+				"-f", ".*", "-r", "same.txt", "-F", "--sortr", "size", "--keep-order", testDir,
+			},
+		},
+	})
 }
 
 func TestFixConflicts(t *testing.T) {
@@ -236,6 +370,12 @@ func TestReportConflicts(t *testing.T) {
 				target: filepath.Join(testDir, ""),
 			},
 		},
+		sourceExists: {
+			{
+				source: []string{filepath.Join(testDir, "abc.epub")},
+				target: filepath.Join(testDir, "abc.pdf"),
+			},
+		},
 		trailingPeriod: {
 			{
 				source: []string{filepath.Join(testDir, "abc.pdf")},
@@ -360,3 +500,120 @@ func TestGetNewPath(t *testing.T) {
 		}
 	}
 }
+
+func TestFixStrategies(t *testing.T) {
+	testDir := t.TempDir()
+
+	for _, dir := range []string{"a", "b", "c", filepath.Join("out", "c")} {
+		if err := os.MkdirAll(filepath.Join(testDir, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, content := range map[string]string{
+		filepath.Join("a", "img.jpg"):        "one",
+		filepath.Join("b", "img.jpg"):        "two",
+		filepath.Join("c", "img.jpg"):        "three",
+		filepath.Join("out", "c", "img.jpg"): "taken",
+	} {
+		err := os.WriteFile(filepath.Join(testDir, name), []byte(content), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sum, err := getHash(filepath.Join(testDir, "c", "img.jpg"), sha256Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join("..", "out", "img.jpg")
+
+	table := []struct {
+		name    string
+		args    []string
+		targets []string
+		fixedBy []fixStrategy
+	}{
+		{
+			name: "Try the strategies in order",
+			args: []string{"--fix-strategy", "dir,hash,number"},
+			targets: []string{
+				target,
+				filepath.Join("..", "out", "b", "img.jpg"),
+				filepath.Join("..", "out", "img_"+sum[:fixHashLength]+".jpg"),
+			},
+			fixedBy: []fixStrategy{"", fixStrategyDir, fixStrategyHash},
+		},
+		{
+			name: "Number the files when the other strategies fail",
+			args: []string{"--fix-strategy", "dir"},
+			targets: []string{
+				target,
+				filepath.Join("..", "out", "b", "img.jpg"),
+				filepath.Join("..", "out", "img (2).jpg"),
+			},
+			fixedBy: []fixStrategy{"", fixStrategyDir, fixStrategyNumber},
+		},
+		{
+			name: "Number the files without a strategy",
+			targets: []string{
+				target,
+				filepath.Join("..", "out", "img (2).jpg"),
+				filepath.Join("..", "out", "img (3).jpg"),
+			},
+			fixedBy: []fixStrategy{"", "", ""},
+		},
+	}
+
+	for _, tc := range table {
+		args := append([]string{}, os.Args[0:1]...)
+		args = append(args, tc.args...)
+		args = append(
+			args,
+			"-f", "img", "-r", filepath.Join("..", "out", "img"), "-F",
+			filepath.Join(testDir, "a"),
+			filepath.Join(testDir, "b"),
+			filepath.Join(testDir, "c"),
+		)
+
+		result, err := action(args)
+		if err != nil {
+			t.Fatalf("Test (%s) — Unexpected error: %v", tc.name, err)
+		}
+
+		sortChanges(result.changes)
+
+		if len(result.changes) != len(tc.targets) {
+			t.Fatalf(
+				"Test (%s) — Expected %d changes, got: %s",
+				tc.name,
+				len(tc.targets),
+				prettyPrint(result.changes),
+			)
+		}
+
+		for i, ch := range result.changes {
+			if ch.Target != tc.targets[i] || ch.fixedBy != tc.fixedBy[i] {
+				t.Fatalf(
+					"Test (%s) — Expected target '%s' fixed by '%s', got '%s' fixed by '%s'",
+					tc.name,
+					tc.targets[i],
+					tc.fixedBy[i],
+					ch.Target,
+					ch.fixedBy,
+				)
+			}
+		}
+	}
+
+	args := append(
+		[]string{},
+		os.Args[0], "-f", "img", "-F", "--fix-strategy", "dir,size", testDir,
+	)
+
+	_, err = action(args)
+	if !errors.Is(err, errInvalidFixStrategy) {
+		t.Fatalf("Expected error '%v', got: %v", errInvalidFixStrategy, err)
+	}
+}
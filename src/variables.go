@@ -7,9 +7,11 @@ import (
 	"crypto/sha512"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash"
 	"io"
+	"math"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -18,6 +20,7 @@ import (
 	"strings"
 	"time"
 	"unicode"
+	"unicode/utf8"
 
 	exiftool "github.com/barasher/go-exiftool"
 	"github.com/dhowden/tag"
@@ -50,10 +53,43 @@ const (
 	numberBytes = "0123456789"
 )
 
+// transformTokens lists the string transformations that can be
+// applied through `{{tr.<token>}}` or appended to other variables.
+const transformTokens = "up|lw|ti|win|mac|di|slug|safe|squeeze"
+
+// transformArg matches an argument of a parameterized transform which is
+// either quoted (e.g. ' ') or bare (e.g. _). A backslash escapes the
+// next character such as a quote or the '/' delimiter.
+const transformArg = `(?:'(?:[^'\\]|\\.)*'|(?:[^'./}\\]|\\.)*)`
+
+// transformToken matches a single transform token such as `.lw`,
+// `.replace:' '/'_'`, `.squeeze:_` or `.padnum:3`.
+const transformToken = `\.(?:replace:` + transformArg + `/` + transformArg +
+	`|squeeze:` + transformArg + `|padnum:` + transformArg + `|[a-z]+)`
+
+// transformChain matches a dot-separated chain of transform tokens
+// such as `.lw.slug`. The tokens are validated after matching so that
+// an unknown token can be reported.
+const transformChain = `(?:` + transformToken + `)*`
+
+// replaceTransform is the prefix of the transform that replaces
+// each occurrence of a literal string with another.
+const replaceTransform = "replace:"
+
+// squeezeTransform is the prefix of the transform that collapses
+// consecutive occurrences of a literal string to one.
+const squeezeTransform = "squeeze:"
+
+// padNumTransform is the prefix of the transform that pads each number
+// in a string with zeros to a width.
+const padNumTransform = "padnum:"
+
 // Exif represents exif information from an image file.
 type Exif struct {
 	ISOSpeedRatings       []int
 	DateTimeOriginal      string
+	SubSecTimeOriginal    string
+	OffsetTimeOriginal    string
 	Make                  string
 	Model                 string
 	ExposureTime          []string
@@ -64,10 +100,18 @@ type Exif struct {
 	LensModel             string
 	Software              string
 	FocalLengthIn35mmFilm []int
+	FocalPlaneXResolution []string
+	FocalPlaneYResolution []string
+	FocalPlaneUnit        []int `json:"FocalPlaneResolutionUnit"`
 	PixelYDimension       []int
 	PixelXDimension       []int
+	ExposureProgram       []int
+	MeteringMode          []int
+	WhiteBalance          []int
 	Longitude             string
 	Latitude              string
+	// Raw holds every decoded tag keyed by its standard name
+	Raw map[string]interface{} `json:"-"`
 }
 
 // ID3 represents id3 data from an audio file.
@@ -85,27 +129,241 @@ type ID3 struct {
 	TotalTracks int
 	Disc        int
 	TotalDiscs  int
+	Lyrics      string
+	Comment     string
+	HasArt      bool
+	BPM         int
+	Key         string
+	Length      int // in milliseconds
 }
 
+// defaultID3TextLength is the maximum number of characters used for
+// multi-line id3 tags such as lyrics if no length is specified.
+const defaultID3TextLength = 50
+
 var (
-	filenameRegex  = regexp.MustCompile("{{f}}")
+	// filenameRegex matches the filename variable which may strip a
+	// literal prefix or suffix (e.g. {{f.stripprefix:IMG_}}), split the
+	// name on the first occurrence of a separator which may be quoted
+	// (e.g. {{f.before:' - '}}), extract a single word with optional
+	// delimiters (e.g. {{f.word:2: -}}), or extract the first match of a
+	// regular expression or one of its groups (e.g. {{f.match:\d{4}}}
+	// or {{f.match.1:(\d{4})-\d\d}}). The plain variable accepts a chain
+	// of transforms (e.g. {{f.squeeze:_}}).
+	filenameRegex = regexp.MustCompile(
+		`{{f(?:\.(stripprefix|stripsuffix|before|after):([^}]*)|\.(word):(\d+)(?::([^}]+))?|\.(match)(?:\.(\d+))?:((?:[^{}]|\{[^{}]*\})+))?(` + transformChain + `)}}`,
+	)
 	extensionRegex = regexp.MustCompile("{{ext}}")
 	parentDirRegex = regexp.MustCompile("{{p}}")
-	indexRegex     = regexp.MustCompile(
-		`(\d+)?(%(\d?)+d)([borh])?(\d+)?(?:<(\d+(?:-\d+)?(?:,\s*\d+(?:-\d+)?)*)>)?`,
+	siblingRegex   = regexp.MustCompile(`{{sibling\.name}}`)
+	dirCountRegex  = regexp.MustCompile(`{{dirsize\.count}}`)
+	// firstLineRegex matches the first non-empty line of a text file.
+	// It may be truncated to a number of characters (e.g. {{firstline.30}})
+	firstLineRegex = regexp.MustCompile(`{{firstline(?:\.(\d+))?}}`)
+	// jsonRegex matches a dotted key path in the JSON sidecar of a file
+	// with an optional default value (e.g. {{json.tags.0|untagged}})
+	jsonRegex = regexp.MustCompile(`{{json\.([^|}]+)(?:\|([^}]*))?}}`)
+	// relPathRegex matches the path of a file relative to its search
+	// root (e.g. {{relpath}} or {{relpath.replace:'/'/'__'}})
+	relPathRegex = regexp.MustCompile(
+		`{{relpath(` + transformChain + `)}}`,
+	)
+	// durationRegex matches the duration of a media file in an optional
+	// format (e.g. {{duration}} or {{duration.hh-mm-ss}})
+	durationRegex = regexp.MustCompile(`{{duration(?:\.(mm-ss|hh-mm-ss|s))?}}`)
+	// pdfRegex matches a value from the document information of a PDF
+	// file (e.g. {{pdf.title}} or {{pdf.author.up}})
+	pdfRegex = regexp.MustCompile(
+		`{{pdf\.(title|author|pages)(` + transformChain + `)}}`,
+	)
+	// ownerRegex matches the name of the user or group that owns
+	// a file (e.g. {{owner}} or {{owner.group.up}})
+	ownerRegex = regexp.MustCompile(
+		`{{owner(\.group)?(` + transformChain + `)}}`,
+	)
+	// dateSourceRegex matches a date taken from the first of one or more
+	// sources that has a value (e.g. {{date.exif:CreateDate|mtime.YYYY-MM-DD}})
+	dateSourceRegex = regexp.MustCompile(
+		`{{date\.(` + dateSourcePattern + `(?:\|` + dateSourcePattern + `)*)\.([^{}]+)}}`,
+	)
+	// archiveRegex matches a name derived from the entries of
+	// a zip or tar archive
+	archiveRegex = regexp.MustCompile(`{{archive\.commonprefix}}`)
+	// ageBucketRegex matches the label of the age bucket of a file
+	ageBucketRegex = regexp.MustCompile(`{{agebucket}}`)
+	// groupRegex matches the number of the chunk that a file belongs to.
+	// It may be zero padded to a width (e.g. {{group.2}})
+	groupRegex = regexp.MustCompile(`{{group(?:\.(\d+))?}}`)
+	// dateSeqRegex matches a date in a sequence that advances by a fixed
+	// interval for each file in the specified format (e.g. {{dateseq.YYYY-MM-DD}})
+	dateSeqRegex = regexp.MustCompile(`{{dateseq\.([^{}]+)}}`)
+	// dirIndexRegex matches the position of a file within its directory.
+	// It may be zero padded to a width (e.g. {{diridx.3}})
+	dirIndexRegex = regexp.MustCompile(`{{diridx(?:\.(\d+))?}}`)
+	// passCaptureRegex matches a capture group of the find pattern in an
+	// earlier replacement pass (e.g. {{pass1.$1}})
+	passCaptureRegex = regexp.MustCompile(`{{pass(\d+)\.\$(\d+)}}`)
+	// matchCountRegex matches the number of times the find pattern matched
+	// the filename. It may be zero padded to a width (e.g. {{matchcount.3}})
+	matchCountRegex = regexp.MustCompile(`{{matchcount(?:\.(\d+))?}}`)
+	// matchNumRegex matches the position of a match among the matches of
+	// the find pattern in the filename. It may be zero padded to a width
+	// (e.g. {{matchnum.2}})
+	matchNumRegex = regexp.MustCompile(`{{matchnum(?:\.(\d+))?}}`)
+	// captureNameRegex matches the text captured by a named group of the
+	// find pattern in the filename (e.g. {{capture.year}} for (?P<year>\d{4}))
+	captureNameRegex = regexp.MustCompile(`{{capture\.([A-Za-z_]\w*)}}`)
+	// capturePosRegex matches the character offset at which a capture group
+	// of the find pattern started in the filename (e.g. {{capture.1.pos}})
+	capturePosRegex = regexp.MustCompile(`{{capture\.(\d+)\.pos}}`)
+	// indexRegex matches the index variable. It may be wrapped in braces
+	// (e.g. {{%03d.up}}) so that a transform token can be specified, and a
+	// start value in letters (e.g. {{c%da}}) is also allowed in this form.
+	indexRegex = regexp.MustCompile(
+		`{{(\d+|[a-zA-Z]+)?(%(\d?)+d)([borhaz])?(\d+)?(?:<(\d+(?:-\d+)?(?:,\s*\d+(?:-\d+)?)*)>)?(` + transformChain + `)}}|(\d+)?(%(\d?)+d)([borhaz])?(\d+)?(?:<(\d+(?:-\d+)?(?:,\s*\d+(?:-\d+)?)*)>)?`,
 	)
 	randomRegex = regexp.MustCompile(
 		`{{(\d+)?r(?:(_l|_d|_ld)|(?:<(.*)>))?}}`,
 	)
-	hashRegex      = regexp.MustCompile(`{{hash.(sha1|sha256|sha512|md5)}}`)
-	transformRegex = regexp.MustCompile(`{{tr.(up|lw|ti|win|mac|di)}}`)
-	csvRegex       = regexp.MustCompile(`{{csv.(\d+)}}`)
+	// randomPickRegex matches a list of pipe-separated options
+	// (e.g. {{random.pick:draft|review|final}})
+	randomPickRegex = regexp.MustCompile(`{{random\.pick:([^}]*)}}`)
+	hashRegex       = regexp.MustCompile(`{{hash.(sha1|sha256|sha512|md5)}}`)
+	phashRegex      = regexp.MustCompile(`{{phash(?:\.(ahash|dhash))?(?:\.(\d+))?}}`)
+	transformRegex  = regexp.MustCompile(`{{tr((?:` + transformToken + `)+)}}`)
+	// whitespaceRunRegex matches a run of whitespace characters which is
+	// collapsed to a single space by the squeeze transform
+	whitespaceRunRegex = regexp.MustCompile(`\s+`)
+	// numberRunRegex matches a run of digits which is padded by the
+	// padnum transform
+	numberRunRegex = regexp.MustCompile(`\d+`)
+	// transformTokenRegex is used to split a chain of transform tokens
+	transformTokenRegex = regexp.MustCompile(transformToken)
+	// csvRegex matches a single column (e.g. {{csv.2}}) or a format
+	// string that references several columns (e.g. {{csv.fmt:"{3}-{1}"}})
+	csvRegex       = regexp.MustCompile(`{{csv\.(?:(\d+)|fmt:"([^"]*)")}}`)
+	csvColumnRegex = regexp.MustCompile(`\{(\d+)\}`)
 	id3Regex       *regexp.Regexp
 	exifRegex      *regexp.Regexp
 	dateRegex      *regexp.Regexp
 	exiftoolRegex  *regexp.Regexp
+	videoRegex     *regexp.Regexp
+	// id3GenreRegex matches genres that reference an ID3v1 genre code
+	// in ID3v2 frames such as "(17)" or "(17)Rock".
+	id3GenreRegex = regexp.MustCompile(`^\((\d+|RX|CR)\)(.*)$`)
 )
 
+// id3v1Genres contains the genre names for the numeric ID3v1 genre codes
+// (including the Winamp extensions). The code is the index in the slice.
+var id3v1Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge",
+	"Hip-Hop", "Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B",
+	"Rap", "Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska",
+	"Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient",
+	"Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance", "Classical",
+	"Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative",
+	"Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic", "Darkwave",
+	"Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap",
+	"Pop/Funk", "Jungle", "Native American", "Cabaret", "New Wave",
+	"Psychadelic", "Rave", "Showtunes", "Trailer", "Lo-Fi", "Tribal",
+	"Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll",
+	"Hard Rock", "Folk", "Folk-Rock", "National Folk", "Swing", "Fast Fusion",
+	"Bebob", "Latin", "Revival", "Celtic", "Bluegrass", "Avantgarde",
+	"Gothic Rock", "Progressive Rock", "Psychedelic Rock", "Symphonic Rock",
+	"Slow Rock", "Big Band", "Chorus", "Easy Listening", "Acoustic", "Humour",
+	"Speech", "Chanson", "Opera", "Chamber Music", "Sonata", "Symphony",
+	"Booty Bass", "Primus", "Porn Groove", "Satire", "Slow Jam", "Club",
+	"Tango", "Samba", "Folklore", "Ballad", "Power Ballad", "Rhythmic Soul",
+	"Freestyle", "Duet", "Punk Rock", "Drum Solo", "A capella", "Euro-House",
+	"Dance Hall", "Goa", "Drum & Bass", "Club-House", "Hardcore", "Terror",
+	"Indie", "BritPop", "Afro-Punk", "Polsk Punk", "Beat",
+	"Christian Gangsta Rap", "Heavy Metal", "Black Metal", "Crossover",
+	"Contemporary Christian", "Christian Rock", "Merengue", "Salsa",
+	"Thrash Metal", "Anime", "JPop", "Synthpop", "Abstract", "Art Rock",
+	"Baroque", "Bhangra", "Big Beat", "Breakbeat", "Chillout", "Downtempo",
+	"Dub", "EBM", "Eclectic", "Electro", "Electroclash", "Emo",
+	"Experimental", "Garage", "Global", "IDM", "Illbient", "Industro-Goth",
+	"Jam Band", "Krautrock", "Leftfield", "Lounge", "Math Rock",
+	"New Romantic", "Nu-Breakz", "Post-Punk", "Post-Rock", "Psytrance",
+	"Shoegaze", "Space Rock", "Trop Rock", "World Music", "Neoclassical",
+	"Audiobook", "Audio Theatre", "Neue Deutsche Welle", "Podcast",
+	"Indie Rock", "G-Funk", "Dubstep", "Garage Rock", "Psybient",
+}
+
+// exposurePrograms maps the ExposureProgram exif tag to its labels.
+var exposurePrograms = map[int]string{
+	0: "Not defined",
+	1: "Manual",
+	2: "Normal program",
+	3: "Aperture priority",
+	4: "Shutter priority",
+	5: "Creative program",
+	6: "Action program",
+	7: "Portrait mode",
+	8: "Landscape mode",
+}
+
+// meteringModes maps the MeteringMode exif tag to its labels.
+var meteringModes = map[int]string{
+	0:   "Unknown",
+	1:   "Average",
+	2:   "Center-weighted average",
+	3:   "Spot",
+	4:   "Multi-spot",
+	5:   "Pattern",
+	6:   "Partial",
+	255: "Other",
+}
+
+// cameraMakes maps the exif Make values of common cameras (in uppercase)
+// to their short brand names.
+var cameraMakes = map[string]string{
+	"APPLE":                       "Apple",
+	"CANON":                       "Canon",
+	"CASIO COMPUTER CO.,LTD.":     "Casio",
+	"DJI":                         "DJI",
+	"EASTMAN KODAK COMPANY":       "Kodak",
+	"FUJIFILM":                    "Fujifilm",
+	"FUJI PHOTO FILM CO., LTD.":   "Fujifilm",
+	"GOOGLE":                      "Google",
+	"GOPRO":                       "GoPro",
+	"HASSELBLAD":                  "Hasselblad",
+	"HUAWEI":                      "Huawei",
+	"KONICA MINOLTA":              "Konica Minolta",
+	"KONICA MINOLTA CAMERA, INC.": "Konica Minolta",
+	"LEICA":                       "Leica",
+	"LEICA CAMERA AG":             "Leica",
+	"LG ELECTRONICS":              "LG",
+	"MINOLTA CO.,LTD":             "Minolta",
+	"MOTOROLA":                    "Motorola",
+	"NIKON":                       "Nikon",
+	"NIKON CORPORATION":           "Nikon",
+	"OLYMPUS CORPORATION":         "Olympus",
+	"OLYMPUS IMAGING CORP.":       "Olympus",
+	"OLYMPUS OPTICAL CO.,LTD":     "Olympus",
+	"OM DIGITAL SOLUTIONS":        "OM System",
+	"ONEPLUS":                     "OnePlus",
+	"PANASONIC":                   "Panasonic",
+	"PENTAX":                      "Pentax",
+	"PENTAX CORPORATION":          "Pentax",
+	"RICOH":                       "Ricoh",
+	"RICOH IMAGING COMPANY, LTD.": "Ricoh",
+	"SAMSUNG":                     "Samsung",
+	"SAMSUNG TECHWIN":             "Samsung",
+	"SEIKO EPSON CORP.":           "Epson",
+	"SIGMA":                       "Sigma",
+	"SONY":                        "Sony",
+	"XIAOMI":                      "Xiaomi",
+}
+
+// whiteBalanceModes maps the WhiteBalance exif tag to its labels.
+var whiteBalanceModes = map[int]string{
+	0: "Auto",
+	1: "Manual",
+}
+
 var dateTokens = map[string]string{
 	"YYYY": "2006",
 	"YY":   "06",
@@ -142,23 +400,25 @@ func init() {
 	exiftoolRegex = regexp.MustCompile(`{{xt\.([0-9a-zA-Z]+)}}`)
 
 	exifRegex = regexp.MustCompile(
-		"{{(?:exif|x)\\.(iso|et|fl|w|h|wh|make|model|lens|fnum|fl35|lat|lon|soft)?(?:(dt)\\.(" + tokenString + "))?}}",
+		"{{(?:exif|x)\\.(iso|et|fl|w|h|wh|make\\.short|make|model|lens|fnum|fl35|lat|lon|software|soft|rating)?(?:(dt)\\.(" + tokenString + ")(?:\\.(sub))?)?(?:(raw):([A-Za-z0-9]+)(" + transformChain + "))?(?:(expprog|metering|wb)(" + transformChain + "))?(?:(focallength35)(?:\\.(\\d)?(mm)?)?)?}}",
 	)
 
-	id3Regex = regexp.MustCompile(
-		`{{id3\.(format|type|title|album|album_artist|artist|genre|year|composer|track|disc|total_tracks|total_discs)}}`,
+	videoRegex = regexp.MustCompile(
+		"{{video\\.(make|model|duration|w|h|wh|creationdate)(?:\\.(" + tokenString + "))?}}",
 	)
 
-	rand.Seed(time.Now().UnixNano())
+	id3Regex = regexp.MustCompile(
+		`{{id3\.(?:(format|type|title|album|album_artist|artist|genre|year|composer|track|disc|total_tracks|total_discs|hasart|key)|(lyrics|comment)(?:\.(\d+))?|(bpm)(?:\.(\d+))?)(` + transformChain + `)}}`,
+	)
 }
 
 // randString returns a random string of the specified length
 // using the specified characterSet.
-func randString(n int, characterSet string) string {
+func randString(n int, characterSet string, rng *rand.Rand) string {
 	b := make([]byte, n)
 
 	for i := range b {
-		b[i] = characterSet[rand.Intn(len(characterSet))] //nolint:gosec // appropriate use of math.rand
+		b[i] = characterSet[rng.Intn(len(characterSet))]
 	}
 
 	return string(b)
@@ -167,7 +427,11 @@ func randString(n int, characterSet string) string {
 // replaceRandomVariables replaces all random string variables
 // in the target filename with a generated random string that matches
 // the specifications.
-func replaceRandomVariables(target string, rv randomVar) string {
+func replaceRandomVariables(
+	target string,
+	rv randomVar,
+	rng *rand.Rand,
+) string {
 	for i := range rv.submatches {
 		r := rv.values[i]
 		characters := r.characters
@@ -185,7 +449,27 @@ func replaceRandomVariables(target string, rv randomVar) string {
 
 		target = r.regex.ReplaceAllString(
 			target,
-			randString(r.length, characters),
+			randString(r.length, characters, rng),
+		)
+	}
+
+	return target
+}
+
+// replaceRandomPickVariables replaces each random pick variable in the
+// target with one of its options. The option is chosen independently
+// for each occurrence.
+func replaceRandomPickVariables(
+	target string,
+	rpv randomPickVar,
+	rng *rand.Rand,
+) string {
+	for _, current := range rpv.values {
+		target = current.regex.ReplaceAllStringFunc(
+			target,
+			func(string) string {
+				return current.options[rng.Intn(len(current.options))]
+			},
 		)
 	}
 
@@ -231,44 +515,168 @@ func integerToRoman(integer int) string {
 	return roman.String()
 }
 
-// getHash retrieves the appropriate hash value for the specified file.
-func getHash(file string, hashValue hashAlgorithm) (string, error) {
-	f, err := os.Open(file)
-	if err != nil {
-		return "", err
+// integerToLetters converts an integer to a spreadsheet-style sequence of
+// letters where 1 is a, 26 is z, 27 is aa, and so on. For integers below 1,
+// it returns the stringified integer.
+func integerToLetters(integer int) string {
+	if integer < 1 {
+		return strconv.Itoa(integer)
 	}
 
-	defer f.Close()
+	var letters []byte
+
+	for integer > 0 {
+		integer--
+		letters = append([]byte{letterBytes[integer%len(letterBytes)]}, letters...)
+		integer /= len(letterBytes)
+	}
+
+	return string(letters)
+}
+
+// lettersToInteger is the inverse of integerToLetters. It is case
+// insensitive, and any non-letter characters are ignored.
+func lettersToInteger(letters string) int {
+	var integer int
 
-	var h hash.Hash
+	for _, r := range strings.ToLower(letters) {
+		if r < 'a' || r > 'z' {
+			continue
+		}
+
+		integer = integer*len(letterBytes) + int(r-'a') + 1
+	}
+
+	return integer
+}
+
+// getHash retrieves the appropriate hash value for the specified file.
+func getHash(file string, hashValue hashAlgorithm) (string, error) {
+	return getFilesHash([]string{file}, hashValue, 0)
+}
 
+// newHash creates a hash for the specified algorithm. It returns nil
+// if the algorithm is not supported.
+func newHash(hashValue hashAlgorithm) hash.Hash {
 	switch hashValue {
 	case sha1Hash:
-		h = sha1.New()
+		return sha1.New()
 	case sha256Hash:
-		h = sha256.New()
+		return sha256.New()
 	case sha512Hash:
-		h = sha512.New()
+		return sha512.New()
 	case md5Hash:
-		h = md5.New()
-	default:
+		return md5.New()
+	}
+
+	return nil
+}
+
+// getFilesHash retrieves the appropriate hash value for the contents
+// of the specified files in the order that they are provided. If limit
+// is greater than zero, only the first limit bytes of each file are hashed.
+func getFilesHash(
+	files []string,
+	hashValue hashAlgorithm,
+	limit int64,
+) (string, error) {
+	h := newHash(hashValue)
+	if h == nil {
 		return "", nil
 	}
 
-	if _, err := io.Copy(h, f); err != nil {
-		return "", err
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return "", err
+		}
+
+		var r io.Reader = f
+		if limit > 0 {
+			r = io.LimitReader(f, limit)
+		}
+
+		_, err = io.Copy(h, r)
+
+		f.Close()
+
+		if err != nil {
+			return "", err
+		}
 	}
 
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
+// hashSources returns the files whose contents make up the hash of the
+// source file. If a sidecar extension is specified with `--hash-sidecar`,
+// the sidecar of the source (e.g. IMG_1.xmp or IMG_1.CR2.xmp for IMG_1.CR2)
+// is hashed after it. If the source is itself a sidecar, the primary file
+// is hashed before it so that both files share the same hash. Only the
+// source is hashed if there is no corresponding file.
+func (op *Operation) hashSources(sourcePath string) ([]string, error) {
+	if op.hashSidecar == "" {
+		return []string{sourcePath}, nil
+	}
+
+	sidecarExt := "." + strings.TrimPrefix(op.hashSidecar, ".")
+
+	isSidecar := func(name string) bool {
+		return strings.EqualFold(filepath.Ext(name), sidecarExt)
+	}
+
+	dir, base := filepath.Split(sourcePath)
+	stem := filenameWithoutExtension(base)
+
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		if entry.IsDir() || name == base {
+			continue
+		}
+
+		if isSidecar(base) {
+			if !isSidecar(name) &&
+				(name == stem || filenameWithoutExtension(name) == stem) {
+				return []string{filepath.Join(dir, name), sourcePath}, nil
+			}
+
+			continue
+		}
+
+		if isSidecar(name) &&
+			(filenameWithoutExtension(name) == stem ||
+				filenameWithoutExtension(name) == base) {
+			return []string{sourcePath, filepath.Join(dir, name)}, nil
+		}
+	}
+
+	return []string{sourcePath}, nil
+}
+
 // replaceFileHash replaces a hash variable with the corresponding
-// hash value.
-func replaceFileHash(target, sourcePath string, hv hashVar) (string, error) {
+// hash value of the contents of the specified files. Only the first
+// limit bytes of each file are hashed if limit is greater than zero.
+func replaceFileHash(
+	target string,
+	files []string,
+	hv hashVar,
+	limit int64,
+) (string, error) {
 	for i := range hv.submatches {
 		h := hv.values[i]
 
-		hashValue, err := getHash(sourcePath, h.hashFn)
+		// Skip hashing for variables that are not in the target
+		if !h.regex.MatchString(target) {
+			continue
+		}
+
+		hashValue, err := getFilesHash(files, h.hashFn, limit)
 		if err != nil {
 			return "", err
 		}
@@ -279,11 +687,31 @@ func replaceFileHash(target, sourcePath string, hv hashVar) (string, error) {
 	return target, nil
 }
 
+// replaceContentHash replaces a hash variable with the corresponding
+// hash value of the provided content.
+func replaceContentHash(target string, content []byte, hv hashVar) string {
+	for i := range hv.submatches {
+		h := hv.values[i]
+
+		var hashValue string
+		if hf := newHash(h.hashFn); hf != nil {
+			hf.Write(content)
+			hashValue = hex.EncodeToString(hf.Sum(nil))
+		}
+
+		target = h.regex.ReplaceAllString(target, hashValue)
+	}
+
+	return target
+}
+
 // replaceDateVariables replaces any date variables in the target
-// with the corresponding date value.
+// with the corresponding date value. The current time is taken from now
+// so that it is the same for every file in the operation.
 func replaceDateVariables(
 	target, sourcePath string,
 	dv dateVar,
+	now time.Time,
 ) (string, error) {
 	t, err := times.Stat(sourcePath)
 	if err != nil {
@@ -319,8 +747,7 @@ func replaceDateVariables(
 
 			timeStr = changeTime.Format(dateTokens[token])
 		case currentTime:
-			currentTime := time.Now()
-			timeStr = currentTime.Format(dateTokens[token])
+			timeStr = now.Format(dateTokens[token])
 		}
 
 		target = regex.ReplaceAllString(target, timeStr)
@@ -329,6 +756,100 @@ func replaceDateVariables(
 	return target, nil
 }
 
+// Names of the raw frames that hold the tempo, the initial key, and the
+// length of a track in ID3v2.2, ID3v2.3/4, MP4, and Vorbis comments
+// respectively.
+var (
+	id3BPMFrames = []string{"TBP", "TBPM", "tmpo", "bpm"}
+	id3KeyFrames = []string{"TKE", "TKEY", "initialkey", "key"}
+	// the length is only stored in the ID3v2 frames
+	id3LengthFrames = []string{"TLE", "TLEN"}
+)
+
+// rawID3Text returns the value of the first of the named frames that is
+// present in the raw tags as text.
+func rawID3Text(raw map[string]interface{}, names []string) string {
+	for _, name := range names {
+		var value string
+
+		switch v := raw[name].(type) {
+		case nil:
+			continue
+		case string:
+			value = v
+		default:
+			value = fmt.Sprint(v)
+		}
+
+		if value = strings.TrimSpace(strings.Trim(value, "\x00")); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// decodeID3Number parses a numeric frame such as the tempo of a track
+// which is rounded to the nearest whole number. Zero is returned if the
+// value is missing or invalid.
+func decodeID3Number(value string) int {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) {
+		return 0
+	}
+
+	return int(math.Round(n))
+}
+
+// decodeID3Genre converts numeric ID3v1 genre codes (e.g. "17" or "(17)")
+// to the corresponding genre name. Textual genres are returned as is,
+// and unknown genre codes resolve to an empty string. Path separators in
+// the result are replaced with underscores.
+func decodeID3Genre(genre string) string {
+	return sanitizeID3Genre(decodeID3GenreCode(genre))
+}
+
+// decodeID3GenreCode resolves a numeric or parenthesised ID3v1 genre code
+// to its name.
+func decodeID3GenreCode(genre string) string {
+	genre = strings.TrimSpace(genre)
+
+	if match := id3GenreRegex.FindStringSubmatch(genre); match != nil {
+		// A refinement after the genre code takes precedence
+		if refinement := strings.TrimSpace(match[2]); refinement != "" {
+			return refinement
+		}
+
+		switch match[1] {
+		case "RX":
+			return "Remix"
+		case "CR":
+			return "Cover"
+		}
+
+		genre = match[1]
+	}
+
+	code, err := strconv.Atoi(genre)
+	if err != nil {
+		return genre
+	}
+
+	if code >= 0 && code < len(id3v1Genres) {
+		return id3v1Genres[code]
+	}
+
+	return ""
+}
+
+// sanitizeID3Genre replaces forward and backward slashes in genre names
+// such as 'Pop/Funk' so that they do not create directories.
+func sanitizeID3Genre(genre string) string {
+	genre = strings.ReplaceAll(genre, `/`, "_")
+
+	return strings.ReplaceAll(genre, `\`, "_")
+}
+
 // getID3Tags retrieves the id3 tags in an audi file (such as mp3)
 // errors while reading the id3 tags are ignored since the corresponding
 // variable will be replaced with an empty string.
@@ -359,15 +880,36 @@ func getID3Tags(sourcePath string) (*ID3, error) {
 		TotalDiscs:  totalDiscs,
 		Composer:    m.Composer(),
 		Year:        m.Year(),
-		Genre:       m.Genre(),
+		Genre:       decodeID3Genre(m.Genre()),
+		Lyrics:      m.Lyrics(),
+		Comment:     m.Comment(),
+		HasArt:      m.Picture() != nil,
+		BPM:         decodeID3Number(rawID3Text(m.Raw(), id3BPMFrames)),
+		Key:         rawID3Text(m.Raw(), id3KeyFrames),
+		Length:      decodeID3Number(rawID3Text(m.Raw(), id3LengthFrames)),
 	}, nil
 }
 
+// flattenText joins the lines of a multi-line tag value with single spaces
+// and truncates the result to the specified number of characters.
+func flattenText(text string, length int) string {
+	text = strings.Join(strings.Fields(text), " ")
+
+	runes := []rune(text)
+	if len(runes) > length {
+		text = strings.TrimSpace(string(runes[:length]))
+	}
+
+	return text
+}
+
 // replaceID3Variables replaces all id3 variables in the target file name
-// with the corresponding id3 tag value.
+// with the corresponding id3 tag value. The presence of cover art is
+// replaced with the first or second of the art labels.
 func replaceID3Variables(
 	target, sourcePath string,
 	id3v id3Var,
+	artLabels [2]string,
 ) (string, error) {
 	tags, err := getID3Tags(sourcePath)
 	if err != nil {
@@ -378,61 +920,69 @@ func replaceID3Variables(
 	for i := range submatches {
 		current := id3v.values[i]
 		regex := current.regex
-		submatch := current.tag
 
-		switch submatch {
+		var value string
+
+		switch current.tag {
 		case "format":
-			target = regex.ReplaceAllString(target, tags.Format)
+			value = tags.Format
 		case "type":
-			target = regex.ReplaceAllString(target, tags.FileType)
+			value = tags.FileType
 		case "title":
-			target = regex.ReplaceAllString(target, tags.Title)
+			value = tags.Title
 		case "album":
-			target = regex.ReplaceAllString(target, tags.Album)
+			value = tags.Album
 		case "artist":
-			target = regex.ReplaceAllString(target, tags.Artist)
+			value = tags.Artist
 		case "album_artist":
-			target = regex.ReplaceAllString(target, tags.AlbumArtist)
+			value = tags.AlbumArtist
 		case "genre":
-			target = regex.ReplaceAllString(target, tags.Genre)
+			value = tags.Genre
 		case "composer":
-			target = regex.ReplaceAllString(target, tags.Composer)
+			value = tags.Composer
 		case "track":
-			var track string
 			if tags.Track != 0 {
-				track = strconv.Itoa(tags.Track)
+				value = strconv.Itoa(tags.Track)
 			}
-
-			target = regex.ReplaceAllString(target, track)
 		case "total_tracks":
-			var total string
 			if tags.TotalTracks != 0 {
-				total = strconv.Itoa(tags.TotalTracks)
+				value = strconv.Itoa(tags.TotalTracks)
 			}
-
-			target = regex.ReplaceAllString(target, total)
 		case "disc":
-			var disc string
 			if tags.Disc != 0 {
-				disc = strconv.Itoa(tags.Disc)
+				value = strconv.Itoa(tags.Disc)
 			}
-
-			target = regex.ReplaceAllString(target, disc)
 		case "total_discs":
-			var total string
 			if tags.TotalDiscs != 0 {
-				total = strconv.Itoa(tags.TotalDiscs)
+				value = strconv.Itoa(tags.TotalDiscs)
 			}
-
-			target = regex.ReplaceAllString(target, total)
 		case "year":
-			var year string
 			if tags.Year != 0 {
-				year = strconv.Itoa(tags.Year)
+				value = strconv.Itoa(tags.Year)
+			}
+		case "lyrics":
+			value = flattenText(tags.Lyrics, current.length)
+		case "comment":
+			value = flattenText(tags.Comment, current.length)
+		case "bpm":
+			if tags.BPM != 0 {
+				value = fmt.Sprintf("%0*d", current.width, tags.BPM)
+			}
+		case "key":
+			value = tags.Key
+		case "hasart":
+			// files without tags are not labelled
+			if tags.Format != "" {
+				value = artLabels[1]
+				if tags.HasArt {
+					value = artLabels[0]
+				}
 			}
-
-			target = regex.ReplaceAllString(target, year)
 		}
+
+		value = applyTransforms(value, current.transforms)
+
+		target = regex.ReplaceAllLiteralString(target, value)
 	}
 
 	return target, nil
@@ -459,6 +1009,7 @@ func getExifData(sourcePath string) (*Exif, error) {
 		b, err = x.MarshalJSON()
 		if err == nil {
 			_ = json.Unmarshal(b, exifData)
+			_ = json.Unmarshal(b, &exifData.Raw)
 		}
 
 		lat, lon, err := x.LatLong()
@@ -471,6 +1022,82 @@ func getExifData(sourcePath string) (*Exif, error) {
 	return exifData, nil
 }
 
+// getExifRawTag retrieves the value of any exif tag by its standard
+// name (e.g. Artist). The name is matched case insensitively if there
+// is no exact match. Multiple values are separated by a space.
+func getExifRawTag(exifData *Exif, name string) string {
+	value, ok := exifData.Raw[name]
+	if !ok {
+		for k, v := range exifData.Raw {
+			if strings.EqualFold(k, name) {
+				value = v
+				break
+			}
+		}
+	}
+
+	var format func(v interface{}) string
+
+	format = func(v interface{}) string {
+		switch val := v.(type) {
+		case string:
+			return strings.TrimSpace(strings.Trim(val, "\x00"))
+		case float64:
+			return strconv.FormatFloat(val, 'f', -1, 64)
+		case bool:
+			return strconv.FormatBool(val)
+		case []interface{}:
+			s := make([]string, len(val))
+			for i := range val {
+				s[i] = format(val[i])
+			}
+
+			return strings.Join(s, " ")
+		}
+
+		return ""
+	}
+
+	return strings.ReplaceAll(format(value), "/", "_")
+}
+
+// shortMake returns the short brand name of a camera make. Entries in the
+// file specified with the `--make-map` flag take precedence over the
+// defaults, and unknown makes are title-cased.
+func (op *Operation) shortMake(cameraMake string) string {
+	cameraMake = normalizeSpace(strings.Trim(cameraMake, "\x00"))
+	if cameraMake == "" {
+		return ""
+	}
+
+	key := strings.ToUpper(cameraMake)
+
+	if short, ok := op.makeMap[key]; ok {
+		return short
+	}
+
+	if short, ok := cameraMakes[key]; ok {
+		return short
+	}
+
+	return strings.Title(strings.ToLower(cameraMake))
+}
+
+// getExifLabel returns the label of an enumerated exif tag. The numeric
+// value is returned if it has no label, and an empty string is
+// returned if the tag is not present.
+func getExifLabel(value []int, labels map[int]string) string {
+	if len(value) == 0 {
+		return ""
+	}
+
+	if label, ok := labels[value[0]]; ok {
+		return label
+	}
+
+	return strconv.Itoa(value[0])
+}
+
 // getExifExposureTime retrieves the exposure time from
 // exif data. This exposure time may be a fraction
 // so it is reduced to its simplest form and the
@@ -505,16 +1132,21 @@ func getExifExposureTime(exifData *Exif) string {
 	return fmt.Sprintf("%d_%d", numerator/divisor, denominator/divisor)
 }
 
-// getExifDate parses the exif original date and returns it
-// in the specified format.
-func getExifDate(exifData *Exif, format string) string {
-	dateTimeString := exifData.DateTimeOriginal
-	dateTimeSlice := strings.Split(dateTimeString, " ")
+// parseExifDate parses the exif original date into a time value.
+// The second return value is false if the date is missing or invalid.
+func parseExifDate(exifData *Exif) (time.Time, bool) {
+	return parseExifDateTime(exifData.DateTimeOriginal)
+}
+
+// parseExifDateTime parses an exif date such as '2021:06:12 15:04:05'.
+// False is returned if the value is not a valid date.
+func parseExifDateTime(value string) (time.Time, bool) {
+	dateTimeSlice := strings.Split(strings.TrimSpace(value), " ")
 
 	// must include date and time components
 	expectedLength := 2
 	if len(dateTimeSlice) < expectedLength {
-		return ""
+		return time.Time{}, false
 	}
 
 	dateString := strings.ReplaceAll(dateTimeSlice[0], ":", "-")
@@ -522,10 +1154,103 @@ func getExifDate(exifData *Exif, format string) string {
 
 	dateTime, err := time.Parse(time.RFC3339, dateString+"T"+timeString+"Z")
 	if err != nil {
+		return time.Time{}, false
+	}
+
+	return dateTime, true
+}
+
+// exifOffsetRegex matches a timezone offset such as '+01:00' or '-0530'.
+var exifOffsetRegex = regexp.MustCompile(`^([+-])(\d{2}):?(\d{2})$`)
+
+// parseExifOffset parses a timezone offset in the format used by the
+// OffsetTimeOriginal tag (e.g. '+01:00'). 'Z' is accepted for UTC.
+// False is returned if the value is not a valid offset.
+func parseExifOffset(value string) (*time.Location, bool) {
+	value = strings.TrimSpace(strings.Trim(value, "\x00"))
+	if value == "Z" {
+		return time.UTC, true
+	}
+
+	match := exifOffsetRegex.FindStringSubmatch(value)
+	if match == nil {
+		return nil, false
+	}
+
+	hours, _ := strconv.Atoi(match[2])
+	minutes, _ := strconv.Atoi(match[3])
+
+	if hours > 14 || minutes > 59 {
+		return nil, false
+	}
+
+	seconds := hours*3600 + minutes*60
+	if match[1] == "-" {
+		seconds = -seconds
+	}
+
+	return time.FixedZone(value, seconds), true
+}
+
+// exifDateInUTC parses the exif original date and converts it to UTC
+// if offset is not nil. The offset recorded in the OffsetTimeOriginal tag
+// takes precedence over the specified offset which is only used when the
+// tag is missing or invalid.
+func exifDateInUTC(exifData *Exif, offset *time.Location) (time.Time, bool) {
+	dateTime, ok := parseExifDate(exifData)
+	if !ok || offset == nil {
+		return dateTime, ok
+	}
+
+	if loc, ok := parseExifOffset(exifData.OffsetTimeOriginal); ok {
+		offset = loc
+	}
+
+	// the date is parsed as UTC so its clock time is reinterpreted
+	// in the timezone of the camera before the conversion
+	dateTime = time.Date(
+		dateTime.Year(),
+		dateTime.Month(),
+		dateTime.Day(),
+		dateTime.Hour(),
+		dateTime.Minute(),
+		dateTime.Second(),
+		dateTime.Nanosecond(),
+		offset,
+	)
+
+	return dateTime.UTC(), true
+}
+
+// getExifDate parses the exif original date and returns it
+// in the specified format. If subsec is true, the subsecond digits
+// from the SubSecTimeOriginal tag are appended to the result
+// if present. The date is converted to UTC first if offset is not nil
+// (see exifDateInUTC).
+func getExifDate(
+	exifData *Exif,
+	format string,
+	subsec bool,
+	offset *time.Location,
+) string {
+	dateTime, ok := exifDateInUTC(exifData, offset)
+	if !ok {
 		return ""
 	}
 
-	return dateTime.Format(dateTokens[format])
+	value := dateTime.Format(dateTokens[format])
+
+	if subsec {
+		digits := strings.TrimFunc(exifData.SubSecTimeOriginal, func(r rune) bool {
+			return !unicode.IsDigit(r)
+		})
+
+		if digits != "" {
+			value += "." + digits
+		}
+	}
+
+	return value
 }
 
 // getDecimalFromSlice reduces an exif values in the following format: [8/5]
@@ -562,29 +1287,110 @@ func getDecimalFromSlice(slice []string) string {
 	return decimalValue
 }
 
-// getExifDimensions retrieves the specified dimension
-// w -> width, h -> height, wh -> width x height.
-func getExifDimensions(exifData *Exif, dimension string) string {
-	var w, h string
-	if len(exifData.ImageWidth) > 0 {
-		w = strconv.Itoa(exifData.ImageWidth[0])
-	} else if len(exifData.PixelXDimension) > 0 {
-		w = strconv.Itoa(exifData.PixelXDimension[0])
-	}
+// fullFrameDiagonal is the diagonal of a 35mm film frame in millimetres.
+const fullFrameDiagonal = 43.27
 
-	if len(exifData.ImageLength) > 0 {
-		h = strconv.Itoa(exifData.ImageLength[0])
-	} else if len(exifData.PixelYDimension) > 0 {
-		h = strconv.Itoa(exifData.PixelYDimension[0])
-	}
+// focalPlaneUnits maps the exif focal plane resolution units
+// to millimetres. Inches are assumed if the unit is not specified.
+var focalPlaneUnits = map[int]float64{
+	2: 25.4,
+	3: 10,
+	4: 1,
+	5: 0.001,
+}
 
-	switch dimension {
-	case "w":
-		return w
-	case "h":
-		return h
-	case "wh":
-		return w + "x" + h
+// getRational parses the first exif rational value (e.g. "50/1")
+// in the slice.
+func getRational(slice []string) (float64, bool) {
+	if len(slice) == 0 {
+		return 0, false
+	}
+
+	var numerator, denominator float64
+
+	_, err := fmt.Sscanf(slice[0], "%g/%g", &numerator, &denominator)
+	if err != nil || denominator == 0 {
+		return 0, false
+	}
+
+	return numerator / denominator, true
+}
+
+// getFocalLength35 retrieves the 35mm equivalent focal length of an image.
+// FocalLengthIn35mmFilm is used if it is present. Otherwise, the focal
+// length is multiplied by the crop factor of the sensor whose size is
+// derived from the image dimensions and the focal plane resolution.
+func getFocalLength35(exifData *Exif) (float64, bool) {
+	if len(exifData.FocalLengthIn35mmFilm) > 0 &&
+		exifData.FocalLengthIn35mmFilm[0] > 0 {
+		return float64(exifData.FocalLengthIn35mmFilm[0]), true
+	}
+
+	fl, ok := getRational(exifData.FocalLength)
+	if !ok || fl <= 0 {
+		return 0, false
+	}
+
+	xres, ok := getRational(exifData.FocalPlaneXResolution)
+	if !ok || xres <= 0 {
+		return 0, false
+	}
+
+	yres, ok := getRational(exifData.FocalPlaneYResolution)
+	if !ok || yres <= 0 {
+		return 0, false
+	}
+
+	width, height := exifData.PixelXDimension, exifData.PixelYDimension
+	if len(width) == 0 || len(height) == 0 {
+		width, height = exifData.ImageWidth, exifData.ImageLength
+	}
+
+	if len(width) == 0 || len(height) == 0 {
+		return 0, false
+	}
+
+	unit := focalPlaneUnits[2]
+	if len(exifData.FocalPlaneUnit) > 0 {
+		if u, ok := focalPlaneUnits[exifData.FocalPlaneUnit[0]]; ok {
+			unit = u
+		}
+	}
+
+	sensorWidth := float64(width[0]) / xres * unit
+	sensorHeight := float64(height[0]) / yres * unit
+
+	diagonal := math.Hypot(sensorWidth, sensorHeight)
+	if diagonal == 0 {
+		return 0, false
+	}
+
+	return fl * fullFrameDiagonal / diagonal, true
+}
+
+// getExifDimensions retrieves the specified dimension
+// w -> width, h -> height, wh -> width x height.
+func getExifDimensions(exifData *Exif, dimension string) string {
+	var w, h string
+	if len(exifData.ImageWidth) > 0 {
+		w = strconv.Itoa(exifData.ImageWidth[0])
+	} else if len(exifData.PixelXDimension) > 0 {
+		w = strconv.Itoa(exifData.PixelXDimension[0])
+	}
+
+	if len(exifData.ImageLength) > 0 {
+		h = strconv.Itoa(exifData.ImageLength[0])
+	} else if len(exifData.PixelYDimension) > 0 {
+		h = strconv.Itoa(exifData.PixelYDimension[0])
+	}
+
+	switch dimension {
+	case "w":
+		return w
+	case "h":
+		return h
+	case "wh":
+		return w + "x" + h
 	}
 
 	return ""
@@ -593,7 +1399,7 @@ func getExifDimensions(exifData *Exif, dimension string) string {
 // replaceExifVariables replaces the exif variables in an input string
 // if an error occurs while attempting to get the value represented
 // by the variables, it is replaced with an empty string.
-func replaceExifVariables(
+func (op *Operation) replaceExifVariables(
 	target, sourcePath string,
 	ev exifVar,
 ) (string, error) {
@@ -610,15 +1416,47 @@ func replaceExifVariables(
 
 		switch current.attr {
 		case "dt":
-			value = getExifDate(exifData, current.timeStr)
-		case "soft":
+			value = getExifDate(
+				exifData,
+				current.timeStr,
+				current.subsec,
+				op.exifOffset,
+			)
+		case "soft", "software":
 			value = exifData.Software
+		case "rating":
+			value, err = op.exifRating(sourcePath, exifData)
+			if err != nil {
+				return target, err
+			}
+		case "raw":
+			value = applyTransforms(
+				getExifRawTag(exifData, current.tag),
+				current.transforms,
+			)
+		case "expprog":
+			value = applyTransforms(
+				getExifLabel(exifData.ExposureProgram, exposurePrograms),
+				current.transforms,
+			)
+		case "metering":
+			value = applyTransforms(
+				getExifLabel(exifData.MeteringMode, meteringModes),
+				current.transforms,
+			)
+		case "wb":
+			value = applyTransforms(
+				getExifLabel(exifData.WhiteBalance, whiteBalanceModes),
+				current.transforms,
+			)
 		case "model":
 			value = strings.ReplaceAll(exifData.Model, "/", "_")
 		case "lens":
 			value = strings.ReplaceAll(exifData.LensModel, "/", "_")
 		case "make":
 			value = exifData.Make
+		case "make.short":
+			value = strings.ReplaceAll(op.shortMake(exifData.Make), "/", "_")
 		case "iso":
 			if len(exifData.ISOSpeedRatings) > 0 {
 				value = strconv.Itoa(exifData.ISOSpeedRatings[0])
@@ -635,6 +1473,11 @@ func replaceExifVariables(
 			if len(exifData.FocalLengthIn35mmFilm) > 0 {
 				value = strconv.Itoa(exifData.FocalLengthIn35mmFilm[0])
 			}
+		case "focallength35":
+			if fl, ok := getFocalLength35(exifData); ok {
+				value = strconv.FormatFloat(fl, 'f', current.decimals, 64)
+				value += current.unit
+			}
 		case "lat":
 			value = exifData.Latitude
 		case "lon":
@@ -643,7 +1486,7 @@ func replaceExifVariables(
 			value = getExifDimensions(exifData, current.attr)
 		}
 
-		target = regex.ReplaceAllString(target, value)
+		target = regex.ReplaceAllLiteralString(target, value)
 	}
 
 	return target, nil
@@ -651,11 +1494,11 @@ func replaceExifVariables(
 
 // replaceExifToolVariables replaces the all exiftool
 // variables in the target.
-func replaceExifToolVariables(
+func (op *Operation) replaceExifToolVariables(
 	target, sourcePath string,
 	ev exiftoolVar,
 ) (string, error) {
-	et, err := exiftool.NewExiftool()
+	et, err := exiftool.NewExiftool(op.exiftoolOpts...)
 	if err != nil {
 		return "", fmt.Errorf("Failed to initialise exiftool: %w", err)
 	}
@@ -693,39 +1536,86 @@ func replaceExifToolVariables(
 	return target, nil
 }
 
+// padNumber pads a number that has been formatted in a different number
+// system to the width specified in the index format (e.g. `%04d`).
+// The width is counted in the characters of the formatted number.
+func padNumber(number, format string) string {
+	flags := strings.TrimSuffix(strings.TrimPrefix(format, "%"), "d")
+
+	width, err := strconv.Atoi(flags)
+	if err != nil || len(number) >= width {
+		return number
+	}
+
+	if !strings.HasPrefix(flags, "0") {
+		return strings.Repeat(" ", width-len(number)) + number
+	}
+
+	sign := ""
+	if strings.HasPrefix(number, "-") {
+		sign, number = "-", number[1:]
+	}
+
+	return sign + strings.Repeat("0", width-len(number)-len(sign)) + number
+}
+
+// indexNumber returns the number at the specified position in the sequence
+// that begins at start and advances by step. The numbers in the skip ranges
+// are reserved so they leave gaps in the sequence without taking up a
+// position, which means that the result depends only on the position and
+// not on the numbers assigned to other files. Overlapping ranges are
+// treated as their union.
+func indexNumber(start, step, position int, skip []numbersToSkip) int {
+	isSkipped := func(num int) bool {
+		for _, v := range skip {
+			if num >= v.min && num <= v.max {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	num := start + position*step
+	if len(skip) == 0 || step <= 0 {
+		return num
+	}
+
+	num = start
+
+	for {
+		if !isSkipped(num) {
+			if position == 0 {
+				return num
+			}
+
+			position--
+		}
+
+		num += step
+	}
+}
+
 // replaceIndex replaces indexing variables in the target with their
-// corresponding values. The `index` argument is used in conjunction with
-// other values to increment the current index.
+// corresponding values. The `index` argument is the position of the file
+// in the sequence of numbered files. It restarts from zero at the start
+// of each chunk.
 func (op *Operation) replaceIndex(
 	target string,
 	index int,
 	nv numberVar,
 ) string {
-	if len(op.numberOffset) == 0 {
-		for range nv.submatches {
-			op.numberOffset = append(op.numberOffset, 0)
-		}
+	// The index wraps around at the start of each chunk
+	if op.chunkSize > 0 {
+		index %= op.chunkSize
 	}
 
 	for i := range nv.submatches {
 		current := nv.values[i]
 
 		op.startNumber = current.startNumber
-		num := op.startNumber + (index * current.step) + op.numberOffset[i]
-
-		if len(current.skip) != 0 {
-		outer:
-			for {
-				for _, v := range current.skip {
-					if num >= v.min && num <= v.max {
-						num += current.step
-						op.numberOffset[i] += current.step
-						continue outer
-					}
-				}
-				break
-			}
-		}
+
+		num := indexNumber(op.startNumber, current.step, index, current.skip)
 
 		n := int64(num)
 
@@ -734,22 +1624,281 @@ func (op *Operation) replaceIndex(
 		switch current.format {
 		case "r":
 			r = integerToRoman(num)
+		case "a":
+			r = integerToLetters(num)
+		case "z":
+			r = padNumber(strconv.FormatInt(n, 36), current.index)
 		case "h":
-			r = strconv.FormatInt(n, 16)
+			r = padNumber(strconv.FormatInt(n, 16), current.index)
 		case "o":
-			r = strconv.FormatInt(n, 8)
+			r = padNumber(strconv.FormatInt(n, 8), current.index)
 		case "b":
-			r = strconv.FormatInt(n, 2)
+			r = padNumber(strconv.FormatInt(n, 2), current.index)
 		default:
 			r = fmt.Sprintf(current.index, num)
 		}
 
-		target = current.regex.ReplaceAllString(target, r)
+		r = applyTransforms(r, current.transforms)
+
+		target = current.regex.ReplaceAllLiteralString(target, r)
 	}
 
 	return target
 }
 
+// removeDiacritics strips all diacritics from the input
+// (e.g. é becomes e).
+func removeDiacritics(input string) string {
+	t := transform.Chain(
+		norm.NFD,
+		runes.Remove(runes.In(unicode.Mn)),
+		norm.NFC,
+	)
+
+	result, _, err := transform.String(t, input)
+	if err != nil {
+		return input
+	}
+
+	return result
+}
+
+// slugify converts the input to a lowercase string in which all
+// characters that are not letters or digits are collapsed into
+// single hyphens (e.g. "Rock & Roll" becomes "rock-roll").
+func slugify(input string) string {
+	var b strings.Builder
+
+	hyphen := false
+
+	for _, r := range removeDiacritics(strings.ToLower(input)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+
+			hyphen = false
+
+			continue
+		}
+
+		if !hyphen && b.Len() > 0 {
+			b.WriteRune('-')
+
+			hyphen = true
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// transformString applies the string transformation represented by
+// token to the input. The input is returned unchanged if the token is
+// empty or unknown.
+func transformString(input, token string) string {
+	switch token {
+	case "up":
+		return strings.ToUpper(input)
+	case "lw":
+		return strings.ToLower(input)
+	case "ti":
+		return strings.Title(strings.ToLower(input))
+	case "win":
+		return regexReplace(fullWindowsForbiddenCharRegex, input, "", 0)
+	case "mac":
+		return regexReplace(macForbiddenCharRegex, input, "", 0)
+	case "di":
+		return removeDiacritics(input)
+	case "slug":
+		return slugify(input)
+	case "safe":
+		return defaultSymbolFilter.strip(input)
+	case "squeeze":
+		return whitespaceRunRegex.ReplaceAllString(input, " ")
+	}
+
+	if strings.HasPrefix(token, replaceTransform) {
+		if old, replacement, err := parseReplaceArgs(token); err == nil {
+			return strings.ReplaceAll(input, old, replacement)
+		}
+	}
+
+	if strings.HasPrefix(token, squeezeTransform) {
+		if str, err := parseSqueezeArg(token); err == nil {
+			return squeeze(input, str)
+		}
+	}
+
+	if strings.HasPrefix(token, padNumTransform) {
+		if width, err := parsePadNumArg(token); err == nil {
+			return padNumbers(input, width)
+		}
+	}
+
+	return input
+}
+
+// readTransformArg reads a quoted or bare argument from the start of the
+// input and returns its unescaped value along with the rest of the input.
+// A bare argument ends at the first unescaped '/'.
+func readTransformArg(input string) (arg, rest string, err error) {
+	var b strings.Builder
+
+	quoted := strings.HasPrefix(input, "'")
+	if quoted {
+		input = input[1:]
+	}
+
+	for i := 0; i < len(input); i++ {
+		switch c := input[i]; {
+		case c == '\\' && i+1 < len(input):
+			i++
+			b.WriteByte(input[i])
+		case quoted && c == '\'':
+			return b.String(), input[i+1:], nil
+		case !quoted && c == '/':
+			return b.String(), input[i:], nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	if quoted {
+		return "", "", fmt.Errorf("%w: unterminated quote", errInvalidTransform)
+	}
+
+	return b.String(), "", nil
+}
+
+// parseReplaceArgs parses the arguments of a replace transform
+// (e.g. `replace:' '/'_'`) into the string to replace and its replacement.
+func parseReplaceArgs(token string) (old, replacement string, err error) {
+	args := strings.TrimPrefix(token, replaceTransform)
+
+	old, rest, err := readTransformArg(args)
+	if err != nil {
+		return "", "", err
+	}
+
+	if !strings.HasPrefix(rest, "/") || old == "" {
+		return "", "", fmt.Errorf("%w: '%s'", errInvalidTransform, token)
+	}
+
+	replacement, rest, err = readTransformArg(rest[1:])
+	if err != nil {
+		return "", "", err
+	}
+
+	if rest != "" {
+		return "", "", fmt.Errorf("%w: '%s'", errInvalidTransform, token)
+	}
+
+	return old, replacement, nil
+}
+
+// parseSqueezeArg parses the argument of a squeeze transform
+// (e.g. `squeeze:'.'`) into the string whose runs are collapsed.
+func parseSqueezeArg(token string) (string, error) {
+	str, rest, err := readTransformArg(
+		strings.TrimPrefix(token, squeezeTransform),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	if str == "" || rest != "" {
+		return "", fmt.Errorf("%w: '%s'", errInvalidTransform, token)
+	}
+
+	return str, nil
+}
+
+// squeeze collapses each run of consecutive occurrences of str in the
+// input to a single occurrence (e.g. `a__b` becomes `a_b` for `_`).
+func squeeze(input, str string) string {
+	double := str + str
+
+	for strings.Contains(input, double) {
+		input = strings.ReplaceAll(input, double, str)
+	}
+
+	return input
+}
+
+// parsePadNumArg parses the width of a padnum transform (e.g. `padnum:3`)
+// which must be a positive integer.
+func parsePadNumArg(token string) (int, error) {
+	width, err := strconv.Atoi(strings.TrimPrefix(token, padNumTransform))
+	if err != nil || width < 1 {
+		return 0, fmt.Errorf("%w: '%s'", errInvalidTransform, token)
+	}
+
+	return width, nil
+}
+
+// padNumbers pads each run of digits in the input with leading zeros to
+// the specified width (e.g. `track2` becomes `track02` for a width of 2).
+// Numbers that are already as wide are left unchanged.
+func padNumbers(input string, width int) string {
+	return numberRunRegex.ReplaceAllStringFunc(input, func(n string) string {
+		if len(n) >= width {
+			return n
+		}
+
+		return strings.Repeat("0", width-len(n)) + n
+	})
+}
+
+// parseTransforms splits a chain of transform tokens (e.g. `.lw.slug`)
+// into its individual tokens. An error is returned if any of the tokens
+// is not a valid transform.
+func parseTransforms(chain string) ([]string, error) {
+	if chain == "" {
+		return nil, nil
+	}
+
+	valid := strings.Split(transformTokens, "|")
+
+	matches := transformTokenRegex.FindAllString(chain, -1)
+	if strings.Join(matches, "") != chain {
+		return nil, fmt.Errorf("%w: '%s'", errInvalidTransform, chain)
+	}
+
+	tokens := make([]string, len(matches))
+
+	for i, match := range matches {
+		token := strings.TrimPrefix(match, ".")
+
+		if strings.HasPrefix(token, replaceTransform) {
+			if _, _, err := parseReplaceArgs(token); err != nil {
+				return nil, err
+			}
+		} else if strings.HasPrefix(token, squeezeTransform) {
+			if _, err := parseSqueezeArg(token); err != nil {
+				return nil, err
+			}
+		} else if strings.HasPrefix(token, padNumTransform) {
+			if _, err := parsePadNumArg(token); err != nil {
+				return nil, err
+			}
+		} else if !contains(valid, token) {
+			return nil, fmt.Errorf("%w: '%s'", errInvalidTransform, token)
+		}
+
+		tokens[i] = token
+	}
+
+	return tokens, nil
+}
+
+// applyTransforms applies each of the transforms to the input
+// from left to right.
+func applyTransforms(input string, transforms []string) string {
+	for _, token := range transforms {
+		input = transformString(input, token)
+	}
+
+	return input
+}
+
 // replaceTransformVariables handles string transformations like uppercase,
 // lowercase, stripping characters, e.t.c.
 func replaceTransformVariables(
@@ -761,46 +1910,13 @@ func replaceTransformVariables(
 		current := tv.values[i]
 		r := current.regex
 
+		// the transformed value is substituted literally so that
+		// a '$' in it is not expanded
 		for _, v := range matches {
-			switch current.token {
-			case "up":
-				target = regexReplace(r, target, strings.ToUpper(v), 1)
-			case "lw":
-				target = regexReplace(r, target, strings.ToLower(v), 1)
-			case "ti":
-				target = regexReplace(
-					r,
-					target,
-					strings.Title(strings.ToLower(v)),
-					1,
-				)
-			case "win":
-				target = regexReplace(
-					r,
-					target,
-					regexReplace(fullWindowsForbiddenCharRegex, v, "", 0),
-					1,
-				)
-			case "mac":
-				target = regexReplace(
-					r,
-					target,
-					regexReplace(macForbiddenCharRegex, v, "", 0),
-					1,
-				)
-			case "di":
-				t := transform.Chain(
-					norm.NFD,
-					runes.Remove(runes.In(unicode.Mn)),
-					norm.NFC,
-				)
-
-				result, _, err := transform.String(t, v)
-				if err != nil {
-					return v
-				}
-
-				target = regexReplace(r, target, result, 1)
+			if loc := r.FindStringIndex(target); loc != nil {
+				target = target[:loc[0]] +
+					applyTransforms(v, current.transforms) +
+					target[loc[1]:]
 			}
 		}
 	}
@@ -808,27 +1924,367 @@ func replaceTransformVariables(
 	return target
 }
 
+// csvColumn returns the specified column (starting from 1) in the row
+// or an empty string if the column is not present.
+func csvColumn(csvRow []string, n int) string {
+	column := n - 1
+
+	if len(csvRow) > column && column >= 0 {
+		return csvRow[column]
+	}
+
+	return ""
+}
+
 // replaceCsvVariables inserts the appropriate CSV column
 // in the replacement target or an empty string if the column
-// is not present in the row.
+// is not present in the row. Row formats have each `{n}` replaced
+// with the corresponding column.
 func replaceCsvVariables(target string, csvRow []string, cv csvVar) string {
 	for i := range cv.submatches {
 		current := cv.values[i]
-		column := current.column - 1
 		r := current.regex
 
-		var value string
+		value := csvColumn(csvRow, current.column)
 
-		if len(csvRow) > column && column >= 0 {
-			value = csvRow[column]
+		if current.format != "" {
+			value = csvColumnRegex.ReplaceAllStringFunc(
+				current.format,
+				func(s string) string {
+					n, _ := strconv.Atoi(s[1 : len(s)-1])
+
+					return csvColumn(csvRow, n)
+				},
+			)
 		}
 
-		target = r.ReplaceAllString(target, value)
+		target = r.ReplaceAllLiteralString(target, value)
 	}
 
 	return target
 }
 
+// filenameWord returns the nth word (starting from 1) in the filename or
+// an empty string if there is no such word. Words are separated by any of
+// the characters in delimiters or by whitespace if no delimiters are
+// specified.
+func filenameWord(filename string, n int, delimiters string) string {
+	isDelimiter := unicode.IsSpace
+	if delimiters != "" {
+		isDelimiter = func(r rune) bool {
+			return strings.ContainsRune(delimiters, r)
+		}
+	}
+
+	words := strings.FieldsFunc(filename, isDelimiter)
+	if n < 1 || n > len(words) {
+		return ""
+	}
+
+	return words[n-1]
+}
+
+// filenameMatch returns the first match of the regex in the filename or
+// the specified capture group of the match. An empty string is returned
+// if there is no match.
+func filenameMatch(filename string, regex *regexp.Regexp, group int) string {
+	if regex == nil {
+		return ""
+	}
+
+	submatch := regex.FindStringSubmatch(filename)
+	if group >= len(submatch) {
+		return ""
+	}
+
+	return submatch[group]
+}
+
+// filenameSplit returns the part of the filename before or after the
+// first occurrence of the separator. The separator may be wrapped in
+// single quotes so that leading and trailing spaces are easy to see.
+// If the separator is not present, the part before it is the entire
+// filename and the part after it is empty.
+func filenameSplit(filename, separator string, after bool) string {
+	if len(separator) >= 2 &&
+		strings.HasPrefix(separator, "'") && strings.HasSuffix(separator, "'") {
+		separator = separator[1 : len(separator)-1]
+	}
+
+	i := strings.Index(filename, separator)
+	if separator == "" || i < 0 {
+		if after {
+			return ""
+		}
+
+		return filename
+	}
+
+	if after {
+		return filename[i+len(separator):]
+	}
+
+	return filename[:i]
+}
+
+// replaceFilenameVariables replaces the filename variables in the target
+// with the filename. A prefix or suffix specified in the variable is
+// removed from the filename only if it is present.
+func replaceFilenameVariables(
+	target, filename string,
+	fv filenameVar,
+) string {
+	return filenameRegex.ReplaceAllStringFunc(target, func(match string) string {
+		submatch := filenameRegex.FindStringSubmatch(match)
+
+		value := filename
+
+		switch {
+		case submatch[1] == "stripprefix":
+			value = strings.TrimPrefix(filename, submatch[2])
+		case submatch[1] == "stripsuffix":
+			value = strings.TrimSuffix(filename, submatch[2])
+		case submatch[1] == "before", submatch[1] == "after":
+			value = filenameSplit(filename, submatch[2], submatch[1] == "after")
+		case submatch[3] == "word":
+			n, _ := strconv.Atoi(submatch[4])
+
+			value = filenameWord(filename, n, submatch[5])
+		case submatch[6] == "match":
+			group, _ := strconv.Atoi(submatch[7])
+
+			value = filenameMatch(filename, fv.patterns[submatch[8]], group)
+		}
+
+		// the transforms are validated when the variable is extracted
+		transforms, _ := parseTransforms(submatch[9])
+
+		return applyTransforms(value, transforms)
+	})
+}
+
+// dirEntryCount returns the number of entries in the specified directory.
+// Hidden entries are excluded unless `--dirsize-hidden` is set. The count
+// is cached so that each directory is read only once.
+func (op *Operation) dirEntryCount(dir string) (int, error) {
+	if count, ok := op.dirCounts[dir]; ok {
+		return count, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	if !op.dirCountHidden {
+		entries, err = removeHidden(entries, dir)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if op.dirCounts == nil {
+		op.dirCounts = make(map[string]int)
+	}
+
+	op.dirCounts[dir] = len(entries)
+
+	return len(entries), nil
+}
+
+// replacePassCaptureVariables replaces the pass variables in the target
+// with the corresponding capture group from the find pattern of an earlier
+// replacement pass. Passes are numbered from 1. A variable is replaced with
+// an empty string if the find pattern did not match in that pass, if the
+// capture group did not participate in the match, or if the pass has not
+// happened yet.
+func replacePassCaptureVariables(target string, captures [][]string) string {
+	return passCaptureRegex.ReplaceAllStringFunc(target, func(match string) string {
+		submatch := passCaptureRegex.FindStringSubmatch(match)
+
+		pass, _ := strconv.Atoi(submatch[1])
+		group, _ := strconv.Atoi(submatch[2])
+
+		if pass < 1 || pass > len(captures) || group >= len(captures[pass-1]) {
+			return ""
+		}
+
+		return captures[pass-1][group]
+	})
+}
+
+// replaceGroupVariables replaces the group variables in the target with
+// the number of the chunk (starting from 1) that the index belongs to
+// according to `--chunk-size`. All files belong to the first group if
+// a chunk size is not specified.
+func (op *Operation) replaceGroupVariables(target string, index int) string {
+	group := 1
+	if op.chunkSize > 0 {
+		group = index/op.chunkSize + 1
+	}
+
+	return groupRegex.ReplaceAllStringFunc(target, func(match string) string {
+		submatch := groupRegex.FindStringSubmatch(match)
+
+		width, _ := strconv.Atoi(submatch[1])
+
+		return fmt.Sprintf("%0*d", width, group)
+	})
+}
+
+// dirPositions returns the position (starting from 1) of each match
+// within its own directory in the current order of the matches.
+func dirPositions(matches []Change) []int {
+	positions := make([]int, len(matches))
+	counts := make(map[string]int)
+
+	for i := range matches {
+		dir := filepath.Clean(matches[i].BaseDir)
+		counts[dir]++
+		positions[i] = counts[dir]
+	}
+
+	return positions
+}
+
+// replaceDirIndexVariables replaces the directory index variables in the
+// target with the position of the file within its directory, zero padded
+// to the specified width.
+func (op *Operation) replaceDirIndexVariables(target string, index int) string {
+	if op.dirIndexes == nil {
+		op.dirIndexes = dirPositions(op.matches)
+	}
+
+	position := op.dirIndexes[index]
+
+	return dirIndexRegex.ReplaceAllStringFunc(target, func(match string) string {
+		submatch := dirIndexRegex.FindStringSubmatch(match)
+
+		width, _ := strconv.Atoi(submatch[1])
+
+		return fmt.Sprintf("%0*d", width, position)
+	})
+}
+
+// replaceMatchCountVariables replaces the match count variables in the
+// target with the number of matches, zero padded to the specified width.
+func replaceMatchCountVariables(target string, count int) string {
+	return matchCountRegex.ReplaceAllStringFunc(target, func(match string) string {
+		submatch := matchCountRegex.FindStringSubmatch(match)
+
+		width, _ := strconv.Atoi(submatch[1])
+
+		return fmt.Sprintf("%0*d", width, count)
+	})
+}
+
+// checkCaptureNames ensures that each named capture variable in the
+// replacement refers to a named group in the find pattern.
+func checkCaptureNames(replacement string, searchRegex *regexp.Regexp) error {
+	for _, submatch := range captureNameRegex.FindAllStringSubmatch(replacement, -1) {
+		if searchRegex.SubexpIndex(submatch[1]) < 0 {
+			return &UnknownVariableError{
+				Variable: submatch[0],
+				Err:      errInvalidMatchGroup,
+			}
+		}
+	}
+
+	return nil
+}
+
+// replaceCaptureNameVariables replaces the named capture variables in the
+// target with the text captured by the corresponding group in the first
+// match of the find pattern. Unlike ${name}, the value is the same for
+// every match in the filename. The variable is replaced with an empty
+// string if the group does not exist or did not participate in the match.
+func replaceCaptureNameVariables(
+	target, name string,
+	searchRegex *regexp.Regexp,
+) string {
+	submatch := searchRegex.FindStringSubmatch(name)
+
+	return captureNameRegex.ReplaceAllStringFunc(target, func(match string) string {
+		group := searchRegex.SubexpIndex(captureNameRegex.FindStringSubmatch(match)[1])
+		if group < 0 || group >= len(submatch) {
+			return ""
+		}
+
+		return submatch[group]
+	})
+}
+
+// replaceCapturePosVariables replaces the capture position variables in
+// the target with the zero-based character offset at which the capture
+// group started in the first match of the find pattern. The variable is
+// replaced with an empty string if the group does not exist or did not
+// participate in the match.
+func replaceCapturePosVariables(
+	target, name string,
+	searchRegex *regexp.Regexp,
+) string {
+	indices := searchRegex.FindStringSubmatchIndex(name)
+
+	return capturePosRegex.ReplaceAllStringFunc(target, func(match string) string {
+		submatch := capturePosRegex.FindStringSubmatch(match)
+
+		group, err := strconv.Atoi(submatch[1])
+		if err != nil || 2*group+1 >= len(indices) || indices[2*group] < 0 {
+			return ""
+		}
+
+		return strconv.Itoa(utf8.RuneCountInString(name[:indices[2*group]]))
+	})
+}
+
+// normalizeSpace trims the input and collapses each run of internal
+// whitespace into a single space.
+func normalizeSpace(input string) string {
+	return strings.Join(strings.Fields(input), " ")
+}
+
+// resolveVariables replaces the variables matched by the regex in the
+// target using the provided function. If the whitespace in variable values
+// is being normalized, each variable is resolved in isolation so that
+// its value can be normalized without affecting the surrounding text.
+func (op *Operation) resolveVariables(
+	target string,
+	regex *regexp.Regexp,
+	resolve func(target string) (string, error),
+) (string, error) {
+	if !op.normalizeVariables {
+		return resolve(target)
+	}
+
+	var err error
+
+	out := regex.ReplaceAllStringFunc(target, func(match string) string {
+		value, rerr := resolve(match)
+		if rerr != nil {
+			err = rerr
+		}
+
+		return normalizeSpace(value)
+	})
+
+	return out, err
+}
+
+// metadataReadError wraps an error that occurred while resolving the
+// variables matched by the regex in the target. The first matching
+// variable is reported.
+func metadataReadError(
+	target, sourcePath string,
+	regex *regexp.Regexp,
+	err error,
+) error {
+	return &MetadataReadError{
+		Path:     sourcePath,
+		Variable: regex.FindString(target),
+		Err:      err,
+	}
+}
+
 // replaceVariables checks if any variables are present in the target filename
 // and delegates the variable replacement to the appropriate function.
 func (op *Operation) replaceVariables(
@@ -845,14 +2301,23 @@ func (op *Operation) replaceVariables(
 		parentDir = filepath.Base(op.workingDir)
 	}
 
+	if passCaptureRegex.MatchString(ch.Target) {
+		ch.Target = replacePassCaptureVariables(ch.Target, ch.captures)
+	}
+
 	// replace `{{f}}` in the target with the original filename
 	// (excluding the extension)
 	if filenameRegex.MatchString(ch.Target) {
-		ch.Target = regexReplace(
-			filenameRegex,
+		ch.Target, _ = op.resolveVariables(
 			ch.Target,
-			filenameWithoutExtension(sourceName),
-			0,
+			filenameRegex,
+			func(target string) (string, error) {
+				return replaceFilenameVariables(
+					target,
+					filenameWithoutExtension(sourceName),
+					vars.filename,
+				), nil
+			},
 		)
 	}
 
@@ -863,67 +2328,368 @@ func (op *Operation) replaceVariables(
 
 	// replace `{{p}}` in the target with the parent directory name
 	if parentDirRegex.MatchString(ch.Target) {
-		ch.Target = regexReplace(parentDirRegex, ch.Target, parentDir, 0)
+		ch.Target, _ = op.resolveVariables(
+			ch.Target,
+			parentDirRegex,
+			func(target string) (string, error) {
+				return regexReplace(parentDirRegex, target, parentDir, 0), nil
+			},
+		)
+	}
+
+	// replace `{{relpath}}` in the target with the path of the file
+	// relative to its search root
+	if relPathRegex.MatchString(ch.Target) {
+		ch.Target, _ = op.resolveVariables(
+			ch.Target,
+			relPathRegex,
+			func(target string) (string, error) {
+				return op.replaceRelPathVariables(target, ch, vars.relPath), nil
+			},
+		)
+	}
+
+	// replace `{{sibling.name}}` in the target with the name of
+	// the matching file in the same directory
+	if siblingRegex.MatchString(ch.Target) {
+		out, err := op.resolveVariables(
+			ch.Target,
+			siblingRegex,
+			func(target string) (string, error) {
+				return op.replaceSiblingVariables(target, ch)
+			},
+		)
+		if errors.Is(err, errSiblingNotFound) {
+			return err
+		}
+
+		if err != nil {
+			return metadataReadError(ch.Target, sourcePath, siblingRegex, err)
+		}
+
+		ch.Target = out
 	}
 
 	// handle date variables (e.g {{mtime.DD}})
 	if dateRegex.MatchString(ch.Target) {
-		out, err := replaceDateVariables(ch.Target, sourcePath, vars.date)
+		out, err := op.resolveVariables(
+			ch.Target,
+			dateRegex,
+			func(target string) (string, error) {
+				return replaceDateVariables(target, sourcePath, vars.date, op.now)
+			},
+		)
 		if err != nil {
-			return err
+			return metadataReadError(ch.Target, sourcePath, dateRegex, err)
 		}
 
 		ch.Target = out
 	}
 
 	if exiftoolRegex.MatchString(ch.Target) {
-		out, err := replaceExifToolVariables(
+		out, err := op.resolveVariables(
 			ch.Target,
-			sourcePath,
-			vars.exiftool,
+			exiftoolRegex,
+			func(target string) (string, error) {
+				return op.replaceExifToolVariables(target, sourcePath, vars.exiftool)
+			},
 		)
 		if err != nil {
-			return err
+			return metadataReadError(ch.Target, sourcePath, exiftoolRegex, err)
 		}
 
 		ch.Target = out
 	}
 
 	if exifRegex.MatchString(ch.Target) {
-		out, err := replaceExifVariables(ch.Target, sourcePath, vars.exif)
+		out, err := op.resolveVariables(
+			ch.Target,
+			exifRegex,
+			func(target string) (string, error) {
+				return op.replaceExifVariables(target, sourcePath, vars.exif)
+			},
+		)
 		if err != nil {
-			return err
+			return metadataReadError(ch.Target, sourcePath, exifRegex, err)
+		}
+
+		ch.Target = out
+	}
+
+	if videoRegex.MatchString(ch.Target) {
+		out, err := op.resolveVariables(
+			ch.Target,
+			videoRegex,
+			func(target string) (string, error) {
+				return replaceVideoVariables(target, sourcePath, vars.video)
+			},
+		)
+		if err != nil {
+			return metadataReadError(ch.Target, sourcePath, videoRegex, err)
 		}
 
 		ch.Target = out
 	}
 
 	if id3Regex.MatchString(ch.Target) {
-		out, err := replaceID3Variables(ch.Target, sourcePath, vars.id3)
+		out, err := op.resolveVariables(
+			ch.Target,
+			id3Regex,
+			func(target string) (string, error) {
+				return replaceID3Variables(target, sourcePath, vars.id3, op.artLabels)
+			},
+		)
 		if err != nil {
-			return err
+			return metadataReadError(ch.Target, sourcePath, id3Regex, err)
 		}
 
 		ch.Target = out
 	}
 
 	if csvRegex.MatchString(ch.Target) {
-		out := replaceCsvVariables(ch.Target, ch.csvRow, vars.csv)
+		row := ch.csvRow
 
-		ch.Target = out
+		// The row is matched against the file name in lookup mode
+		if op.csvKey > 0 {
+			var err error
+
+			row, err = op.csvLookup(ch)
+			if err != nil {
+				return err
+			}
+		}
+
+		ch.Target, _ = op.resolveVariables(
+			ch.Target,
+			csvRegex,
+			func(target string) (string, error) {
+				return replaceCsvVariables(target, row, vars.csv), nil
+			},
+		)
 	}
 
 	if hashRegex.MatchString(ch.Target) {
-		out, err := replaceFileHash(ch.Target, sourcePath, vars.hash)
+		content, ok, err := op.customContent(ch)
 		if err != nil {
-			return err
+			return metadataReadError(ch.Target, sourcePath, hashRegex, err)
+		}
+
+		var files []string
+
+		if !ok {
+			files, err = op.hashSources(sourcePath)
+			if err != nil {
+				return metadataReadError(ch.Target, sourcePath, hashRegex, err)
+			}
+		}
+
+		out, err := op.resolveVariables(
+			ch.Target,
+			hashRegex,
+			func(target string) (string, error) {
+				if ok {
+					return replaceContentHash(target, content, vars.hash), nil
+				}
+
+				return replaceFileHash(target, files, vars.hash, op.hashHead)
+			},
+		)
+		if err != nil {
+			return metadataReadError(ch.Target, sourcePath, hashRegex, err)
+		}
+
+		ch.Target = out
+	}
+
+	if jsonRegex.MatchString(ch.Target) {
+		out, err := op.resolveVariables(
+			ch.Target,
+			jsonRegex,
+			func(target string) (string, error) {
+				return op.replaceJSONVariables(target, sourcePath)
+			},
+		)
+		if err != nil {
+			return metadataReadError(ch.Target, sourcePath, jsonRegex, err)
+		}
+
+		ch.Target = out
+	}
+
+	if firstLineRegex.MatchString(ch.Target) {
+		out, err := op.resolveVariables(
+			ch.Target,
+			firstLineRegex,
+			func(target string) (string, error) {
+				return replaceFirstLineVariables(target, sourcePath)
+			},
+		)
+		if err != nil {
+			return metadataReadError(ch.Target, sourcePath, firstLineRegex, err)
+		}
+
+		ch.Target = out
+	}
+
+	if phashRegex.MatchString(ch.Target) {
+		out, err := replacePerceptualHash(ch.Target, sourcePath, vars.phash)
+		if err != nil {
+			return metadataReadError(ch.Target, sourcePath, phashRegex, err)
 		}
 
 		ch.Target = out
 	}
 
 	if randomRegex.MatchString(ch.Target) {
-		ch.Target = replaceRandomVariables(ch.Target, vars.random)
+		ch.Target = replaceRandomVariables(ch.Target, vars.random, op.rng)
+	}
+
+	if randomPickRegex.MatchString(ch.Target) {
+		ch.Target = replaceRandomPickVariables(
+			ch.Target,
+			vars.randomPick,
+			op.rng,
+		)
+	}
+
+	// replace `{{dirsize.count}}` in the target with the number
+	// of entries in the parent directory
+	if dirCountRegex.MatchString(ch.Target) {
+		count, err := op.dirEntryCount(ch.BaseDir)
+		if err != nil {
+			return metadataReadError(ch.Target, sourcePath, dirCountRegex, err)
+		}
+
+		ch.Target, _ = op.resolveVariables(
+			ch.Target,
+			dirCountRegex,
+			func(target string) (string, error) {
+				return regexReplace(dirCountRegex, target, strconv.Itoa(count), 0), nil
+			},
+		)
+	}
+
+	if durationRegex.MatchString(ch.Target) {
+		out, err := op.resolveVariables(
+			ch.Target,
+			durationRegex,
+			func(target string) (string, error) {
+				return replaceDurationVariables(target, sourcePath)
+			},
+		)
+		if err != nil {
+			return metadataReadError(ch.Target, sourcePath, durationRegex, err)
+		}
+
+		ch.Target = out
+	}
+
+	if pdfRegex.MatchString(ch.Target) {
+		out, err := op.resolveVariables(
+			ch.Target,
+			pdfRegex,
+			func(target string) (string, error) {
+				return op.replacePDFVariables(target, sourcePath, vars.pdf)
+			},
+		)
+		if err != nil {
+			return metadataReadError(ch.Target, sourcePath, pdfRegex, err)
+		}
+
+		ch.Target = out
+	}
+
+	if ownerRegex.MatchString(ch.Target) {
+		out, err := op.resolveVariables(
+			ch.Target,
+			ownerRegex,
+			func(target string) (string, error) {
+				return op.replaceOwnerVariables(target, sourcePath, vars.owner)
+			},
+		)
+		if err != nil {
+			return metadataReadError(ch.Target, sourcePath, ownerRegex, err)
+		}
+
+		ch.Target = out
+	}
+
+	if dateSourceRegex.MatchString(ch.Target) {
+		out, err := op.resolveVariables(
+			ch.Target,
+			dateSourceRegex,
+			func(target string) (string, error) {
+				return op.replaceDateSourceVariables(target, ch, vars.dateSource)
+			},
+		)
+		if err != nil {
+			return metadataReadError(ch.Target, sourcePath, dateSourceRegex, err)
+		}
+
+		ch.Target = out
+	}
+
+	// replace `{{archive.commonprefix}}` in the target with
+	// the name derived from the entries of the archive
+	if archiveRegex.MatchString(ch.Target) {
+		prefix, err := archiveCommonPrefix(sourcePath)
+		if err != nil {
+			return metadataReadError(ch.Target, sourcePath, archiveRegex, err)
+		}
+
+		ch.Target, _ = op.resolveVariables(
+			ch.Target,
+			archiveRegex,
+			func(target string) (string, error) {
+				return regexReplace(archiveRegex, target, prefix, 0), nil
+			},
+		)
+	}
+
+	// replace `{{agebucket}}` in the target with the label of the bucket
+	// that contains the modification time of the file
+	if ageBucketRegex.MatchString(ch.Target) {
+		bucket, err := op.fileAgeBucket(sourcePath)
+		if err != nil {
+			return metadataReadError(ch.Target, sourcePath, ageBucketRegex, err)
+		}
+
+		ch.Target, _ = op.resolveVariables(
+			ch.Target,
+			ageBucketRegex,
+			func(target string) (string, error) {
+				return regexReplace(ageBucketRegex, target, bucket, 0), nil
+			},
+		)
+	}
+
+	if matchCountRegex.MatchString(ch.Target) {
+		name := sourceName
+		if op.ignoreExt {
+			name = filenameWithoutExtension(name)
+		}
+
+		count := len(op.searchRegex.FindAllString(name, -1))
+
+		ch.Target = replaceMatchCountVariables(ch.Target, count)
+	}
+
+	if captureNameRegex.MatchString(ch.Target) {
+		name := sourceName
+		if op.ignoreExt {
+			name = filenameWithoutExtension(name)
+		}
+
+		ch.Target = replaceCaptureNameVariables(ch.Target, name, op.searchRegex)
+	}
+
+	if capturePosRegex.MatchString(ch.Target) {
+		name := sourceName
+		if op.ignoreExt {
+			name = filenameWithoutExtension(name)
+		}
+
+		ch.Target = replaceCapturePosVariables(ch.Target, name, op.searchRegex)
 	}
 
 	if transformRegex.MatchString(ch.Target) {
@@ -931,16 +2697,34 @@ func (op *Operation) replaceVariables(
 			sourceName = filenameWithoutExtension(sourceName)
 		}
 
-		ch.Target = replaceTransformVariables(
+		matches := op.searchRegex.FindAllString(sourceName, -1)
+
+		ch.Target, _ = op.resolveVariables(
 			ch.Target,
-			op.searchRegex.FindAllString(sourceName, -1),
-			vars.transform,
+			transformRegex,
+			func(target string) (string, error) {
+				return replaceTransformVariables(target, matches, vars.transform), nil
+			},
 		)
 	}
 
+	index := op.numberIndex(ch.index)
+
+	if groupRegex.MatchString(ch.Target) {
+		ch.Target = op.replaceGroupVariables(ch.Target, index)
+	}
+
+	if dirIndexRegex.MatchString(ch.Target) {
+		ch.Target = op.replaceDirIndexVariables(ch.Target, ch.index)
+	}
+
+	if dateSeqRegex.MatchString(ch.Target) {
+		ch.Target = op.replaceDateSeqVariables(ch.Target, index)
+	}
+
 	// Replace indexing scheme like %03d in the target
 	if indexRegex.MatchString(ch.Target) {
-		ch.Target = op.replaceIndex(ch.Target, ch.index, vars.number)
+		ch.Target = op.replaceIndex(ch.Target, index, vars.number)
 	}
 
 	return nil
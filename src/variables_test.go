@@ -1,17 +1,26 @@
 package f2
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"gopkg.in/djherbis/times.v1"
 )
 
@@ -36,11 +45,19 @@ func TestAutoIncrementingNumber(t *testing.T) {
 		"%db",
 		"%do",
 		"%dh",
+		"%da",
+		"26%da",
+		"{{c%da2.up}}",
+		"{{254%04dh.up}}",
+		"%04db",
+		"35%dz",
+		"{{35%03dz.up}}",
+		"10%3do",
 	}
 	want := map[string][]string{
-		"a.md": {"1", "000001", "010", "2", "VI", "1", "1", "1"},
-		"b.md": {"2", "000002", "011", "8", "VII", "10", "2", "2"},
-		"c.md": {"3", "000003", "012", "11", "VIII", "11", "3", "3"},
+		"a.md": {"1", "000001", "010", "2", "VI", "1", "1", "1", "a", "z", "C", "00FE", "0001", "z", "00Z", " 12"},
+		"b.md": {"2", "000002", "011", "8", "VII", "10", "2", "2", "b", "aa", "E", "00FF", "0010", "10", "010", " 13"},
+		"c.md": {"3", "000003", "012", "11", "VIII", "11", "3", "3", "c", "ab", "G", "0100", "0011", "11", "011", " 14"},
 	}
 
 	for i, v := range replacement {
@@ -60,233 +77,998 @@ func TestAutoIncrementingNumber(t *testing.T) {
 	}
 }
 
-func TestReplaceFilenameVariables(t *testing.T) {
-	testDir := setupFileSystem(t)
-
-	for _, path := range fileSystem {
-		op := &Operation{}
-		op.replacement = "{{p}}-{{f}}{{ext}}"
-
-		fullPath := filepath.Join(testDir, path)
-		base := filenameWithoutExtension(filepath.Base(path))
-		ext := filepath.Ext(path)
-		dir := filepath.Dir(path)
-		ch := Change{
-			BaseDir: filepath.Join(testDir, dir),
-			Source:  filepath.Base(path),
-			Target:  op.replacement,
-		}
-
-		v, err := extractVariables(op.replacement)
-		if err != nil {
-			t.Fatalf("Unexpected error: %v", err)
-		}
+func TestIndexSkipRanges(t *testing.T) {
+	cases := []struct {
+		replacement string
+		want        []string
+	}{
+		{"%d<2-4,3-6>", []string{"1", "7", "8", "9"}},
+		{"%d<3-6,2-4,5>", []string{"1", "7", "8", "9"}},
+		{"%d2<3-5>", []string{"1", "7", "9", "11"}},
+		{"%d2<2-6>", []string{"1", "7", "9", "11"}},
+		{"10%d5<15-20,20-30>", []string{"10", "35", "40", "45"}},
+		{"%d<1>", []string{"2", "3", "4", "5"}},
+		{"%d<8-10>", []string{"1", "2", "3", "4"}},
+	}
 
-		err = op.replaceVariables(&ch, &v)
+	for _, tc := range cases {
+		nv, err := getNumberVar(tc.replacement)
 		if err != nil {
-			t.Fatalf("Unexpected error: %v", err)
+			t.Fatalf("Test (%s) — Unexpected error: %v", tc.replacement, err)
 		}
 
-		got := ch.Target
+		op := &Operation{}
 
-		want := fmt.Sprintf(
-			"%s-%s%s",
-			filepath.Base(filepath.Dir(fullPath)),
-			base,
-			ext,
-		)
-		if got != want {
-			t.Fatalf("Expected: %s, but got: %s", want, got)
+		// the number only depends on the position of the file so the
+		// files are numbered in reverse to ensure that no state is kept
+		for j := len(tc.want) - 1; j >= 0; j-- {
+			got := op.replaceIndex(tc.replacement, j, nv)
+			if got != tc.want[j] {
+				t.Fatalf("Test (%s) — Expected: %s at position %d, got: %s", tc.replacement, tc.want[j], j, got)
+			}
 		}
 	}
-}
 
-func TestReplaceDateVariables(t *testing.T) {
 	testDir := setupFileSystem(t)
 
-	for _, file := range fileSystem {
-		path := filepath.Join(testDir, file)
-
-		// change the atime and mtime to a random value
-		mtime, atime := randate(), randate()
-
-		err := os.Chtimes(path, atime, mtime)
-		if err != nil {
-			t.Fatalf("Expected no errors, but got one: %v\n", err)
-		}
-
-		timeInfo, err := times.Stat(path)
-		if err != nil {
-			t.Fatalf("Expected no errors, but got one: %v\n", err)
-		}
+	images := filepath.Join(testDir, "images")
 
-		want := make(map[string]string)
-		got := make(map[string]string)
+	cases2 := []testCase{
+		{
+			name: "Skip ranges leave gaps in each chunk",
+			want: []Change{
+				{
+					Source:  "456.webp",
+					BaseDir: images,
+					Target:  "1.webp",
+				},
+				{
+					Source:  "a.jpg",
+					BaseDir: images,
+					Target:  "4.jpg",
+				},
+				{
+					Source:  "abc.png",
+					BaseDir: images,
+					Target:  "1.png",
+				},
+				{
+					Source:  "b.jPg",
+					BaseDir: images,
+					Target:  "4.jPg",
+				},
+			},
+			args: []string{
+				"-f",
+				".*",
+				"-r",
+				"%d<2-3>{{ext}}",
+				"--chunk-size",
+				"2",
+				images,
+			},
+		},
+	}
 
-		accessTime := timeInfo.AccessTime()
-		modTime := timeInfo.ModTime()
+	runFindReplace(t, cases2)
+}
 
-		fileTimes := []string{"mtime", "atime", "ctime", "btime"}
+func TestChunkedIndex(t *testing.T) {
+	testDir := setupFileSystem(t)
 
-		for _, v := range fileTimes {
-			var timeValue time.Time
+	images := filepath.Join(testDir, "images")
 
-			switch v {
-			case "mtime":
-				timeValue = modTime
-			case "atime":
-				timeValue = accessTime
-			case "ctime":
-				timeValue = modTime
-				if timeInfo.HasChangeTime() {
-					timeValue = timeInfo.ChangeTime()
-				}
-			case "btime":
-				timeValue = modTime
-				if timeInfo.HasBirthTime() {
-					timeValue = timeInfo.BirthTime()
-				}
-			}
+	cases := []testCase{
+		{
+			name: "Restart the index in each chunk and number the groups",
+			want: []Change{
+				{
+					Source:  "456.webp",
+					BaseDir: images,
+					Target:  filepath.Join("g01", "1.webp"),
+				},
+				{
+					Source:  "a.jpg",
+					BaseDir: images,
+					Target:  filepath.Join("g01", "2.jpg"),
+				},
+				{
+					Source:  "abc.png",
+					BaseDir: images,
+					Target:  filepath.Join("g01", "3.png"),
+				},
+				{
+					Source:  "b.jPg",
+					BaseDir: images,
+					Target:  filepath.Join("g02", "1.jPg"),
+				},
+			},
+			args: []string{
+				"-f",
+				".*",
+				"-r",
+				"g{{group.2}}/%d{{ext}}",
+				"--chunk-size",
+				"3",
+				images,
+			},
+		},
+	}
 
-			for key, token := range dateTokens {
-				want[v+"."+key] = timeValue.Format(token)
+	runFindReplace(t, cases)
 
-				dv, err := getDateVar("{{" + v + "." + key + "}}")
-				if err != nil {
-					t.Fatalf("Test (%s) — Unexpected error: %v", v, err)
-				}
+	_, err := action([]string{
+		os.Args[0],
+		"-f",
+		".*",
+		"-r",
+		"%d",
+		"--chunk-size",
+		"0",
+		images,
+	})
+	if !errors.Is(err, errInvalidChunkSize) {
+		t.Fatalf("Expected an invalid chunk size error, got: %v", err)
+	}
+}
 
-				out, err := replaceDateVariables("{{"+v+"."+key+"}}", path, dv)
-				if err != nil {
-					t.Fatalf("Expected no errors, but got one: %v\n", err)
-				}
+func TestParseExiftoolOpts(t *testing.T) {
+	cases := []struct {
+		opts  []string
+		count int
+		err   bool
+	}{
+		{
+			opts:  []string{"-api largefilesupport=1", "-charset utf8", "-ee", "-n"},
+			count: 4,
+		},
+		{opts: []string{"", "  "}, count: 0},
+		{opts: []string{"-charset"}, err: true},
+		{opts: []string{"-charset -json"}, err: true},
+		{opts: []string{"-api"}, err: true},
+		{opts: []string{"-api -json"}, err: true},
+		{opts: []string{"-ee 1"}, err: true},
+		{opts: []string{"-csv"}, err: true},
+		{opts: []string{"-stay_open False"}, err: true},
+	}
 
-				got[v+"."+key] = out
+	for _, v := range cases {
+		got, err := parseExiftoolOpts(v.opts)
+		if v.err {
+			if !errors.Is(err, errInvalidExiftoolOpt) {
+				t.Fatalf(
+					"Test (%v) — Expected: %v, got: %v",
+					v.opts,
+					errInvalidExiftoolOpt,
+					err,
+				)
 			}
+
+			continue
 		}
 
-		if !cmp.Equal(want, got) {
+		if err != nil || len(got) != v.count {
 			t.Fatalf(
-				"Expected %v, but got %v\n",
-				prettyPrint(want),
-				prettyPrint(got),
+				"Test (%v) — Expected %d options, got: %d (%v)",
+				v.opts,
+				v.count,
+				len(got),
+				err,
 			)
 		}
 	}
 }
 
-func TestReplaceExifVariables(t *testing.T) {
-	rootDir := filepath.Join("..", "testdata", "images")
+func TestDirIndex(t *testing.T) {
+	testDir := t.TempDir()
 
-	type FileExif struct {
-		Year         string `json:"year"`
-		Make         string `json:"make"`
-		Model        string `json:"model"`
-		ISO          int    `json:"iso"`
-		Width        int    `json:"width"`
-		Height       int    `json:"height"`
-		Dimensions   string `json:"dimensions"`
-		ExposureTime string `json:"exposure_time"`
-		FocalLength  string `json:"focal_length"`
-		Aperture     string `json:"aperture"`
+	for _, f := range []string{"a/x.txt", "a/y.txt", "b/z.txt"} {
+		path := filepath.Join(testDir, f)
+
+		err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.WriteFile(path, nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
 	}
 
 	cases := []testCase{
 		{
-			name: "Use EXIF data to rename CR2 file",
+			name: "Number files within their own directory",
 			want: []Change{
 				{
-					Source:  "tractor-raw.cr2",
-					BaseDir: rootDir,
+					Source:  "x.txt",
+					BaseDir: filepath.Join(testDir, "a"),
+					Target:  "01_x.txt",
+				},
+				{
+					Source:  "y.txt",
+					BaseDir: filepath.Join(testDir, "a"),
+					Target:  "02_y.txt",
+				},
+				{
+					Source:  "z.txt",
+					BaseDir: filepath.Join(testDir, "b"),
+					Target:  "1-z.txt",
 				},
 			},
 			args: []string{
 				"-f",
-				"tractor-raw.cr2",
+				"^",
 				"-r",
-				"{{exif.dt.YYYY}}_{{exif.make}}_{{exif.model}}_ISO{{exif.iso}}_w{{exif.w}}_h{{exif.h}}_{{exif.wh}}_{{exif.et}}s_{{exif.fl}}mm_f{{exif.fnum}}{{ext}}",
-				rootDir,
+				"{{diridx.2}}_",
+				"-f",
+				"^01_z",
+				"-r",
+				"{{diridx}}-z",
+				"-R",
+				testDir,
 			},
 		},
+	}
+
+	runFindReplace(t, cases)
+}
+
+func TestRelPath(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	cases := []testCase{
 		{
-			name: "Use EXIF data to rename JPEG file",
+			name: "Flatten the relative path into the file name",
 			want: []Change{
 				{
-					Source:  "bike.jpeg",
-					BaseDir: rootDir,
+					Source:  "index.js",
+					BaseDir: filepath.Join(testDir, "scripts"),
+					Target:  "scripts__index.js",
+				},
+				{
+					Source:  "main.js",
+					BaseDir: filepath.Join(testDir, "scripts"),
+					Target:  "scripts__main.js",
 				},
 			},
 			args: []string{
 				"-f",
-				"bike.jpeg",
+				`^.*\.js$`,
 				"-r",
-				"{{exif.dt.YYYY}}_{{exif.make}}_{{exif.model}}_ISO{{exif.iso}}_w{{exif.w}}_h{{exif.h}}_{{exif.wh}}_{{exif.et}}s_{{exif.fl}}mm_f{{exif.fnum}}{{ext}}",
-				rootDir,
+				"{{relpath.replace:'/'/'__'}}",
+				"-R",
+				testDir,
 			},
 		},
 		{
-			name: "Use EXIF data to rename DNG file",
+			name: "Files in the search root only include their name",
 			want: []Change{
 				{
-					Source:  "proraw.dng",
-					BaseDir: rootDir,
+					Source:  "index.js",
+					BaseDir: filepath.Join(testDir, "scripts"),
+					Target:  "INDEX.JS",
+				},
+				{
+					Source:  "main.js",
+					BaseDir: filepath.Join(testDir, "scripts"),
+					Target:  "MAIN.JS",
 				},
 			},
 			args: []string{
 				"-f",
-				"proraw.dng",
+				".*",
 				"-r",
-				"{{exif.dt.YYYY}}_{{exif.make}}_{{exif.model}}_ISO{{exif.iso}}_w{{exif.h}}_h{{exif.w}}_{{exif.h}}x{{exif.w}}_{{exif.et}}s_{{exif.fl}}mm_f{{exif.fnum}}{{ext}}",
-				rootDir,
+				"{{relpath.up}}",
+				filepath.Join(testDir, "scripts"),
 			},
 		},
 	}
 
-	for _, c := range cases {
-		f := filenameWithoutExtension(c.want[0].Source)
-		ext := filepath.Ext(c.want[0].Source)
+	runFindReplace(t, cases)
 
-		jsonFile, err := os.ReadFile(filepath.Join(rootDir, f+".json"))
+	_, err := extractVariables("{{relpath.nope}}")
+	if !errors.Is(err, errInvalidTransform) {
+		t.Fatalf("Expected an invalid transform error, got: %v", err)
+	}
+}
+
+func TestReplaceFilenameVariables(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	for _, path := range fileSystem {
+		op := &Operation{}
+		op.replacement = "{{p}}-{{f}}{{ext}}"
+
+		fullPath := filepath.Join(testDir, path)
+		base := filenameWithoutExtension(filepath.Base(path))
+		ext := filepath.Ext(path)
+		dir := filepath.Dir(path)
+		ch := Change{
+			BaseDir: filepath.Join(testDir, dir),
+			Source:  filepath.Base(path),
+			Target:  op.replacement,
+		}
+
+		v, err := extractVariables(op.replacement)
 		if err != nil {
 			t.Fatalf("Unexpected error: %v", err)
 		}
 
-		var exif FileExif
-
-		err = json.Unmarshal(jsonFile, &exif)
+		err = op.replaceVariables(&ch, &v)
 		if err != nil {
 			t.Fatalf("Unexpected error: %v", err)
 		}
 
-		target := fmt.Sprintf(
-			"%s_%s_%s_ISO%d_w%d_h%d_%s_%ss_%smm_f%s%s",
-			exif.Year,
-			exif.Make,
-			exif.Model,
-			exif.ISO,
-			exif.Width,
-			exif.Height,
-			exif.Dimensions,
-			exif.ExposureTime,
-			exif.FocalLength,
-			exif.Aperture,
+		got := ch.Target
+
+		want := fmt.Sprintf(
+			"%s-%s%s",
+			filepath.Base(filepath.Dir(fullPath)),
+			base,
 			ext,
 		)
-
-		c.want[0].Target = target
+		if got != want {
+			t.Fatalf("Expected: %s, but got: %s", want, got)
+		}
 	}
-
-	runFindReplace(t, cases)
 }
 
-func TestReplaceID3Variables(t *testing.T) {
-	rootDir := filepath.Join("..", "testdata", "audio")
-
-	type FileID3 struct {
-		Format      string `json:"format"`
-		FileType    string `json:"file_type"`
-		Title       string `json:"title"`
-		Album       string `json:"album"`
+func TestReplaceFilenameStripVariables(t *testing.T) {
+	cases := []struct {
+		target   string
+		filename string
+		want     string
+	}{
+		{
+			target:   "{{f.stripprefix:IMG_}}",
+			filename: "IMG_2021",
+			want:     "2021",
+		},
+		{
+			target:   "{{f.stripprefix:IMG_}}",
+			filename: "DSC_2021",
+			want:     "DSC_2021",
+		},
+		{
+			target:   "{{f.stripsuffix:_final}}-v2",
+			filename: "report_final",
+			want:     "report-v2",
+		},
+		{
+			target:   "{{f.stripsuffix:_final}}",
+			filename: "report_final_draft",
+			want:     "report_final_draft",
+		},
+		{
+			target:   "{{f.stripprefix:IMG_}}_{{f}}",
+			filename: "IMG_1",
+			want:     "1_IMG_1",
+		},
+		{
+			target:   "{{f.after:' - '}} by {{f.before:' - '}}",
+			filename: "Artist - Title - Remix",
+			want:     "Title - Remix by Artist",
+		},
+		{
+			target:   "{{f.before:_}}",
+			filename: "IMG_2021_05",
+			want:     "IMG",
+		},
+		{
+			target:   "[{{f.before:' - '}}][{{f.after:' - '}}]",
+			filename: "untitled",
+			want:     "[untitled][]",
+		},
+		{
+			target:   "{{f.word:2}}",
+			filename: "Artist - Title - Remix",
+			want:     "-",
+		},
+		{
+			target:   "{{f.word:2: -}} ({{f.word:3: -}}) {{f.word:1: -}}",
+			filename: "Artist - Title - Remix",
+			want:     "Title (Remix) Artist",
+		},
+		{
+			target:   "{{f.word:3:_-}}",
+			filename: "IMG_2021-05_edit",
+			want:     "05",
+		},
+		{
+			target:   "x{{f.word:4}}y{{f.word:0}}",
+			filename: "one two three",
+			want:     "xy",
+		},
+		{
+			target:   "{{f.match:\\d{4}}}_{{f}}",
+			filename: "holiday 2019 beach",
+			want:     "2019_holiday 2019 beach",
+		},
+		{
+			target:   "{{f.match.2:(\\d{4})-(\\d{2})}}",
+			filename: "report-2021-05-final",
+			want:     "05",
+		},
+		{
+			target:   "[{{f.match:\\d{4}}}]",
+			filename: "untitled",
+			want:     "[]",
+		},
+	}
+
+	for _, v := range cases {
+		fv, err := getFilenameVar(v.target)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		got := replaceFilenameVariables(v.target, v.filename, fv)
+		if got != v.want {
+			t.Fatalf("Expected: %s, but got: %s", v.want, got)
+		}
+	}
+
+	for _, v := range []string{"{{f.match:(\\d}}", "{{f.match.2:(\\d+)}}"} {
+		var unknownErr *UnknownVariableError
+
+		_, err := getFilenameVar(v)
+		if !errors.As(err, &unknownErr) {
+			t.Fatalf("Test (%s) — Expected an UnknownVariableError, got: %v", v, err)
+		}
+	}
+}
+
+func TestReplaceMatchCountVariable(t *testing.T) {
+	cases := []struct {
+		source    string
+		target    string
+		ignoreExt bool
+		want      string
+	}{
+		{
+			source: "a1b2c3.txt",
+			target: "{{matchcount}}",
+			want:   "3",
+		},
+		{
+			source: "a1b2c3.txt",
+			target: "{{f}}_{{matchcount.3}}",
+			want:   "a1b2c3_003",
+		},
+		{
+			source: "abc.txt",
+			target: "{{matchcount.2}}",
+			want:   "00",
+		},
+		{
+			source:    "a1.mp4",
+			target:    "{{matchcount}}",
+			ignoreExt: true,
+			want:      "1",
+		},
+		{
+			source: "a1.mp4",
+			target: "{{matchcount}}",
+			want:   "2",
+		},
+	}
+
+	for _, v := range cases {
+		op := &Operation{
+			searchRegex: regexp.MustCompile(`\d`),
+			ignoreExt:   v.ignoreExt,
+		}
+
+		vars, err := extractVariables(v.target)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		ch := Change{
+			BaseDir:        ".",
+			Source:         v.source,
+			originalSource: v.source,
+			Target:         v.target,
+		}
+
+		err = op.replaceVariables(&ch, &vars)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if ch.Target != v.want {
+			t.Fatalf("Expected: %s, but got: %s", v.want, ch.Target)
+		}
+	}
+}
+
+func TestReplaceCapturePosVariable(t *testing.T) {
+	cases := []struct {
+		source    string
+		target    string
+		ignoreExt bool
+		want      string
+	}{
+		{
+			source: "report-2024-final.txt",
+			target: "{{capture.1.pos}}_{{capture.2.pos}}",
+			want:   "7_12",
+		},
+		{
+			source: "report-2024-final.txt",
+			target: "{{capture.0.pos}}",
+			want:   "6",
+		},
+		{
+			source: "café-2024-x.txt",
+			target: "{{capture.1.pos}}",
+			want:   "5",
+		},
+		{
+			source: "report-2024.txt",
+			target: "a{{capture.2.pos}}b{{capture.5.pos}}",
+			want:   "ab",
+		},
+		{
+			source: "notes.txt",
+			target: "{{f}}{{capture.1.pos}}",
+			want:   "notes",
+		},
+		{
+			source:    "x-1-y.mp4",
+			target:    "{{capture.1.pos}}",
+			ignoreExt: true,
+			want:      "2",
+		},
+	}
+
+	for _, v := range cases {
+		op := &Operation{
+			searchRegex: regexp.MustCompile(`-(\d+)(?:-(\w+))?`),
+			ignoreExt:   v.ignoreExt,
+		}
+
+		vars, err := extractVariables(v.target)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		ch := Change{
+			BaseDir:        ".",
+			Source:         v.source,
+			originalSource: v.source,
+			Target:         v.target,
+		}
+
+		err = op.replaceVariables(&ch, &vars)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if ch.Target != v.want {
+			t.Fatalf("Expected: %s, but got: %s", v.want, ch.Target)
+		}
+	}
+}
+
+func TestReplaceJSONVariables(t *testing.T) {
+	testDir := t.TempDir()
+
+	files := map[string]string{
+		"song.mp3":      "",
+		"song.mp3.json": `{"artist": {"name": "Queen"}, "tags": ["rock", "live"], "year": 1975, "live": true}`,
+		"clip.mp4":      "",
+		"clip.meta":     `{"artist": {"name": "Muse"}}`,
+		"photo.jpg":     "",
+	}
+
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(testDir, name), []byte(content), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []testCase{
+		{
+			name: "Use values from the JSON sidecar of each file",
+			want: []Change{
+				{
+					Source:  "song.mp3",
+					BaseDir: testDir,
+					Target:  "Queen-live-1975-true-.mp3",
+				},
+				{
+					Source:  "photo.jpg",
+					BaseDir: testDir,
+					Target:  "-unknown---.jpg",
+				},
+			},
+			args: []string{
+				"-f",
+				"^(song|photo)$",
+				"-r",
+				"{{json.artist.name}}-{{json.tags.1|unknown}}-{{json.year}}-{{json.live}}-{{json.tags}}",
+				"-e",
+				testDir,
+			},
+		},
+		{
+			name: "Use a custom sidecar pattern",
+			want: []Change{
+				{
+					Source:  "clip.mp4",
+					BaseDir: testDir,
+					Target:  "Muse.mp4",
+				},
+			},
+			args: []string{
+				"-f",
+				"clip.mp4",
+				"-r",
+				"{{json.artist.name}}{{ext}}",
+				"--json-sidecar",
+				"{stem}.meta",
+				testDir,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+
+	err := os.WriteFile(filepath.Join(testDir, "song.mp3.json"), []byte("{"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := action([]string{
+		os.Args[0], "-f", "song", "-r", "{{json.artist}}", "-e", testDir,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var readErr *MetadataReadError
+	if !errors.As(result.applyError, &readErr) {
+		t.Fatalf("Expected a metadata read error, got: %v", result.applyError)
+	}
+}
+
+func TestAgeBucket(t *testing.T) {
+	testDir := t.TempDir()
+
+	now := time.Date(2021, 6, 12, 15, 0, 0, 0, time.Local)
+
+	files := map[string]time.Time{
+		"morning.txt": time.Date(2021, 6, 12, 1, 0, 0, 0, time.Local),
+		"recent.txt":  now.AddDate(0, 0, -3),
+		"month.txt":   now.AddDate(0, 0, -20),
+		"old.txt":     now.AddDate(0, 0, -60),
+	}
+
+	for name, modTime := range files {
+		path := filepath.Join(testDir, name)
+
+		err := os.WriteFile(path, nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.Chtimes(path, modTime, modTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buckets, err := parseAgeBuckets(defaultAgeBuckets)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	op := &Operation{now: now, ageBuckets: buckets}
+
+	want := map[string]string{
+		"morning.txt": "today",
+		"recent.txt":  "7d",
+		"month.txt":   "30d",
+		"old.txt":     "older",
+	}
+
+	for name, label := range want {
+		got, err := op.fileAgeBucket(filepath.Join(testDir, name))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if got != label {
+			t.Fatalf("Test (%s) — Expected: %s, got: %s", name, label, got)
+		}
+	}
+
+	for _, v := range []string{"yesterday", "7", "0d", "3m", ""} {
+		if _, err := parseAgeBuckets(v); !errors.Is(err, errInvalidAgeBuckets) {
+			t.Fatalf("Expected an error for age buckets %q, got: %v", v, err)
+		}
+	}
+
+	cases := []testCase{
+		{
+			name: "Prefix files with their age bucket",
+			want: []Change{
+				{
+					Source:  "new.txt",
+					BaseDir: testDir,
+					Target:  "12h_new.txt",
+				},
+			},
+			args: []string{
+				"-f",
+				"new",
+				"-r",
+				"{{agebucket}}_new",
+				"--age-buckets",
+				"12h,2w",
+				testDir,
+			},
+		},
+	}
+
+	err = os.WriteFile(filepath.Join(testDir, "new.txt"), nil, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runFindReplace(t, cases)
+}
+
+func TestReplaceDirCountVariable(t *testing.T) {
+	testDir := t.TempDir()
+
+	for _, v := range []string{"a.txt", "b.txt", ".hidden"} {
+		err := os.WriteFile(filepath.Join(testDir, v), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := os.Mkdir(filepath.Join(testDir, "sub"), 0o750)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []testCase{
+		{
+			name: "Count the entries in the parent directory",
+			want: []Change{
+				{
+					Source:  "a.txt",
+					BaseDir: testDir,
+					Target:  "a-3.txt",
+				},
+			},
+			args: []string{
+				"-f",
+				"a",
+				"-r",
+				"a-{{dirsize.count}}",
+				testDir,
+			},
+		},
+		{
+			name: "Count the entries in the parent directory including hidden files",
+			want: []Change{
+				{
+					Source:  "a.txt",
+					BaseDir: testDir,
+					Target:  "a-4.txt",
+				},
+			},
+			args: []string{
+				"-f",
+				"a",
+				"-r",
+				"a-{{dirsize.count}}",
+				"--dirsize-hidden",
+				testDir,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+}
+
+func TestReplaceDateVariables(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	for _, file := range fileSystem {
+		path := filepath.Join(testDir, file)
+
+		// change the atime and mtime to a random value
+		mtime, atime := randate(), randate()
+
+		err := os.Chtimes(path, atime, mtime)
+		if err != nil {
+			t.Fatalf("Expected no errors, but got one: %v\n", err)
+		}
+
+		timeInfo, err := times.Stat(path)
+		if err != nil {
+			t.Fatalf("Expected no errors, but got one: %v\n", err)
+		}
+
+		want := make(map[string]string)
+		got := make(map[string]string)
+
+		accessTime := timeInfo.AccessTime()
+		modTime := timeInfo.ModTime()
+
+		fileTimes := []string{"mtime", "atime", "ctime", "btime"}
+
+		for _, v := range fileTimes {
+			var timeValue time.Time
+
+			switch v {
+			case "mtime":
+				timeValue = modTime
+			case "atime":
+				timeValue = accessTime
+			case "ctime":
+				timeValue = modTime
+				if timeInfo.HasChangeTime() {
+					timeValue = timeInfo.ChangeTime()
+				}
+			case "btime":
+				timeValue = modTime
+				if timeInfo.HasBirthTime() {
+					timeValue = timeInfo.BirthTime()
+				}
+			}
+
+			for key, token := range dateTokens {
+				want[v+"."+key] = timeValue.Format(token)
+
+				dv, err := getDateVar("{{" + v + "." + key + "}}")
+				if err != nil {
+					t.Fatalf("Test (%s) — Unexpected error: %v", v, err)
+				}
+
+				out, err := replaceDateVariables(
+					"{{"+v+"."+key+"}}",
+					path,
+					dv,
+					time.Now(),
+				)
+				if err != nil {
+					t.Fatalf("Expected no errors, but got one: %v\n", err)
+				}
+
+				got[v+"."+key] = out
+			}
+		}
+
+		if !cmp.Equal(want, got) {
+			t.Fatalf(
+				"Expected %v, but got %v\n",
+				prettyPrint(want),
+				prettyPrint(got),
+			)
+		}
+	}
+}
+
+func TestReplaceExifVariables(t *testing.T) {
+	rootDir := filepath.Join("..", "testdata", "images")
+
+	type FileExif struct {
+		Year         string `json:"year"`
+		Make         string `json:"make"`
+		Model        string `json:"model"`
+		ISO          int    `json:"iso"`
+		Width        int    `json:"width"`
+		Height       int    `json:"height"`
+		Dimensions   string `json:"dimensions"`
+		ExposureTime string `json:"exposure_time"`
+		FocalLength  string `json:"focal_length"`
+		Aperture     string `json:"aperture"`
+	}
+
+	cases := []testCase{
+		{
+			name: "Use EXIF data to rename CR2 file",
+			want: []Change{
+				{
+					Source:  "tractor-raw.cr2",
+					BaseDir: rootDir,
+				},
+			},
+			args: []string{
+				"-f",
+				"tractor-raw.cr2",
+				"-r",
+				"{{exif.dt.YYYY}}_{{exif.make}}_{{exif.model}}_ISO{{exif.iso}}_w{{exif.w}}_h{{exif.h}}_{{exif.wh}}_{{exif.et}}s_{{exif.fl}}mm_f{{exif.fnum}}{{ext}}",
+				rootDir,
+			},
+		},
+		{
+			name: "Use EXIF data to rename JPEG file",
+			want: []Change{
+				{
+					Source:  "bike.jpeg",
+					BaseDir: rootDir,
+				},
+			},
+			args: []string{
+				"-f",
+				"bike.jpeg",
+				"-r",
+				"{{exif.dt.YYYY}}_{{exif.make}}_{{exif.model}}_ISO{{exif.iso}}_w{{exif.w}}_h{{exif.h}}_{{exif.wh}}_{{exif.et}}s_{{exif.fl}}mm_f{{exif.fnum}}{{ext}}",
+				rootDir,
+			},
+		},
+		{
+			name: "Use EXIF data to rename DNG file",
+			want: []Change{
+				{
+					Source:  "proraw.dng",
+					BaseDir: rootDir,
+				},
+			},
+			args: []string{
+				"-f",
+				"proraw.dng",
+				"-r",
+				"{{exif.dt.YYYY}}_{{exif.make}}_{{exif.model}}_ISO{{exif.iso}}_w{{exif.h}}_h{{exif.w}}_{{exif.h}}x{{exif.w}}_{{exif.et}}s_{{exif.fl}}mm_f{{exif.fnum}}{{ext}}",
+				rootDir,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		f := filenameWithoutExtension(c.want[0].Source)
+		ext := filepath.Ext(c.want[0].Source)
+
+		jsonFile, err := os.ReadFile(filepath.Join(rootDir, f+".json"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		var exif FileExif
+
+		err = json.Unmarshal(jsonFile, &exif)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		target := fmt.Sprintf(
+			"%s_%s_%s_ISO%d_w%d_h%d_%s_%ss_%smm_f%s%s",
+			exif.Year,
+			exif.Make,
+			exif.Model,
+			exif.ISO,
+			exif.Width,
+			exif.Height,
+			exif.Dimensions,
+			exif.ExposureTime,
+			exif.FocalLength,
+			exif.Aperture,
+			ext,
+		)
+
+		c.want[0].Target = target
+	}
+
+	runFindReplace(t, cases)
+}
+
+func TestReplaceID3Variables(t *testing.T) {
+	rootDir := filepath.Join("..", "testdata", "audio")
+
+	type FileID3 struct {
+		Format      string `json:"format"`
+		FileType    string `json:"file_type"`
+		Title       string `json:"title"`
+		Album       string `json:"album"`
 		Artist      string `json:"artist"`
 		AlbumArtist string `json:"album_artist"`
 		Genre       string `json:"genre"`
@@ -299,310 +1081,2158 @@ func TestReplaceID3Variables(t *testing.T) {
 
 	cases := []testCase{
 		{
-			name: "Use ID3 tags to rename an mp3 file",
+			name: "Use ID3 tags to rename an mp3 file",
+			want: []Change{
+				{
+					Source:  "sample_mp3.mp3",
+					BaseDir: rootDir,
+				},
+			},
+			args: []string{
+				"-f",
+				"sample_mp3.mp3",
+				"-r",
+				"{{id3.title}}_{{id3.artist}}_{{id3.format}}_{{id3.type}}_{{id3.album}}_{{id3.album_artist}}_{{id3.track}}_{{id3.total_tracks}}_{{id3.disc}}_{{id3.total_discs}}_{{id3.year}}",
+				rootDir,
+			},
+		},
+		{
+			name: "Use ID3 tags to rename an ogg file",
+			want: []Change{
+				{
+					Source:  "sample_ogg.ogg",
+					BaseDir: rootDir,
+				},
+			},
+			args: []string{
+				"-f",
+				"sample_ogg.ogg",
+				"-r",
+				"{{id3.title}}_{{id3.artist}}_{{id3.format}}_{{id3.type}}_{{id3.album}}_{{id3.album_artist}}_{{id3.track}}_{{id3.total_tracks}}_{{id3.disc}}_{{id3.total_discs}}_{{id3.year}}",
+				rootDir,
+			},
+		},
+		{
+			name: "Use ID3 tags to rename a flac file",
+			want: []Change{
+				{
+					Source:  "sample_flac.flac",
+					BaseDir: rootDir,
+				},
+			},
+			args: []string{
+				"-f",
+				"sample_flac.flac",
+				"-r",
+				"{{id3.title}}_{{id3.artist}}_{{id3.format}}_{{id3.type}}_{{id3.album}}_{{id3.album_artist}}_{{id3.track}}_{{id3.total_tracks}}_{{id3.disc}}_{{id3.total_discs}}_{{id3.year}}",
+				rootDir,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		f := filenameWithoutExtension(c.want[0].Source)
+
+		jsonFile, err := os.ReadFile(filepath.Join(rootDir, f+".json"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		var id3 FileID3
+
+		err = json.Unmarshal(jsonFile, &id3)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		target := fmt.Sprintf(
+			"%s_%s_%s_%s_%s_%s_%s_%s_%s_%s_%s",
+			id3.Title,
+			id3.Artist,
+			id3.Format,
+			id3.FileType,
+			id3.Album,
+			id3.AlbumArtist,
+			id3.Track,
+			id3.TotalTracks,
+			id3.Disc,
+			id3.TotalDiscs,
+			id3.Year,
+		)
+
+		c.want[0].Target = target
+	}
+
+	runFindReplace(t, cases)
+}
+
+func TestID3HasArt(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	cases := []testCase{
+		{
+			name: "Files without tags do not have an art label",
+			want: []Change{
+				{
+					Source:  "index.js",
+					BaseDir: filepath.Join(testDir, "scripts"),
+					Target:  "index.js",
+				},
+			},
+			args: []string{
+				"-f",
+				"index",
+				"-r",
+				"index{{id3.hasart}}",
+				"--art-labels",
+				"art,noart",
+				filepath.Join(testDir, "scripts"),
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+
+	for _, labels := range []string{"art", "a,b,c"} {
+		args := []string{
+			os.Args[0], "-f", "index", "--art-labels", labels, testDir,
+		}
+
+		_, err := action(args)
+		if !errors.Is(err, errInvalidArtLabels) {
+			t.Fatalf("Test (%s) — Expected errInvalidArtLabels, got: %v", labels, err)
+		}
+	}
+}
+
+func TestDateSeq(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	scripts := filepath.Join(testDir, "scripts")
+
+	cases := []testCase{
+		{
+			name: "Assign consecutive days starting from a date",
+			want: []Change{
+				{
+					Source:  "index.js",
+					BaseDir: scripts,
+					Target:  "2021-12-31_index.js",
+				},
+				{
+					Source:  "main.js",
+					BaseDir: scripts,
+					Target:  "2022-01-01_main.js",
+				},
+			},
+			args: []string{
+				"-f",
+				"(index|main)",
+				"-r",
+				"{{dateseq.YYYY-MM-DD}}_$1",
+				"--dateseq-start",
+				"2021-12-31",
+				scripts,
+			},
+		},
+		{
+			name: "Advance the dates by a number of hours in the sort order",
+			want: []Change{
+				{
+					Source:  "index.js",
+					BaseDir: scripts,
+					Target:  "0530 2100.js",
+				},
+				{
+					Source:  "main.js",
+					BaseDir: scripts,
+					Target:  "0530 0900.js",
+				},
+			},
+			args: []string{
+				"-f",
+				"(index|main)",
+				"-r",
+				"{{dateseq.MMDD Hmm}}",
+				"--dateseq-start",
+				"2021-05-30T09:00",
+				"--dateseq-step",
+				"12h",
+				"--sortr",
+				"default",
+				scripts,
+			},
+		},
+		{
+			name: "Start from midnight on the current day by default",
+			want: []Change{
+				{
+					Source:  "index.js",
+					BaseDir: scripts,
+					Target:  "2000-01-15 00.js",
+				},
+				{
+					Source:  "main.js",
+					BaseDir: scripts,
+					Target:  "2000-01-01 00.js",
+				},
+			},
+			args: []string{
+				"-f",
+				"(index|main)",
+				"-r",
+				"{{dateseq.YYYY-MM-DD H}}",
+				"--dateseq-step",
+				"2w",
+				"--deterministic",
+				"--sortr",
+				"default",
+				scripts,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+
+	for _, args := range [][]string{
+		{"--dateseq-start", "05/30/2021"},
+		{"--dateseq-step", "1m"},
+		{"--dateseq-step", "0d"},
+	} {
+		args = append(
+			append([]string{os.Args[0], "-f", "js"}, args...),
+			scripts,
+		)
+
+		_, err := action(args)
+		if !errors.Is(err, errInvalidDateSeqStart) &&
+			!errors.Is(err, errInvalidDateSeqStep) {
+			t.Fatalf("Test (%v) — Expected an invalid date sequence error, got: %v", args, err)
+		}
+	}
+}
+
+func TestFirstLine(t *testing.T) {
+	testDir := t.TempDir()
+
+	utf16le := []byte{0xFF, 0xFE}
+	for _, r := range "\r\nRésumé draft\r\n" {
+		utf16le = append(utf16le, byte(r), byte(r>>8))
+	}
+
+	cases := []struct {
+		name    string
+		content []byte
+		target  string
+		want    string
+	}{
+		{"notes.md", []byte("\n  \n  # Meeting   notes  \nbody\n"), "{{firstline}}", "# Meeting notes"},
+		{"bom.txt", []byte("\xEF\xBB\xBFShopping list"), "{{firstline}}", "Shopping list"},
+		{"utf16.txt", utf16le, "{{firstline}}", "Résumé draft"},
+		{"long.txt", []byte("The quick brown fox jumps"), "{{firstline.9}}-{{firstline}}", "The quick-The quick brown fox jumps"},
+		{"path.txt", []byte("Q1/Q2 report"), "{{firstline}}", "Q1Q2 report"},
+		{"empty.txt", []byte(""), "x{{firstline}}", "x"},
+		{"binary.bin", []byte("PK\x03\x04\x00\x00"), "x{{firstline}}", "x"},
+	}
+
+	for _, tc := range cases {
+		err := os.WriteFile(filepath.Join(testDir, tc.name), tc.content, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vars, err := extractVariables(tc.target)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		ch := Change{
+			BaseDir:        testDir,
+			Source:         tc.name,
+			originalSource: tc.name,
+			Target:         tc.target,
+		}
+
+		op := &Operation{}
+
+		err = op.replaceVariables(&ch, &vars)
+		if err != nil {
+			t.Fatalf("Test (%s) — Unexpected error: %v", tc.name, err)
+		}
+
+		if ch.Target != tc.want {
+			t.Fatalf("Test (%s) — Expected: %s, got: %s", tc.name, tc.want, ch.Target)
+		}
+	}
+}
+
+func TestFileHash(t *testing.T) {
+	testDir := filepath.Join("..", "testdata", "images")
+
+	cases := []testCase{
+		{
+			name: "Replace md5 and sha1 hash",
+			want: []Change{
+				{
+					Source:  "bike.jpeg",
+					BaseDir: testDir,
+					Target:  "6801e3de5f584028b8cd4292c6eca7ba_5b97fd595c700277315742bc91ac0ae67e5eb7a3",
+				},
+			},
+			args: []string{
+				"-f",
+				"bike.jpeg",
+				"-r",
+				"{{hash.md5}}_{{hash.sha1}}",
+				testDir,
+			},
+		},
+		{
+			name: "Replace sha256 and sha512 hash",
+			want: []Change{
+				{
+					Source:  "proraw.dng",
+					BaseDir: testDir,
+					Target:  "55195ff447785e9af9dea2b0e4f3dc1e991f19dc224413f7a3e5718efb980d99_d53831330e6a70899ad36cbde793284d2cd0332ef090cf20dae86299ec9b8f5b50e06becd8bfadb65fce001d3fedb811d02d751cd9a8279cbaf88b46d25b6408",
+				},
+			},
+			args: []string{
+				"-f",
+				"proraw.dng",
+				"-r",
+				"{{hash.sha256}}_{{hash.sha512}}",
+				testDir,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+}
+
+func TestFileHashSidecar(t *testing.T) {
+	testDir := t.TempDir()
+
+	files := map[string]string{
+		"IMG_1.CR2": "raw",
+		"IMG_1.xmp": "edits",
+		"IMG_2.CR2": "raw2",
+	}
+
+	for k, v := range files {
+		err := os.WriteFile(filepath.Join(testDir, k), []byte(v), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pair := fmt.Sprintf("%x", md5.Sum([]byte("rawedits")))
+	single := fmt.Sprintf("%x", md5.Sum([]byte("raw2")))
+
+	cases := []testCase{
+		{
+			name: "Include the sidecar in the hash of the file and its sidecar",
+			want: []Change{
+				{
+					Source:  "IMG_1.CR2",
+					BaseDir: testDir,
+					Target:  pair + ".CR2",
+				},
+				{
+					Source:  "IMG_1.xmp",
+					BaseDir: testDir,
+					Target:  pair + ".xmp",
+				},
+				{
+					Source:  "IMG_2.CR2",
+					BaseDir: testDir,
+					Target:  single + ".CR2",
+				},
+			},
+			args: []string{
+				"-f",
+				".*",
+				"-r",
+				"{{hash.md5}}{{ext}}",
+				"--hash-sidecar",
+				"xmp",
+				testDir,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+}
+
+func TestHashHead(t *testing.T) {
+	sizes := map[string]int64{
+		"512":   512,
+		"64k":   64 << 10,
+		"1M":    1 << 20,
+		"2GiB":  2 << 30,
+		"1.5kb": 1536,
+		"3 T":   3 << 40,
+	}
+
+	for input, want := range sizes {
+		got, err := parseByteSize(input)
+		if err != nil {
+			t.Fatalf("Unexpected error for size %q: %v", input, err)
+		}
+
+		if got != want {
+			t.Fatalf("Test (%s) — Expected: %d, got: %d", input, want, got)
+		}
+	}
+
+	for _, v := range []string{"", "k", "64x", "-1M", "1.3", "1.2.3k"} {
+		_, err := parseByteSize(v)
+		if !errors.Is(err, errInvalidByteSize) || !strings.Contains(err.Error(), "'"+v+"'") {
+			t.Fatalf("Expected an error naming the size %q, got: %v", v, err)
+		}
+	}
+
+	testDir := t.TempDir()
+
+	content := strings.Repeat("a", 1024) + strings.Repeat("b", 1024)
+
+	err := os.WriteFile(filepath.Join(testDir, "video.mp4"), []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head := fmt.Sprintf("%x", md5.Sum([]byte(content[:1024])))
+
+	cases := []testCase{
+		{
+			name: "Hash only the start of the file",
+			want: []Change{
+				{
+					Source:  "video.mp4",
+					BaseDir: testDir,
+					Target:  head + ".mp4",
+				},
+			},
+			args: []string{
+				"-f",
+				".*",
+				"-r",
+				"{{hash.md5}}{{ext}}",
+				"--hash-head",
+				"1k",
+				testDir,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+}
+
+func TestReplaceRandomVariable(t *testing.T) {
+	slice := []string{
+		`{{10r_l}}`,
+		`{{8r_d}}`,
+		`{{9r_l}}`,
+		`{{5r_ld}}`,
+		`{{15r<12345>}}`,
+		`{{r}}`,
+	}
+
+	for _, v := range slice {
+		submatches := randomRegex.FindAllStringSubmatch(v, -1)
+		strLen := submatches[0][1]
+		length := 10
+
+		var err error
+
+		if strLen != "" {
+			length, err = strconv.Atoi(strLen)
+			if err != nil {
+				t.Fatalf("Test (%s) — Unexpected error: %v", v, err)
+			}
+		}
+
+		rv, err := getRandomVar(v)
+		if err != nil {
+			t.Fatalf("Test (%s) — Unexpected error: %v", v, err)
+		}
+
+		str := replaceRandomVariables(
+			v,
+			rv,
+			rand.New(rand.NewSource(time.Now().UnixNano())), //nolint:gosec // appropriate use of math.rand
+		)
+		if len(str) != length {
+			t.Fatalf(
+				"Test (%s) — Expected length of random string to be %d, got: %d",
+				v,
+				length,
+				len(str),
+			)
+		}
+	}
+}
+
+func TestIntegerToRoman(t *testing.T) {
+	testCases := []struct {
+		input  int
+		output string
+	}{
+		{463, "CDLXIII"},
+		{464, "CDLXIV"},
+		{1386, "MCCCLXXXVI"},
+		{1838, "MDCCCXXXVIII"},
+		{4000, "4000"},
+		{7070, "7070"},
+	}
+	for _, v := range testCases {
+		str := integerToRoman(v.input)
+		if str != v.output {
+			t.Fatalf("Roman(%v) = %v, want %v.", v.input, str, v.output)
+		}
+	}
+}
+
+func TestReplaceTransformVariables(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	cases := []testCase{
+		{
+			name: "transform file name to uppercase",
+			want: []Change{
+				{
+					Source:  "abc.pdf",
+					Target:  "ABC.PDF",
+					BaseDir: testDir,
+				},
+				{
+					Source:  "abc.epub",
+					Target:  "ABC.EPUB",
+					BaseDir: testDir,
+				},
+			},
+			args: []string{"-f", "abc.*", "-r", "{{tr.up}}", testDir},
+		},
+		{
+			name: "transform file extension to title case",
+			want: []Change{
+				{
+					Source:  "abc.pdf",
+					Target:  "abc.Pdf",
+					BaseDir: testDir,
+				},
+				{
+					Source:  "abc.epub",
+					Target:  "abc.Epub",
+					BaseDir: testDir,
+				},
+			},
+			args: []string{"-f", "pdf|epub", "-r", "{{tr.ti}}", testDir},
+		},
+		{
+			name: "transform file name to title case",
+			want: []Change{
+				{
+					Source:  "abc.pdf",
+					Target:  "abc_abc_ABC_abc_abc.pdf",
+					BaseDir: testDir,
+				},
+				{
+					Source:  "abc.epub",
+					Target:  "abc_abc_ABC_abc_abc.epub",
+					BaseDir: testDir,
+				},
+			},
+			args: []string{
+				"-f",
+				"abc.*",
+				"-r",
+				"{{tr.di}}_{{tr.lw}}_{{tr.up}}_{{tr.win}}_{{tr.mac}}",
+				"-e",
+				testDir,
+			},
+		},
+		{
+			name: "apply a chain of transforms from left to right",
+			want: []Change{
+				{
+					Source:  "abc.pdf",
+					Target:  "Abc.pdf",
+					BaseDir: testDir,
+				},
+				{
+					Source:  "abc.epub",
+					Target:  "Abc.epub",
+					BaseDir: testDir,
+				},
+			},
+			args: []string{
+				"-f",
+				"abc",
+				"-r",
+				"{{tr.up.ti}}",
+				"-e",
+				testDir,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+}
+
+func TestReplaceExifToolVariables(t *testing.T) {
+	_, err := exec.LookPath("exiftool")
+	if err != nil {
+		return
+	}
+
+	rootDir := filepath.Join("..", "testdata", "images")
+
+	cases := []testCase{
+		{
+			name: "Use exiftool data to rename DNG file",
+			want: []Change{
+				{
+					Source:  "proraw.dng",
+					BaseDir: rootDir,
+				},
+			},
+			args: []string{
+				"-f",
+				"proraw.dng",
+				"-r",
+				"{{xt.FOV}}_{{xt.ISO}}_{{xt.ImageWidth}}",
+				rootDir,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		f := filenameWithoutExtension(c.want[0].Source)
+
+		jsonFile, err := os.ReadFile(filepath.Join(rootDir, f+"_exiftool.json"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		var m = make(map[string]interface{})
+
+		err = json.Unmarshal(jsonFile, &m)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		target := fmt.Sprintf(
+			"%v_%v_%v",
+			m["FOV"],
+			m["ISO"],
+			m["ImageWidth"],
+		)
+
+		c.want[0].Target = target
+	}
+
+	runFindReplace(t, cases)
+}
+
+func TestID3BPMAndKey(t *testing.T) {
+	raw := map[string]interface{}{
+		"TBPM": " 127.6\x00",
+		"TKEY": "",
+		"key":  "8A",
+		"tmpo": 90,
+	}
+
+	if got := rawID3Text(raw, id3BPMFrames); got != "127.6" {
+		t.Fatalf("Expected the ID3v2.3 tempo, got: %s", got)
+	}
+
+	if got := rawID3Text(raw, id3KeyFrames); got != "8A" {
+		t.Fatalf("Expected empty frames to be skipped, got: %s", got)
+	}
+
+	if got := rawID3Text(map[string]interface{}{"tmpo": 90}, id3BPMFrames); got != "90" {
+		t.Fatalf("Expected the MP4 tempo, got: %s", got)
+	}
+
+	for input, want := range map[string]int{
+		"127.6": 128,
+		"90":    90,
+		"":      0,
+		"fast":  0,
+		"-5":    0,
+	} {
+		if got := decodeID3Number(input); got != want {
+			t.Fatalf("Test (%s) — Expected: %d, got: %d", input, want, got)
+		}
+	}
+
+	iv, err := getID3Var("{{id3.bpm.3}}_{{id3.bpm}}_{{id3.key.up}}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if iv.values[0].tag != "bpm" || iv.values[0].width != 3 ||
+		iv.values[1].width != 0 || iv.values[2].tag != "key" {
+		t.Fatalf("Unexpected id3 variables: %+v", iv.values)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	testDir := t.TempDir()
+
+	// a WAV file with 75.03 seconds of data at 100 bytes per second
+	wav := []byte("RIFF\x00\x00\x00\x00WAVE")
+	wav = append(wav, []byte("fmt \x10\x00\x00\x00")...)
+	wav = append(wav, 1, 0, 1, 0, 100, 0, 0, 0, 100, 0, 0, 0, 1, 0, 8, 0)
+	wav = append(wav, []byte("LIST\x03\x00\x00\x00abc\x00")...)
+	wav = append(wav, []byte("data\x4F\x1D\x00\x00")...)
+	wav = append(wav, make([]byte, 7503)...)
+
+	// a FLAC file with 3661 seconds of samples at 44.1kHz
+	samples := uint64(44100 * 3661)
+	info := make([]byte, 34)
+	info[10], info[11], info[12] = 0x0A, 0xC4, 0x40|1<<1
+	info[13] = 0xF0 | byte(samples>>32)
+	binary.BigEndian.PutUint32(info[14:18], uint32(samples))
+	flac := append([]byte("fLaC\x80\x00\x00\x22"), info...)
+
+	files := map[string][]byte{
+		"clip.wav":  wav,
+		"song.flac": flac,
+		"notes.txt": []byte("not media"),
+	}
+
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(testDir, name), content, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []testCase{
+		{
+			name: "Use the duration of media files",
+			want: []Change{
+				{
+					Source:  "clip.wav",
+					BaseDir: testDir,
+					Target:  "clip_01-15_00-01-15_75.wav",
+				},
+				{
+					Source:  "notes.txt",
+					BaseDir: testDir,
+					Target:  "notes___.txt",
+				},
+				{
+					Source:  "song.flac",
+					BaseDir: testDir,
+					Target:  "song_61-01_01-01-01_3661.flac",
+				},
+			},
+			args: []string{
+				"-f",
+				`^(\w+)`,
+				"-r",
+				"${1}_{{duration}}_{{duration.hh-mm-ss}}_{{duration.s}}",
+				testDir,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+}
+
+func TestPDFVariables(t *testing.T) {
+	testDir := t.TempDir()
+
+	files := map[string]string{
+		"report.pdf": "%PDF-1.4\n" +
+			"1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n" +
+			"2 0 obj\n<< /Type /Pages /Kids [3 0 R] /Count 12 >>\nendobj\n" +
+			"4 0 obj\n<< /Title (Annual \\(Draft\\) Report\\0402021) /Author <FEFF004A006F00E9> >>\nendobj\n" +
+			"14 0 obj\n<< /Title (Wrong object) >>\nendobj\n" +
+			"trailer\n<< /Root 1 0 R /Info 4 0 R >>\n%%EOF\n",
+		"locked.pdf": "%PDF-1.4\n" +
+			"4 0 obj\n<< /Title (Secret) >>\nendobj\n" +
+			"trailer\n<< /Info 4 0 R /Encrypt 5 0 R >>\n%%EOF\n",
+		"broken.pdf": "not a pdf",
+	}
+
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(testDir, name), []byte(content), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []testCase{
+		{
+			name: "Use the document information of PDF files",
+			want: []Change{
+				{
+					Source:  "broken.pdf",
+					BaseDir: testDir,
+					Target:  "broken___.pdf",
+				},
+				{
+					Source:  "locked.pdf",
+					BaseDir: testDir,
+					Target:  "locked___.pdf",
+				},
+				{
+					Source:  "report.pdf",
+					BaseDir: testDir,
+					Target:  "report_Annual (Draft) Report 2021_JOÉ_12.pdf",
+				},
+			},
+			args: []string{
+				"-f",
+				`.*\.pdf`,
+				"-r",
+				"{{f}}_{{pdf.title}}_{{pdf.author.up}}_{{pdf.pages}}.pdf",
+				testDir,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+}
+
+func TestDecodeID3Genre(t *testing.T) {
+	testCases := []struct {
+		input  string
+		output string
+	}{
+		{"17", "Rock"},
+		{"(17)", "Rock"},
+		{"(0)", "Blues"},
+		{"(191)", "Psybient"},
+		{"(17)Indie Rock", "Indie Rock"},
+		{"(RX)", "Remix"},
+		{"(CR)", "Cover"},
+		{"62", "Pop_Funk"},
+		{"(62)", "Pop_Funk"},
+		{"(17)Rock/Pop", "Rock_Pop"},
+		{`Drum\Bass`, "Drum_Bass"},
+		{"Jazz", "Jazz"},
+		{"255", ""},
+		{"(500)", ""},
+		{"", ""},
+	}
+
+	for _, v := range testCases {
+		got := decodeID3Genre(v.input)
+		if got != v.output {
+			t.Fatalf(
+				"Test (%s) — Expected: %s, got: %s",
+				v.input,
+				v.output,
+				got,
+			)
+		}
+	}
+}
+
+func TestFlattenText(t *testing.T) {
+	cases := []struct {
+		text   string
+		length int
+		want   string
+	}{
+		{"First line\nSecond line", 50, "First line Second line"},
+		{"  Verse one\r\n\r\nVerse two  ", 50, "Verse one Verse two"},
+		{"First line\nSecond line", 11, "First line"},
+		{"Ünïcödé text", 6, "Ünïcöd"},
+		{"", 10, ""},
+	}
+
+	for _, v := range cases {
+		got := flattenText(v.text, v.length)
+		if got != v.want {
+			t.Fatalf("Test (%q) — Expected: %q, got: %q", v.text, v.want, got)
+		}
+	}
+
+	iv, err := getID3Var("{{id3.lyrics.20.up}}_{{id3.comment}}_{{id3.title}}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []struct {
+		tag    string
+		length int
+	}{
+		{"lyrics", 20},
+		{"comment", defaultID3TextLength},
+		{"title", 0},
+	}
+
+	for i, v := range want {
+		got := iv.values[i]
+		if got.tag != v.tag || got.length != v.length {
+			t.Fatalf("Expected %s with length %d, got: %+v", v.tag, v.length, got)
+		}
+	}
+
+	if !cmp.Equal(iv.values[0].transforms, []string{"up"}) {
+		t.Fatalf("Unexpected transforms: %v", iv.values[0].transforms)
+	}
+}
+
+func TestTransformString(t *testing.T) {
+	testCases := []struct {
+		input  string
+		token  string
+		output string
+	}{
+		{"Rock & Roll", "slug", "rock-roll"},
+		{"  Café del Mar!  ", "slug", "cafe-del-mar"},
+		{"Pop/Funk", "slug", "pop-funk"},
+		{"Rock & Roll", "up", "ROCK & ROLL"},
+		{"Rock & Roll", "", "Rock & Roll"},
+		{"Song 🎵 (Live) ©2020", "safe", "Song (Live) 2020"},
+		{"Family 👨‍👩‍👧 Trip 🇳🇬", "safe", "Family Trip"},
+		{"Wave👋🏽 1️⃣ Café", "safe", "Wave Café"},
+		{"Plain name", "safe", "Plain name"},
+	}
+
+	for _, v := range testCases {
+		got := transformString(v.input, v.token)
+		if got != v.output {
+			t.Fatalf(
+				"Test (%s.%s) — Expected: %s, got: %s",
+				v.input,
+				v.token,
+				v.output,
+				got,
+			)
+		}
+	}
+}
+
+func TestIntegerToLetters(t *testing.T) {
+	testCases := []struct {
+		input  int
+		output string
+	}{
+		{1, "a"},
+		{26, "z"},
+		{27, "aa"},
+		{52, "az"},
+		{53, "ba"},
+		{702, "zz"},
+		{703, "aaa"},
+		{0, "0"},
+	}
+	for _, v := range testCases {
+		str := integerToLetters(v.input)
+		if str != v.output {
+			t.Fatalf("Letters(%v) = %v, want %v.", v.input, str, v.output)
+		}
+
+		if v.input > 0 && lettersToInteger(str) != v.input {
+			t.Fatalf(
+				"Integer(%v) = %v, want %v.",
+				str,
+				lettersToInteger(str),
+				v.input,
+			)
+		}
+	}
+}
+
+func TestReplacePerceptualHash(t *testing.T) {
+	testDir := filepath.Join("..", "testdata", "images")
+
+	cases := []struct {
+		input  string
+		source string
+		length int
+	}{
+		{input: "{{phash}}", source: "bike.jpeg", length: 16},
+		{input: "{{phash.ahash}}", source: "bike.jpeg", length: 16},
+		{input: "{{phash.dhash}}", source: "bike.jpeg", length: 16},
+		{input: "{{phash.dhash.16}}", source: "bike.jpeg", length: 64},
+		{input: "{{phash.4}}", source: "bike.jpeg", length: 4},
+		{input: "{{phash}}", source: "bike.json", length: 0},
+	}
+
+	for _, v := range cases {
+		pv, err := getPhashVar(v.input)
+		if err != nil {
+			t.Fatalf("Test (%s) — Unexpected error: %v", v.input, err)
+		}
+
+		out, err := replacePerceptualHash(
+			v.input,
+			filepath.Join(testDir, v.source),
+			pv,
+		)
+		if err != nil {
+			t.Fatalf("Test (%s) — Unexpected error: %v", v.input, err)
+		}
+
+		if len(out) != v.length {
+			t.Fatalf(
+				"Test (%s) — Expected length of hash to be %d, got: %d (%s)",
+				v.input,
+				v.length,
+				len(out),
+				out,
+			)
+		}
+	}
+
+	_, err := getPhashVar("{{phash.0}}")
+	if err == nil {
+		t.Fatal("Expected an error for a perceptual hash of size zero")
+	}
+}
+
+func TestGetExifDateSubsec(t *testing.T) {
+	cases := []struct {
+		exif   Exif
+		format string
+		subsec bool
+		want   string
+	}{
+		{
+			exif: Exif{
+				DateTimeOriginal:   "2020:11:14 15:55:36",
+				SubSecTimeOriginal: "855",
+			},
+			format: "ss",
+			subsec: true,
+			want:   "36.855",
+		},
+		{
+			exif: Exif{
+				DateTimeOriginal:   "2020:11:14 15:55:36",
+				SubSecTimeOriginal: "855",
+			},
+			format: "ss",
+			want:   "36",
+		},
+		{
+			exif: Exif{
+				DateTimeOriginal: "2020:11:14 15:55:36",
+			},
+			format: "ss",
+			subsec: true,
+			want:   "36",
+		},
+	}
+
+	for _, v := range cases {
+		v := v
+
+		got := getExifDate(&v.exif, v.format, v.subsec, nil)
+		if got != v.want {
+			t.Fatalf("Expected: %s, got: %s", v.want, got)
+		}
+	}
+
+	ev, err := getExifVar("{{exif.dt.ss.sub}}_{{x.dt.YYYY}}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !ev.values[0].subsec || ev.values[1].subsec {
+		t.Fatal("Expected only the first exif date variable to request subseconds")
+	}
+}
+
+// mp4Atom encodes an MP4 atom with the specified type and contents.
+func mp4Atom(typ string, data ...[]byte) []byte {
+	var body []byte
+	for _, d := range data {
+		body = append(body, d...)
+	}
+
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b[0:4], uint32(8+len(body)))
+	copy(b[4:8], typ)
+
+	return append(b, body...)
+}
+
+func TestReplaceVideoVariables(t *testing.T) {
+	testDir := t.TempDir()
+
+	creation := time.Date(2021, time.May, 1, 12, 0, 0, 0, time.UTC)
+
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(
+		mvhd[4:8],
+		uint32(creation.Sub(mp4Epoch)/time.Second),
+	)
+	binary.BigEndian.PutUint32(mvhd[12:16], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:20], 61500)
+
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:80], 1920<<16)
+	binary.BigEndian.PutUint32(tkhd[80:84], 1080<<16)
+
+	userData := func(s string) []byte {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint16(b[0:2], uint16(len(s)))
+
+		return append(b, s...)
+	}
+
+	keys := make([]byte, 8)
+	binary.BigEndian.PutUint32(keys[4:8], 1)
+
+	index := make([]byte, 4)
+	binary.BigEndian.PutUint32(index, 1)
+
+	video := append(
+		mp4Atom("ftyp", []byte("qt  \x00\x00\x00\x00")),
+		mp4Atom("mdat", make([]byte, 32))...,
+	)
+	video = append(video, mp4Atom("moov",
+		mp4Atom("mvhd", mvhd),
+		mp4Atom("trak", mp4Atom("tkhd", tkhd)),
+		mp4Atom("udta",
+			mp4Atom("\xa9mak", userData("Apple")),
+			mp4Atom("\xa9mod", userData("iPhone 12")),
+		),
+		mp4Atom("meta",
+			mp4Atom("hdlr", make([]byte, 24)),
+			mp4Atom("keys", keys, mp4Atom(
+				"mdta",
+				[]byte("com.apple.quicktime.creationdate"),
+			)),
+			mp4Atom("ilst", mp4Atom(string(index), mp4Atom(
+				"data",
+				make([]byte, 8),
+				[]byte("2021-05-02T08:30:00+0100"),
+			))),
+		),
+	)...)
+
+	err := os.WriteFile(filepath.Join(testDir, "video.mov"), video, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(testDir, "notes.txt"), []byte("notes"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []testCase{
+		{
+			name: "Use video metadata to rename a QuickTime file",
+			want: []Change{
+				{
+					Source:  "video.mov",
+					BaseDir: testDir,
+					Target:  "2021-05-02_08_Apple_iPhone 12_1920x1080_62s.mov",
+				},
+			},
+			args: []string{
+				"-f",
+				"video",
+				"-r",
+				"{{video.creationdate}}_{{video.creationdate.H}}_{{video.make}}_{{video.model}}_{{video.wh}}_{{video.duration}}s",
+				testDir,
+			},
+		},
+		{
+			name: "Video variables resolve empty for non-video files",
+			want: []Change{
+				{
+					Source:  "notes.txt",
+					BaseDir: testDir,
+					Target:  "notes_.txt",
+				},
+			},
+			args: []string{
+				"-f",
+				"notes",
+				"-r",
+				"notes_{{video.creationdate}}{{video.make}}{{video.wh}}",
+				testDir,
+			},
+		},
+	}
+
+	runFindReplace(t, cases)
+}
+
+func TestNormalizeVariables(t *testing.T) {
+	testDir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(testDir, " a   b .txt"), nil, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsonDir := t.TempDir()
+
+	err = os.WriteFile(filepath.Join(jsonDir, "song.mp3"), nil, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(
+		filepath.Join(jsonDir, "song.mp3.json"),
+		[]byte(`{"title": "  Bohemian   Rhapsody "}`),
+		0o600,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []testCase{
+		{
+			name: "Normalize the whitespace in JSON sidecar values",
 			want: []Change{
 				{
-					Source:  "sample_mp3.mp3",
-					BaseDir: rootDir,
+					Source:  "song.mp3",
+					BaseDir: jsonDir,
+					Target:  "[Bohemian Rhapsody].mp3",
 				},
 			},
 			args: []string{
 				"-f",
-				"sample_mp3.mp3",
+				"^song$",
 				"-r",
-				"{{id3.title}}_{{id3.artist}}_{{id3.format}}_{{id3.type}}_{{id3.album}}_{{id3.album_artist}}_{{id3.track}}_{{id3.total_tracks}}_{{id3.disc}}_{{id3.total_discs}}_{{id3.year}}",
-				rootDir,
+				"[{{json.title}}]",
+				"-e",
+				"--normalize-variables",
+				jsonDir,
 			},
 		},
 		{
-			name: "Use ID3 tags to rename an ogg file",
+			name: "Normalize the whitespace in variable values",
 			want: []Change{
 				{
-					Source:  "sample_ogg.ogg",
-					BaseDir: rootDir,
+					Source:  " a   b .txt",
+					BaseDir: testDir,
+					Target:  "[a b]  x.txt",
 				},
 			},
 			args: []string{
 				"-f",
-				"sample_ogg.ogg",
+				".*",
 				"-r",
-				"{{id3.title}}_{{id3.artist}}_{{id3.format}}_{{id3.type}}_{{id3.album}}_{{id3.album_artist}}_{{id3.track}}_{{id3.total_tracks}}_{{id3.disc}}_{{id3.total_discs}}_{{id3.year}}",
-				rootDir,
+				"[{{f}}]  x{{ext}}",
+				"--normalize-variables",
+				testDir,
 			},
 		},
 		{
-			name: "Use ID3 tags to rename a flac file",
+			name: "Preserve the whitespace in variable values by default",
 			want: []Change{
 				{
-					Source:  "sample_flac.flac",
-					BaseDir: rootDir,
+					Source:  " a   b .txt",
+					BaseDir: testDir,
+					Target:  "[ a   b ]  x.txt",
 				},
 			},
 			args: []string{
 				"-f",
-				"sample_flac.flac",
+				".*",
 				"-r",
-				"{{id3.title}}_{{id3.artist}}_{{id3.format}}_{{id3.type}}_{{id3.album}}_{{id3.album_artist}}_{{id3.track}}_{{id3.total_tracks}}_{{id3.disc}}_{{id3.total_discs}}_{{id3.year}}",
-				rootDir,
+				"[{{f}}]  x{{ext}}",
+				testDir,
 			},
 		},
 	}
 
-	for _, c := range cases {
-		f := filenameWithoutExtension(c.want[0].Source)
+	runFindReplace(t, cases)
+}
 
-		jsonFile, err := os.ReadFile(filepath.Join(rootDir, f+".json"))
+func TestParseTransforms(t *testing.T) {
+	tokens, err := parseTransforms(".lw.slug")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !cmp.Equal(tokens, []string{"lw", "slug"}) {
+		t.Fatalf("Expected: [lw slug], got: %v", tokens)
+	}
+
+	got := applyTransforms("Rock & ROLL", tokens)
+	if got != "rock-roll" {
+		t.Fatalf("Expected: rock-roll, got: %s", got)
+	}
+
+	for _, v := range []string{"{{tr.lw.bogus}}", "{{id3.title.bogus}}", "{{%03d.bogus}}"} {
+		_, err = extractVariables(v)
+		if !errors.Is(err, errInvalidTransform) {
+			t.Fatalf("Test (%s) — Expected an invalid transform error, got: %v", v, err)
+		}
+
+		if !strings.Contains(err.Error(), "'bogus'") {
+			t.Fatalf("Test (%s) — Expected the error to name the token, got: %v", v, err)
+		}
+	}
+}
+
+func TestReplaceTransform(t *testing.T) {
+	testDir := setupFileSystem(t)
+
+	cases := []struct {
+		chain string
+		input string
+		want  string
+	}{
+		{`.replace:' '/'_'`, "Rock and Roll", "Rock_and_Roll"},
+		{`.replace:and/&.up`, "Rock and Roll", "ROCK & ROLL"},
+		{`.replace:'\''/''`, "Don't Stop", "Dont Stop"},
+		{`.replace:a\/b/'.'`, "a/b-a/b", ".-."},
+		{`.lw.replace:' '/`, "Rock And Roll", "rockandroll"},
+	}
+
+	for _, v := range cases {
+		tokens, err := parseTransforms(v.chain)
 		if err != nil {
-			t.Fatalf("Unexpected error: %v", err)
+			t.Fatalf("Test (%s) — Unexpected error: %v", v.chain, err)
 		}
 
-		var id3 FileID3
+		got := applyTransforms(v.input, tokens)
+		if got != v.want {
+			t.Fatalf("Test (%s) — Expected: %s, got: %s", v.chain, v.want, got)
+		}
+	}
 
-		err = json.Unmarshal(jsonFile, &id3)
+	for _, v := range []string{`.replace:''/x`, `.replace:'a/b`, `.replace:a`} {
+		if _, err := parseTransforms(v); !errors.Is(err, errInvalidTransform) {
+			t.Fatalf("Test (%s) — Expected an invalid transform error, got: %v", v, err)
+		}
+	}
+
+	cases2 := []testCase{
+		{
+			name: "Replace literal characters in a transformed match",
+			want: []Change{
+				{
+					Source:  "index.js",
+					BaseDir: filepath.Join(testDir, "scripts"),
+					Target:  "in+dex.js",
+				},
+			},
+			args: []string{
+				"-f",
+				"index",
+				"-r",
+				"{{tr.replace:'d'/'+d'}}",
+				filepath.Join(testDir, "scripts"),
+			},
+		},
+	}
+
+	runFindReplace(t, cases2)
+
+	tv, err := extractVariables(`{{tr.replace:' '/'-'.up}}_{{id3.title.replace:'.'/_}}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !cmp.Equal(tv.transform.values[0].transforms, []string{`replace:' '/'-'`, "up"}) {
+		t.Fatalf("Unexpected transforms: %v", tv.transform.values[0].transforms)
+	}
+
+	if !cmp.Equal(tv.id3.values[0].transforms, []string{`replace:'.'/_`}) {
+		t.Fatalf("Unexpected id3 transforms: %v", tv.id3.values[0].transforms)
+	}
+
+	// the transformed value is substituted literally
+	tv, err = extractVariables(`{{tr.replace:'d'/'$1'}}.js`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got := replaceTransformVariables(
+		`{{tr.replace:'d'/'$1'}}.js`,
+		[]string{"index"},
+		tv.transform,
+	)
+	if got != "in$1ex.js" {
+		t.Fatalf("Expected: in$1ex.js, got: %s", got)
+	}
+}
+
+func TestSqueezeTransform(t *testing.T) {
+	cases := []struct {
+		chain string
+		input string
+		want  string
+	}{
+		{`.squeeze:_`, "file___name__1", "file_name_1"},
+		{`.squeeze:'.'`, "photo...jpg", "photo.jpg"},
+		{`.squeeze:'ab'`, "xababab-ab", "xab-ab"},
+		{`.squeeze`, "Rock \t and   Roll", "Rock and Roll"},
+		{`.replace:' '/_.squeeze:_.up`, "a  b", "A_B"},
+	}
+
+	for _, v := range cases {
+		tokens, err := parseTransforms(v.chain)
 		if err != nil {
-			t.Fatalf("Unexpected error: %v", err)
+			t.Fatalf("Test (%s) — Unexpected error: %v", v.chain, err)
 		}
 
-		target := fmt.Sprintf(
-			"%s_%s_%s_%s_%s_%s_%s_%s_%s_%s_%s",
-			id3.Title,
-			id3.Artist,
-			id3.Format,
-			id3.FileType,
-			id3.Album,
-			id3.AlbumArtist,
-			id3.Track,
-			id3.TotalTracks,
-			id3.Disc,
-			id3.TotalDiscs,
-			id3.Year,
+		got := applyTransforms(v.input, tokens)
+		if got != v.want {
+			t.Fatalf("Test (%s) — Expected: %s, got: %s", v.chain, v.want, got)
+		}
+	}
+
+	for _, v := range []string{`.squeeze:`, `.squeeze:''`, `.squeeze:'_`} {
+		if _, err := parseTransforms(v); !errors.Is(err, errInvalidTransform) {
+			t.Fatalf("Test (%s) — Expected an invalid transform error, got: %v", v, err)
+		}
+	}
+
+	_, err := extractVariables("{{f.squeeze:_.bogus}}")
+
+	var varErr *UnknownVariableError
+	if !errors.As(err, &varErr) || !errors.Is(err, errInvalidTransform) {
+		t.Fatalf("Expected an invalid transform error, got: %v", err)
+	}
+
+	testDir := t.TempDir()
+
+	err = os.WriteFile(filepath.Join(testDir, "my__new___file.txt"), nil, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runFindReplace(t, []testCase{
+		{
+			name: "Collapse runs of a character in the file name",
+			want: []Change{
+				{
+					Source:  "my__new___file.txt",
+					BaseDir: testDir,
+					Target:  "my_new_file.txt",
+				},
+			},
+			args: []string{"-f", ".*", "-r", "{{f.squeeze:_}}{{ext}}", testDir},
+		},
+	})
+}
+
+func TestPadNumTransform(t *testing.T) {
+	cases := []struct {
+		chain string
+		input string
+		want  string
+	}{
+		{`.padnum:2`, "track2", "track02"},
+		{`.padnum:2`, "track10", "track10"},
+		{`.padnum:3`, "s1e12 part 0004", "s001e012 part 0004"},
+		{`.padnum:2.up`, "disc1-track3", "DISC01-TRACK03"},
+		{`.padnum:4`, "no numbers", "no numbers"},
+	}
+
+	for _, v := range cases {
+		tokens, err := parseTransforms(v.chain)
+		if err != nil {
+			t.Fatalf("Test (%s) — Unexpected error: %v", v.chain, err)
+		}
+
+		got := applyTransforms(v.input, tokens)
+		if got != v.want {
+			t.Fatalf("Test (%s) — Expected: %s, got: %s", v.chain, v.want, got)
+		}
+	}
+
+	for _, v := range []string{`.padnum:`, `.padnum:0`, `.padnum:x`, `.padnum:-2`} {
+		if _, err := parseTransforms(v); !errors.Is(err, errInvalidTransform) {
+			t.Fatalf("Test (%s) — Expected an invalid transform error, got: %v", v, err)
+		}
+	}
+
+	testDir := t.TempDir()
+
+	for _, name := range []string{"track2.mp3", "track10.mp3"} {
+		err := os.WriteFile(filepath.Join(testDir, name), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runFindReplace(t, []testCase{
+		{
+			name: "Pad the numbers in the file name",
+			want: []Change{
+				{Source: "track10.mp3", BaseDir: testDir, Target: "track10.mp3"},
+				{Source: "track2.mp3", BaseDir: testDir, Target: "track02.mp3"},
+			},
+			args: []string{"-f", ".*", "-r", "{{f.padnum:2}}{{ext}}", testDir},
+		},
+	})
+}
+
+func TestReplaceRandomPickVariable(t *testing.T) {
+	options := []string{"draft", "review", "final"}
+
+	rpv, err := getRandomPickVar("{{random.pick:draft|review|final}}_{{random.pick:a.b}}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !cmp.Equal(rpv.values[0].options, options) {
+		t.Fatalf("Expected options: %v, got: %v", options, rpv.values[0].options)
+	}
+
+	for i := 0; i < 20; i++ {
+		out := replaceRandomPickVariables(
+			"{{random.pick:draft|review|final}}_{{random.pick:a.b}}",
+			rpv,
+			rand.New(rand.NewSource(int64(i))), //nolint:gosec // appropriate use of math.rand
+		)
+
+		parts := strings.Split(out, "_")
+		if len(parts) != 2 || !contains(options, parts[0]) || parts[1] != "a.b" {
+			t.Fatalf("Unexpected output: %s", out)
+		}
+	}
+
+	testDir := setupFileSystem(t)
+
+	args := []string{
+		os.Args[0],
+		"-f",
+		"abc",
+		"-r",
+		"{{random.pick:draft|review|final}}",
+		"--seed",
+		"42",
+		testDir,
+	}
+
+	first, err := action(args)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	second, err := action(args)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !cmp.Equal(
+		first.changes,
+		second.changes,
+		cmpopts.IgnoreUnexported(Change{}),
+	) {
+		t.Fatalf(
+			"Expected the same seed to produce the same output. First: %+v, second: %+v",
+			prettyPrint(first.changes),
+			prettyPrint(second.changes),
 		)
+	}
+}
+
+func TestGetFocalLength35(t *testing.T) {
+	cases := []struct {
+		name     string
+		exifData *Exif
+		want     string
+	}{
+		{
+			name:     "Use the 35mm focal length tag if present",
+			exifData: &Exif{FocalLengthIn35mmFilm: []int{28}},
+			want:     "28",
+		},
+		{
+			name: "Derive the focal length from the sensor size",
+			exifData: &Exif{
+				FocalLength:           []string{"25/1"},
+				FocalPlaneXResolution: []string{"1000/3"},
+				FocalPlaneYResolution: []string{"1000/3"},
+				FocalPlaneUnit:        []int{4},
+				PixelXDimension:       []int{6000},
+				PixelYDimension:       []int{4000},
+			},
+			want: "50",
+		},
+		{
+			name: "Assume inches if the focal plane unit is missing",
+			exifData: &Exif{
+				FocalLength:           []string{"25/1"},
+				FocalPlaneXResolution: []string{"8466.67/1"},
+				FocalPlaneYResolution: []string{"8466.67/1"},
+				ImageWidth:            []int{6000},
+				ImageLength:           []int{4000},
+			},
+			want: "50",
+		},
+		{
+			name:     "Resolve to nothing without a focal plane resolution",
+			exifData: &Exif{FocalLength: []string{"25/1"}},
+			want:     "",
+		},
+	}
+
+	for _, v := range cases {
+		var got string
+		if fl, ok := getFocalLength35(v.exifData); ok {
+			got = strconv.FormatFloat(fl, 'f', 0, 64)
+		}
+
+		if got != v.want {
+			t.Fatalf("Test (%s) — Expected: %s, got: %s", v.name, v.want, got)
+		}
+	}
+
+	ev, err := getExifVar("{{exif.focallength35}}_{{x.focallength35.1mm}}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if ev.values[0].attr != "focallength35" || ev.values[0].decimals != 0 ||
+		ev.values[1].decimals != 1 || ev.values[1].unit != "mm" {
+		t.Fatalf("Unexpected focal length variables: %+v", ev.values)
+	}
+}
+
+func TestGetExifRawTag(t *testing.T) {
+	exifData := &Exif{
+		Raw: map[string]interface{}{
+			"Artist":        "Jane Doe\x00",
+			"XResolution":   []interface{}{"72/1"},
+			"ISOSpeed":      []interface{}{float64(100), float64(200)},
+			"FocalPlaneRes": float64(1.5),
+		},
+	}
+
+	cases := []struct {
+		tag  string
+		want string
+	}{
+		{tag: "Artist", want: "Jane Doe"},
+		{tag: "artist", want: "Jane Doe"},
+		{tag: "XResolution", want: "72_1"},
+		{tag: "ISOSpeed", want: "100 200"},
+		{tag: "FocalPlaneRes", want: "1.5"},
+		{tag: "Copyright", want: ""},
+	}
+
+	for _, v := range cases {
+		got := getExifRawTag(exifData, v.tag)
+		if got != v.want {
+			t.Fatalf("Test (%s) — Expected: %s, got: %s", v.tag, v.want, got)
+		}
+	}
+
+	ev, err := getExifVar("{{exif.raw:Artist.up.slug}}_{{x.software}}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if ev.values[0].attr != "raw" || ev.values[0].tag != "Artist" ||
+		!cmp.Equal(ev.values[0].transforms, []string{"up", "slug"}) {
+		t.Fatalf("Unexpected raw exif variable: %+v", ev.values[0])
+	}
+
+	if ev.values[1].attr != "software" {
+		t.Fatalf("Unexpected exif variable: %+v", ev.values[1])
+	}
+}
+
+func TestGetExifLabel(t *testing.T) {
+	cases := []struct {
+		name   string
+		value  []int
+		labels map[int]string
+		want   string
+	}{
+		{"exposure program", []int{3}, exposurePrograms, "Aperture priority"},
+		{"metering mode", []int{5}, meteringModes, "Pattern"},
+		{"white balance", []int{1}, whiteBalanceModes, "Manual"},
+		{"unknown code", []int{9}, exposurePrograms, "9"},
+		{"missing tag", nil, whiteBalanceModes, ""},
+	}
+
+	for _, v := range cases {
+		got := getExifLabel(v.value, v.labels)
+		if got != v.want {
+			t.Fatalf("Test (%s) — Expected: %s, got: %s", v.name, v.want, got)
+		}
+	}
+
+	ev, err := getExifVar("{{exif.wb.up}}_{{x.metering}}_{{x.iso}}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if ev.values[0].attr != "wb" ||
+		!cmp.Equal(ev.values[0].transforms, []string{"up"}) {
+		t.Fatalf("Unexpected exif label variable: %+v", ev.values[0])
+	}
+
+	if ev.values[1].attr != "metering" || ev.values[2].attr != "iso" {
+		t.Fatalf("Unexpected exif variables: %+v", ev.values[1:])
+	}
+}
+
+func TestGetExifDateOffset(t *testing.T) {
+	plusOne, _ := parseExifOffset("+01:00")
+
+	cases := []struct {
+		name   string
+		exif   Exif
+		offset *time.Location
+		want   string
+	}{
+		{
+			name:   "no conversion without an offset",
+			exif:   Exif{DateTimeOriginal: "2020:11:14 00:30:00", OffsetTimeOriginal: "+02:00"},
+			offset: nil,
+			want:   "2020-11-14 00:30",
+		},
+		{
+			name:   "default offset",
+			exif:   Exif{DateTimeOriginal: "2020:11:14 00:30:00"},
+			offset: plusOne,
+			want:   "2020-11-13 23:30",
+		},
+		{
+			name:   "OffsetTimeOriginal takes precedence",
+			exif:   Exif{DateTimeOriginal: "2020:11:14 00:30:00", OffsetTimeOriginal: "-05:30"},
+			offset: plusOne,
+			want:   "2020-11-14 06:00",
+		},
+		{
+			name:   "invalid OffsetTimeOriginal",
+			exif:   Exif{DateTimeOriginal: "2020:11:14 00:30:00", OffsetTimeOriginal: "   :  "},
+			offset: plusOne,
+			want:   "2020-11-13 23:30",
+		},
+	}
+
+	for _, v := range cases {
+		v := v
+
+		date := getExifDate(&v.exif, "YYYY", false, v.offset) + "-" +
+			getExifDate(&v.exif, "MM", false, v.offset) + "-" +
+			getExifDate(&v.exif, "DD", false, v.offset) + " " +
+			getExifDate(&v.exif, "H", false, v.offset) + ":" +
+			getExifDate(&v.exif, "mm", false, v.offset)
+		if date != v.want {
+			t.Fatalf("Test (%s) — Expected: %s, got: %s", v.name, v.want, date)
+		}
+	}
+
+	for _, v := range []string{"+0100", "-05:30", "Z", "+14:00"} {
+		if _, ok := parseExifOffset(v); !ok {
+			t.Fatalf("Expected %s to be a valid offset", v)
+		}
+	}
+
+	for _, v := range []string{"1:00", "+1:00", "+15:00", "+01:60", "UTC"} {
+		if _, ok := parseExifOffset(v); ok {
+			t.Fatalf("Expected %s to be an invalid offset", v)
+		}
+	}
 
-		c.want[0].Target = target
+	_, err := action([]string{os.Args[0], "-f", "a", "--exif-offset", "+1"})
+	if !errors.Is(err, errInvalidExifOffset) {
+		t.Fatalf("Expected an invalid exif offset error, got: %v", err)
+	}
+}
+
+func TestShortMake(t *testing.T) {
+	op := &Operation{
+		makeMap: map[string]string{"SONY": "Sony Alpha"},
 	}
 
-	runFindReplace(t, cases)
+	cases := []struct {
+		make string
+		want string
+	}{
+		{"NIKON CORPORATION", "Nikon"},
+		{"  Nikon   Corporation ", "Nikon"},
+		{"Canon\x00", "Canon"},
+		{"SONY", "Sony Alpha"},
+		{"ACME OPTICS", "Acme Optics"},
+		{"", ""},
+	}
+
+	for _, v := range cases {
+		got := op.shortMake(v.make)
+		if got != v.want {
+			t.Fatalf("Test (%q) — Expected: %s, got: %s", v.make, v.want, got)
+		}
+	}
+
+	ev, err := getExifVar("{{exif.make.short}}_{{x.make}}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if ev.values[0].attr != "make.short" || ev.values[1].attr != "make" {
+		t.Fatalf("Unexpected exif variables: %+v", ev.values)
+	}
 }
 
-func TestFileHash(t *testing.T) {
-	testDir := filepath.Join("..", "testdata", "images")
+func TestReplaceSiblingVariable(t *testing.T) {
+	testDir := t.TempDir()
+
+	files := []string{
+		"holiday.mkv",
+		"holiday.en.srt",
+		"trip.mkv",
+		"trip-subs.srt",
+		"notes.txt",
+	}
+
+	for _, v := range files {
+		err := os.WriteFile(filepath.Join(testDir, v), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
 
 	cases := []testCase{
 		{
-			name: "Replace md5 and sha1 hash",
+			name: "Name subtitles after the sibling with the matching extension",
 			want: []Change{
 				{
-					Source:  "bike.jpeg",
+					Source:  "holiday.en.srt",
 					BaseDir: testDir,
-					Target:  "6801e3de5f584028b8cd4292c6eca7ba_5b97fd595c700277315742bc91ac0ae67e5eb7a3",
+					Target:  "holiday.srt",
+				},
+				{
+					Source:  "trip-subs.srt",
+					BaseDir: testDir,
+					Target:  "trip.srt",
 				},
 			},
 			args: []string{
 				"-f",
-				"bike.jpeg",
+				".*\\.srt",
 				"-r",
-				"{{hash.md5}}_{{hash.sha1}}",
+				"{{sibling.name}}.srt",
+				"--sibling-ext",
+				".mkv",
 				testDir,
 			},
 		},
 		{
-			name: "Replace sha256 and sha512 hash",
+			name: "Resolve the sibling with a regex",
 			want: []Change{
 				{
-					Source:  "proraw.dng",
+					Source:  "notes.txt",
 					BaseDir: testDir,
-					Target:  "55195ff447785e9af9dea2b0e4f3dc1e991f19dc224413f7a3e5718efb980d99_d53831330e6a70899ad36cbde793284d2cd0332ef090cf20dae86299ec9b8f5b50e06becd8bfadb65fce001d3fedb811d02d751cd9a8279cbaf88b46d25b6408",
+					Target:  "trip.txt",
 				},
 			},
 			args: []string{
 				"-f",
-				"proraw.dng",
+				"notes",
 				"-r",
-				"{{hash.sha256}}_{{hash.sha512}}",
+				"{{sibling.name}}",
+				"--sibling-pattern",
+				"^trip\\.mkv$",
+				testDir,
+			},
+		},
+		{
+			name: "Resolve a missing sibling to an empty string",
+			want: []Change{
+				{
+					Source:  "notes.txt",
+					BaseDir: testDir,
+					Target:  "memo.txt",
+				},
+			},
+			args: []string{
+				"-f",
+				"notes",
+				"-r",
+				"{{sibling.name}}memo",
+				"--sibling-ext",
+				"mp4",
 				testDir,
 			},
 		},
 	}
 
 	runFindReplace(t, cases)
+
+	result, err := action([]string{
+		os.Args[0],
+		"-f",
+		"notes",
+		"-r",
+		"{{sibling.name}}memo",
+		"--sibling-ext",
+		"mp4",
+		"--sibling-missing",
+		"skip",
+		testDir,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(result.changes) != 1 {
+		t.Fatalf("Expected 1 change, got: %+v", prettyPrint(result.changes))
+	}
+
+	for _, ch := range result.changes {
+		if ch.Source != ch.Target {
+			t.Fatalf(
+				"Expected the file to be skipped when no sibling matches, got: %+v",
+				prettyPrint(result.changes),
+			)
+		}
+	}
 }
 
-func TestReplaceRandomVariable(t *testing.T) {
-	slice := []string{
-		`{{10r_l}}`,
-		`{{8r_d}}`,
-		`{{9r_l}}`,
-		`{{5r_ld}}`,
-		`{{15r<12345>}}`,
-		`{{r}}`,
+func TestArchiveCommonPrefix(t *testing.T) {
+	prefixes := []struct {
+		entries []string
+		want    string
+	}{
+		{[]string{"project-1.2/", "project-1.2/README", "project-1.2/src/a.go"}, "project-1.2"},
+		{[]string{"./bundle/a.txt", "__MACOSX/bundle/._a.txt"}, "bundle"},
+		{[]string{"holiday-001.jpg", "holiday-002.jpg", "holiday-010.jpg"}, "holiday"},
+		{[]string{"report.pdf"}, "report"},
+		{[]string{"a/x.txt", "b/y.txt"}, ""},
+		{[]string{"café.txt", "cafè.txt"}, "caf"},
+		{nil, ""},
 	}
 
-	for _, v := range slice {
-		submatches := randomRegex.FindAllStringSubmatch(v, -1)
-		strLen := submatches[0][1]
-		length := 10
+	for _, v := range prefixes {
+		if got := commonEntryPrefix(v.entries); got != v.want {
+			t.Fatalf("Test (%v) — Expected: %s, got: %s", v.entries, v.want, got)
+		}
+	}
 
-		var err error
+	testDir := t.TempDir()
 
-		if strLen != "" {
-			length, err = strconv.Atoi(strLen)
-			if err != nil {
-				t.Fatalf("Test (%s) — Unexpected error: %v", v, err)
-			}
+	zf, err := os.Create(filepath.Join(testDir, "download.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zw := zip.NewWriter(zf)
+	for _, name := range []string{"f2-v1.7.2/README.md", "f2-v1.7.2/LICENSE"} {
+		if _, err = zw.Create(name); err != nil {
+			t.Fatal(err)
 		}
+	}
 
-		rv, err := getRandomVar(v)
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zf.Close()
+
+	tf, err := os.Create(filepath.Join(testDir, "download.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gw := gzip.NewWriter(tf)
+	tw := tar.NewWriter(gw)
+
+	for _, name := range []string{"scan_01.png", "scan_02.png"} {
+		err = tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Typeflag: tar.TypeReg})
 		if err != nil {
-			t.Fatalf("Test (%s) — Unexpected error: %v", v, err)
+			t.Fatal(err)
 		}
+	}
 
-		str := replaceRandomVariables(v, rv)
-		if len(str) != length {
-			t.Fatalf(
-				"Test (%s) — Expected length of random string to be %d, got: %d",
-				v,
-				length,
-				len(str),
-			)
-		}
+	tw.Close()
+	gw.Close()
+	tf.Close()
+
+	err = os.WriteFile(filepath.Join(testDir, "notes.txt"), nil, 0o600)
+	if err != nil {
+		t.Fatal(err)
 	}
-}
 
-func TestIntegerToRoman(t *testing.T) {
-	testCases := []struct {
-		input  int
-		output string
-	}{
-		{463, "CDLXIII"},
-		{464, "CDLXIV"},
-		{1386, "MCCCLXXXVI"},
-		{1838, "MDCCCXXXVIII"},
-		{4000, "4000"},
-		{7070, "7070"},
+	cases := []testCase{
+		{
+			name: "Name archives after their entries",
+			want: []Change{
+				{Source: "download.tar.gz", BaseDir: testDir, Target: "scan.tar.gz"},
+				{Source: "download.zip", BaseDir: testDir, Target: "f2-v1.7.2.zip"},
+				{Source: "notes.txt", BaseDir: testDir, Target: ".txt"},
+			},
+			args: []string{
+				"-f", "^(download|notes)", "-r", "{{archive.commonprefix}}", testDir,
+			},
+		},
 	}
-	for _, v := range testCases {
-		str := integerToRoman(v.input)
-		if str != v.output {
-			t.Fatalf("Roman(%v) = %v, want %v.", v.input, str, v.output)
-		}
+
+	runFindReplace(t, cases)
+
+	err = os.WriteFile(filepath.Join(testDir, "broken.zip"), []byte("zip"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := action([]string{
+		os.Args[0], "-f", "broken", "-r", "{{archive.commonprefix}}", testDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var readErr *MetadataReadError
+	if !errors.As(result.applyError, &readErr) {
+		t.Fatalf("Expected a MetadataReadError, got: %v", result.applyError)
 	}
 }
 
-func TestReplaceTransformVariables(t *testing.T) {
-	testDir := setupFileSystem(t)
+func TestDateSource(t *testing.T) {
+	want := []string{"YYYY", "-", "MM", "-", "DD", "T", "H", "mm", "é", "Y"}
+	if got := splitDateFormat("YYYY-MM-DDTHmméY"); !cmp.Equal(got, want) {
+		t.Fatalf("Expected: %v, got: %v", want, got)
+	}
+
+	testDir := t.TempDir()
+
+	modTime := time.Date(2021, 6, 12, 15, 4, 5, 0, time.Local)
+
+	for _, name := range []string{"notes.txt", "song.mp3"} {
+		path := filepath.Join(testDir, name)
+
+		err := os.WriteFile(path, nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.Chtimes(path, modTime, modTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
 
 	cases := []testCase{
 		{
-			name: "transform file name to uppercase",
+			name: "Use the modification time",
 			want: []Change{
-				{
-					Source:  "abc.pdf",
-					Target:  "ABC.PDF",
-					BaseDir: testDir,
-				},
-				{
-					Source:  "abc.epub",
-					Target:  "ABC.EPUB",
-					BaseDir: testDir,
-				},
+				{Source: "notes.txt", BaseDir: testDir, Target: "2021-06-12_150405.txt"},
+			},
+			args: []string{
+				"-f", "notes", "-r", "{{date.mtime.YYYY-MM-DD_Hmmss}}", testDir,
 			},
-			args: []string{"-f", "abc.*", "-r", "{{tr.up}}", testDir},
 		},
 		{
-			name: "transform file extension to title case",
+			name: "Fall back to the next source without a date",
 			want: []Change{
-				{
-					Source:  "abc.pdf",
-					Target:  "abc.Pdf",
-					BaseDir: testDir,
-				},
-				{
-					Source:  "abc.epub",
-					Target:  "abc.Epub",
-					BaseDir: testDir,
-				},
+				{Source: "song.mp3", BaseDir: testDir, Target: "Jun 2021.mp3"},
+			},
+			args: []string{
+				"-f", "song", "-r", "{{date.exif:CreateDate|id3|mtime.MMM YYYY}}",
+				testDir,
 			},
-			args: []string{"-f", "pdf|epub", "-r", "{{tr.ti}}", testDir},
 		},
 		{
-			name: "transform file name to title case",
+			name: "Resolve to an empty string if no source has a date",
 			want: []Change{
-				{
-					Source:  "abc.pdf",
-					Target:  "abc_abc_ABC_abc_abc.pdf",
-					BaseDir: testDir,
-				},
-				{
-					Source:  "abc.epub",
-					Target:  "abc_abc_ABC_abc_abc.epub",
-					BaseDir: testDir,
-				},
+				{Source: "song.mp3", BaseDir: testDir, Target: "song-.mp3"},
+			},
+			args: []string{"-f", "song", "-r", "song-{{date.exif|id3.YYYY}}", testDir},
+		},
+		{
+			name: "Use the current time",
+			want: []Change{
+				{Source: "notes.txt", BaseDir: testDir, Target: "2000.txt"},
 			},
 			args: []string{
-				"-f",
-				"abc.*",
-				"-r",
-				"{{tr.di}}_{{tr.lw}}_{{tr.up}}_{{tr.win}}_{{tr.mac}}",
-				"-e",
-				testDir,
+				"-f", "notes", "-r", "{{date.now.YYYY}}", "--deterministic", testDir,
 			},
 		},
 	}
 
 	runFindReplace(t, cases)
+
+	_, err := extractVariables("{{date.exif|size.YYYY}}")
+
+	var unknownErr *UnknownVariableError
+	if !errors.As(err, &unknownErr) || !errors.Is(err, errInvalidDateSource) {
+		t.Fatalf("Expected an invalid date source error, got: %v", err)
+	}
 }
 
-func TestReplaceExifToolVariables(t *testing.T) {
-	_, err := exec.LookPath("exiftool")
+func TestDebugVariables(t *testing.T) {
+	testDir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(testDir, "my file.txt"), nil, 0o600)
 	if err != nil {
-		return
+		t.Fatal(err)
 	}
 
-	rootDir := filepath.Join("..", "testdata", "images")
-
-	cases := []testCase{
-		{
-			name: "Use exiftool data to rename DNG file",
-			want: []Change{
-				{
-					Source:  "proraw.dng",
-					BaseDir: rootDir,
-				},
-			},
-			args: []string{
-				"-f",
-				"proraw.dng",
-				"-r",
-				"{{xt.FOV}}_{{xt.ISO}}_{{xt.ImageWidth}}",
-				rootDir,
-			},
-		},
+	result, err := action([]string{
+		os.Args[0],
+		"-f", ".*",
+		"-r", "{{f.up}}_{{exif.iso}}{{bogus}}_{{f.up}}{{ext}}",
+		"--debug-variables",
+		testDir,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
 	}
 
-	for _, c := range cases {
-		f := filenameWithoutExtension(c.want[0].Source)
+	want := filepath.Join(testDir, "my file.txt") + "\n" +
+		"  {{f.up}} = \"MY FILE\"\n" +
+		"  {{exif.iso}} = \"\"\n" +
+		"  {{bogus}} = not a variable\n" +
+		"  {{ext}} = \".txt\"\n"
 
-		jsonFile, err := os.ReadFile(filepath.Join(rootDir, f+"_exiftool.json"))
-		if err != nil {
-			t.Fatalf("Unexpected error: %v", err)
-		}
+	if got := result.output.String(); !strings.HasPrefix(got, want) {
+		t.Fatalf("Expected output to start with:\n%s\ngot:\n%s", want, got)
+	}
+}
 
-		var m = make(map[string]interface{})
+func TestExifRating(t *testing.T) {
+	testDir := t.TempDir()
+
+	files := map[string]string{
+		// the sidecar takes precedence over the embedded rating
+		"a.jpg": `<x:xmpmeta><rdf:Description xmp:Rating="2"/></x:xmpmeta>`,
+		"a.xmp": `<x:xmpmeta><xmp:Rating>5</xmp:Rating></x:xmpmeta>`,
+		"b.jpg": `<x:xmpmeta><rdf:Description xmp:Rating="3"/></x:xmpmeta>`,
+		"c.jpg": "",
+		// rejected photos are unrated
+		"d.jpg":     `<x:xmpmeta><rdf:Description xmp:Rating="-1"/></x:xmpmeta>`,
+		"e.cr2":     "",
+		"e.cr2.xmp": `<x:xmpmeta><rdf:Description xmp:Rating = '4'/></x:xmpmeta>`,
+	}
 
-		err = json.Unmarshal(jsonFile, &m)
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(testDir, name), []byte(content), 0o600)
 		if err != nil {
-			t.Fatalf("Unexpected error: %v", err)
+			t.Fatal(err)
 		}
+	}
 
-		target := fmt.Sprintf(
-			"%v_%v_%v",
-			m["FOV"],
-			m["ISO"],
-			m["ImageWidth"],
-		)
-
-		c.want[0].Target = target
+	want := []Change{
+		{Source: "a.jpg", BaseDir: testDir, Target: "5-a.jpg"},
+		{Source: "b.jpg", BaseDir: testDir, Target: "3-b.jpg"},
+		{Source: "c.jpg", BaseDir: testDir, Target: "-c.jpg"},
+		{Source: "d.jpg", BaseDir: testDir, Target: "-d.jpg"},
+		{Source: "e.cr2", BaseDir: testDir, Target: "4-e.cr2"},
 	}
 
-	runFindReplace(t, cases)
+	zeroWant := append([]Change(nil), want...)
+	zeroWant[2].Target = "0-c.jpg"
+	zeroWant[3].Target = "0-d.jpg"
+
+	args := []string{"-f", `^.+\.(jpg|cr2)$`, "-r", "{{exif.rating}}-$0"}
+
+	runFindReplace(t, []testCase{
+		{
+			name: "Read the rating from the XMP sidecar or the file",
+			want: want,
+			args: append(append([]string{}, args...), testDir),
+		},
+		{
+			name: "Unrated photos resolve to zero",
+			want: zeroWant,
+			args: append(append([]string{}, args...), "--unrated-zero", testDir),
+		},
+	})
 }
@@ -0,0 +1,371 @@
+package f2
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Video represents the metadata of an MP4 or QuickTime video file.
+type Video struct {
+	Make         string
+	Model        string
+	CreationDate time.Time
+	Duration     float64 // in seconds
+	Width        int
+	Height       int
+}
+
+// maxMoovSize is the largest `moov` atom that will be read into memory.
+const maxMoovSize = 64 << 20
+
+const defaultVideoDateFormat = "2006-01-02"
+
+var errInvalidAtom = errors.New("Invalid atom")
+
+// mp4Epoch is the reference time for the timestamps in MP4 files.
+var mp4Epoch = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// topLevelAtoms are the atom types that may appear at the start
+// of an MP4 or QuickTime file.
+var topLevelAtoms = map[string]bool{
+	"ftyp": true,
+	"moov": true,
+	"mdat": true,
+	"free": true,
+	"skip": true,
+	"wide": true,
+	"pnot": true,
+}
+
+type atom struct {
+	typ  string
+	data []byte
+}
+
+// parseAtoms splits the contents of a container atom into its children.
+func parseAtoms(b []byte) []atom {
+	var atoms []atom
+
+	for len(b) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(b[0:4]))
+		typ := string(b[4:8])
+		headerSize := uint64(8)
+
+		switch size {
+		case 0:
+			size = uint64(len(b))
+		case 1:
+			if len(b) < 16 {
+				return atoms
+			}
+
+			size = binary.BigEndian.Uint64(b[8:16])
+			headerSize = 16
+		}
+
+		if size < headerSize || size > uint64(len(b)) {
+			return atoms
+		}
+
+		atoms = append(atoms, atom{typ: typ, data: b[headerSize:size]})
+		b = b[size:]
+	}
+
+	return atoms
+}
+
+// readMoovAtom scans the top-level atoms in the file and returns
+// the contents of the `moov` atom. Other atoms (such as `mdat`) are
+// skipped without being read.
+func readMoovAtom(r io.ReadSeeker) ([]byte, error) {
+	header := make([]byte, 8)
+
+	for i := 0; ; i++ {
+		_, err := io.ReadFull(r, header)
+		if err != nil {
+			return nil, err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		typ := string(header[4:8])
+		headerSize := int64(8)
+
+		if i == 0 && !topLevelAtoms[typ] {
+			return nil, errInvalidAtom
+		}
+
+		switch size {
+		case 0:
+			// the atom extends to the end of the file
+			if typ != "moov" {
+				return nil, io.EOF
+			}
+
+			return io.ReadAll(io.LimitReader(r, maxMoovSize))
+		case 1:
+			largeSize := make([]byte, 8)
+
+			_, err = io.ReadFull(r, largeSize)
+			if err != nil {
+				return nil, err
+			}
+
+			size = int64(binary.BigEndian.Uint64(largeSize))
+			headerSize = 16
+		}
+
+		if size < headerSize {
+			return nil, errInvalidAtom
+		}
+
+		if typ == "moov" {
+			if size-headerSize > maxMoovSize {
+				return nil, errInvalidAtom
+			}
+
+			b := make([]byte, size-headerSize)
+
+			_, err = io.ReadFull(r, b)
+
+			return b, err
+		}
+
+		_, err = r.Seek(size-headerSize, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseMvhd retrieves the creation date and duration from
+// the movie header atom.
+func parseMvhd(b []byte, v *Video) {
+	if len(b) < 20 {
+		return
+	}
+
+	var creation, timescale, duration uint64
+
+	if b[0] == 1 {
+		if len(b) < 32 {
+			return
+		}
+
+		creation = binary.BigEndian.Uint64(b[4:12])
+		timescale = uint64(binary.BigEndian.Uint32(b[20:24]))
+		duration = binary.BigEndian.Uint64(b[24:32])
+	} else {
+		creation = uint64(binary.BigEndian.Uint32(b[4:8]))
+		timescale = uint64(binary.BigEndian.Uint32(b[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(b[16:20]))
+	}
+
+	if creation != 0 && v.CreationDate.IsZero() {
+		v.CreationDate = mp4Epoch.Add(time.Duration(creation) * time.Second)
+	}
+
+	if timescale != 0 {
+		v.Duration = float64(duration) / float64(timescale)
+	}
+}
+
+// parseTrak retrieves the dimensions of a video track from its
+// track header atom. The width and height are stored as 16.16 fixed
+// point numbers at the end of the atom.
+func parseTrak(b []byte, v *Video) {
+	for _, a := range parseAtoms(b) {
+		if a.typ != "tkhd" || len(a.data) < 8 {
+			continue
+		}
+
+		width := int(binary.BigEndian.Uint32(a.data[len(a.data)-8:]) >> 16)
+		height := int(binary.BigEndian.Uint32(a.data[len(a.data)-4:]) >> 16)
+
+		// audio tracks have zero dimensions
+		if width != 0 && v.Width == 0 {
+			v.Width = width
+			v.Height = height
+		}
+	}
+}
+
+// parseUdta retrieves the QuickTime user data text entries.
+// Each entry begins with a 16-bit length and a 16-bit language code.
+func parseUdta(b []byte, v *Video) {
+	for _, a := range parseAtoms(b) {
+		if len(a.data) < 4 {
+			continue
+		}
+
+		n := int(binary.BigEndian.Uint16(a.data[0:2]))
+		if n > len(a.data)-4 {
+			continue
+		}
+
+		value := strings.TrimSpace(string(a.data[4 : 4+n]))
+
+		switch a.typ {
+		case "\xa9mak":
+			v.Make = value
+		case "\xa9mod":
+			v.Model = value
+		}
+	}
+}
+
+// parseMeta retrieves the QuickTime metadata entries which are stored
+// as a list of keys and a corresponding list of values.
+func parseMeta(b []byte, v *Video) {
+	// ISO meta atoms include a version and flags before the children
+	if len(b) >= 8 && string(b[4:8]) != "hdlr" {
+		b = b[4:]
+	}
+
+	var keys []string
+
+	var items []atom
+
+	for _, a := range parseAtoms(b) {
+		switch a.typ {
+		case "keys":
+			if len(a.data) < 8 {
+				continue
+			}
+
+			for _, k := range parseAtoms(a.data[8:]) {
+				keys = append(keys, string(k.data))
+			}
+		case "ilst":
+			items = parseAtoms(a.data)
+		}
+	}
+
+	for _, item := range items {
+		index := int(binary.BigEndian.Uint32([]byte(item.typ)))
+		if index < 1 || index > len(keys) {
+			continue
+		}
+
+		for _, d := range parseAtoms(item.data) {
+			if d.typ != "data" || len(d.data) < 8 {
+				continue
+			}
+
+			value := strings.TrimSpace(string(d.data[8:]))
+
+			switch keys[index-1] {
+			case "com.apple.quicktime.make":
+				v.Make = value
+			case "com.apple.quicktime.model":
+				v.Model = value
+			case "com.apple.quicktime.creationdate":
+				t, err := time.Parse("2006-01-02T15:04:05-0700", value)
+				if err == nil {
+					v.CreationDate = t
+				}
+			}
+		}
+	}
+}
+
+// getVideoData retrieves the metadata of an MP4 or QuickTime file.
+// Errors in parsing the file are ignored intentionally since the
+// corresponding video variable will be replaced by an empty string.
+func getVideoData(sourcePath string) (*Video, error) {
+	f, err := os.Open(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	v := &Video{}
+
+	moov, err := readMoovAtom(f)
+	if err != nil {
+		return v, nil
+	}
+
+	children := parseAtoms(moov)
+
+	// The metadata entries take precedence over the movie header
+	// since the creation date includes the timezone offset
+	for _, a := range children {
+		if a.typ == "meta" {
+			parseMeta(a.data, v)
+		}
+	}
+
+	for _, a := range children {
+		switch a.typ {
+		case "mvhd":
+			parseMvhd(a.data, v)
+		case "trak":
+			parseTrak(a.data, v)
+		case "udta":
+			if v.Make == "" && v.Model == "" {
+				parseUdta(a.data, v)
+			}
+		}
+	}
+
+	return v, nil
+}
+
+// replaceVideoVariables replaces the video variables in an input string
+// with the corresponding metadata of the source file.
+func replaceVideoVariables(
+	input, sourcePath string,
+	vv videoVar,
+) (string, error) {
+	videoData, err := getVideoData(sourcePath)
+	if err != nil {
+		return input, err
+	}
+
+	for _, current := range vv.values {
+		var value string
+
+		switch current.attr {
+		case "creationdate":
+			if !videoData.CreationDate.IsZero() {
+				format := defaultVideoDateFormat
+				if current.timeStr != "" {
+					format = dateTokens[current.timeStr]
+				}
+
+				value = videoData.CreationDate.Format(format)
+			}
+		case "make":
+			value = strings.ReplaceAll(videoData.Make, "/", "_")
+		case "model":
+			value = strings.ReplaceAll(videoData.Model, "/", "_")
+		case "duration":
+			if videoData.Duration > 0 {
+				value = strconv.Itoa(int(videoData.Duration + 0.5))
+			}
+		case "w":
+			if videoData.Width > 0 {
+				value = strconv.Itoa(videoData.Width)
+			}
+		case "h":
+			if videoData.Height > 0 {
+				value = strconv.Itoa(videoData.Height)
+			}
+		case "wh":
+			if videoData.Width > 0 {
+				value = strconv.Itoa(videoData.Width) + "x" +
+					strconv.Itoa(videoData.Height)
+			}
+		}
+
+		input = current.regex.ReplaceAllLiteralString(input, value)
+	}
+
+	return input, nil
+}